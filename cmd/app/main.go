@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
@@ -16,14 +17,15 @@ import (
 	"remnawave-tg-shop-bot/internal/handler"
 	"remnawave-tg-shop-bot/internal/moynalog"
 	"remnawave-tg-shop-bot/internal/notification"
+	"remnawave-tg-shop-bot/internal/outbox"
 	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/internal/platega"
 	"remnawave-tg-shop-bot/internal/remnawave"
 	"remnawave-tg-shop-bot/internal/sync"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/tribute"
+	"remnawave-tg-shop-bot/internal/webhook"
 	"remnawave-tg-shop-bot/internal/yookasa"
-	"strconv"
 	"strings"
 	"time"
 
@@ -73,10 +75,31 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	cache := cache.NewCache(30 * time.Minute)
+	// The "Pay" message ids are kept until the purchase is paid or expired. Twice the
+	// longest invoice TTL leaves room for invoices the provider closes late.
+	cache := cache.NewCache(max(30*time.Minute, 2*config.LongestInvoiceTTL()))
 	customerRepository := database.NewCustomerRepository(pool)
 	purchaseRepository := database.NewPurchaseRepository(pool)
 	referralRepository := database.NewReferralRepository(pool)
+	outboxRepository := database.NewOutboxRepository(pool)
+	promoRepository := database.NewPromoRepository(pool)
+	giftRepository := database.NewGiftRepository(pool)
+	balanceRepository := database.NewBalanceRepository(pool)
+	planRepository := database.NewPlanRepository(pool)
+	trafficPackRepository := database.NewTrafficPackRepository(pool)
+	starsSubscriptionRepository := database.NewStarsSubscriptionRepository(pool)
+	receiptRepository := database.NewReceiptRepository(pool)
+	linkResetRepository := database.NewLinkResetRepository(pool)
+	panelGrantRepository := database.NewPanelGrantRepository(pool)
+	panelRevokeRepository := database.NewPanelRevokeRepository(pool)
+	webhookRecorder := webhook.NewRecorder(database.NewWebhookEventRepository(pool), int64(config.WebhookMaxBodyBytes()))
+	if seeded, err := planRepository.SeedIfEmpty(ctx, payment.DefaultPlans(func(months int) string {
+		return tm.GetButton(config.DefaultLanguage(), fmt.Sprintf("month_%d", months)).Text
+	})); err != nil {
+		panic(err)
+	} else if seeded {
+		slog.Info("Plan catalog seeded from PRICE_* settings")
+	}
 
 	cryptoPayClient := cryptopay.NewCryptoPayClient(config.CryptoPayUrl(), config.CryptoPayToken())
 	remnawaveClient := remnawave.NewClient(config.RemnawaveUrl(), config.RemnawaveToken(), config.RemnawaveMode())
@@ -99,15 +122,69 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	remnawaveClient.OnOutage(func(since time.Time, recovered bool) {
+		text := fmt.Sprintf("Remnawave panel is unreachable since %s UTC. Purchases and trials fail until it is back.", since.UTC().Format("02.01.2006 15:04"))
+		if recovered {
+			text = fmt.Sprintf("Remnawave panel is reachable again after an outage since %s UTC.", since.UTC().Format("02.01.2006 15:04"))
+		}
+		if _, err := b.SendMessage(context.Background(), &bot.SendMessageParams{ChatID: config.GetAdminTelegramId(), Text: text}); err != nil {
+			slog.Error("notify admin about remnawave outage", "error", err)
+		}
+	})
+	go remnawaveClient.WatchOutage(ctx, time.Minute)
 
-	paymentService := payment.NewPaymentService(tm, purchaseRepository, remnawaveClient, customerRepository, b, cryptoPayClient, yookasaClient, plategaClient, referralRepository, cache, moynalogClient)
+	paymentProviders := payment.NewRegistry(
+		payment.NewBalanceProvider(balanceRepository),
+		cryptopay.NewProvider(cryptoPayClient, purchaseRepository),
+		yookasa.NewProvider(yookasaClient, purchaseRepository),
+	)
+	for _, p := range platega.NewProviders(plategaClient, purchaseRepository) {
+		paymentProviders.Register(p)
+	}
+	paymentProviders.Register(payment.NewTelegramProvider(b, tm, customerRepository, starsSubscriptionRepository))
+	paymentProviders.Register(tribute.NewProvider(customerRepository))
 
-	cronScheduler := setupInvoiceChecker(purchaseRepository, cryptoPayClient, paymentService)
+	paymentService := payment.NewPaymentService(tm, purchaseRepository, remnawaveClient, customerRepository, b, paymentProviders, referralRepository, outboxRepository, promoRepository, giftRepository, balanceRepository, planRepository, trafficPackRepository, starsSubscriptionRepository, receiptRepository, linkResetRepository, panelGrantRepository, panelRevokeRepository, cache, moynalogClient)
+
+	cronScheduler := setupInvoiceChecker(paymentProviders, paymentService)
 	if cronScheduler != nil {
 		cronScheduler.Start()
 		defer cronScheduler.Stop()
 	}
 
+	reconcileCronScheduler := setupReconciliation(paymentProviders, paymentService)
+	if reconcileCronScheduler != nil {
+		reconcileCronScheduler.Start()
+		defer reconcileCronScheduler.Stop()
+	}
+
+	if moynalogClient != nil {
+		receiptCronScheduler := setupReceiptReconciliation(paymentService)
+		receiptCronScheduler.Start()
+		defer receiptCronScheduler.Stop()
+	}
+
+	expiryCronScheduler := setupPurchaseExpiry(paymentService)
+	expiryCronScheduler.Start()
+	defer expiryCronScheduler.Stop()
+
+	trafficPackCronScheduler := setupTrafficPackExpiry(paymentService)
+	trafficPackCronScheduler.Start()
+	defer trafficPackCronScheduler.Stop()
+
+	outboxWorker := outbox.NewWorker(outboxRepository, paymentService.JobHandlers(), func(ctx context.Context, job database.OutboxJob) {
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: config.GetAdminTelegramId(),
+			Text:   fmt.Sprintf("Job #%d (%s) failed after %d attempts. See /jobs", job.ID, job.Kind, job.Attempts),
+		})
+		if err != nil {
+			slog.Error("notify admin about failed job", "error", err, "job_id", job.ID)
+		}
+	})
+	outboxCronScheduler := setupOutboxWorker(outboxWorker)
+	outboxCronScheduler.Start()
+	defer outboxCronScheduler.Stop()
+
 	subService := notification.NewSubscriptionService(customerRepository, purchaseRepository, paymentService, b, tm)
 
 	subscriptionNotificationCronScheduler := subscriptionChecker(subService)
@@ -116,7 +193,7 @@ func main() {
 
 	syncService := sync.NewSyncService(remnawaveClient, customerRepository)
 
-	h := handler.NewHandler(syncService, paymentService, tm, customerRepository, purchaseRepository, cryptoPayClient, yookasaClient, referralRepository, cache)
+	h := handler.NewHandler(syncService, paymentService, tm, customerRepository, purchaseRepository, cryptoPayClient, yookasaClient, referralRepository, outboxRepository, promoRepository, cache, webhookRecorder, remnawaveClient)
 
 	me, err := b.GetMe(ctx)
 	if err != nil {
@@ -152,6 +229,18 @@ func main() {
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypePrefix, h.StartCommandHandler, h.SuspiciousUserFilterMiddleware)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/connect", bot.MatchTypeExact, h.ConnectCommandHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/sync", bot.MatchTypeExact, h.SyncUsersCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/jobs", bot.MatchTypeExact, h.JobsCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/retry", bot.MatchTypePrefix, h.RetryJobCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/refund", bot.MatchTypePrefix, h.RefundCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/approve", bot.MatchTypePrefix, h.ApproveCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/reject", bot.MatchTypePrefix, h.RejectCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/webhooks", bot.MatchTypeExact, h.WebhooksCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/replay_webhook", bot.MatchTypePrefix, h.ReplayWebhookCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/panel_cache", bot.MatchTypePrefix, h.PanelCacheCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/receipts", bot.MatchTypeExact, h.ReceiptsCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/resend_receipt", bot.MatchTypePrefix, h.ResendReceiptCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/promo", bot.MatchTypePrefix, h.PromoCommandHandler, isAdminMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/balance", bot.MatchTypePrefix, h.BalanceCommandHandler, isAdminMiddleware)
 
 	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferral, bot.MatchTypeExact, h.ReferralCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBuy, bot.MatchTypeExact, h.BuyCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
@@ -160,7 +249,20 @@ func main() {
 	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStart, bot.MatchTypeExact, h.StartCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackSell, bot.MatchTypePrefix, h.SellCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackConnect, bot.MatchTypeExact, h.ConnectCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackGift, bot.MatchTypeExact, h.GiftCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackPromo, bot.MatchTypeExact, h.PromoCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackPayment, bot.MatchTypePrefix, h.PaymentCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTopUp, bot.MatchTypeExact, h.TopUpCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTopUpSell, bot.MatchTypePrefix, h.TopUpSellCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTopUpPay, bot.MatchTypePrefix, h.TopUpPaymentCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTraffic, bot.MatchTypeExact, h.TrafficCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrafficSell, bot.MatchTypePrefix, h.TrafficSellCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrafficPay, bot.MatchTypePrefix, h.TrafficPaymentCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackLinkReset, bot.MatchTypeExact, h.LinkResetCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackLinkResetConfirm, bot.MatchTypeExact, h.LinkResetConfirmCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAutoRenew, bot.MatchTypeExact, h.AutoRenewCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStarsSubscription, bot.MatchTypeExact, h.StarsSubscriptionCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStarsSubscriptionToggle, bot.MatchTypeExact, h.StarsSubscriptionToggleCallbackHandler, h.AnswerCallbackQueryMiddleware, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
 		return update.PreCheckoutQuery != nil
 	}, h.PreCheckoutCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
@@ -169,19 +271,35 @@ func main() {
 		return update.Message != nil && update.Message.SuccessfulPayment != nil
 	}, h.SuccessPaymentHandler, h.SuspiciousUserFilterMiddleware)
 
+	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
+		return update.Message != nil && update.Message.From != nil && update.Message.Text != "" &&
+			!strings.HasPrefix(update.Message.Text, "/") && h.AwaitingPromoCode(update.Message.From.ID)
+	}, h.PromoCodeMessageHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+
 	mux := http.NewServeMux()
 	mux.Handle("/healthcheck", fullHealthHandler(pool, remnawaveClient))
-	if config.GetTributeWebHookUrl() != "" {
-		tributeHandler := tribute.NewClient(paymentService, customerRepository)
-		mux.Handle(config.GetTributeWebHookUrl(), tributeHandler.WebHookHandler())
+	webhookGuard := webhook.NewGuard(config.WebhookTrustedProxies(), int64(config.WebhookMaxBodyBytes()))
+	for path, provider := range paymentProviders.Webhooks() {
+		policy := webhook.Policy{
+			AllowedIPs: config.WebhookAllowedIPs(provider.WebhookName()),
+			EventID:    provider.WebhookEventID,
+		}
+		recorded := webhookRecorder.Handle(provider.WebhookName(), provider.WebhookHandler(paymentService))
+		mux.Handle(path, webhookGuard.Handle(provider.WebhookName(), policy, recorded))
+		slog.Info("Payment webhook registered", "invoice_type", provider.InvoiceType())
 	}
-	if config.IsYookasaEnabled() && config.GetYookasaWebHookUrl() != "" {
-		yookasaWebhook := yookasa.NewWebhookHandler(yookasaClient, paymentService, purchaseRepository)
-		mux.Handle(config.GetYookasaWebHookUrl(), yookasaWebhook)
+	if config.RemnawaveWebhookUrl() != "" {
+		policy := webhook.Policy{
+			AllowedIPs: config.WebhookAllowedIPs("remnawave"),
+			EventID:    remnawave.WebhookEventID,
+		}
+		panelEvents := notification.NewPanelEventService(customerRepository, remnawaveClient, b, tm)
+		recorded := webhookRecorder.Handle("remnawave", remnawaveClient.WebhookHandler(config.RemnawaveWebhookSecret(), panelEvents))
+		mux.Handle(config.RemnawaveWebhookUrl(), webhookGuard.Handle("remnawave", policy, recorded))
+		slog.Info("Remnawave webhook registered")
 	}
-	if config.IsPlategaEnabled() && config.GetPlategaWebHookUrl() != "" {
-		plategaWebhook := platega.NewWebhookHandler(purchaseRepository, paymentService, config.PlategaMerchantId(), config.PlategaSecret())
-		mux.Handle(config.GetPlategaWebHookUrl(), plategaWebhook)
+	if config.AdminAPIToken() != "" {
+		webhookRecorder.RegisterAPI(mux, config.AdminAPIToken())
 	}
 
 	srv := &http.Server{
@@ -238,9 +356,16 @@ func fullHealthHandler(pool *pgxpool.Pool, rw *remnawave.Client) http.Handler {
 			w.WriteHeader(http.StatusOK)
 		}
 
+		cacheStats, _ := json.Marshal(rw.CacheStats())
+		breaker := rw.BreakerStatus()
+		downSince := ""
+		if breaker.DownSince != nil {
+			downSince = breaker.DownSince.Format(time.RFC3339)
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, `{"status":"%s","db":"%s","remnawave":"%s","time":"%s","version":"%s","commit":"%s","buildDate":"%s"}`,
-			status["status"], status["db"], status["rw"], status["time"], Version, Commit, BuildDate)
+		fmt.Fprintf(w, `{"status":"%s","db":"%s","remnawave":"%s","remnawaveBreaker":"%s","remnawaveDownSince":"%s","remnawaveCache":%s,"time":"%s","version":"%s","commit":"%s","buildDate":"%s"}`,
+			status["status"], status["db"], status["rw"], breaker.State, downSince, cacheStats, status["time"], Version, Commit, BuildDate)
 	})
 }
 
@@ -283,17 +408,16 @@ func initDatabase(ctx context.Context, connString string) (*pgxpool.Pool, error)
 }
 
 func setupInvoiceChecker(
-	purchaseRepository *database.PurchaseRepository,
-	cryptoPayClient *cryptopay.Client,
+	providers *payment.Registry,
 	paymentService *payment.PaymentService) *cron.Cron {
-	if !config.IsCryptoPayEnabled() {
+	pollers := providers.Pollers()
+	if len(pollers) == 0 {
 		return nil
 	}
-	c := cron.New(cron.WithSeconds())
+	c := cron.New(cron.WithSeconds(), cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
 
-	_, err := c.AddFunc("*/5 * * * * *", func() {
-		ctx := context.Background()
-		checkCryptoPayInvoice(ctx, purchaseRepository, cryptoPayClient, paymentService)
+	_, err := c.AddFunc(pollSchedule(pollers), func() {
+		paymentService.PollPendingInvoices(context.Background())
 	})
 
 	if err != nil {
@@ -303,58 +427,89 @@ func setupInvoiceChecker(
 	return c
 }
 
-func checkCryptoPayInvoice(
-	ctx context.Context,
-	purchaseRepository *database.PurchaseRepository,
-	cryptoPayClient *cryptopay.Client,
-	paymentService *payment.PaymentService,
-) {
-	pendingPurchases, err := purchaseRepository.FindByInvoiceTypeAndStatus(
-		ctx,
-		database.InvoiceTypeCrypto,
-		database.PurchaseStatusPending,
-	)
+func setupReconciliation(
+	providers *payment.Registry,
+	paymentService *payment.PaymentService) *cron.Cron {
+	if len(providers.Reconcilable()) == 0 && !config.IsTelegramStarsEnabled() {
+		return nil
+	}
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+
+	_, err := c.AddFunc("*/5 * * * *", func() {
+		paymentService.ReconcilePendingPurchases(context.Background())
+	})
+
 	if err != nil {
-		log.Printf("Error finding pending purchases: %v", err)
-		return
+		panic(err)
 	}
-	if len(*pendingPurchases) == 0 {
-		return
+
+	return c
+}
+
+func setupReceiptReconciliation(paymentService *payment.PaymentService) *cron.Cron {
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+
+	_, err := c.AddFunc("0 3 * * *", func() {
+		paymentService.ReconcileReceipts(context.Background())
+	})
+
+	if err != nil {
+		panic(err)
 	}
 
-	var invoiceIDs []string
+	return c
+}
 
-	for _, purchase := range *pendingPurchases {
-		if purchase.CryptoInvoiceID != nil {
-			invoiceIDs = append(invoiceIDs, fmt.Sprintf("%d", *purchase.CryptoInvoiceID))
-		}
+func setupPurchaseExpiry(paymentService *payment.PaymentService) *cron.Cron {
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+
+	_, err := c.AddFunc("* * * * *", func() {
+		paymentService.ExpireStalePurchases(context.Background())
+	})
+
+	if err != nil {
+		panic(err)
 	}
 
-	if len(invoiceIDs) == 0 {
-		return
+	return c
+}
+
+func setupTrafficPackExpiry(paymentService *payment.PaymentService) *cron.Cron {
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+
+	_, err := c.AddFunc("*/5 * * * *", func() {
+		paymentService.ExpireTrafficPacks(context.Background())
+	})
+
+	if err != nil {
+		panic(err)
 	}
 
-	stringInvoiceIDs := strings.Join(invoiceIDs, ",")
-	invoices, err := cryptoPayClient.GetInvoices("", "", "", stringInvoiceIDs, 0, 0)
+	return c
+}
+
+func setupOutboxWorker(worker *outbox.Worker) *cron.Cron {
+	c := cron.New(cron.WithSeconds(), cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+
+	_, err := c.AddFunc("*/5 * * * * *", func() {
+		worker.Run(context.Background())
+	})
+
 	if err != nil {
-		log.Printf("Error getting invoices: %v", err)
-		return
+		panic(err)
 	}
 
-	for _, invoice := range *invoices {
-		if invoice.InvoiceID != nil && invoice.IsPaid() {
-			payload := strings.Split(invoice.Payload, "&")
-			purchaseID, err := strconv.Atoi(strings.Split(payload[0], "=")[1])
-			username := strings.Split(payload[1], "=")[1]
-			ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, username)
-			err = paymentService.ProcessPurchaseById(ctxWithUsername, int64(purchaseID))
-			if err != nil {
-				slog.Error("Error processing invoice", "invoiceId", invoice.InvoiceID, "error", err)
-			} else {
-				slog.Info("Invoice processed", "invoiceId", invoice.InvoiceID, "purchaseId", purchaseID)
-			}
+	return c
+}
 
+// pollSchedule polls every 5 seconds unless every poller also receives webhooks,
+// in which case polling is only a fallback for lost updates.
+func pollSchedule(pollers []payment.Poller) string {
+	for _, p := range pollers {
+		wp, ok := p.(payment.WebhookProvider)
+		if !ok || wp.WebhookPath() == "" {
+			return "*/5 * * * * *"
 		}
 	}
-
+	return "0 */2 * * * *"
 }
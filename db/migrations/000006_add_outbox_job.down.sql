@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_outbox_job_status_run_at;
+DROP TABLE IF EXISTS outbox_job;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS outbox_job
+(
+    id           BIGSERIAL PRIMARY KEY,
+    kind         VARCHAR(50) NOT NULL,
+    payload      JSONB       NOT NULL DEFAULT '{}',
+    status       VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    max_attempts INTEGER     NOT NULL DEFAULT 8,
+    run_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_error   TEXT,
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_job_status_run_at ON outbox_job (status, run_at);
@@ -0,0 +1,2 @@
+ALTER TABLE purchase DROP COLUMN IF EXISTS moynalog_receipt_uuid;
+ALTER TABLE purchase DROP COLUMN IF EXISTS telegram_charge_id;
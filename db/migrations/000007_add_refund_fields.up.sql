@@ -0,0 +1,2 @@
+ALTER TABLE purchase ADD COLUMN telegram_charge_id TEXT;
+ALTER TABLE purchase ADD COLUMN moynalog_receipt_uuid TEXT;
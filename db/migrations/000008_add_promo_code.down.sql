@@ -0,0 +1,6 @@
+ALTER TABLE purchase DROP COLUMN IF EXISTS bonus_days;
+ALTER TABLE purchase DROP COLUMN IF EXISTS discount_amount;
+ALTER TABLE purchase DROP COLUMN IF EXISTS promo_code_id;
+
+DROP TABLE IF EXISTS promo_activation;
+DROP TABLE IF EXISTS promo_code;
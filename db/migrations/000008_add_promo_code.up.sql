@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS promo_code
+(
+    id             BIGSERIAL PRIMARY KEY,
+    code           VARCHAR(32) NOT NULL UNIQUE,
+    type           VARCHAR(20) NOT NULL,
+    value          INTEGER     NOT NULL,
+    max_uses       INTEGER,
+    per_user_limit INTEGER     NOT NULL DEFAULT 1,
+    used_count     INTEGER     NOT NULL DEFAULT 0,
+    months         INTEGER,
+    valid_from     TIMESTAMP WITH TIME ZONE,
+    valid_until    TIMESTAMP WITH TIME ZONE,
+    created_at     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS promo_activation
+(
+    id            BIGSERIAL PRIMARY KEY,
+    promo_code_id BIGINT NOT NULL REFERENCES promo_code (id) ON DELETE CASCADE,
+    customer_id   BIGINT NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    purchase_id   BIGINT REFERENCES purchase (id) ON DELETE SET NULL,
+    activated_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    redeemed_at   TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_promo_activation_customer ON promo_activation (customer_id, promo_code_id);
+
+ALTER TABLE purchase ADD COLUMN promo_code_id BIGINT REFERENCES promo_code (id) ON DELETE SET NULL;
+ALTER TABLE purchase ADD COLUMN discount_amount DECIMAL(20, 8) NOT NULL DEFAULT 0;
+ALTER TABLE purchase ADD COLUMN bonus_days INTEGER NOT NULL DEFAULT 0;
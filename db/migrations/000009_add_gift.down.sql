@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS gift;
+
+ALTER TABLE purchase DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,14 @@
+ALTER TABLE purchase ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'subscription';
+
+CREATE TABLE IF NOT EXISTS gift
+(
+    id          BIGSERIAL PRIMARY KEY,
+    code        VARCHAR(32) NOT NULL UNIQUE,
+    purchase_id BIGINT      NOT NULL UNIQUE REFERENCES purchase (id) ON DELETE CASCADE,
+    customer_id BIGINT      NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    days        INTEGER     NOT NULL,
+    redeemed_by BIGINT REFERENCES customer (id) ON DELETE SET NULL,
+    redeemed_at TIMESTAMP WITH TIME ZONE,
+    revoked_at  TIMESTAMP WITH TIME ZONE,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS balance_transaction
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT         NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    amount      DECIMAL(20, 8) NOT NULL,
+    reason      VARCHAR(30)    NOT NULL,
+    purchase_id BIGINT REFERENCES purchase (id) ON DELETE SET NULL,
+    comment     TEXT,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_balance_transaction_customer ON balance_transaction (customer_id, created_at);
+
+-- A purchase moves money for a given reason at most once, so retried payments,
+-- refunds and referral jobs cannot credit or debit twice.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_balance_transaction_purchase_reason
+    ON balance_transaction (customer_id, reason, purchase_id)
+    WHERE purchase_id IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE purchase DROP COLUMN IF EXISTS duration_days;
+ALTER TABLE purchase DROP COLUMN IF EXISTS plan_id;
+
+DROP TABLE IF EXISTS plan;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS plan
+(
+    id               BIGSERIAL PRIMARY KEY,
+    name             VARCHAR(64) NOT NULL,
+    days             INTEGER     NOT NULL CHECK (days > 0),
+    price_rub        INTEGER,
+    price_stars      INTEGER,
+    price_crypto     INTEGER,
+    traffic_limit_gb INTEGER,
+    reset_strategy   VARCHAR(20),
+    internal_squads  TEXT[],
+    external_squad   UUID,
+    visible          BOOLEAN     NOT NULL DEFAULT TRUE,
+    sort_order       INTEGER     NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE purchase ADD COLUMN plan_id BIGINT REFERENCES plan (id) ON DELETE SET NULL;
+ALTER TABLE purchase ADD COLUMN duration_days INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS traffic_pack;
+
+ALTER TABLE purchase DROP COLUMN IF EXISTS traffic_gb;
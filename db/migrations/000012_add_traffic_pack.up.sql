@@ -0,0 +1,14 @@
+ALTER TABLE purchase ADD COLUMN traffic_gb INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS traffic_pack
+(
+    id          BIGSERIAL PRIMARY KEY,
+    purchase_id BIGINT  NOT NULL UNIQUE REFERENCES purchase (id) ON DELETE CASCADE,
+    customer_id BIGINT  NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    bytes       BIGINT  NOT NULL CHECK (bytes > 0),
+    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at  TIMESTAMP WITH TIME ZONE,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS traffic_pack_active_idx ON traffic_pack (expires_at) WHERE revoked_at IS NULL;
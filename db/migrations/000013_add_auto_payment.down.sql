@@ -0,0 +1,2 @@
+ALTER TABLE customer DROP COLUMN IF EXISTS auto_renew;
+ALTER TABLE customer DROP COLUMN IF EXISTS yookasa_payment_method_id;
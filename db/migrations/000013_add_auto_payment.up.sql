@@ -0,0 +1,2 @@
+ALTER TABLE customer ADD COLUMN yookasa_payment_method_id UUID;
+ALTER TABLE customer ADD COLUMN auto_renew BOOLEAN NOT NULL DEFAULT FALSE;
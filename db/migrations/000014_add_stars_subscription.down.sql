@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS purchase_telegram_charge_id_idx;
+DROP TABLE IF EXISTS stars_subscription;
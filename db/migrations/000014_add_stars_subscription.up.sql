@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS stars_subscription
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    purchase_id BIGINT NOT NULL UNIQUE REFERENCES purchase (id) ON DELETE CASCADE,
+    charge_id   TEXT   NOT NULL,
+    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    canceled_at TIMESTAMP WITH TIME ZONE,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS stars_subscription_customer_idx ON stars_subscription (customer_id, expires_at);
+
+CREATE INDEX IF NOT EXISTS purchase_telegram_charge_id_idx ON purchase (telegram_charge_id) WHERE telegram_charge_id IS NOT NULL;
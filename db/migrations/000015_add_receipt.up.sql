@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS receipt
+(
+    id           BIGSERIAL PRIMARY KEY,
+    purchase_id  BIGINT      NOT NULL UNIQUE REFERENCES purchase (id) ON DELETE CASCADE,
+    status       VARCHAR(20) NOT NULL DEFAULT 'pending',
+    receipt_uuid TEXT,
+    attempts     INTEGER     NOT NULL DEFAULT 0,
+    last_error   TEXT,
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS receipt_status_idx ON receipt (status);
+
+INSERT INTO receipt (purchase_id, status, receipt_uuid, attempts)
+SELECT id, 'issued', moynalog_receipt_uuid, 1
+FROM purchase
+WHERE moynalog_receipt_uuid IS NOT NULL
+ON CONFLICT (purchase_id) DO NOTHING;
@@ -0,0 +1 @@
+ALTER TABLE receipt DROP COLUMN IF EXISTS amount;
@@ -0,0 +1,8 @@
+ALTER TABLE receipt ADD COLUMN amount DECIMAL(20, 8);
+
+UPDATE receipt
+SET amount = purchase.amount
+FROM purchase
+WHERE purchase.id = receipt.purchase_id
+  AND purchase.currency = 'RUB'
+  AND receipt.status = 'issued';
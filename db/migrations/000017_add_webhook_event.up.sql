@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS webhook_event
+(
+    id              BIGSERIAL PRIMARY KEY,
+    provider        VARCHAR(20) NOT NULL,
+    path            TEXT        NOT NULL,
+    headers         JSONB       NOT NULL DEFAULT '{}',
+    body            TEXT        NOT NULL,
+    signature_valid BOOLEAN,
+    status          VARCHAR(20) NOT NULL DEFAULT 'received',
+    response_code   INTEGER,
+    error           TEXT,
+    purchase_id     BIGINT REFERENCES purchase (id) ON DELETE SET NULL,
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_event_status ON webhook_event (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_event_purchase_id ON webhook_event (purchase_id);
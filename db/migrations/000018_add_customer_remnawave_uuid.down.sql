@@ -0,0 +1 @@
+ALTER TABLE customer DROP COLUMN remnawave_uuid;
@@ -0,0 +1 @@
+ALTER TABLE customer ADD COLUMN remnawave_uuid UUID;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS subscription_link_reset;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS subscription_link_reset
+(
+    id          BIGSERIAL PRIMARY KEY,
+    customer_id BIGINT NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    old_link    TEXT,
+    new_link    TEXT   NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_link_reset_customer_id ON subscription_link_reset (customer_id, created_at);
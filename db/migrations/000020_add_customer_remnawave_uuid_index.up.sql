@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_customer_remnawave_uuid ON customer (remnawave_uuid);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS panel_grant
+(
+    purchase_id   BIGINT PRIMARY KEY REFERENCES purchase (id) ON DELETE CASCADE,
+    customer_id   BIGINT NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    expire_at     TIMESTAMP WITH TIME ZONE,
+    traffic_limit BIGINT,
+    applied_at    TIMESTAMP WITH TIME ZONE,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_panel_grant_pending ON panel_grant (customer_id, purchase_id) WHERE applied_at IS NULL;
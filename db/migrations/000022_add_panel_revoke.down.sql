@@ -0,0 +1 @@
+DROP TABLE IF EXISTS panel_revoke;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS panel_revoke
+(
+    purchase_id BIGINT PRIMARY KEY REFERENCES purchase (id) ON DELETE CASCADE,
+    customer_id BIGINT  NOT NULL REFERENCES customer (id) ON DELETE CASCADE,
+    days        INTEGER NOT NULL,
+    expire_at   TIMESTAMP WITH TIME ZONE,
+    applied_at  TIMESTAMP WITH TIME ZONE,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_panel_revoke_pending ON panel_revoke (customer_id, created_at) WHERE applied_at IS NULL;
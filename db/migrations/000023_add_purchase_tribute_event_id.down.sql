@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS purchase_tribute_event_id_idx;
+ALTER TABLE purchase DROP COLUMN IF EXISTS tribute_event_id;
@@ -0,0 +1,3 @@
+ALTER TABLE purchase ADD COLUMN IF NOT EXISTS tribute_event_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS purchase_tribute_event_id_idx ON purchase (tribute_event_id) WHERE tribute_event_id IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS webhook_event_provider_event_id_idx;
+ALTER TABLE webhook_event DROP COLUMN IF EXISTS event_id;
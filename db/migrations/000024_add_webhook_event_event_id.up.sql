@@ -0,0 +1,3 @@
+ALTER TABLE webhook_event ADD COLUMN IF NOT EXISTS event_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_event_provider_event_id_idx ON webhook_event (provider, event_id) WHERE event_id IS NOT NULL;
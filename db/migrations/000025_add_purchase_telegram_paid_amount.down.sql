@@ -0,0 +1,2 @@
+ALTER TABLE purchase DROP COLUMN IF EXISTS telegram_paid_currency;
+ALTER TABLE purchase DROP COLUMN IF EXISTS telegram_paid_amount;
@@ -0,0 +1,2 @@
+ALTER TABLE purchase ADD COLUMN IF NOT EXISTS telegram_paid_amount DECIMAL(20, 8);
+ALTER TABLE purchase ADD COLUMN IF NOT EXISTS telegram_paid_currency VARCHAR(10);
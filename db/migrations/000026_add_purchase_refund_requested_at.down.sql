@@ -0,0 +1 @@
+ALTER TABLE purchase DROP COLUMN IF EXISTS refund_requested_at;
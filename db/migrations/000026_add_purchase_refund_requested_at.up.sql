@@ -0,0 +1 @@
+ALTER TABLE purchase ADD COLUMN IF NOT EXISTS refund_requested_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+ALTER TABLE referral DROP COLUMN IF EXISTS bonus_expire_at;
+ALTER TABLE referral DROP COLUMN IF EXISTS bonus_purchase_id;
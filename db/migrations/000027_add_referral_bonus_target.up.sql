@@ -0,0 +1,2 @@
+ALTER TABLE referral ADD COLUMN IF NOT EXISTS bonus_purchase_id BIGINT;
+ALTER TABLE referral ADD COLUMN IF NOT EXISTS bonus_expire_at TIMESTAMP WITH TIME ZONE;
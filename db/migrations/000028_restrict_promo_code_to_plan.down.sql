@@ -0,0 +1,7 @@
+ALTER TABLE promo_code ADD COLUMN IF NOT EXISTS months INTEGER;
+
+UPDATE promo_code
+SET months = GREATEST(1, (SELECT days FROM plan WHERE plan.id = promo_code.plan_id) / 30)
+WHERE plan_id IS NOT NULL;
+
+ALTER TABLE promo_code DROP COLUMN IF EXISTS plan_id;
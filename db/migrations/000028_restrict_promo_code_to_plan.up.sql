@@ -0,0 +1,11 @@
+ALTER TABLE promo_code ADD COLUMN IF NOT EXISTS plan_id BIGINT REFERENCES plan (id);
+
+-- Codes restricted to a number of months move to the plan seeded for it with the
+-- default 30 days per month. Codes without such a plan are expired instead of
+-- applying to every plan.
+UPDATE promo_code
+SET plan_id = (SELECT id FROM plan WHERE plan.days = promo_code.months * 30 ORDER BY sort_order, id LIMIT 1)
+WHERE months IS NOT NULL;
+UPDATE promo_code SET valid_until = NOW() WHERE months IS NOT NULL AND plan_id IS NULL;
+
+ALTER TABLE promo_code DROP COLUMN IF EXISTS months;
@@ -0,0 +1,4 @@
+UPDATE plan SET name = 'month_1' WHERE name = '1 месяц';
+UPDATE plan SET name = 'month_3' WHERE name = '3 месяца';
+UPDATE plan SET name = 'month_6' WHERE name = '6 месяцев';
+UPDATE plan SET name = 'month_12' WHERE name = '12 месяцев';
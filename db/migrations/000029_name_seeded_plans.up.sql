@@ -0,0 +1,7 @@
+-- Plan names are shown on the buy buttons as they are. Plans seeded before that
+-- carry the translation key of their button, which gets the label of the default
+-- language.
+UPDATE plan SET name = '1 месяц' WHERE name = 'month_1';
+UPDATE plan SET name = '3 месяца' WHERE name = 'month_3';
+UPDATE plan SET name = '6 месяцев' WHERE name = 'month_6';
+UPDATE plan SET name = '12 месяцев' WHERE name = 'month_12';
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
@@ -19,10 +21,12 @@ type config struct {
 	remnawaveUrl, remnawaveToken, remnawaveMode, remnawaveTag string
 	defaultLanguage                                           string
 	databaseURL                                               string
-	cryptoPayURL, cryptoPayToken                              string
+	cryptoPayURL, cryptoPayToken, cryptoPayWebhookUrl         string
 	botURL                                                    string
 	yookasaURL, yookasaShopId, yookasaSecretKey, yookasaEmail string
 	moynalogURL, moynalogUsername, moynalogPassword           string
+	moynalogInvoiceTypes                                      map[string]bool
+	moynalogExchangeRates                                     map[string]float64
 	trafficLimit, trialTrafficLimit                           int
 	feedbackURL                                               string
 	channelURL                                                string
@@ -32,21 +36,36 @@ type config struct {
 	isYookasaEnabled                                          bool
 	isCryptoEnabled                                           bool
 	isTelegramStarsEnabled                                    bool
+	isStarsSubscriptionEnabled                                bool
 	isMoynalogEnabled                                         bool
 	adminTelegramId                                           int64
 	trialDays                                                 int
 	trialRemnawaveTag                                         string
 	squadUUIDs                                                map[uuid.UUID]uuid.UUID
 	referralDays                                              int
+	referralBonusAmount                                       int
+	topUpAmounts                                              []int
+	trafficPacks                                              []TrafficPack
+	trafficPacksUntilReset                                    bool
 	miniApp                                                   string
 	enableAutoPayment                                         bool
 	healthCheckPort                                           int
+	adminAPIToken                                             string
+	webhookAllowedIPs                                         map[string][]netip.Prefix
+	webhookTrustedProxies                                     []netip.Prefix
+	webhookMaxBodyBytes                                       int
+	linkResetCooldown                                         time.Duration
+	remnawaveWebhookUrl, remnawaveWebhookSecret               string
+	remnawaveRetryAttempts, remnawaveBreakerThreshold         int
+	remnawaveRetryBaseDelay, remnawaveRetryMaxDelay           time.Duration
+	remnawaveBreakerOpenDuration, remnawaveOutageAlertAfter   time.Duration
+	remnawaveCacheTTL                                         time.Duration
 	tributeWebhookUrl, tributeAPIKey, tributePaymentUrl       string
 	yookasaWebhookUrl                                         string
 	plategaMerchantId, plategaSecret, plategaWebhookUrl       string
-	isPlategaSBPEnabled, isPlategaCardsEnabled               bool
-	isPlategaAcquiringEnabled, isPlategaWorldwideEnabled     bool
-	isPlategaCryptoEnabled                                   bool
+	isPlategaSBPEnabled, isPlategaCardsEnabled                bool
+	isPlategaAcquiringEnabled, isPlategaWorldwideEnabled      bool
+	isPlategaCryptoEnabled                                    bool
 	isWebAppLinkEnabled                                       bool
 	daysInMonth                                               int
 	externalSquadUUID                                         uuid.UUID
@@ -58,6 +77,8 @@ type config struct {
 	remnawaveHeaders                                          map[string]string
 	trialTrafficLimitResetStrategy                            string
 	trafficLimitResetStrategy                                 string
+	cryptoPayInvoiceTTL, yookasaInvoiceTTL                    time.Duration
+	plategaInvoiceTTL, starsInvoiceTTL                        time.Duration
 }
 
 var conf config
@@ -87,6 +108,10 @@ func GetTributePaymentUrl() string {
 	return conf.tributePaymentUrl
 }
 
+func GetCryptoPayWebHookUrl() string {
+	return conf.cryptoPayWebhookUrl
+}
+
 func GetYookasaWebHookUrl() string {
 	return conf.yookasaWebhookUrl
 }
@@ -133,6 +158,46 @@ func GetReferralDays() int {
 	return conf.referralDays
 }
 
+// ReferralBonusAmount is credited to the referrer's balance instead of referral days
+// when positive.
+func ReferralBonusAmount() int {
+	return conf.referralBonusAmount
+}
+
+// TopUpAmounts are the balance top-up amounts offered to customers, in rubles.
+func TopUpAmounts() []int {
+	return conf.topUpAmounts
+}
+
+// TrafficPack is an extra traffic pack offered to customers with an active
+// subscription. A zero StarsPrice means the pack is not sold for Stars.
+type TrafficPack struct {
+	GB         int
+	Price      int
+	StarsPrice int
+}
+
+// TrafficPacks are the extra traffic packs offered to customers, empty disables them.
+func TrafficPacks() []TrafficPack {
+	return conf.trafficPacks
+}
+
+// FindTrafficPack returns the offered pack of the given size.
+func FindTrafficPack(gb int) (TrafficPack, bool) {
+	for _, pack := range conf.trafficPacks {
+		if pack.GB == gb {
+			return pack, true
+		}
+	}
+	return TrafficPack{}, false
+}
+
+// TrafficPacksUntilReset tells whether traffic packs expire at the next traffic
+// reset of the subscription instead of at its end.
+func TrafficPacksUntilReset() bool {
+	return conf.trafficPacksUntilReset
+}
+
 func GetMiniAppURL() string {
 	return conf.miniApp
 }
@@ -194,22 +259,6 @@ func YookasaEmail() string {
 	return conf.yookasaEmail
 }
 
-func Price1() int {
-	return conf.price1
-}
-
-func Price3() int {
-	return conf.price3
-}
-
-func Price6() int {
-	return conf.price6
-}
-
-func Price12() int {
-	return conf.price12
-}
-
 func DaysInMonth() int {
 	return conf.daysInMonth
 }
@@ -218,6 +267,7 @@ func ExternalSquadUUID() uuid.UUID {
 	return conf.externalSquadUUID
 }
 
+// Price is the PRICE_* setting for the period. It only seeds the plan catalog.
 func Price(month int) int {
 	switch month {
 	case 1:
@@ -233,6 +283,7 @@ func Price(month int) int {
 	}
 }
 
+// StarsPrice is the STARS_PRICE_* setting for the period. It only seeds the plan catalog.
 func StarsPrice(month int) int {
 	switch month {
 	case 1:
@@ -303,10 +354,22 @@ func IsYookasaEnabled() bool {
 	return conf.isYookasaEnabled
 }
 
+// IsAutoPaymentEnabled tells whether YooKassa card payments save the card so the
+// subscription can be renewed automatically.
+func IsAutoPaymentEnabled() bool {
+	return conf.enableAutoPayment && conf.isYookasaEnabled
+}
+
 func IsTelegramStarsEnabled() bool {
 	return conf.isTelegramStarsEnabled
 }
 
+// IsStarsSubscriptionEnabled tells whether 30-day subscriptions paid with Stars are
+// sold as Telegram subscriptions that renew every month.
+func IsStarsSubscriptionEnabled() bool {
+	return conf.isTelegramStarsEnabled && conf.isStarsSubscriptionEnabled
+}
+
 func RequirePaidPurchaseForStars() bool {
 	return conf.requirePaidPurchaseForStars
 }
@@ -319,6 +382,80 @@ func GetHealthCheckPort() int {
 	return conf.healthCheckPort
 }
 
+// WebhookAllowedIPs returns the networks allowed to call the named webhook. An empty
+// list allows any address.
+func WebhookAllowedIPs(name string) []netip.Prefix {
+	return conf.webhookAllowedIPs[name]
+}
+
+// WebhookTrustedProxies are the reverse proxies whose X-Forwarded-For header names
+// the webhook caller.
+func WebhookTrustedProxies() []netip.Prefix {
+	return conf.webhookTrustedProxies
+}
+
+func WebhookMaxBodyBytes() int {
+	return conf.webhookMaxBodyBytes
+}
+
+// LinkResetCooldown is how long a customer waits between subscription link resets.
+func LinkResetCooldown() time.Duration {
+	return conf.linkResetCooldown
+}
+
+// RemnawaveWebhookUrl is the path the panel webhook is served on. The webhook is
+// disabled when it is empty.
+func RemnawaveWebhookUrl() string {
+	return conf.remnawaveWebhookUrl
+}
+
+// RemnawaveWebhookSecret is the key the panel signs its webhooks with.
+func RemnawaveWebhookSecret() string {
+	return conf.remnawaveWebhookSecret
+}
+
+// RemnawaveRetryAttempts is how many times an idempotent panel request is sent
+// before its error is returned.
+func RemnawaveRetryAttempts() int {
+	return conf.remnawaveRetryAttempts
+}
+
+func RemnawaveRetryBaseDelay() time.Duration {
+	return conf.remnawaveRetryBaseDelay
+}
+
+func RemnawaveRetryMaxDelay() time.Duration {
+	return conf.remnawaveRetryMaxDelay
+}
+
+// RemnawaveBreakerThreshold is how many panel requests in a row may fail before
+// further requests fail fast.
+func RemnawaveBreakerThreshold() int {
+	return conf.remnawaveBreakerThreshold
+}
+
+// RemnawaveBreakerOpenDuration is how long requests fail fast before the panel is
+// tried again.
+func RemnawaveBreakerOpenDuration() time.Duration {
+	return conf.remnawaveBreakerOpenDuration
+}
+
+// RemnawaveOutageAlertAfter is how long the panel may be unreachable before the
+// admin is alerted.
+func RemnawaveOutageAlertAfter() time.Duration {
+	return conf.remnawaveOutageAlertAfter
+}
+
+// RemnawaveCacheTTL is how long squads and nodes loaded from the panel are reused.
+func RemnawaveCacheTTL() time.Duration {
+	return conf.remnawaveCacheTTL
+}
+
+// AdminAPIToken authorizes the admin HTTP API. The API is disabled when it is empty.
+func AdminAPIToken() string {
+	return conf.adminAPIToken
+}
+
 func IsWepAppLinkEnabled() bool {
 	return conf.isWebAppLinkEnabled
 }
@@ -353,6 +490,45 @@ func IsMoynalogEnabled() bool {
 	return conf.isMoynalogEnabled
 }
 
+// IsMoynalogInvoiceType tells whether purchases of the invoice type are declared as
+// Moynalog income.
+func IsMoynalogInvoiceType(invoiceType string) bool {
+	return conf.moynalogInvoiceTypes[invoiceType]
+}
+
+// MoynalogExchangeRate returns how many rubles one unit of the currency is declared
+// as. Rubles are declared as is.
+func MoynalogExchangeRate(currency string) (float64, bool) {
+	currency = strings.ToUpper(currency)
+	if currency == "RUB" {
+		return 1, true
+	}
+	rate, ok := conf.moynalogExchangeRates[currency]
+	return rate, ok
+}
+
+// CryptoPayInvoiceTTL is how long an unpaid CryptoPay invoice stays open. Zero disables expiry.
+func CryptoPayInvoiceTTL() time.Duration {
+	return conf.cryptoPayInvoiceTTL
+}
+
+func YookasaInvoiceTTL() time.Duration {
+	return conf.yookasaInvoiceTTL
+}
+
+func PlategaInvoiceTTL() time.Duration {
+	return conf.plategaInvoiceTTL
+}
+
+func StarsInvoiceTTL() time.Duration {
+	return conf.starsInvoiceTTL
+}
+
+// LongestInvoiceTTL is the longest time an invoice of any provider stays open.
+func LongestInvoiceTTL() time.Duration {
+	return max(conf.cryptoPayInvoiceTTL, conf.yookasaInvoiceTTL, conf.plategaInvoiceTTL, conf.starsInvoiceTTL)
+}
+
 func mustEnv(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -394,6 +570,105 @@ func envBool(key string) bool {
 	return os.Getenv(key) == "true"
 }
 
+// parseTrafficPacks parses a comma separated list of GB:PRICE[:STARS_PRICE] packs.
+func parseTrafficPacks(v string) []TrafficPack {
+	var packs []TrafficPack
+	for _, value := range strings.Split(v, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		parts := strings.Split(value, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			log.Panicf("invalid pack in %q: %q", "TRAFFIC_PACKS", value)
+		}
+		var numbers []int
+		for _, part := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 0 {
+				log.Panicf("invalid pack in %q: %q", "TRAFFIC_PACKS", value)
+			}
+			numbers = append(numbers, n)
+		}
+		pack := TrafficPack{GB: numbers[0], Price: numbers[1]}
+		if len(numbers) == 3 {
+			pack.StarsPrice = numbers[2]
+		}
+		if pack.GB == 0 || pack.Price == 0 {
+			log.Panicf("invalid pack in %q: %q", "TRAFFIC_PACKS", value)
+		}
+		packs = append(packs, pack)
+	}
+	return packs
+}
+
+// parseMoynalogInvoiceTypes parses a comma separated list of invoice types. Balance
+// payments are not income, the top-up that funded the balance was declared already.
+func parseMoynalogInvoiceTypes(v string) map[string]bool {
+	types := make(map[string]bool)
+	for _, value := range strings.Split(v, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if value == "balance" {
+			log.Panicf("invalid invoice type in %q: %q", "MOYNALOG_INVOICE_TYPES", value)
+		}
+		types[value] = true
+	}
+	return types
+}
+
+// parseExchangeRates parses comma separated CURRENCY:RATE pairs, e.g. "EUR:100,USD:92.5".
+func parseExchangeRates(v string) map[string]float64 {
+	rates := make(map[string]float64)
+	for _, value := range strings.Split(v, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		currency, rateValue, ok := strings.Cut(value, ":")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+		if !ok || err != nil || rate <= 0 {
+			log.Panicf("invalid rate in %q: %q", "MOYNALOG_EXCHANGE_RATES", value)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(currency))] = rate
+	}
+	return rates
+}
+
+// yookassaWebhookIPs are the addresses YooKassa sends notifications from.
+const yookassaWebhookIPs = "185.71.76.0/27,185.71.77.0/27,77.75.153.0/25,77.75.156.11,77.75.156.35,77.75.154.128/25,2a02:5180::/32"
+
+// privateNetworks cover loopback and the private ranges reverse proxies usually
+// reach the bot from.
+const privateNetworks = "127.0.0.0/8,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,::1/128,fc00::/7"
+
+// parsePrefixes parses a comma separated list of IP addresses and CIDR networks.
+func parsePrefixes(key, v string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(v, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				log.Panicf("invalid network in %q: %q", key, value)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			log.Panicf("invalid address in %q: %q", key, value)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes
+}
+
 func InitConfig() {
 	if os.Getenv("DISABLE_ENV_FILE") != "true" {
 		if err := godotenv.Load(".env"); err != nil {
@@ -417,6 +692,20 @@ func InitConfig() {
 
 	conf.remnawaveTag = envStringDefault("REMNAWAVE_TAG", "")
 
+	conf.remnawaveRetryAttempts = envIntDefault("REMNAWAVE_RETRY_ATTEMPTS", 3)
+	conf.remnawaveRetryBaseDelay = time.Duration(envIntDefault("REMNAWAVE_RETRY_BASE_DELAY_MS", 200)) * time.Millisecond
+	conf.remnawaveRetryMaxDelay = time.Duration(envIntDefault("REMNAWAVE_RETRY_MAX_DELAY_MS", 3000)) * time.Millisecond
+	conf.remnawaveBreakerThreshold = envIntDefault("REMNAWAVE_BREAKER_THRESHOLD", 5)
+	conf.remnawaveBreakerOpenDuration = time.Duration(envIntDefault("REMNAWAVE_BREAKER_OPEN_SECONDS", 30)) * time.Second
+	conf.remnawaveOutageAlertAfter = time.Duration(envIntDefault("REMNAWAVE_OUTAGE_ALERT_MINUTES", 5)) * time.Minute
+
+	conf.remnawaveCacheTTL = time.Duration(envIntDefault("REMNAWAVE_CACHE_TTL_MINUTES", 10)) * time.Minute
+
+	conf.remnawaveWebhookUrl = os.Getenv("REMNAWAVE_WEBHOOK_URL")
+	if conf.remnawaveWebhookUrl != "" {
+		conf.remnawaveWebhookSecret = mustEnv("REMNAWAVE_WEBHOOK_SECRET")
+	}
+
 	conf.trialRemnawaveTag = envStringDefault("TRIAL_REMNAWAVE_TAG", "")
 
 	conf.trialTrafficLimitResetStrategy = envStringDefault("TRIAL_TRAFFIC_LIMIT_RESET_STRATEGY", "MONTH")
@@ -440,15 +729,26 @@ func InitConfig() {
 	conf.trialTrafficLimit = mustEnvInt("TRIAL_TRAFFIC_LIMIT")
 
 	conf.healthCheckPort = envIntDefault("HEALTH_CHECK_PORT", 8080)
+	conf.adminAPIToken = os.Getenv("ADMIN_API_TOKEN")
+	conf.webhookAllowedIPs = map[string][]netip.Prefix{
+		"yookassa":  parsePrefixes("YOOKASA_WEBHOOK_ALLOWED_IPS", envStringDefault("YOOKASA_WEBHOOK_ALLOWED_IPS", yookassaWebhookIPs)),
+		"platega":   parsePrefixes("PLATEGA_WEBHOOK_ALLOWED_IPS", os.Getenv("PLATEGA_WEBHOOK_ALLOWED_IPS")),
+		"cryptopay": parsePrefixes("CRYPTO_PAY_WEBHOOK_ALLOWED_IPS", os.Getenv("CRYPTO_PAY_WEBHOOK_ALLOWED_IPS")),
+		"tribute":   parsePrefixes("TRIBUTE_WEBHOOK_ALLOWED_IPS", os.Getenv("TRIBUTE_WEBHOOK_ALLOWED_IPS")),
+		"remnawave": parsePrefixes("REMNAWAVE_WEBHOOK_ALLOWED_IPS", os.Getenv("REMNAWAVE_WEBHOOK_ALLOWED_IPS")),
+	}
+	conf.webhookTrustedProxies = parsePrefixes("WEBHOOK_TRUSTED_PROXIES", envStringDefault("WEBHOOK_TRUSTED_PROXIES", privateNetworks))
+	conf.webhookMaxBodyBytes = envIntDefault("WEBHOOK_MAX_BODY_BYTES", 64<<10)
+	conf.linkResetCooldown = time.Duration(envIntDefault("LINK_RESET_COOLDOWN_HOURS", 24)) * time.Hour
 
 	conf.trialDays = mustEnvInt("TRIAL_DAYS")
 
 	conf.enableAutoPayment = envBool("ENABLE_AUTO_PAYMENT")
 
-	conf.price1 = mustEnvInt("PRICE_1")
-	conf.price3 = mustEnvInt("PRICE_3")
-	conf.price6 = mustEnvInt("PRICE_6")
-	conf.price12 = mustEnvInt("PRICE_12")
+	conf.price1 = envIntDefault("PRICE_1", 0)
+	conf.price3 = envIntDefault("PRICE_3", 0)
+	conf.price6 = envIntDefault("PRICE_6", 0)
+	conf.price12 = envIntDefault("PRICE_12", 0)
 
 	conf.isTelegramStarsEnabled = envBool("TELEGRAM_STARS_ENABLED")
 	if conf.isTelegramStarsEnabled {
@@ -459,6 +759,8 @@ func InitConfig() {
 
 	}
 
+	conf.isStarsSubscriptionEnabled = envBool("TELEGRAM_STARS_SUBSCRIPTION")
+
 	conf.requirePaidPurchaseForStars = envBool("REQUIRE_PAID_PURCHASE_FOR_STARS")
 
 	conf.remnawaveUrl = mustEnv("REMNAWAVE_URL")
@@ -484,6 +786,7 @@ func InitConfig() {
 	if conf.isCryptoEnabled {
 		conf.cryptoPayURL = mustEnv("CRYPTO_PAY_URL")
 		conf.cryptoPayToken = mustEnv("CRYPTO_PAY_TOKEN")
+		conf.cryptoPayWebhookUrl = os.Getenv("CRYPTO_PAY_WEBHOOK_URL")
 	}
 
 	conf.isYookasaEnabled = envBool("YOOKASA_ENABLED")
@@ -506,8 +809,33 @@ func InitConfig() {
 		conf.isPlategaCryptoEnabled = envBool("PLATEGA_CRYPTO_ENABLED")
 	}
 
+	invoiceTTL := envIntDefault("INVOICE_TTL_MINUTES", 60)
+	conf.cryptoPayInvoiceTTL = time.Duration(envIntDefault("CRYPTO_PAY_INVOICE_TTL_MINUTES", invoiceTTL)) * time.Minute
+	conf.yookasaInvoiceTTL = time.Duration(envIntDefault("YOOKASA_INVOICE_TTL_MINUTES", invoiceTTL)) * time.Minute
+	conf.plategaInvoiceTTL = time.Duration(envIntDefault("PLATEGA_INVOICE_TTL_MINUTES", invoiceTTL)) * time.Minute
+	conf.starsInvoiceTTL = time.Duration(envIntDefault("TELEGRAM_STARS_INVOICE_TTL_MINUTES", invoiceTTL)) * time.Minute
+
 	conf.trafficLimit = mustEnvInt("TRAFFIC_LIMIT")
 	conf.referralDays = mustEnvInt("REFERRAL_DAYS")
+	conf.referralBonusAmount = envIntDefault("REFERRAL_BONUS_AMOUNT", 0)
+
+	for _, value := range strings.Split(envStringDefault("TOPUP_AMOUNTS", "100,300,500,1000"), ",") {
+		amount, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || amount <= 0 {
+			log.Panicf("invalid amount in %q: %q", "TOPUP_AMOUNTS", value)
+		}
+		conf.topUpAmounts = append(conf.topUpAmounts, amount)
+	}
+
+	conf.trafficPacks = parseTrafficPacks(os.Getenv("TRAFFIC_PACKS"))
+	switch expiry := envStringDefault("TRAFFIC_PACK_EXPIRY", "reset"); expiry {
+	case "reset":
+		conf.trafficPacksUntilReset = true
+	case "subscription":
+		conf.trafficPacksUntilReset = false
+	default:
+		log.Panicf("invalid %q: %q, expected reset or subscription", "TRAFFIC_PACK_EXPIRY", expiry)
+	}
 
 	conf.serverStatusURL = os.Getenv("SERVER_STATUS_URL")
 	conf.supportURL = os.Getenv("SUPPORT_URL")
@@ -642,5 +970,7 @@ func InitConfig() {
 		conf.moynalogURL = envStringDefault("MOYNALOG_URL", "https://moynalog.ru/api/v1")
 		conf.moynalogUsername = mustEnv("MOYNALOG_USERNAME")
 		conf.moynalogPassword = mustEnv("MOYNALOG_PASSWORD")
+		conf.moynalogInvoiceTypes = parseMoynalogInvoiceTypes(envStringDefault("MOYNALOG_INVOICE_TYPES", "yookasa"))
+		conf.moynalogExchangeRates = parseExchangeRates(os.Getenv("MOYNALOG_EXCHANGE_RATES"))
 	}
 }
@@ -11,6 +11,7 @@ import (
 type CryptoPayApi interface {
 	CreateInvoice(invoiceReq *InvoiceRequest) (*InvoiceResponse, error)
 	GetInvoices(status, fiat, asset, invoiceIds string, offset, limit int) (*[]InvoiceResponse, error)
+	DeleteInvoice(invoiceID int64) error
 }
 
 type Client struct {
@@ -131,3 +132,45 @@ func (c *Client) GetInvoices(status, fiat, asset, invoiceIds string, offset, lim
 
 	return &apiResp.Result.Items, nil
 }
+
+func (c *Client) DeleteInvoice(invoiceID int64) error {
+	jsonData, err := json.Marshal(map[string]int64{"invoice_id": invoiceID})
+	if err != nil {
+		return fmt.Errorf("error marshaling delete invoice request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/deleteInvoice", c.baseURL)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error while creating delete invoice req: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Crypto-Pay-API-Token", c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while making delete invoice req: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error while reading delete invoice resp: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API return error. Status: %d, Body: %s", resp.StatusCode, string(body))
+	}
+
+	var apiResp ResponseWrapper[bool]
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return fmt.Errorf("error while unmarshiling response: %w", err)
+	}
+
+	if !apiResp.Ok || !apiResp.Result {
+		return fmt.Errorf("API delete invoice failed: ok=%v", apiResp.Ok)
+	}
+
+	return nil
+}
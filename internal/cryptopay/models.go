@@ -1,6 +1,10 @@
 package cryptopay
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 type InvoiceRequest struct {
 	CurrencyType   string `json:"currency_type,omitempty"`
@@ -55,6 +59,19 @@ func (r InvoiceResponse) IsPaid() bool {
 	return r.Status == "paid"
 }
 
+// Price returns the invoice amount and the fiat currency or asset it was issued in.
+func (r InvoiceResponse) Price() (float64, string, error) {
+	currency := r.Asset
+	if r.CurrencyType == "fiat" {
+		currency = r.Fiat
+	}
+	amount, err := strconv.ParseFloat(r.Amount, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid invoice amount %q: %w", r.Amount, err)
+	}
+	return amount, currency, nil
+}
+
 type ResponseWrapper[T any] struct {
 	Ok     bool `json:"ok"`
 	Result T    `json:"result"`
@@ -0,0 +1,200 @@
+package cryptopay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+type Provider struct {
+	client       *Client
+	purchaseRepo *database.PurchaseRepository
+}
+
+var (
+	_ payment.Poller          = (*Provider)(nil)
+	_ payment.WebhookProvider = (*Provider)(nil)
+)
+
+func NewProvider(client *Client, purchaseRepo *database.PurchaseRepository) *Provider {
+	return &Provider{client: client, purchaseRepo: purchaseRepo}
+}
+
+func (p *Provider) InvoiceType() database.InvoiceType {
+	return database.InvoiceTypeCrypto
+}
+
+func (p *Provider) ButtonKey() string {
+	return "crypto_button"
+}
+
+func (p *Provider) IsEnabled() bool {
+	return config.IsCryptoPayEnabled()
+}
+
+func (p *Provider) Currency() string {
+	return "RUB"
+}
+
+func (p *Provider) InvoiceTTL() time.Duration {
+	return config.CryptoPayInvoiceTTL()
+}
+
+func (p *Provider) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*payment.Invoice, error) {
+	invoice, err := p.client.CreateInvoice(&InvoiceRequest{
+		CurrencyType:   "fiat",
+		Fiat:           "RUB",
+		Amount:         fmt.Sprintf("%d", int(purchase.Amount)),
+		AcceptedAssets: "USDT",
+		Payload:        fmt.Sprintf("purchaseId=%d&username=%s", purchase.ID, remnawave.UsernameFromCtx(ctx)),
+		Description:    payment.PurchaseDescription(purchase),
+		PaidBtnName:    "callback",
+		PaidBtnUrl:     config.BotURL(),
+		ExpiresIn:      invoiceExpiresIn(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.Invoice{
+		URL: invoice.BotInvoiceUrl,
+		Fields: map[string]interface{}{
+			"crypto_invoice_url": invoice.BotInvoiceUrl,
+			"crypto_invoice_id":  invoice.InvoiceID,
+		},
+	}, nil
+}
+
+func (p *Provider) FetchStatus(ctx context.Context, purchase *database.Purchase) (*payment.Transaction, error) {
+	txs, err := p.FetchStatuses(ctx, []database.Purchase{*purchase})
+	if err != nil {
+		return nil, err
+	}
+	tx, ok := txs[purchase.ID]
+	if !ok {
+		return nil, fmt.Errorf("crypto invoice for purchase %d not found", purchase.ID)
+	}
+	return tx, nil
+}
+
+func (p *Provider) FetchStatuses(ctx context.Context, purchases []database.Purchase) (map[int64]*payment.Transaction, error) {
+	purchaseByInvoice := make(map[int64]int64, len(purchases))
+	var invoiceIDs []string
+	for _, purchase := range purchases {
+		if purchase.CryptoInvoiceID == nil {
+			continue
+		}
+		purchaseByInvoice[*purchase.CryptoInvoiceID] = purchase.ID
+		invoiceIDs = append(invoiceIDs, strconv.FormatInt(*purchase.CryptoInvoiceID, 10))
+	}
+
+	result := make(map[int64]*payment.Transaction, len(invoiceIDs))
+	if len(invoiceIDs) == 0 {
+		return result, nil
+	}
+
+	invoices, err := p.client.GetInvoices("", "", "", strings.Join(invoiceIDs, ","), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, invoice := range *invoices {
+		if invoice.InvoiceID == nil {
+			continue
+		}
+		purchaseID, ok := purchaseByInvoice[*invoice.InvoiceID]
+		if !ok {
+			continue
+		}
+		amount, currency, err := invoice.Price()
+		if err != nil {
+			slog.Error("cryptopay: skip invoice", "invoice_id", *invoice.InvoiceID, "error", err)
+			continue
+		}
+		_, username, _ := ParsePayload(invoice.Payload)
+		result[purchaseID] = &payment.Transaction{
+			Status:   invoiceStatus(invoice),
+			Username: username,
+			Amount:   amount,
+			Currency: currency,
+		}
+	}
+	return result, nil
+}
+
+func (p *Provider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	if purchase.CryptoInvoiceID == nil {
+		return nil
+	}
+	return p.client.DeleteInvoice(*purchase.CryptoInvoiceID)
+}
+
+// invoiceExpiresIn lets CryptoPay close the invoice itself once the TTL passes.
+func invoiceExpiresIn() *int {
+	ttl := config.CryptoPayInvoiceTTL()
+	if ttl <= 0 {
+		return nil
+	}
+	seconds := int(ttl.Seconds())
+	return &seconds
+}
+
+func (p *Provider) Refund(ctx context.Context, purchase *database.Purchase) error {
+	return payment.ErrNotSupported
+}
+
+func (p *Provider) WebhookName() string {
+	return "cryptopay"
+}
+
+func (p *Provider) WebhookPath() string {
+	return config.GetCryptoPayWebHookUrl()
+}
+
+func (p *Provider) WebhookEventID(body []byte) string {
+	var update webhookUpdate
+	if err := json.Unmarshal(body, &update); err != nil || update.UpdateID == 0 {
+		return ""
+	}
+	return strconv.FormatInt(update.UpdateID, 10)
+}
+
+func (p *Provider) WebhookHandler(service *payment.PaymentService) http.Handler {
+	return NewWebhookHandler(service, p.purchaseRepo, config.CryptoPayToken())
+}
+
+func invoiceStatus(invoice InvoiceResponse) database.PurchaseStatus {
+	switch invoice.Status {
+	case "paid":
+		return database.PurchaseStatusPaid
+	case "expired":
+		return database.PurchaseStatusCancel
+	default:
+		return database.PurchaseStatusPending
+	}
+}
+
+// ParsePayload extracts the purchase id and Telegram username from an invoice payload
+// built as "purchaseId=<id>&username=<name>".
+func ParsePayload(payload string) (purchaseID int64, username string, ok bool) {
+	values, err := url.ParseQuery(payload)
+	if err != nil {
+		return 0, "", false
+	}
+	purchaseID, err = strconv.ParseInt(values.Get("purchaseId"), 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return purchaseID, values.Get("username"), true
+}
@@ -0,0 +1,143 @@
+package cryptopay
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/webhook"
+)
+
+const signatureHeader = "crypto-pay-api-signature"
+
+type PurchaseProcessor interface {
+	ProcessPaidPurchase(ctx context.Context, purchaseID int64, amount float64, currency string) error
+}
+
+type WebhookHandler struct {
+	processor    PurchaseProcessor
+	purchaseRepo *database.PurchaseRepository
+	secret       []byte
+}
+
+// NewWebhookHandler verifies updates with the app token: CryptoPay signs the raw
+// body with HMAC-SHA-256 keyed by SHA-256 of the token.
+func NewWebhookHandler(processor PurchaseProcessor, purchaseRepo *database.PurchaseRepository, token string) *WebhookHandler {
+	secret := sha256.Sum256([]byte(token))
+	return &WebhookHandler{
+		processor:    processor,
+		purchaseRepo: purchaseRepo,
+		secret:       secret[:],
+	}
+}
+
+type webhookUpdate struct {
+	UpdateID   int64           `json:"update_id"`
+	UpdateType string          `json:"update_type"`
+	Payload    InvoiceResponse `json:"payload"`
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("cryptopay webhook: read body error", "error", err)
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	valid := h.validSignature(body, r.Header.Get(signatureHeader))
+	webhook.MarkSignature(ctx, valid)
+	if !valid {
+		slog.Warn("cryptopay webhook: invalid signature", "remote_addr", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var update webhookUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		slog.Error("cryptopay webhook: unmarshal error", "error", err)
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if update.UpdateType != "invoice_paid" || !update.Payload.IsPaid() {
+		slog.Debug("cryptopay webhook: ignored update", "update_type", update.UpdateType, "status", update.Payload.Status)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	purchaseID, username, ok := ParsePayload(update.Payload.Payload)
+	if !ok {
+		slog.Warn("cryptopay webhook: invalid invoice payload", "invoice_id", update.Payload.InvoiceID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	purchase, err := h.purchaseRepo.FindById(ctx, purchaseID)
+	if err != nil {
+		slog.Error("cryptopay webhook: find purchase failed", "purchase_id", purchaseID, "error", err)
+		webhook.RecordError(ctx, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if purchase == nil || purchase.CryptoInvoiceID == nil || update.Payload.InvoiceID == nil || *purchase.CryptoInvoiceID != *update.Payload.InvoiceID {
+		slog.Warn("cryptopay webhook: purchase not found for invoice", "purchase_id", purchaseID, "invoice_id", update.Payload.InvoiceID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	webhook.LinkPurchase(ctx, purchaseID)
+
+	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusCancel || purchase.Status == database.PurchaseStatusRefunded || purchase.Status == database.PurchaseStatusReview {
+		slog.Info("cryptopay webhook: purchase already finalized", "purchase_id", purchaseID, "status", purchase.Status)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	amount, currency, err := update.Payload.Price()
+	if err != nil {
+		slog.Error("cryptopay webhook: invalid invoice price", "purchase_id", purchaseID, "error", err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, username)
+	if err := h.processor.ProcessPaidPurchase(ctxWithUsername, purchaseID, amount, currency); err != nil {
+		if errors.Is(err, payment.ErrPaymentMismatch) {
+			slog.Warn("cryptopay webhook: payment held for review", "purchase_id", purchaseID, "error", err)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		slog.Error("cryptopay webhook: process purchase failed", "purchase_id", purchaseID, "error", err)
+		webhook.RecordError(ctx, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *WebhookHandler) validSignature(body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,89 @@
+package cryptopay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(token, body string) string {
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandler_ValidSignature(t *testing.T) {
+	h := NewWebhookHandler(nil, nil, "token")
+	body := []byte(`{"update_id":1}`)
+
+	if !h.validSignature(body, sign("token", string(body))) {
+		t.Fatalf("expected signature to be valid")
+	}
+	if h.validSignature(body, sign("other", string(body))) {
+		t.Fatalf("signature with another token must be rejected")
+	}
+	if h.validSignature(body, "not-hex") || h.validSignature(body, "") {
+		t.Fatalf("malformed signature must be rejected")
+	}
+}
+
+func TestWebhookHandler_RejectsUnsignedRequest(t *testing.T) {
+	h := NewWebhookHandler(nil, nil, "token")
+	body := `{"update_type":"invoice_paid","payload":{"status":"paid","payload":"purchaseId=1&username=u"}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/cryptopay", strings.NewReader(body))
+	req.Header.Set(signatureHeader, sign("wrong", body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestWebhookHandler_IgnoresOtherUpdates(t *testing.T) {
+	h := NewWebhookHandler(nil, nil, "token")
+	body := `{"update_type":"invoice_created","payload":{"status":"active"}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/cryptopay", strings.NewReader(body))
+	req.Header.Set(signatureHeader, sign("token", body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestParsePayload(t *testing.T) {
+	id, username, ok := ParsePayload("purchaseId=42&username=alice")
+	if !ok || id != 42 || username != "alice" {
+		t.Fatalf("unexpected result: %d %q %v", id, username, ok)
+	}
+	if _, _, ok := ParsePayload("purchaseId=abc"); ok {
+		t.Fatalf("expected invalid purchase id to fail")
+	}
+}
+
+func TestInvoiceResponsePrice(t *testing.T) {
+	fiat := InvoiceResponse{CurrencyType: "fiat", Fiat: "RUB", Asset: "USDT", Amount: "199"}
+	amount, currency, err := fiat.Price()
+	if err != nil || amount != 199 || currency != "RUB" {
+		t.Fatalf("fiat invoice price = %v %q %v, want 199 RUB", amount, currency, err)
+	}
+
+	crypto := InvoiceResponse{CurrencyType: "crypto", Asset: "USDT", Amount: "2.5"}
+	amount, currency, err = crypto.Price()
+	if err != nil || amount != 2.5 || currency != "USDT" {
+		t.Fatalf("crypto invoice price = %v %q %v, want 2.5 USDT", amount, currency, err)
+	}
+
+	if _, _, err := (InvoiceResponse{Amount: "abc"}).Price(); err == nil {
+		t.Fatalf("expected error for invalid amount")
+	}
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type BalanceReason string
+
+const (
+	BalanceReasonTopUp        BalanceReason = "topup"
+	BalanceReasonPurchase     BalanceReason = "purchase"
+	BalanceReasonRefund       BalanceReason = "refund"
+	BalanceReasonTopUpRefund  BalanceReason = "topup_refund"
+	BalanceReasonReferral     BalanceReason = "referral"
+	BalanceReasonCompensation BalanceReason = "compensation"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// BalanceTransaction is an entry of the customer's balance ledger. Credits are
+// positive, debits negative; the balance is the sum of all entries.
+type BalanceTransaction struct {
+	ID         int64         `db:"id"`
+	CustomerID int64         `db:"customer_id"`
+	Amount     float64       `db:"amount"`
+	Reason     BalanceReason `db:"reason"`
+	PurchaseID *int64        `db:"purchase_id"`
+	Comment    *string       `db:"comment"`
+	CreatedAt  time.Time     `db:"created_at"`
+}
+
+type BalanceRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBalanceRepository(pool *pgxpool.Pool) *BalanceRepository {
+	return &BalanceRepository{pool: pool}
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func (r *BalanceRepository) Balance(ctx context.Context, customerID int64) (float64, error) {
+	return balance(ctx, r.pool, customerID)
+}
+
+func balance(ctx context.Context, q queryRower, customerID int64) (float64, error) {
+	sql, args, err := sq.Select("COALESCE(SUM(amount), 0)").
+		From("balance_transaction").
+		Where(sq.Eq{"customer_id": customerID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build balance query: %w", err)
+	}
+
+	var amount float64
+	if err := q.QueryRow(ctx, sql, args...).Scan(&amount); err != nil {
+		return 0, fmt.Errorf("query balance: %w", err)
+	}
+	return amount, nil
+}
+
+// Credit adds the entry to the ledger. Entries tied to a purchase are recorded once
+// per reason, so it reports false when the entry already exists.
+func (r *BalanceRepository) Credit(ctx context.Context, entry *BalanceTransaction) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	applied, err := insertBalanceTransaction(ctx, tx, entry)
+	if err != nil {
+		return false, err
+	}
+	return applied, tx.Commit(ctx)
+}
+
+// CreditTx is Credit inside the given transaction.
+func (r *BalanceRepository) CreditTx(ctx context.Context, tx pgx.Tx, entry *BalanceTransaction) (bool, error) {
+	return insertBalanceTransaction(ctx, tx, entry)
+}
+
+// DebitTx takes amount from the customer's balance in the given transaction. The
+// customer row is locked so concurrent debits cannot overdraw the balance. It
+// returns ErrInsufficientBalance when the balance does not cover amount.
+func (r *BalanceRepository) DebitTx(ctx context.Context, tx pgx.Tx, entry *BalanceTransaction) error {
+	sql, args, err := sq.Select("id").
+		From("customer").
+		Where(sq.Eq{"id": entry.CustomerID}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build lock customer query: %w", err)
+	}
+	var id int64
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return fmt.Errorf("lock customer: %w", err)
+	}
+
+	current, err := balance(ctx, tx, entry.CustomerID)
+	if err != nil {
+		return err
+	}
+	if current < entry.Amount {
+		return ErrInsufficientBalance
+	}
+
+	debit := *entry
+	debit.Amount = -entry.Amount
+	if _, err := insertBalanceTransaction(ctx, tx, &debit); err != nil {
+		return err
+	}
+	return nil
+}
+
+func insertBalanceTransaction(ctx context.Context, tx pgx.Tx, entry *BalanceTransaction) (bool, error) {
+	sql, args, err := sq.Insert("balance_transaction").
+		Columns("customer_id", "amount", "reason", "purchase_id", "comment").
+		Values(entry.CustomerID, entry.Amount, entry.Reason, entry.PurchaseID, entry.Comment).
+		Suffix("ON CONFLICT (customer_id, reason, purchase_id) WHERE purchase_id IS NOT NULL DO NOTHING").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build insert balance transaction query: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("insert balance transaction: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
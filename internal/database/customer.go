@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"log/slog"
@@ -21,16 +22,19 @@ func NewCustomerRepository(poll *pgxpool.Pool) *CustomerRepository {
 }
 
 type Customer struct {
-	ID               int64      `db:"id"`
-	TelegramID       int64      `db:"telegram_id"`
-	ExpireAt         *time.Time `db:"expire_at"`
-	CreatedAt        time.Time  `db:"created_at"`
-	SubscriptionLink *string    `db:"subscription_link"`
-	Language         string     `db:"language"`
+	ID                     int64      `db:"id"`
+	TelegramID             int64      `db:"telegram_id"`
+	ExpireAt               *time.Time `db:"expire_at"`
+	CreatedAt              time.Time  `db:"created_at"`
+	SubscriptionLink       *string    `db:"subscription_link"`
+	Language               string     `db:"language"`
+	YookasaPaymentMethodID *uuid.UUID `db:"yookasa_payment_method_id"`
+	AutoRenew              bool       `db:"auto_renew"`
+	RemnawaveUUID          *uuid.UUID `db:"remnawave_uuid"`
 }
 
 func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDate, endDate time.Time) (*[]Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "yookasa_payment_method_id", "auto_renew", "remnawave_uuid").
 		From("customer").
 		Where(
 			sq.And{
@@ -62,6 +66,9 @@ func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDa
 			&customer.CreatedAt,
 			&customer.SubscriptionLink,
 			&customer.Language,
+			&customer.YookasaPaymentMethodID,
+			&customer.AutoRenew,
+			&customer.RemnawaveUUID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan customer row: %w", err)
@@ -77,7 +84,7 @@ func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDa
 }
 
 func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "yookasa_payment_method_id", "auto_renew", "remnawave_uuid").
 		From("customer").
 		Where(sq.Eq{"id": id}).
 		PlaceholderFormat(sq.Dollar)
@@ -96,6 +103,9 @@ func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer
 		&customer.CreatedAt,
 		&customer.SubscriptionLink,
 		&customer.Language,
+		&customer.YookasaPaymentMethodID,
+		&customer.AutoRenew,
+		&customer.RemnawaveUUID,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -107,7 +117,7 @@ func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer
 }
 
 func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId int64) (*Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "yookasa_payment_method_id", "auto_renew", "remnawave_uuid").
 		From("customer").
 		Where(sq.Eq{"telegram_id": telegramId}).
 		PlaceholderFormat(sq.Dollar)
@@ -126,6 +136,44 @@ func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId i
 		&customer.CreatedAt,
 		&customer.SubscriptionLink,
 		&customer.Language,
+		&customer.YookasaPaymentMethodID,
+		&customer.AutoRenew,
+		&customer.RemnawaveUUID,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query customer: %w", err)
+	}
+	return &customer, nil
+}
+
+// FindByRemnawaveUUID returns the customer linked to the Remnawave user, nil when
+// there is none.
+func (cr *CustomerRepository) FindByRemnawaveUUID(ctx context.Context, userUUID uuid.UUID) (*Customer, error) {
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "yookasa_payment_method_id", "auto_renew", "remnawave_uuid").
+		From("customer").
+		Where(sq.Eq{"remnawave_uuid": userUUID}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := buildSelect.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var customer Customer
+
+	err = cr.pool.QueryRow(ctx, sql, args...).Scan(
+		&customer.ID,
+		&customer.TelegramID,
+		&customer.ExpireAt,
+		&customer.CreatedAt,
+		&customer.SubscriptionLink,
+		&customer.Language,
+		&customer.YookasaPaymentMethodID,
+		&customer.AutoRenew,
+		&customer.RemnawaveUUID,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -145,7 +193,7 @@ func (cr *CustomerRepository) FindOrCreate(ctx context.Context, customer *Custom
 		INSERT INTO customer (telegram_id, expire_at, language)
 		VALUES ($1, $2, $3)
 		ON CONFLICT (telegram_id) DO UPDATE SET telegram_id = customer.telegram_id
-		RETURNING id, telegram_id, expire_at, created_at, subscription_link, language
+		RETURNING id, telegram_id, expire_at, created_at, subscription_link, language, yookasa_payment_method_id, auto_renew, remnawave_uuid
 	`
 
 	row := cr.pool.QueryRow(ctx, query, customer.TelegramID, customer.ExpireAt, customer.Language)
@@ -157,6 +205,9 @@ func (cr *CustomerRepository) FindOrCreate(ctx context.Context, customer *Custom
 		&result.CreatedAt,
 		&result.SubscriptionLink,
 		&result.Language,
+		&result.YookasaPaymentMethodID,
+		&result.AutoRenew,
+		&result.RemnawaveUUID,
 	); err != nil {
 		return nil, fmt.Errorf("failed to find or create customer: %w", err)
 	}
@@ -207,8 +258,37 @@ func (cr *CustomerRepository) UpdateFields(ctx context.Context, id int64, update
 	return nil
 }
 
+// UpdateFieldsTx applies updates to the customer inside an existing transaction.
+func (cr *CustomerRepository) UpdateFieldsTx(ctx context.Context, tx pgx.Tx, id int64, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	buildUpdate := sq.Update("customer").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"id": id})
+
+	for field, value := range updates {
+		buildUpdate = buildUpdate.Set(field, value)
+	}
+
+	sql, args, err := buildUpdate.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update query: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update customer: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("no customer found with id: %s", utils.MaskHalfInt64(id))
+	}
+	return nil
+}
+
 func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs []int64) ([]Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "yookasa_payment_method_id", "auto_renew", "remnawave_uuid").
 		From("customer").
 		Where(sq.Eq{"telegram_id": telegramIDs}).
 		PlaceholderFormat(sq.Dollar)
@@ -234,6 +314,9 @@ func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs
 			&customer.CreatedAt,
 			&customer.SubscriptionLink,
 			&customer.Language,
+			&customer.YookasaPaymentMethodID,
+			&customer.AutoRenew,
+			&customer.RemnawaveUUID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan customer row: %w", err)
@@ -252,10 +335,10 @@ func (cr *CustomerRepository) CreateBatch(ctx context.Context, customers []Custo
 		return nil
 	}
 	builder := sq.Insert("customer").
-		Columns("telegram_id", "expire_at", "language", "subscription_link").
+		Columns("telegram_id", "expire_at", "language", "subscription_link", "remnawave_uuid").
 		PlaceholderFormat(sq.Dollar)
 	for _, cust := range customers {
-		builder = builder.Values(cust.TelegramID, cust.ExpireAt, cust.Language, cust.SubscriptionLink)
+		builder = builder.Values(cust.TelegramID, cust.ExpireAt, cust.Language, cust.SubscriptionLink, cust.RemnawaveUUID)
 	}
 	sqlStr, args, err := builder.ToSql()
 	if err != nil {
@@ -285,16 +368,16 @@ func (cr *CustomerRepository) UpdateBatch(ctx context.Context, customers []Custo
 	if len(customers) == 0 {
 		return nil
 	}
-	query := "UPDATE customer SET expire_at = c.expire_at, subscription_link = c.subscription_link FROM (VALUES "
+	query := "UPDATE customer SET expire_at = c.expire_at, subscription_link = c.subscription_link, remnawave_uuid = COALESCE(c.remnawave_uuid, customer.remnawave_uuid) FROM (VALUES "
 	var args []interface{}
 	for i, cust := range customers {
 		if i > 0 {
 			query += ", "
 		}
-		query += fmt.Sprintf("($%d::bigint, $%d::timestamp, $%d::text)", i*3+1, i*3+2, i*3+3)
-		args = append(args, cust.TelegramID, cust.ExpireAt, cust.SubscriptionLink)
+		query += fmt.Sprintf("($%d::bigint, $%d::timestamp, $%d::text, $%d::uuid)", i*4+1, i*4+2, i*4+3, i*4+4)
+		args = append(args, cust.TelegramID, cust.ExpireAt, cust.SubscriptionLink, cust.RemnawaveUUID)
 	}
-	query += ") AS c(telegram_id, expire_at, subscription_link) WHERE customer.telegram_id = c.telegram_id"
+	query += ") AS c(telegram_id, expire_at, subscription_link, remnawave_uuid) WHERE customer.telegram_id = c.telegram_id"
 
 	tx, err := cr.pool.Begin(ctx)
 	if err != nil {
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var (
+	ErrGiftNotFound        = errors.New("gift not found")
+	ErrGiftAlreadyRedeemed = errors.New("gift already redeemed")
+)
+
+// Gift is the subscription period bought by CustomerID for someone else. It is
+// created when the gift purchase is paid and redeemed once with its code.
+type Gift struct {
+	ID         int64      `db:"id"`
+	Code       string     `db:"code"`
+	PurchaseID int64      `db:"purchase_id"`
+	CustomerID int64      `db:"customer_id"`
+	Days       int        `db:"days"`
+	RedeemedBy *int64     `db:"redeemed_by"`
+	RedeemedAt *time.Time `db:"redeemed_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+const giftColumns = "id, code, purchase_id, customer_id, days, redeemed_by, redeemed_at, revoked_at, created_at"
+
+type GiftRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewGiftRepository(pool *pgxpool.Pool) *GiftRepository {
+	return &GiftRepository{pool: pool}
+}
+
+func scanGift(row pgx.Row, g *Gift) error {
+	return row.Scan(
+		&g.ID, &g.Code, &g.PurchaseID, &g.CustomerID, &g.Days,
+		&g.RedeemedBy, &g.RedeemedAt, &g.RevokedAt, &g.CreatedAt,
+	)
+}
+
+// CreateTx stores the gift in the transaction that marks its purchase paid.
+func (r *GiftRepository) CreateTx(ctx context.Context, tx pgx.Tx, gift *Gift) error {
+	sql, args, err := sq.Insert("gift").
+		Columns("code", "purchase_id", "customer_id", "days").
+		Values(gift.Code, gift.PurchaseID, gift.CustomerID, gift.Days).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert gift query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert gift: %w", err)
+	}
+	return nil
+}
+
+func (r *GiftRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*Gift, error) {
+	sql, args, err := sq.Select(giftColumns).
+		From("gift").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select gift query: %w", err)
+	}
+
+	gift := &Gift{}
+	if err := scanGift(r.pool.QueryRow(ctx, sql, args...), gift); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query gift: %w", err)
+	}
+	return gift, nil
+}
+
+// RedeemWith locks the gift with the given code, runs apply and marks the gift
+// redeemed by the customer. Nothing is recorded when apply fails, so the code stays
+// usable. Revoked gifts are reported as not found.
+func (r *GiftRepository) RedeemWith(ctx context.Context, code string, customerID int64, apply func(gift *Gift) error) (*Gift, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Select(giftColumns).
+		From("gift").
+		Where(sq.Eq{"code": strings.ToUpper(strings.TrimSpace(code))}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build lock gift query: %w", err)
+	}
+
+	gift := &Gift{}
+	if err := scanGift(tx.QueryRow(ctx, sql, args...), gift); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrGiftNotFound
+		}
+		return nil, fmt.Errorf("lock gift: %w", err)
+	}
+	if gift.RevokedAt != nil {
+		return nil, ErrGiftNotFound
+	}
+	if gift.RedeemedAt != nil {
+		return nil, ErrGiftAlreadyRedeemed
+	}
+
+	if err := apply(gift); err != nil {
+		return nil, err
+	}
+
+	sql, args, err = sq.Update("gift").
+		Set("redeemed_by", customerID).
+		Set("redeemed_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": gift.ID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build redeem gift query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return nil, fmt.Errorf("redeem gift: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	gift.RedeemedBy = &customerID
+	return gift, nil
+}
+
+// RevokeTx makes the gift of a refunded purchase impossible to redeem and returns
+// it, nil when the purchase has no gift. The update waits for a redemption in
+// progress, so the returned gift shows whether it was redeemed.
+func (r *GiftRepository) RevokeTx(ctx context.Context, tx pgx.Tx, purchaseID int64) (*Gift, error) {
+	sql, args, err := sq.Update("gift").
+		Set("revoked_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		Suffix("RETURNING " + giftColumns).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build revoke gift query: %w", err)
+	}
+
+	gift := &Gift{}
+	if err := scanGift(tx.QueryRow(ctx, sql, args...), gift); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("revoke gift: %w", err)
+	}
+	return gift, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ErrLinkResetCooldown is returned when the customer reset the subscription link
+// too recently.
+var ErrLinkResetCooldown = errors.New("subscription link was reset recently")
+
+// ErrLinkResetNotSaved is returned when the link was reset but the new link and
+// the reset could not be stored. The returned LinkReset holds the new link, so it
+// can be stored again with Save.
+var ErrLinkResetNotSaved = errors.New("subscription link reset is not saved")
+
+// LinkReset records a subscription link the customer revoked and the link that
+// replaced it.
+type LinkReset struct {
+	ID         int64     `db:"id"`
+	CustomerID int64     `db:"customer_id"`
+	OldLink    *string   `db:"old_link"`
+	NewLink    string    `db:"new_link"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type LinkResetRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewLinkResetRepository(pool *pgxpool.Pool) *LinkResetRepository {
+	return &LinkResetRepository{pool: pool}
+}
+
+// LastResetAt returns when the customer last reset the subscription link, nil when
+// it never did.
+func (r *LinkResetRepository) LastResetAt(ctx context.Context, customerID int64) (*time.Time, error) {
+	return lastLinkResetAt(ctx, r.pool, customerID)
+}
+
+// ResetWith locks the customer and, unless the link was reset within cooldown,
+// runs reset for the new link. The customer's link is replaced and the reset is
+// recorded in the same transaction. When that fails after reset succeeded, the
+// reset is returned with ErrLinkResetNotSaved, because the old link no longer
+// works.
+func (r *LinkResetRepository) ResetWith(ctx context.Context, customerID int64, cooldown time.Duration, reset func() (string, error)) (*LinkReset, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Select("subscription_link").
+		From("customer").
+		Where(sq.Eq{"id": customerID}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build lock customer query: %w", err)
+	}
+
+	linkReset := &LinkReset{CustomerID: customerID}
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&linkReset.OldLink); err != nil {
+		return nil, fmt.Errorf("lock customer: %w", err)
+	}
+
+	last, err := lastLinkResetAt(ctx, tx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && time.Since(*last) < cooldown {
+		return nil, ErrLinkResetCooldown
+	}
+
+	linkReset.NewLink, err = reset()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := saveLinkResetTx(ctx, tx, linkReset); err != nil {
+		return linkReset, fmt.Errorf("%w: %w", ErrLinkResetNotSaved, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return linkReset, fmt.Errorf("%w: commit transaction: %w", ErrLinkResetNotSaved, err)
+	}
+	return linkReset, nil
+}
+
+// Save stores a reset that ResetWith returned with ErrLinkResetNotSaved.
+func (r *LinkResetRepository) Save(ctx context.Context, linkReset *LinkReset) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := saveLinkResetTx(ctx, tx, linkReset); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func saveLinkResetTx(ctx context.Context, tx pgx.Tx, linkReset *LinkReset) error {
+	sql, args, err := sq.Insert("subscription_link_reset").
+		Columns("customer_id", "old_link", "new_link").
+		Values(linkReset.CustomerID, linkReset.OldLink, linkReset.NewLink).
+		Suffix("RETURNING id, created_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert link reset query: %w", err)
+	}
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&linkReset.ID, &linkReset.CreatedAt); err != nil {
+		return fmt.Errorf("insert link reset: %w", err)
+	}
+
+	sql, args, err = sq.Update("customer").
+		Set("subscription_link", linkReset.NewLink).
+		Where(sq.Eq{"id": linkReset.CustomerID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build update customer link query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update customer link: %w", err)
+	}
+	return nil
+}
+
+func lastLinkResetAt(ctx context.Context, db queryRower, customerID int64) (*time.Time, error) {
+	sql, args, err := sq.Select("MAX(created_at)").
+		From("subscription_link_reset").
+		Where(sq.Eq{"customer_id": customerID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build last link reset query: %w", err)
+	}
+
+	var last *time.Time
+	if err := db.QueryRow(ctx, sql, args...).Scan(&last); err != nil {
+		return nil, fmt.Errorf("query last link reset: %w", err)
+	}
+	return last, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLinkResetWithConcurrentClicks(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	var customerID int64
+	err := pool.QueryRow(ctx, "INSERT INTO customer (telegram_id, subscription_link) VALUES ($1, 'old') RETURNING id", nextTestTelegramID()).Scan(&customerID)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	repo := NewLinkResetRepository(pool)
+	var revoked atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.ResetWith(ctx, customerID, time.Hour, func() (string, error) {
+				return fmt.Sprintf("new-%d", revoked.Add(1)), nil
+			})
+			if err != nil && !errors.Is(err, ErrLinkResetCooldown) {
+				t.Errorf("reset link: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if revoked.Load() != 1 {
+		t.Fatalf("expected one revoke within the cooldown, got %d", revoked.Load())
+	}
+
+	customer, err := NewCustomerRepository(pool).FindById(ctx, customerID)
+	if err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+	if customer.SubscriptionLink == nil || *customer.SubscriptionLink != "new-1" {
+		t.Fatalf("expected the new link to be stored, got %v", customer.SubscriptionLink)
+	}
+
+	last, err := repo.LastResetAt(ctx, customerID)
+	if err != nil || last == nil {
+		t.Fatalf("expected the reset to be recorded, got %v, %v", last, err)
+	}
+}
+
+func TestLinkResetWithFailedRevokeIsNotRecorded(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	var customerID int64
+	err := pool.QueryRow(ctx, "INSERT INTO customer (telegram_id) VALUES ($1) RETURNING id", nextTestTelegramID()).Scan(&customerID)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	repo := NewLinkResetRepository(pool)
+	revokeErr := errors.New("panel unavailable")
+	if _, err := repo.ResetWith(ctx, customerID, time.Hour, func() (string, error) { return "", revokeErr }); !errors.Is(err, revokeErr) {
+		t.Fatalf("expected the revoke error, got %v", err)
+	}
+
+	last, err := repo.LastResetAt(ctx, customerID)
+	if err != nil || last != nil {
+		t.Fatalf("expected no recorded reset, got %v, %v", last, err)
+	}
+}
+
+func TestLinkResetWithFailedSaveReturnsTheNewLink(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	var customerID int64
+	err := pool.QueryRow(ctx, "INSERT INTO customer (telegram_id, subscription_link) VALUES ($1, 'old') RETURNING id", nextTestTelegramID()).Scan(&customerID)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	repo := NewLinkResetRepository(pool)
+	resetCtx, cancel := context.WithCancel(ctx)
+	linkReset, err := repo.ResetWith(resetCtx, customerID, time.Hour, func() (string, error) {
+		cancel()
+		return "new", nil
+	})
+	if !errors.Is(err, ErrLinkResetNotSaved) || linkReset == nil || linkReset.NewLink != "new" {
+		t.Fatalf("expected the new link with ErrLinkResetNotSaved, got %v, %v", linkReset, err)
+	}
+
+	if err := repo.Save(ctx, linkReset); err != nil {
+		t.Fatalf("save link reset: %v", err)
+	}
+	customer, err := NewCustomerRepository(pool).FindById(ctx, customerID)
+	if err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+	if customer.SubscriptionLink == nil || *customer.SubscriptionLink != "new" {
+		t.Fatalf("expected the saved link to be stored, got %v", customer.SubscriptionLink)
+	}
+	if last, err := repo.LastResetAt(ctx, customerID); err != nil || last == nil {
+		t.Fatalf("expected the reset to be recorded, got %v, %v", last, err)
+	}
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type OutboxJobStatus string
+
+const (
+	OutboxJobStatusPending OutboxJobStatus = "pending"
+	OutboxJobStatusRunning OutboxJobStatus = "running"
+	OutboxJobStatusDone    OutboxJobStatus = "done"
+	OutboxJobStatusDead    OutboxJobStatus = "dead"
+)
+
+// OutboxJob is a side effect recorded together with the database change that caused
+// it and executed later by the outbox worker.
+type OutboxJob struct {
+	ID          int64           `db:"id"`
+	Kind        string          `db:"kind"`
+	Payload     json.RawMessage `db:"payload"`
+	Status      OutboxJobStatus `db:"status"`
+	Attempts    int             `db:"attempts"`
+	MaxAttempts int             `db:"max_attempts"`
+	RunAt       time.Time       `db:"run_at"`
+	LockedUntil *time.Time      `db:"locked_until"`
+	LastError   *string         `db:"last_error"`
+	CreatedAt   time.Time       `db:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at"`
+}
+
+const outboxJobColumns = "id, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error, created_at, updated_at"
+
+type OutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewOutboxRepository(pool *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{pool: pool}
+}
+
+func scanOutboxJob(row pgx.Row, j *OutboxJob) error {
+	return row.Scan(
+		&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.RunAt, &j.LockedUntil, &j.LastError, &j.CreatedAt, &j.UpdatedAt,
+	)
+}
+
+// EnqueueTx stores a job in the given transaction, so it is only visible to the
+// worker once the surrounding change is committed.
+func (r *OutboxRepository) EnqueueTx(ctx context.Context, tx pgx.Tx, kind string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal outbox payload: %w", err)
+	}
+
+	sql, args, err := sq.Insert("outbox_job").
+		Columns("kind", "payload").
+		Values(kind, body).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert outbox job query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert outbox job: %w", err)
+	}
+	return nil
+}
+
+// Claim locks up to limit due jobs for lockFor and returns them. Jobs whose lock
+// expired, for example because the process died while running them, are claimed
+// again. Concurrent workers never receive the same job.
+func (r *OutboxRepository) Claim(ctx context.Context, limit int, lockFor time.Duration) ([]OutboxJob, error) {
+	query := `UPDATE outbox_job
+SET status = $1, attempts = attempts + 1, locked_until = NOW() + $2 * INTERVAL '1 second', updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM outbox_job
+    WHERE (status = $3 AND run_at <= NOW()) OR (status = $1 AND locked_until < NOW())
+    ORDER BY run_at
+    LIMIT $4
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING ` + outboxJobColumns
+
+	rows, err := r.pool.Query(ctx, query, OutboxJobStatusRunning, lockFor.Seconds(), OutboxJobStatusPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []OutboxJob
+	for rows.Next() {
+		var job OutboxJob
+		if err := scanOutboxJob(rows, &job); err != nil {
+			return nil, fmt.Errorf("scan outbox job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outbox jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (r *OutboxRepository) Complete(ctx context.Context, id int64) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":       OutboxJobStatusDone,
+		"locked_until": nil,
+		"last_error":   nil,
+	})
+}
+
+// Fail records the error and schedules the job to run again at retryAt. A nil
+// retryAt moves the job to the dead status, where it waits for a manual retry.
+func (r *OutboxRepository) Fail(ctx context.Context, id int64, jobErr string, retryAt *time.Time) error {
+	updates := map[string]interface{}{
+		"status":       OutboxJobStatusDead,
+		"locked_until": nil,
+		"last_error":   jobErr,
+	}
+	if retryAt != nil {
+		updates["status"] = OutboxJobStatusPending
+		updates["run_at"] = *retryAt
+	}
+	return r.update(ctx, id, updates)
+}
+
+// Retry moves a dead job back to pending with a fresh attempt budget. It reports
+// false when no dead job with the given id exists.
+func (r *OutboxRepository) Retry(ctx context.Context, id int64) (bool, error) {
+	sql, args, err := sq.Update("outbox_job").
+		Set("status", OutboxJobStatusPending).
+		Set("attempts", 0).
+		Set("run_at", sq.Expr("NOW()")).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id, "status": OutboxJobStatusDead}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build retry outbox job query: %w", err)
+	}
+
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("retry outbox job: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *OutboxRepository) FindByStatus(ctx context.Context, status OutboxJobStatus, limit uint64) ([]OutboxJob, error) {
+	sql, args, err := sq.Select(outboxJobColumns).
+		From("outbox_job").
+		Where(sq.Eq{"status": status}).
+		OrderBy("updated_at DESC").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select outbox jobs query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query outbox jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []OutboxJob
+	for rows.Next() {
+		var job OutboxJob
+		if err := scanOutboxJob(rows, &job); err != nil {
+			return nil, fmt.Errorf("scan outbox job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outbox jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (r *OutboxRepository) update(ctx context.Context, id int64, updates map[string]interface{}) error {
+	builder := sq.Update("outbox_job").
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar)
+	for field, value := range updates {
+		builder = builder.Set(field, value)
+	}
+
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		return fmt.Errorf("build update outbox job query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update outbox job %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PanelGrant is the change a paid purchase makes to the customer's Remnawave user.
+// It is recorded when the purchase is marked paid and applied to the panel after
+// that commit. The target expiry or traffic limit is fixed before the first panel
+// call, so applying the grant again sets the same values instead of adding the
+// purchase twice.
+type PanelGrant struct {
+	PurchaseID   int64      `db:"purchase_id"`
+	CustomerID   int64      `db:"customer_id"`
+	ExpireAt     *time.Time `db:"expire_at"`
+	TrafficLimit *int64     `db:"traffic_limit"`
+	AppliedAt    *time.Time `db:"applied_at"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+const panelGrantColumns = "purchase_id, customer_id, expire_at, traffic_limit, applied_at, created_at"
+
+// Outbox job kinds that change panel users, see payment.JobPanelGrant,
+// payment.JobPanelRevoke and payment.JobReferralBonus.
+const (
+	panelGrantJobKind    = "panel_grant"
+	panelRevokeJobKind   = "panel_revoke"
+	referralBonusJobKind = "referral_bonus"
+)
+
+// notDeadLettered leaves out the rows whose outbox job, found by the purchase id in
+// column, is dead. They stay unapplied until the admin retries the job, which the
+// dead job alert asks for, and would otherwise hold back every later change of the
+// customer's panel user.
+func notDeadLettered(column, kind string) sq.Sqlizer {
+	return sq.Expr(
+		"NOT EXISTS (SELECT 1 FROM outbox_job j WHERE j.kind = ? AND j.status = ? AND (j.payload->>'purchase_id')::bigint = "+column+")",
+		kind, OutboxJobStatusDead,
+	)
+}
+
+type PanelGrantRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPanelGrantRepository(pool *pgxpool.Pool) *PanelGrantRepository {
+	return &PanelGrantRepository{pool: pool}
+}
+
+func scanPanelGrant(row pgx.Row, g *PanelGrant) error {
+	return row.Scan(&g.PurchaseID, &g.CustomerID, &g.ExpireAt, &g.TrafficLimit, &g.AppliedAt, &g.CreatedAt)
+}
+
+// CreateTx records the grant in the transaction that marks its purchase paid.
+func (r *PanelGrantRepository) CreateTx(ctx context.Context, tx pgx.Tx, purchaseID, customerID int64) error {
+	sql, args, err := sq.Insert("panel_grant").
+		Columns("purchase_id", "customer_id").
+		Values(purchaseID, customerID).
+		Suffix("ON CONFLICT (purchase_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert panel grant query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert panel grant: %w", err)
+	}
+	return nil
+}
+
+func (r *PanelGrantRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*PanelGrant, error) {
+	sql, args, err := sq.Select(panelGrantColumns).
+		From("panel_grant").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select panel grant query: %w", err)
+	}
+
+	grant := &PanelGrant{}
+	if err := scanPanelGrant(r.pool.QueryRow(ctx, sql, args...), grant); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query panel grant: %w", err)
+	}
+	return grant, nil
+}
+
+// HasPendingBefore reports whether the customer has a grant of an earlier purchase
+// that is not applied yet. Grants are applied in purchase order, because each one
+// extends the expiry the previous one set.
+func (r *PanelGrantRepository) HasPendingBefore(ctx context.Context, customerID, purchaseID int64) (bool, error) {
+	sql, args, err := sq.Select("1").
+		From("panel_grant").
+		Where(sq.And{
+			sq.Eq{"customer_id": customerID},
+			sq.Eq{"applied_at": nil},
+			sq.Lt{"purchase_id": purchaseID},
+			notDeadLettered("panel_grant.purchase_id", panelGrantJobKind),
+		}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build select pending panel grants query: %w", err)
+	}
+
+	var pending bool
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&pending); err != nil {
+		return false, fmt.Errorf("query pending panel grants: %w", err)
+	}
+	return pending, nil
+}
+
+// HasPendingCreatedBefore reports whether the customer has a grant recorded before
+// the given time that is not applied yet. A revoke waits for them, so it takes its
+// days from the expiry they set.
+func (r *PanelGrantRepository) HasPendingCreatedBefore(ctx context.Context, customerID int64, before time.Time) (bool, error) {
+	sql, args, err := sq.Select("1").
+		From("panel_grant").
+		Where(sq.And{
+			sq.Eq{"customer_id": customerID},
+			sq.Eq{"applied_at": nil},
+			sq.Lt{"created_at": before},
+			notDeadLettered("panel_grant.purchase_id", panelGrantJobKind),
+		}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build select pending panel grants query: %w", err)
+	}
+
+	var pending bool
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&pending); err != nil {
+		return false, fmt.Errorf("query pending panel grants: %w", err)
+	}
+	return pending, nil
+}
+
+// SetTarget stores the expiry and traffic limit the grant sets on the panel. A
+// target that is already stored is kept, so the values computed before the first
+// panel call win over ones computed after a retry, and the stored grant is
+// returned.
+func (r *PanelGrantRepository) SetTarget(ctx context.Context, purchaseID int64, expireAt *time.Time, trafficLimit *int64) (*PanelGrant, error) {
+	sql, args, err := sq.Update("panel_grant").
+		Set("expire_at", sq.Expr("COALESCE(expire_at, ?)", expireAt)).
+		Set("traffic_limit", sq.Expr("COALESCE(traffic_limit, ?)", trafficLimit)).
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		Suffix("RETURNING " + panelGrantColumns).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build update panel grant query: %w", err)
+	}
+
+	grant := &PanelGrant{}
+	if err := scanPanelGrant(r.pool.QueryRow(ctx, sql, args...), grant); err != nil {
+		return nil, fmt.Errorf("update panel grant: %w", err)
+	}
+	return grant, nil
+}
+
+// ApplyWith runs apply and marks the grant applied in the same transaction, so
+// the customer fields apply stores and the applied mark are committed together.
+func (r *PanelGrantRepository) ApplyWith(ctx context.Context, purchaseID int64, apply func(tx pgx.Tx) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := apply(tx); err != nil {
+		return err
+	}
+
+	sql, args, err := sq.Update("panel_grant").
+		Set("applied_at", sq.Expr("NOW()")).
+		Where(sq.And{
+			sq.Eq{"purchase_id": purchaseID},
+			sq.Eq{"applied_at": nil},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build apply panel grant query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("apply panel grant: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
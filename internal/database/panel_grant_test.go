@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestPanelGrantKeepsFirstTargetAndAppliesInOrder(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewPanelGrantRepository(pool)
+
+	first := createTestPurchase(t, pool, PurchaseStatusPaid)
+	var customerID int64
+	if err := pool.QueryRow(ctx, "SELECT customer_id FROM purchase WHERE id = $1", first).Scan(&customerID); err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+	second, err := NewPurchaseRepository(pool).Create(ctx, &Purchase{
+		Amount:      100,
+		CustomerID:  customerID,
+		Month:       1,
+		Currency:    "RUB",
+		Status:      PurchaseStatusPaid,
+		InvoiceType: InvoiceTypeYookasa,
+	})
+	if err != nil {
+		t.Fatalf("create purchase: %v", err)
+	}
+
+	for _, id := range []int64{first, second} {
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		if err := repo.CreateTx(ctx, tx, id, customerID); err != nil {
+			t.Fatalf("create grant: %v", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+
+	target := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+	if _, err := repo.SetTarget(ctx, first, &target, nil); err != nil {
+		t.Fatalf("set target: %v", err)
+	}
+	later := target.Add(30 * 24 * time.Hour)
+	grant, err := repo.SetTarget(ctx, first, &later, nil)
+	if err != nil {
+		t.Fatalf("set target again: %v", err)
+	}
+	if grant.ExpireAt == nil || !grant.ExpireAt.Equal(target) {
+		t.Fatalf("expected the first target to be kept, got %v", grant.ExpireAt)
+	}
+
+	if pending, err := repo.HasPendingBefore(ctx, customerID, second); err != nil || !pending {
+		t.Fatalf("expected the first grant to block the second, got %v, %v", pending, err)
+	}
+	if err := repo.ApplyWith(ctx, first, func(tx pgx.Tx) error { return nil }); err != nil {
+		t.Fatalf("apply grant: %v", err)
+	}
+	if pending, err := repo.HasPendingBefore(ctx, customerID, second); err != nil || pending {
+		t.Fatalf("expected no pending grant after applying the first, got %v, %v", pending, err)
+	}
+}
+
+func TestPanelGrantDeadLetteredDoesNotBlock(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewPanelGrantRepository(pool)
+
+	first := createTestPurchase(t, pool, PurchaseStatusPaid)
+	var customerID int64
+	if err := pool.QueryRow(ctx, "SELECT customer_id FROM purchase WHERE id = $1", first).Scan(&customerID); err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if err := repo.CreateTx(ctx, tx, first, customerID); err != nil {
+		t.Fatalf("create grant: %v", err)
+	}
+	if err := NewOutboxRepository(pool).EnqueueTx(ctx, tx, panelGrantJobKind, map[string]int64{"purchase_id": first}); err != nil {
+		t.Fatalf("enqueue grant job: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	if pending, err := repo.HasPendingBefore(ctx, customerID, first+1); err != nil || !pending {
+		t.Fatalf("expected the pending grant to block, got %v, %v", pending, err)
+	}
+	if _, err := pool.Exec(ctx, "UPDATE outbox_job SET status = $1 WHERE kind = $2 AND (payload->>'purchase_id')::bigint = $3", OutboxJobStatusDead, panelGrantJobKind, first); err != nil {
+		t.Fatalf("dead-letter job: %v", err)
+	}
+	if pending, err := repo.HasPendingBefore(ctx, customerID, first+1); err != nil || pending {
+		t.Fatalf("expected the dead-lettered grant not to block, got %v, %v", pending, err)
+	}
+	if pending, err := repo.HasPendingCreatedBefore(ctx, customerID, time.Now().Add(time.Minute)); err != nil || pending {
+		t.Fatalf("expected the dead-lettered grant not to block revokes, got %v, %v", pending, err)
+	}
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PanelRevoke takes a purchase's days back from the customer's Remnawave user
+// after the purchase was cancelled or refunded. Like PanelGrant, the target expiry
+// is fixed before the first panel call, so applying it again does not take the
+// days twice.
+type PanelRevoke struct {
+	PurchaseID int64      `db:"purchase_id"`
+	CustomerID int64      `db:"customer_id"`
+	Days       int        `db:"days"`
+	ExpireAt   *time.Time `db:"expire_at"`
+	AppliedAt  *time.Time `db:"applied_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+const panelRevokeColumns = "purchase_id, customer_id, days, expire_at, applied_at, created_at"
+
+type PanelRevokeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPanelRevokeRepository(pool *pgxpool.Pool) *PanelRevokeRepository {
+	return &PanelRevokeRepository{pool: pool}
+}
+
+func scanPanelRevoke(row pgx.Row, r *PanelRevoke) error {
+	return row.Scan(&r.PurchaseID, &r.CustomerID, &r.Days, &r.ExpireAt, &r.AppliedAt, &r.CreatedAt)
+}
+
+// CreateTx records the revoke in the transaction that cancels or refunds its
+// purchase.
+func (r *PanelRevokeRepository) CreateTx(ctx context.Context, tx pgx.Tx, purchaseID, customerID int64, days int) error {
+	sql, args, err := sq.Insert("panel_revoke").
+		Columns("purchase_id", "customer_id", "days").
+		Values(purchaseID, customerID, days).
+		Suffix("ON CONFLICT (purchase_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert panel revoke query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert panel revoke: %w", err)
+	}
+	return nil
+}
+
+func (r *PanelRevokeRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*PanelRevoke, error) {
+	sql, args, err := sq.Select(panelRevokeColumns).
+		From("panel_revoke").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select panel revoke query: %w", err)
+	}
+
+	revoke := &PanelRevoke{}
+	if err := scanPanelRevoke(r.pool.QueryRow(ctx, sql, args...), revoke); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query panel revoke: %w", err)
+	}
+	return revoke, nil
+}
+
+// HasPendingBefore reports whether the customer has a revoke recorded before the
+// given time that is not applied yet. A grant recorded later sets an expiry that
+// the revoke would otherwise overwrite.
+func (r *PanelRevokeRepository) HasPendingBefore(ctx context.Context, customerID int64, before time.Time) (bool, error) {
+	sql, args, err := sq.Select("1").
+		From("panel_revoke").
+		Where(sq.And{
+			sq.Eq{"customer_id": customerID},
+			sq.Eq{"applied_at": nil},
+			sq.Lt{"created_at": before},
+			notDeadLettered("panel_revoke.purchase_id", panelRevokeJobKind),
+		}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build select pending panel revokes query: %w", err)
+	}
+
+	var pending bool
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&pending); err != nil {
+		return false, fmt.Errorf("query pending panel revokes: %w", err)
+	}
+	return pending, nil
+}
+
+// SetTarget stores the expiry the revoke sets on the panel. A target that is
+// already stored is kept, and the stored revoke is returned.
+func (r *PanelRevokeRepository) SetTarget(ctx context.Context, purchaseID int64, expireAt time.Time) (*PanelRevoke, error) {
+	sql, args, err := sq.Update("panel_revoke").
+		Set("expire_at", sq.Expr("COALESCE(expire_at, ?)", expireAt)).
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		Suffix("RETURNING " + panelRevokeColumns).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build update panel revoke query: %w", err)
+	}
+
+	revoke := &PanelRevoke{}
+	if err := scanPanelRevoke(r.pool.QueryRow(ctx, sql, args...), revoke); err != nil {
+		return nil, fmt.Errorf("update panel revoke: %w", err)
+	}
+	return revoke, nil
+}
+
+// ApplyWith runs apply and marks the revoke applied in the same transaction.
+func (r *PanelRevokeRepository) ApplyWith(ctx context.Context, purchaseID int64, apply func(tx pgx.Tx) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := apply(tx); err != nil {
+		return err
+	}
+
+	sql, args, err := sq.Update("panel_revoke").
+		Set("applied_at", sq.Expr("NOW()")).
+		Where(sq.And{
+			sq.Eq{"purchase_id": purchaseID},
+			sq.Eq{"applied_at": nil},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build apply panel revoke query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("apply panel revoke: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestPanelRevokeKeepsFirstTargetAndWaitsForEarlierGrants(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	grants := NewPanelGrantRepository(pool)
+	revokes := NewPanelRevokeRepository(pool)
+
+	purchaseID := createTestPurchase(t, pool, PurchaseStatusPaid)
+	var customerID int64
+	if err := pool.QueryRow(ctx, "SELECT customer_id FROM purchase WHERE id = $1", purchaseID).Scan(&customerID); err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+
+	for _, create := range []func(tx pgx.Tx) error{
+		func(tx pgx.Tx) error { return grants.CreateTx(ctx, tx, purchaseID, customerID) },
+		func(tx pgx.Tx) error { return revokes.CreateTx(ctx, tx, purchaseID, customerID, 30) },
+	} {
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		if err := create(tx); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+
+	revoke, err := revokes.FindByPurchaseID(ctx, purchaseID)
+	if err != nil || revoke == nil || revoke.Days != 30 {
+		t.Fatalf("expected the revoke to be recorded, got %+v, %v", revoke, err)
+	}
+	if pending, err := grants.HasPendingCreatedBefore(ctx, customerID, revoke.CreatedAt); err != nil || !pending {
+		t.Fatalf("expected the grant to block the revoke, got %v, %v", pending, err)
+	}
+
+	target := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	if _, err := revokes.SetTarget(ctx, purchaseID, target); err != nil {
+		t.Fatalf("set target: %v", err)
+	}
+	revoke, err = revokes.SetTarget(ctx, purchaseID, target.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("set target again: %v", err)
+	}
+	if revoke.ExpireAt == nil || !revoke.ExpireAt.Equal(target) {
+		t.Fatalf("expected the first target to be kept, got %v", revoke.ExpireAt)
+	}
+
+	if err := revokes.ApplyWith(ctx, purchaseID, func(tx pgx.Tx) error { return nil }); err != nil {
+		t.Fatalf("apply revoke: %v", err)
+	}
+	if pending, err := revokes.HasPendingBefore(ctx, customerID, time.Now().Add(time.Hour)); err != nil || pending {
+		t.Fatalf("expected no pending revoke after applying it, got %v, %v", pending, err)
+	}
+}
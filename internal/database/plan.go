@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const bytesInGigabyte = 1 << 30
+
+// Plan is a tariff of the catalog. Prices are per currency, a nil price means the
+// plan is not sold in that currency. Nil access fields fall back to the global
+// configuration.
+type Plan struct {
+	ID             int64      `db:"id"`
+	Name           string     `db:"name"`
+	Days           int        `db:"days"`
+	PriceRUB       *int       `db:"price_rub"`
+	PriceStars     *int       `db:"price_stars"`
+	PriceCrypto    *int       `db:"price_crypto"`
+	TrafficLimitGB *int       `db:"traffic_limit_gb"`
+	ResetStrategy  *string    `db:"reset_strategy"`
+	InternalSquads []string   `db:"internal_squads"`
+	ExternalSquad  *uuid.UUID `db:"external_squad"`
+	Visible        bool       `db:"visible"`
+	SortOrder      int        `db:"sort_order"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// Price returns the price of the plan for a provider. CryptoPay invoices use the
+// crypto price when it is set and fall back to rubles otherwise.
+func (p *Plan) Price(invoiceType InvoiceType, currency string) (int, bool) {
+	price := p.PriceRUB
+	switch {
+	case currency == "STARS":
+		price = p.PriceStars
+	case invoiceType == InvoiceTypeCrypto && p.PriceCrypto != nil:
+		price = p.PriceCrypto
+	}
+	if price == nil || *price <= 0 {
+		return 0, false
+	}
+	return *price, true
+}
+
+// TrafficLimitBytes returns the traffic limit of the plan in bytes.
+func (p *Plan) TrafficLimitBytes() (int, bool) {
+	if p.TrafficLimitGB == nil {
+		return 0, false
+	}
+	return *p.TrafficLimitGB * bytesInGigabyte, true
+}
+
+const planColumns = "id, name, days, price_rub, price_stars, price_crypto, traffic_limit_gb, reset_strategy, internal_squads, external_squad, visible, sort_order, created_at"
+
+type PlanRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPlanRepository(pool *pgxpool.Pool) *PlanRepository {
+	return &PlanRepository{pool: pool}
+}
+
+func scanPlan(row pgx.Row, p *Plan) error {
+	return row.Scan(
+		&p.ID, &p.Name, &p.Days, &p.PriceRUB, &p.PriceStars, &p.PriceCrypto,
+		&p.TrafficLimitGB, &p.ResetStrategy, &p.InternalSquads, &p.ExternalSquad,
+		&p.Visible, &p.SortOrder, &p.CreatedAt,
+	)
+}
+
+func (r *PlanRepository) FindByID(ctx context.Context, id int64) (*Plan, error) {
+	sql, args, err := sq.Select(planColumns).
+		From("plan").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select plan query: %w", err)
+	}
+
+	plan := &Plan{}
+	if err := scanPlan(r.pool.QueryRow(ctx, sql, args...), plan); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query plan: %w", err)
+	}
+	return plan, nil
+}
+
+// FindVisible returns the plans shown to customers in catalog order.
+func (r *PlanRepository) FindVisible(ctx context.Context) ([]Plan, error) {
+	sql, args, err := sq.Select(planColumns).
+		From("plan").
+		Where(sq.Eq{"visible": true}).
+		OrderBy("sort_order", "days", "id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select plans query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query plans: %w", err)
+	}
+	defer rows.Close()
+
+	var plans []Plan
+	for rows.Next() {
+		var plan Plan
+		if err := scanPlan(rows, &plan); err != nil {
+			return nil, fmt.Errorf("scan plan: %w", err)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// SeedIfEmpty stores the given plans when the catalog has none yet, so the catalog
+// starts from the legacy price configuration. It reports whether plans were stored.
+func (r *PlanRepository) SeedIfEmpty(ctx context.Context, plans []Plan) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Concurrent instances seed once: the lock is held until the transaction ends.
+	if _, err := tx.Exec(ctx, "LOCK TABLE plan IN EXCLUSIVE MODE"); err != nil {
+		return false, fmt.Errorf("lock plan table: %w", err)
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM plan)").Scan(&exists); err != nil {
+		return false, fmt.Errorf("check plans: %w", err)
+	}
+	if exists || len(plans) == 0 {
+		return false, nil
+	}
+
+	insert := sq.Insert("plan").
+		Columns("name", "days", "price_rub", "price_stars", "price_crypto", "traffic_limit_gb", "reset_strategy", "internal_squads", "external_squad", "visible", "sort_order")
+	for _, p := range plans {
+		insert = insert.Values(p.Name, p.Days, p.PriceRUB, p.PriceStars, p.PriceCrypto, p.TrafficLimitGB, p.ResetStrategy, p.InternalSquads, p.ExternalSquad, p.Visible, p.SortOrder)
+	}
+	sql, args, err := insert.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build insert plans query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return false, fmt.Errorf("insert plans: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return true, nil
+}
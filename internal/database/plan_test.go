@@ -0,0 +1,54 @@
+package database
+
+import "testing"
+
+func TestPlan_Price(t *testing.T) {
+	plan := &Plan{PriceRUB: intPtr(100), PriceStars: intPtr(70)}
+	withCrypto := &Plan{PriceRUB: intPtr(100), PriceCrypto: intPtr(90)}
+	starsOnly := &Plan{PriceStars: intPtr(70)}
+
+	tests := []struct {
+		name        string
+		plan        *Plan
+		invoiceType InvoiceType
+		currency    string
+		want        int
+		wantOK      bool
+	}{
+		{"rubles", plan, InvoiceTypeYookasa, "RUB", 100, true},
+		{"stars", plan, InvoiceTypeTelegram, "STARS", 70, true},
+		{"crypto falls back to rubles", plan, InvoiceTypeCrypto, "RUB", 100, true},
+		{"crypto price", withCrypto, InvoiceTypeCrypto, "RUB", 90, true},
+		{"crypto price only for cryptopay", withCrypto, InvoiceTypePlategaCrypto, "RUB", 100, true},
+		{"no stars price", withCrypto, InvoiceTypeTelegram, "STARS", 0, false},
+		{"no rubles price", starsOnly, InvoiceTypeYookasa, "RUB", 0, false},
+		{"zero price", &Plan{PriceRUB: intPtr(0)}, InvoiceTypeYookasa, "RUB", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.plan.Price(tt.invoiceType, tt.currency)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Price() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPurchase_Days(t *testing.T) {
+	tests := []struct {
+		name     string
+		purchase Purchase
+		want     int
+	}{
+		{"legacy months", Purchase{Month: 3, BonusDays: 2}, 92},
+		{"plan duration", Purchase{Month: 0, DurationDays: 7, BonusDays: 1}, 8},
+		{"plan duration wins over months", Purchase{Month: 1, DurationDays: 45}, 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.purchase.Days(30); got != tt.want {
+				t.Errorf("Days() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
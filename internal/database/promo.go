@@ -0,0 +1,396 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PromoType string
+
+const (
+	PromoTypePercent    PromoType = "percent"
+	PromoTypeFixed      PromoType = "fixed"
+	PromoTypeBonusDays  PromoType = "bonus_days"
+	PromoTypeFreePeriod PromoType = "free_period"
+)
+
+var (
+	ErrPromoNotFound    = errors.New("promo code not found")
+	ErrPromoNotActive   = errors.New("promo code is not valid at this time")
+	ErrPromoExhausted   = errors.New("promo code usage limit reached")
+	ErrPromoAlreadyUsed = errors.New("promo code already used by customer")
+)
+
+// PromoCode is a discount or bonus created by the admin. Value is a percent for
+// percent codes, an amount in RUB for fixed codes and a number of days for bonus
+// and free period codes.
+type PromoCode struct {
+	ID           int64      `db:"id"`
+	Code         string     `db:"code"`
+	Type         PromoType  `db:"type"`
+	Value        int        `db:"value"`
+	MaxUses      *int       `db:"max_uses"`
+	PerUserLimit int        `db:"per_user_limit"`
+	UsedCount    int        `db:"used_count"`
+	PlanID       *int64     `db:"plan_id"`
+	ValidFrom    *time.Time `db:"valid_from"`
+	ValidUntil   *time.Time `db:"valid_until"`
+	CreatedAt    time.Time  `db:"created_at"`
+}
+
+const promoCodeColumns = "id, code, type, value, max_uses, per_user_limit, used_count, valid_from, valid_until, created_at, plan_id"
+
+// NormalizePromoCode makes codes case-insensitive.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate reports whether the customer, who already redeemed the code
+// customerRedemptions times, may use it at now.
+func (p *PromoCode) Validate(now time.Time, customerRedemptions int) error {
+	if p.ValidFrom != nil && now.Before(*p.ValidFrom) {
+		return ErrPromoNotActive
+	}
+	if p.ValidUntil != nil && now.After(*p.ValidUntil) {
+		return ErrPromoNotActive
+	}
+	return p.checkLimits(customerRedemptions)
+}
+
+// checkLimits reports whether the code may be used once more by a customer who
+// already redeemed it customerRedemptions times.
+func (p *PromoCode) checkLimits(customerRedemptions int) error {
+	if p.MaxUses != nil && p.UsedCount >= *p.MaxUses {
+		return ErrPromoExhausted
+	}
+	if customerRedemptions >= p.PerUserLimit {
+		return ErrPromoAlreadyUsed
+	}
+	return nil
+}
+
+// Apply returns the price and bonus days of a purchase of the given plan paid with
+// the code. It reports false when the code does not apply to the purchase: free
+// period codes are not tied to purchases, plan restricted codes only apply to their
+// plan and fixed discounts only to RUB prices. Discounts never bring the price
+// below one currency unit because providers reject empty invoices.
+func (p *PromoCode) Apply(amount float64, planID *int64, currency string) (float64, int, bool) {
+	if p.PlanID != nil && (planID == nil || *planID != *p.PlanID) {
+		return amount, 0, false
+	}
+
+	switch p.Type {
+	case PromoTypePercent:
+		return math.Max(1, math.Round(amount*float64(100-p.Value)/100)), 0, true
+	case PromoTypeFixed:
+		if currency != "RUB" {
+			return amount, 0, false
+		}
+		return math.Max(1, amount-float64(p.Value)), 0, true
+	case PromoTypeBonusDays:
+		return amount, p.Value, true
+	default:
+		return amount, 0, false
+	}
+}
+
+type PromoRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPromoRepository(pool *pgxpool.Pool) *PromoRepository {
+	return &PromoRepository{pool: pool}
+}
+
+func scanPromoCode(row pgx.Row, p *PromoCode) error {
+	return row.Scan(
+		&p.ID, &p.Code, &p.Type, &p.Value, &p.MaxUses, &p.PerUserLimit,
+		&p.UsedCount, &p.ValidFrom, &p.ValidUntil, &p.CreatedAt, &p.PlanID,
+	)
+}
+
+func (r *PromoRepository) Create(ctx context.Context, promo *PromoCode) (int64, error) {
+	sql, args, err := sq.Insert("promo_code").
+		Columns("code", "type", "value", "max_uses", "per_user_limit", "plan_id", "valid_from", "valid_until").
+		Values(NormalizePromoCode(promo.Code), promo.Type, promo.Value, promo.MaxUses, promo.PerUserLimit, promo.PlanID, promo.ValidFrom, promo.ValidUntil).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build insert promo code query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("insert promo code: %w", err)
+	}
+	return id, nil
+}
+
+func (r *PromoRepository) FindByCode(ctx context.Context, code string) (*PromoCode, error) {
+	return r.findOne(ctx, sq.Select(promoCodeColumns).
+		From("promo_code").
+		Where(sq.Eq{"code": NormalizePromoCode(code)}))
+}
+
+// FindActivated returns the code the customer activated but has not paid with yet.
+func (r *PromoRepository) FindActivated(ctx context.Context, customerID int64) (*PromoCode, error) {
+	return r.findOne(ctx, sq.Select(prefixColumns("p", promoCodeColumns)).
+		From("promo_code p").
+		Join("promo_activation a ON a.promo_code_id = p.id").
+		Where(sq.And{
+			sq.Eq{"a.customer_id": customerID},
+			sq.Eq{"a.redeemed_at": nil},
+		}).
+		OrderBy("a.activated_at DESC").
+		Limit(1))
+}
+
+func (r *PromoRepository) findOne(ctx context.Context, query sq.SelectBuilder) (*PromoCode, error) {
+	sql, args, err := query.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select promo code query: %w", err)
+	}
+
+	promo := &PromoCode{}
+	if err := scanPromoCode(r.pool.QueryRow(ctx, sql, args...), promo); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query promo code: %w", err)
+	}
+	return promo, nil
+}
+
+func (r *PromoRepository) FindRecent(ctx context.Context, limit int) ([]PromoCode, error) {
+	sql, args, err := sq.Select(promoCodeColumns).
+		From("promo_code").
+		OrderBy("created_at DESC").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select promo codes query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query promo codes: %w", err)
+	}
+	defer rows.Close()
+
+	var promos []PromoCode
+	for rows.Next() {
+		var promo PromoCode
+		if err := scanPromoCode(rows, &promo); err != nil {
+			return nil, fmt.Errorf("scan promo code: %w", err)
+		}
+		promos = append(promos, promo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate promo codes: %w", err)
+	}
+	return promos, nil
+}
+
+// CountRedemptions returns how many times the customer has used the code.
+func (r *PromoRepository) CountRedemptions(ctx context.Context, promoID, customerID int64) (int, error) {
+	return countRedemptions(ctx, r.pool, promoID, customerID)
+}
+
+func countRedemptions(ctx context.Context, q queryRower, promoID, customerID int64) (int, error) {
+	sql, args, err := sq.Select("COUNT(*)").
+		From("promo_activation").
+		Where(sq.And{
+			sq.Eq{"promo_code_id": promoID},
+			sq.Eq{"customer_id": customerID},
+			sq.NotEq{"redeemed_at": nil},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build count redemptions query: %w", err)
+	}
+
+	var count int
+	if err := q.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count redemptions: %w", err)
+	}
+	return count, nil
+}
+
+// Activate remembers the code for the customer's next purchase, replacing a code
+// activated earlier.
+func (r *PromoRepository) Activate(ctx context.Context, promoID, customerID int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Delete("promo_activation").
+		Where(sq.And{
+			sq.Eq{"customer_id": customerID},
+			sq.Eq{"redeemed_at": nil},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build delete activations query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("delete activations: %w", err)
+	}
+
+	sql, args, err = sq.Insert("promo_activation").
+		Columns("promo_code_id", "customer_id").
+		Values(promoID, customerID).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert activation query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert activation: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RedeemTx locks the code and records that the customer used it, marking their
+// pending activation as redeemed by the purchase. It reports false when the
+// redemption goes over the code's max uses or per-user limit, which concurrent
+// payments of invoices issued with the same code can do. The redemption is
+// recorded anyway: the customer has already paid the discounted price, so the
+// purchase is honoured and the caller reports the overuse.
+func (r *PromoRepository) RedeemTx(ctx context.Context, tx pgx.Tx, promoID, customerID int64, purchaseID *int64) (bool, error) {
+	sql, args, err := sq.Select(promoCodeColumns).
+		From("promo_code").
+		Where(sq.Eq{"id": promoID}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build lock promo code query: %w", err)
+	}
+
+	promo := &PromoCode{}
+	if err := scanPromoCode(tx.QueryRow(ctx, sql, args...), promo); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrPromoNotFound
+		}
+		return false, fmt.Errorf("lock promo code: %w", err)
+	}
+	redemptions, err := countRedemptions(ctx, tx, promoID, customerID)
+	if err != nil {
+		return false, err
+	}
+	withinLimits := promo.checkLimits(redemptions) == nil
+
+	sql, args, err = sq.Update("promo_activation").
+		Set("redeemed_at", sq.Expr("NOW()")).
+		Set("purchase_id", purchaseID).
+		Where(sq.And{
+			sq.Eq{"promo_code_id": promoID},
+			sq.Eq{"customer_id": customerID},
+			sq.Eq{"redeemed_at": nil},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build redeem activation query: %w", err)
+	}
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("redeem activation: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		sql, args, err = sq.Insert("promo_activation").
+			Columns("promo_code_id", "customer_id", "purchase_id", "redeemed_at").
+			Values(promoID, customerID, purchaseID, sq.Expr("NOW()")).
+			PlaceholderFormat(sq.Dollar).
+			ToSql()
+		if err != nil {
+			return false, fmt.Errorf("build insert redemption query: %w", err)
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return false, fmt.Errorf("insert redemption: %w", err)
+		}
+	}
+
+	sql, args, err = sq.Update("promo_code").
+		Set("used_count", sq.Expr("used_count + 1")).
+		Where(sq.Eq{"id": promoID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build increment usage query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return false, fmt.Errorf("increment promo usage: %w", err)
+	}
+	return withinLimits, nil
+}
+
+// RedeemWith locks the code, validates it for the customer and runs apply before
+// recording the redemption, so concurrent redemptions cannot exceed the limits.
+// Nothing is recorded when apply fails.
+func (r *PromoRepository) RedeemWith(ctx context.Context, promoID, customerID int64, apply func(promo *PromoCode) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Select(promoCodeColumns).
+		From("promo_code").
+		Where(sq.Eq{"id": promoID}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build lock promo code query: %w", err)
+	}
+
+	promo := &PromoCode{}
+	if err := scanPromoCode(tx.QueryRow(ctx, sql, args...), promo); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPromoNotFound
+		}
+		return fmt.Errorf("lock promo code: %w", err)
+	}
+
+	redemptions, err := countRedemptions(ctx, tx, promoID, customerID)
+	if err != nil {
+		return err
+	}
+	if err := promo.Validate(time.Now(), redemptions); err != nil {
+		return err
+	}
+
+	if err := apply(promo); err != nil {
+		return err
+	}
+	if _, err := r.RedeemTx(ctx, tx, promoID, customerID, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, c := range parts {
+		parts[i] = alias + "." + c
+	}
+	return strings.Join(parts, ", ")
+}
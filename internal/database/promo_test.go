@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int { return &v }
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestPromoCodeApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		promo     PromoCode
+		amount    float64
+		planID    *int64
+		currency  string
+		wantPrice float64
+		wantDays  int
+		wantOK    bool
+	}{
+		{"percent", PromoCode{Type: PromoTypePercent, Value: 25}, 199, int64Ptr(1), "RUB", 149, 0, true},
+		{"percent on stars", PromoCode{Type: PromoTypePercent, Value: 10}, 100, int64Ptr(1), "XTR", 90, 0, true},
+		{"fixed", PromoCode{Type: PromoTypeFixed, Value: 50}, 199, int64Ptr(1), "RUB", 149, 0, true},
+		{"fixed keeps minimum", PromoCode{Type: PromoTypeFixed, Value: 500}, 199, int64Ptr(1), "RUB", 1, 0, true},
+		{"fixed skips stars", PromoCode{Type: PromoTypeFixed, Value: 50}, 100, int64Ptr(1), "XTR", 100, 0, false},
+		{"bonus days", PromoCode{Type: PromoTypeBonusDays, Value: 7}, 199, int64Ptr(1), "RUB", 199, 7, true},
+		{"other plan", PromoCode{Type: PromoTypePercent, Value: 25, PlanID: int64Ptr(3)}, 199, int64Ptr(1), "RUB", 199, 0, false},
+		{"no plan", PromoCode{Type: PromoTypePercent, Value: 25, PlanID: int64Ptr(3)}, 199, nil, "RUB", 199, 0, false},
+		{"matching plan", PromoCode{Type: PromoTypePercent, Value: 50, PlanID: int64Ptr(3)}, 500, int64Ptr(3), "RUB", 250, 0, true},
+		{"free period", PromoCode{Type: PromoTypeFreePeriod, Value: 7}, 199, int64Ptr(1), "RUB", 199, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, days, ok := tt.promo.Apply(tt.amount, tt.planID, tt.currency)
+			if price != tt.wantPrice || days != tt.wantDays || ok != tt.wantOK {
+				t.Fatalf("Apply() = %v, %d, %v; want %v, %d, %v", price, days, ok, tt.wantPrice, tt.wantDays, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPromoCodeValidate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		promo       PromoCode
+		redemptions int
+		want        error
+	}{
+		{"valid", PromoCode{PerUserLimit: 1}, 0, nil},
+		{"not started", PromoCode{PerUserLimit: 1, ValidFrom: &after}, 0, ErrPromoNotActive},
+		{"expired", PromoCode{PerUserLimit: 1, ValidUntil: &before}, 0, ErrPromoNotActive},
+		{"in window", PromoCode{PerUserLimit: 1, ValidFrom: &before, ValidUntil: &after}, 0, nil},
+		{"exhausted", PromoCode{PerUserLimit: 1, MaxUses: intPtr(5), UsedCount: 5}, 0, ErrPromoExhausted},
+		{"used by customer", PromoCode{PerUserLimit: 2}, 2, ErrPromoAlreadyUsed},
+		{"per user limit left", PromoCode{PerUserLimit: 2}, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.promo.Validate(now, tt.redemptions); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeemTxReportsRedemptionsOverTheLimit(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	repo := NewPromoRepository(pool)
+	code := fmt.Sprintf("LIMIT%d", -nextTestTelegramID())
+	promoID, err := repo.Create(ctx, &PromoCode{
+		Code:         code,
+		Type:         PromoTypePercent,
+		Value:        10,
+		MaxUses:      intPtr(1),
+		PerUserLimit: 1,
+	})
+	if err != nil {
+		t.Fatalf("create promo code: %v", err)
+	}
+
+	var within []bool
+	for i := 0; i < 2; i++ {
+		purchaseID := createTestPurchase(t, pool, PurchaseStatusPaid)
+		var customerID int64
+		if err := pool.QueryRow(ctx, "SELECT customer_id FROM purchase WHERE id = $1", purchaseID).Scan(&customerID); err != nil {
+			t.Fatalf("find customer: %v", err)
+		}
+
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("begin: %v", err)
+		}
+		ok, err := repo.RedeemTx(ctx, tx, promoID, customerID, &purchaseID)
+		if err != nil {
+			t.Fatalf("redeem: %v", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		within = append(within, ok)
+	}
+
+	if !within[0] || within[1] {
+		t.Fatalf("expected only the second redemption over the limit, got %v", within)
+	}
+	promo, err := repo.FindByCode(ctx, code)
+	if err != nil {
+		t.Fatalf("find promo code: %v", err)
+	}
+	if promo.UsedCount != 2 {
+		t.Fatalf("expected both paid redemptions to be counted, got %d", promo.UsedCount)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -15,26 +16,98 @@ import (
 type InvoiceType string
 
 const (
-	InvoiceTypeCrypto             InvoiceType = "crypto"
-	InvoiceTypeYookasa            InvoiceType = "yookasa"
-	InvoiceTypeTelegram           InvoiceType = "telegram"
-	InvoiceTypeTribute            InvoiceType = "tribute"
-	InvoiceTypePlategaSBP         InvoiceType = "plt_sbp"
-	InvoiceTypePlategaCards       InvoiceType = "plt_cards"
-	InvoiceTypePlategaAcquiring   InvoiceType = "plt_acq"
-	InvoiceTypePlategaWorldwide   InvoiceType = "plt_ww"
-	InvoiceTypePlategaCrypto      InvoiceType = "plt_crypto"
+	InvoiceTypeCrypto           InvoiceType = "crypto"
+	InvoiceTypeYookasa          InvoiceType = "yookasa"
+	InvoiceTypeTelegram         InvoiceType = "telegram"
+	InvoiceTypeTribute          InvoiceType = "tribute"
+	InvoiceTypePlategaSBP       InvoiceType = "plt_sbp"
+	InvoiceTypePlategaCards     InvoiceType = "plt_cards"
+	InvoiceTypePlategaAcquiring InvoiceType = "plt_acq"
+	InvoiceTypePlategaWorldwide InvoiceType = "plt_ww"
+	InvoiceTypePlategaCrypto    InvoiceType = "plt_crypto"
+	InvoiceTypeBalance          InvoiceType = "balance"
+)
+
+// PurchaseKind tells what the customer paid for. Gift purchases do not extend the
+// payer's subscription, they produce a gift code redeemed by someone else. Top-up
+// purchases credit the customer's balance. Traffic purchases raise the traffic limit
+// of the current subscription without extending it.
+type PurchaseKind string
+
+const (
+	PurchaseKindSubscription PurchaseKind = "subscription"
+	PurchaseKindGift         PurchaseKind = "gift"
+	PurchaseKindTopUp        PurchaseKind = "topup"
+	PurchaseKindTraffic      PurchaseKind = "traffic"
 )
 
 type PurchaseStatus string
 
 const (
-	PurchaseStatusNew     PurchaseStatus = "new"
-	PurchaseStatusPending PurchaseStatus = "pending"
-	PurchaseStatusPaid    PurchaseStatus = "paid"
-	PurchaseStatusCancel  PurchaseStatus = "cancel"
+	PurchaseStatusNew      PurchaseStatus = "new"
+	PurchaseStatusPending  PurchaseStatus = "pending"
+	PurchaseStatusPaid     PurchaseStatus = "paid"
+	PurchaseStatusCancel   PurchaseStatus = "cancel"
+	PurchaseStatusRefunded PurchaseStatus = "refunded"
+	PurchaseStatusReview   PurchaseStatus = "review"
 )
 
+// ErrInvalidTransition is returned when a purchase is asked to move to a status
+// that is not reachable from its current one.
+var ErrInvalidTransition = errors.New("invalid purchase status transition")
+
+// purchaseTransitions lists the statuses a purchase may move to from each status.
+// Payments whose amount does not match the purchase are held for review until the
+// admin approves or cancels them.
+var purchaseTransitions = map[PurchaseStatus][]PurchaseStatus{
+	PurchaseStatusNew:     {PurchaseStatusPending, PurchaseStatusCancel},
+	PurchaseStatusPending: {PurchaseStatusPaid, PurchaseStatusCancel, PurchaseStatusReview},
+	PurchaseStatusReview:  {PurchaseStatusPaid, PurchaseStatusCancel},
+	PurchaseStatusPaid:    {PurchaseStatusRefunded},
+}
+
+// lockedTransitions are only allowed through TransitionWith, whose caller sees the
+// locked purchase and undoes what was granted for it. Paid purchases are cancelled
+// this way when a Tribute subscription is revoked after it was paid.
+var lockedTransitions = map[PurchaseStatus][]PurchaseStatus{
+	PurchaseStatusPaid: {PurchaseStatusCancel},
+}
+
+func (s PurchaseStatus) CanTransitionTo(to PurchaseStatus) bool {
+	for _, next := range purchaseTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s PurchaseStatus) canTransitionLockedTo(to PurchaseStatus) bool {
+	if s.CanTransitionTo(to) {
+		return true
+	}
+	for _, next := range lockedTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// previousStatuses returns every status from which Transition may reach to.
+func previousStatuses(to PurchaseStatus) []PurchaseStatus {
+	var from []PurchaseStatus
+	for status, next := range purchaseTransitions {
+		for _, n := range next {
+			if n == to {
+				from = append(from, status)
+			}
+		}
+	}
+	sort.Slice(from, func(i, j int) bool { return from[i] < from[j] })
+	return from
+}
+
 type Purchase struct {
 	ID                int64          `db:"id"`
 	Amount            float64        `db:"amount"`
@@ -52,6 +125,38 @@ type Purchase struct {
 	YookasaID         *uuid.UUID     `db:"yookasa_id"`
 	PlategaID         *string        `db:"platega_id"`
 	PlategaURL        *string        `db:"platega_url"`
+	TelegramChargeID  *string        `db:"telegram_charge_id"`
+	MoynalogReceiptID *string        `db:"moynalog_receipt_uuid"`
+	PromoCodeID       *int64         `db:"promo_code_id"`
+	DiscountAmount    float64        `db:"discount_amount"`
+	BonusDays         int            `db:"bonus_days"`
+	Kind              PurchaseKind   `db:"kind"`
+	PlanID            *int64         `db:"plan_id"`
+	DurationDays      int            `db:"duration_days"`
+	TrafficGB         int            `db:"traffic_gb"`
+	TributeEventID    *string        `db:"tribute_event_id"`
+	// TelegramPaidAmount and TelegramPaidCurrency record what Telegram reported as
+	// charged with TelegramChargeID, so a retried Stars payment is checked against
+	// the charge instead of the purchase itself.
+	TelegramPaidAmount   *float64 `db:"telegram_paid_amount"`
+	TelegramPaidCurrency *string  `db:"telegram_paid_currency"`
+	// RefundRequestedAt is set before the provider is asked to return the money,
+	// so a refund whose recording failed is not sent to the provider again.
+	RefundRequestedAt *time.Time `db:"refund_requested_at"`
+}
+
+// Days returns the subscription days the purchase grants, including promo bonus days.
+// Purchases made before plans were introduced only record months.
+func (p *Purchase) Days(daysInMonth int) int {
+	if p.DurationDays > 0 {
+		return p.DurationDays + p.BonusDays
+	}
+	return p.Month*daysInMonth + p.BonusDays
+}
+
+// TrafficBytes returns the extra traffic of a traffic purchase in bytes.
+func (p *Purchase) TrafficBytes() int64 {
+	return int64(p.TrafficGB) * bytesInGigabyte
 }
 
 type PurchaseRepository struct {
@@ -64,10 +169,22 @@ func NewPurchaseRepository(pool *pgxpool.Pool) *PurchaseRepository {
 	}
 }
 
+func scanPurchase(row pgx.Row, p *Purchase) error {
+	return row.Scan(
+		&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
+		&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
+		&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
+		&p.PlategaID, &p.PlategaURL, &p.TelegramChargeID, &p.MoynalogReceiptID,
+		&p.PromoCodeID, &p.DiscountAmount, &p.BonusDays, &p.Kind,
+		&p.PlanID, &p.DurationDays, &p.TrafficGB, &p.TributeEventID,
+		&p.TelegramPaidAmount, &p.TelegramPaidCurrency, &p.RefundRequestedAt,
+	)
+}
+
 func (cr *PurchaseRepository) Create(ctx context.Context, purchase *Purchase) (int64, error) {
 	buildInsert := sq.Insert("purchase").
-		Columns("amount", "customer_id", "month", "currency", "expire_at", "status", "invoice_type", "crypto_invoice_id", "crypto_invoice_url", "yookasa_url", "yookasa_id", "platega_id", "platega_url").
-		Values(purchase.Amount, purchase.CustomerID, purchase.Month, purchase.Currency, purchase.ExpireAt, purchase.Status, purchase.InvoiceType, purchase.CryptoInvoiceID, purchase.CryptoInvoiceLink, purchase.YookasaURL, purchase.YookasaID, purchase.PlategaID, purchase.PlategaURL).
+		Columns("amount", "customer_id", "month", "currency", "expire_at", "status", "invoice_type", "crypto_invoice_id", "crypto_invoice_url", "yookasa_url", "yookasa_id", "platega_id", "platega_url", "promo_code_id", "discount_amount", "bonus_days", "kind", "plan_id", "duration_days", "traffic_gb", "telegram_charge_id", "tribute_event_id", "telegram_paid_amount", "telegram_paid_currency").
+		Values(purchase.Amount, purchase.CustomerID, purchase.Month, purchase.Currency, purchase.ExpireAt, purchase.Status, purchase.InvoiceType, purchase.CryptoInvoiceID, purchase.CryptoInvoiceLink, purchase.YookasaURL, purchase.YookasaID, purchase.PlategaID, purchase.PlategaURL, purchase.PromoCodeID, purchase.DiscountAmount, purchase.BonusDays, purchase.Kind, purchase.PlanID, purchase.DurationDays, purchase.TrafficGB, purchase.TelegramChargeID, purchase.TributeEventID, purchase.TelegramPaidAmount, purchase.TelegramPaidCurrency).
 		Suffix("RETURNING id").
 		PlaceholderFormat(sq.Dollar)
 
@@ -108,24 +225,7 @@ func (cr *PurchaseRepository) FindByInvoiceTypeAndStatus(ctx context.Context, in
 	purchases := []Purchase{}
 	for rows.Next() {
 		purchase := Purchase{}
-		err = rows.Scan(
-			&purchase.ID,
-			&purchase.Amount,
-			&purchase.CustomerID,
-			&purchase.CreatedAt,
-			&purchase.Month,
-			&purchase.PaidAt,
-			&purchase.Currency,
-			&purchase.ExpireAt,
-			&purchase.Status,
-			&purchase.InvoiceType,
-			&purchase.CryptoInvoiceID,
-			&purchase.CryptoInvoiceLink,
-			&purchase.YookasaURL,
-			&purchase.YookasaID,
-			&purchase.PlategaID,
-			&purchase.PlategaURL,
-		)
+		err = scanPurchase(rows, &purchase)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan purchase: %w", err)
 		}
@@ -139,6 +239,80 @@ func (cr *PurchaseRepository) FindByInvoiceTypeAndStatus(ctx context.Context, in
 	return &purchases, nil
 }
 
+// FindByInvoiceTypeAndStatusCreatedBetween returns purchases of the given type and
+// status created within [from, to).
+func (cr *PurchaseRepository) FindByInvoiceTypeAndStatusCreatedBetween(ctx context.Context, invoiceType InvoiceType, status PurchaseStatus, from, to time.Time) ([]Purchase, error) {
+	sql, args, err := sq.Select("*").
+		From("purchase").
+		Where(sq.And{
+			sq.Eq{"invoice_type": invoiceType},
+			sq.Eq{"status": status},
+			sq.GtOrEq{"created_at": from},
+			sq.Lt{"created_at": to},
+		}).
+		OrderBy("created_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := cr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var p Purchase
+		if err := scanPurchase(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return purchases, nil
+}
+
+// FindPaidBetween returns purchases that are paid and were paid within [from, to).
+func (cr *PurchaseRepository) FindPaidBetween(ctx context.Context, from, to time.Time) ([]Purchase, error) {
+	sql, args, err := sq.Select("*").
+		From("purchase").
+		Where(sq.And{
+			sq.Eq{"status": PurchaseStatusPaid},
+			sq.GtOrEq{"paid_at": from},
+			sq.Lt{"paid_at": to},
+		}).
+		OrderBy("paid_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := cr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var p Purchase
+		if err := scanPurchase(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+	return purchases, nil
+}
+
 func (cr *PurchaseRepository) FindById(ctx context.Context, id int64) (*Purchase, error) {
 	buildSelect := sq.Select("*").
 		From("purchase").
@@ -151,24 +325,7 @@ func (cr *PurchaseRepository) FindById(ctx context.Context, id int64) (*Purchase
 	}
 	purchase := &Purchase{}
 
-	err = cr.pool.QueryRow(ctx, sql, args...).Scan(
-		&purchase.ID,
-		&purchase.Amount,
-		&purchase.CustomerID,
-		&purchase.CreatedAt,
-		&purchase.Month,
-		&purchase.PaidAt,
-		&purchase.Currency,
-		&purchase.ExpireAt,
-		&purchase.Status,
-		&purchase.InvoiceType,
-		&purchase.CryptoInvoiceID,
-		&purchase.CryptoInvoiceLink,
-		&purchase.YookasaURL,
-		&purchase.YookasaID,
-		&purchase.PlategaID,
-		&purchase.PlategaURL,
-	)
+	err = scanPurchase(cr.pool.QueryRow(ctx, sql, args...), purchase)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -180,6 +337,49 @@ func (cr *PurchaseRepository) FindById(ctx context.Context, id int64) (*Purchase
 	return purchase, nil
 }
 
+// FindByTelegramChargeID returns the purchase paid by the Telegram Stars charge.
+func (cr *PurchaseRepository) FindByTelegramChargeID(ctx context.Context, chargeID string) (*Purchase, error) {
+	sql, args, err := sq.Select("*").
+		From("purchase").
+		Where(sq.Eq{"telegram_charge_id": chargeID}).
+		Limit(1).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	p := &Purchase{}
+	if err := scanPurchase(cr.pool.QueryRow(ctx, sql, args...), p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query purchase: %w", err)
+	}
+	return p, nil
+}
+
+// FindByTributeEventID returns the purchase created for the Tribute webhook event.
+func (cr *PurchaseRepository) FindByTributeEventID(ctx context.Context, eventID string) (*Purchase, error) {
+	sql, args, err := sq.Select("*").
+		From("purchase").
+		Where(sq.Eq{"tribute_event_id": eventID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	p := &Purchase{}
+	if err := scanPurchase(cr.pool.QueryRow(ctx, sql, args...), p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query purchase: %w", err)
+	}
+	return p, nil
+}
+
 func (p *PurchaseRepository) UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error {
 	if len(updates) == 0 {
 		return nil
@@ -211,15 +411,149 @@ func (p *PurchaseRepository) UpdateFields(ctx context.Context, id int64, updates
 	return nil
 }
 
-func (pr *PurchaseRepository) MarkAsPaid(ctx context.Context, purchaseID int64) error {
-	currentTime := time.Now()
+// RequestRefund records that the paid purchase is about to be refunded through its
+// provider. It reports false when a refund was already requested or the purchase is
+// not paid, so the provider is asked at most once.
+func (pr *PurchaseRepository) RequestRefund(ctx context.Context, id int64) (bool, error) {
+	sql, args, err := sq.Update("purchase").
+		Set("refund_requested_at", sq.Expr("NOW()")).
+		Where(sq.And{
+			sq.Eq{"id": id},
+			sq.Eq{"status": PurchaseStatusPaid},
+			sq.Eq{"refund_requested_at": nil},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build request refund query: %w", err)
+	}
 
-	updates := map[string]interface{}{
-		"status":  PurchaseStatusPaid,
-		"paid_at": currentTime,
+	result, err := pr.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("request refund: %w", err)
 	}
+	return result.RowsAffected() == 1, nil
+}
 
-	return pr.UpdateFields(ctx, purchaseID, updates)
+// CancelRefundRequest clears the request of a refund the provider declined, so it
+// can be requested again.
+func (pr *PurchaseRepository) CancelRefundRequest(ctx context.Context, id int64) error {
+	sql, args, err := sq.Update("purchase").
+		Set("refund_requested_at", nil).
+		Where(sq.And{
+			sq.Eq{"id": id},
+			sq.Eq{"status": PurchaseStatusPaid},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build cancel refund request query: %w", err)
+	}
+
+	if _, err := pr.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("cancel refund request: %w", err)
+	}
+	return nil
+}
+
+func buildTransitionQuery(id int64, from []PurchaseStatus, to PurchaseStatus, updates map[string]interface{}) sq.UpdateBuilder {
+	builder := sq.Update("purchase").
+		Set("status", to).
+		Where(sq.And{
+			sq.Eq{"id": id},
+			sq.Eq{"status": from},
+		})
+
+	for field, value := range updates {
+		builder = builder.Set(field, value)
+	}
+
+	return builder
+}
+
+// Transition moves the purchase to the given status only if its current status
+// allows it. It reports whether the row was changed, so repeated deliveries of the
+// same event are a no-op.
+func (pr *PurchaseRepository) Transition(ctx context.Context, id int64, to PurchaseStatus, updates map[string]interface{}) (bool, error) {
+	sql, args, err := buildTransitionQuery(id, previousStatuses(to), to, updates).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build transition query: %w", err)
+	}
+
+	result, err := pr.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("transition purchase: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// TransitionWith locks the purchase row, runs apply and moves the purchase to the
+// given status in the same transaction. apply receives the transaction so it can
+// record related changes atomically with the status change. Concurrent callers wait on the lock and
+// then see the new status, so apply runs at most once per transition. It reports
+// false without calling apply when the purchase is already in the target status,
+// and returns ErrInvalidTransition when the target is not reachable.
+func (pr *PurchaseRepository) TransitionWith(
+	ctx context.Context,
+	id int64,
+	to PurchaseStatus,
+	updates map[string]interface{},
+	apply func(tx pgx.Tx, purchase *Purchase) error,
+) (bool, error) {
+	tx, err := pr.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Select("*").
+		From("purchase").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build query: %w", err)
+	}
+
+	purchase := &Purchase{}
+	if err := scanPurchase(tx.QueryRow(ctx, sql, args...), purchase); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("purchase %d not found", id)
+		}
+		return false, fmt.Errorf("lock purchase: %w", err)
+	}
+
+	if purchase.Status == to {
+		return false, nil
+	}
+	if !purchase.Status.canTransitionLockedTo(to) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, purchase.Status, to)
+	}
+
+	if err := apply(tx, purchase); err != nil {
+		return false, err
+	}
+
+	// The row is locked, so it is matched on the status it was read with. That also
+	// covers the locked transitions, which previousStatuses leaves out.
+	sql, args, err = buildTransitionQuery(id, []PurchaseStatus{purchase.Status}, to, updates).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build transition query: %w", err)
+	}
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("transition purchase: %w", err)
+	}
+	if result.RowsAffected() != 1 {
+		return false, fmt.Errorf("transition purchase %d: %s -> %s changed no rows", id, purchase.Status, to)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return true, nil
 }
 
 func buildLatestActiveTributesQuery(customerIDs []int64) sq.SelectBuilder {
@@ -259,12 +593,7 @@ func (pr *PurchaseRepository) FindLatestActiveTributesByCustomerIDs(
 	var purchases []Purchase
 	for rows.Next() {
 		var p Purchase
-		if err := rows.Scan(
-			&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
-			&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
-			&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
-			&p.PlategaID, &p.PlategaURL,
-		); err != nil {
+		if err := scanPurchase(rows, &p); err != nil {
 			return nil, fmt.Errorf("scan purchase: %w", err)
 		}
 		purchases = append(purchases, p)
@@ -299,12 +628,7 @@ func (pr *PurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(
 	}
 
 	p := &Purchase{}
-	err = pr.pool.QueryRow(ctx, sql, args...).Scan(
-		&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
-		&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
-		&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
-		&p.PlategaID, &p.PlategaURL,
-	)
+	err = scanPurchase(pr.pool.QueryRow(ctx, sql, args...), p)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -315,6 +639,34 @@ func (pr *PurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(
 	return p, nil
 }
 
+// FindLastPaidSubscription returns the customer's latest paid subscription purchase
+// of the invoice type.
+func (pr *PurchaseRepository) FindLastPaidSubscription(ctx context.Context, customerID int64, invoiceType InvoiceType) (*Purchase, error) {
+	sql, args, err := sq.Select("*").
+		From("purchase").
+		Where(sq.Eq{
+			"customer_id":  customerID,
+			"invoice_type": invoiceType,
+			"status":       PurchaseStatusPaid,
+			"kind":         PurchaseKindSubscription,
+		}).
+		OrderBy("paid_at DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	p := &Purchase{}
+	if err := scanPurchase(pr.pool.QueryRow(ctx, sql, args...), p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query purchase: %w", err)
+	}
+	return p, nil
+}
 
 func (pr *PurchaseRepository) FindSuccessfulPaidPurchaseByCustomer(ctx context.Context, customerID int64) (*Purchase, error) {
 	query := sq.Select("*").
@@ -342,12 +694,7 @@ func (pr *PurchaseRepository) FindSuccessfulPaidPurchaseByCustomer(ctx context.C
 	}
 
 	p := &Purchase{}
-	err = pr.pool.QueryRow(ctx, sql, args...).Scan(
-		&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
-		&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
-		&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
-		&p.PlategaID, &p.PlategaURL,
-	)
+	err = scanPurchase(pr.pool.QueryRow(ctx, sql, args...), p)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
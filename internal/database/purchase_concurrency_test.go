@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// newTestPool connects to TEST_DATABASE_URL and applies the migrations. Tests that
+// need a real database are skipped when the variable is not set.
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	m, err := migrate.New("file://../../db/migrations", url)
+	if err != nil {
+		t.Fatalf("init migrations: %v", err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func createTestPurchase(t *testing.T, pool *pgxpool.Pool, status PurchaseStatus) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	var customerID int64
+	err := pool.QueryRow(ctx, "INSERT INTO customer (telegram_id) VALUES ($1) RETURNING id", nextTestTelegramID()).Scan(&customerID)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	id, err := NewPurchaseRepository(pool).Create(ctx, &Purchase{
+		Amount:      100,
+		CustomerID:  customerID,
+		Month:       1,
+		Currency:    "RUB",
+		Status:      status,
+		InvoiceType: InvoiceTypeYookasa,
+	})
+	if err != nil {
+		t.Fatalf("create purchase: %v", err)
+	}
+	return id
+}
+
+var testTelegramID atomic.Int64
+
+func nextTestTelegramID() int64 {
+	return -1_000_000 - testTelegramID.Add(1)
+}
+
+func TestTransitionWithConcurrentDeliveries(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPurchaseRepository(pool)
+	id := createTestPurchase(t, pool, PurchaseStatusPending)
+
+	const deliveries = 10
+	var (
+		applied atomic.Int32
+		calls   atomic.Int32
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < deliveries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := repo.TransitionWith(context.Background(), id, PurchaseStatusPaid, nil, func(pgx.Tx, *Purchase) error {
+				calls.Add(1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("transition: %v", err)
+				return
+			}
+			if ok {
+				applied.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 || applied.Load() != 1 {
+		t.Fatalf("expected exactly one delivery to apply, got %d calls and %d applied", calls.Load(), applied.Load())
+	}
+
+	purchase, err := repo.FindById(context.Background(), id)
+	if err != nil {
+		t.Fatalf("find purchase: %v", err)
+	}
+	if purchase.Status != PurchaseStatusPaid {
+		t.Fatalf("expected status %s, got %s", PurchaseStatusPaid, purchase.Status)
+	}
+}
+
+func TestTransitionWithFailedApplyKeepsStatus(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPurchaseRepository(pool)
+	id := createTestPurchase(t, pool, PurchaseStatusPending)
+
+	applyErr := fmt.Errorf("remnawave unavailable")
+	_, err := repo.TransitionWith(context.Background(), id, PurchaseStatusPaid, nil, func(pgx.Tx, *Purchase) error {
+		return applyErr
+	})
+	if !errors.Is(err, applyErr) {
+		t.Fatalf("expected apply error, got %v", err)
+	}
+
+	purchase, err := repo.FindById(context.Background(), id)
+	if err != nil {
+		t.Fatalf("find purchase: %v", err)
+	}
+	if purchase.Status != PurchaseStatusPending {
+		t.Fatalf("expected status %s after failed apply, got %s", PurchaseStatusPending, purchase.Status)
+	}
+}
+
+func TestTransitionWithCancelsPaidPurchase(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPurchaseRepository(pool)
+	id := createTestPurchase(t, pool, PurchaseStatusPaid)
+
+	var calls int
+	cancel := func() (bool, error) {
+		return repo.TransitionWith(context.Background(), id, PurchaseStatusCancel, nil, func(_ pgx.Tx, locked *Purchase) error {
+			calls++
+			if locked.Status != PurchaseStatusPaid {
+				t.Errorf("expected the paid purchase to be locked, got %s", locked.Status)
+			}
+			return nil
+		})
+	}
+
+	if applied, err := cancel(); err != nil || !applied {
+		t.Fatalf("expected the paid purchase to be cancelled, got %v, %v", applied, err)
+	}
+	if applied, err := cancel(); err != nil || applied {
+		t.Fatalf("expected a repeated cancel to be a no-op, got %v, %v", applied, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected apply to run once, got %d", calls)
+	}
+
+	purchase, err := repo.FindById(context.Background(), id)
+	if err != nil {
+		t.Fatalf("find purchase: %v", err)
+	}
+	if purchase.Status != PurchaseStatusCancel {
+		t.Fatalf("expected status %s, got %s", PurchaseStatusCancel, purchase.Status)
+	}
+}
+
+func TestTransitionConcurrentCancel(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPurchaseRepository(pool)
+	id := createTestPurchase(t, pool, PurchaseStatusPending)
+
+	var (
+		applied atomic.Int32
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := repo.Transition(context.Background(), id, PurchaseStatusCancel, nil)
+			if err != nil {
+				t.Errorf("transition: %v", err)
+				return
+			}
+			if ok {
+				applied.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if applied.Load() != 1 {
+		t.Fatalf("expected exactly one cancel to apply, got %d", applied.Load())
+	}
+
+	_, err := repo.TransitionWith(context.Background(), id, PurchaseStatusPaid, nil, func(pgx.Tx, *Purchase) error {
+		t.Fatalf("apply must not run for a cancelled purchase")
+		return nil
+	})
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+}
+
+func TestRequestRefundOnce(t *testing.T) {
+	pool := newTestPool(t)
+	repo := NewPurchaseRepository(pool)
+	ctx := context.Background()
+	id := createTestPurchase(t, pool, PurchaseStatusPaid)
+
+	if requested, err := repo.RequestRefund(ctx, id); err != nil || !requested {
+		t.Fatalf("expected the refund to be requested, got %v, %v", requested, err)
+	}
+	if requested, err := repo.RequestRefund(ctx, id); err != nil || requested {
+		t.Fatalf("expected a repeated request to be refused, got %v, %v", requested, err)
+	}
+
+	if err := repo.CancelRefundRequest(ctx, id); err != nil {
+		t.Fatalf("cancel refund request: %v", err)
+	}
+	if requested, err := repo.RequestRefund(ctx, id); err != nil || !requested {
+		t.Fatalf("expected a declined refund to be requested again, got %v, %v", requested, err)
+	}
+
+	pending := createTestPurchase(t, pool, PurchaseStatusPending)
+	if requested, err := repo.RequestRefund(ctx, pending); err != nil || requested {
+		t.Fatalf("expected an unpaid purchase to be refused, got %v, %v", requested, err)
+	}
+}
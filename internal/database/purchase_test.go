@@ -48,3 +48,69 @@ func TestFindLatestActiveTributesByCustomerIDsEmpty(t *testing.T) {
 		t.Fatalf("expected empty result, got %d", len(*result))
 	}
 }
+
+func TestPurchaseStatusCanTransitionTo(t *testing.T) {
+	cases := []struct {
+		from, to PurchaseStatus
+		want     bool
+	}{
+		{PurchaseStatusNew, PurchaseStatusPending, true},
+		{PurchaseStatusPending, PurchaseStatusPaid, true},
+		{PurchaseStatusPending, PurchaseStatusCancel, true},
+		{PurchaseStatusPaid, PurchaseStatusRefunded, true},
+		{PurchaseStatusPaid, PurchaseStatusCancel, false},
+		{PurchaseStatusPending, PurchaseStatusReview, true},
+		{PurchaseStatusReview, PurchaseStatusPaid, true},
+		{PurchaseStatusReview, PurchaseStatusCancel, true},
+		{PurchaseStatusPaid, PurchaseStatusReview, false},
+		{PurchaseStatusReview, PurchaseStatusRefunded, false},
+		{PurchaseStatusNew, PurchaseStatusPaid, false},
+		{PurchaseStatusPaid, PurchaseStatusPaid, false},
+		{PurchaseStatusPaid, PurchaseStatusPending, false},
+		{PurchaseStatusCancel, PurchaseStatusPaid, false},
+		{PurchaseStatusRefunded, PurchaseStatusPaid, false},
+	}
+
+	for _, c := range cases {
+		if got := c.from.CanTransitionTo(c.to); got != c.want {
+			t.Errorf("%s -> %s: want %v, got %v", c.from, c.to, c.want, got)
+		}
+	}
+}
+
+func TestBuildTransitionQuery(t *testing.T) {
+	sql, args, err := buildTransitionQuery(42, previousStatuses(PurchaseStatusPaid), PurchaseStatusPaid, nil).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	if !strings.Contains(sql, "status IN ($3,$4)") {
+		t.Fatalf("expected SQL to guard on the previous statuses, got: %s", sql)
+	}
+
+	expectedArgs := []interface{}{PurchaseStatusPaid, int64(42), PurchaseStatusPending, PurchaseStatusReview}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildTransitionQueryCancelSkipsPaid(t *testing.T) {
+	_, args, err := buildTransitionQuery(42, previousStatuses(PurchaseStatusCancel), PurchaseStatusCancel, nil).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedArgs := []interface{}{PurchaseStatusCancel, int64(42), PurchaseStatusNew, PurchaseStatusPending, PurchaseStatusReview}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("a plain cancel must not match paid purchases, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestLockedTransitionCancelsPaid(t *testing.T) {
+	if !PurchaseStatusPaid.canTransitionLockedTo(PurchaseStatusCancel) {
+		t.Fatalf("expected a locked transition to cancel a paid purchase")
+	}
+	if PurchaseStatusRefunded.canTransitionLockedTo(PurchaseStatusCancel) {
+		t.Fatalf("expected a refunded purchase to stay refunded")
+	}
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ReceiptStatus string
+
+const (
+	ReceiptStatusPending  ReceiptStatus = "pending"
+	ReceiptStatusIssued   ReceiptStatus = "issued"
+	ReceiptStatusFailed   ReceiptStatus = "failed"
+	ReceiptStatusCanceled ReceiptStatus = "canceled"
+)
+
+// Receipt is the Moynalog income registered for a paid purchase. A failed receipt
+// is retried by the outbox worker until it is issued or its purchase is refunded.
+type Receipt struct {
+	ID          int64         `db:"id"`
+	PurchaseID  int64         `db:"purchase_id"`
+	Status      ReceiptStatus `db:"status"`
+	ReceiptUUID *string       `db:"receipt_uuid"`
+	Attempts    int           `db:"attempts"`
+	LastError   *string       `db:"last_error"`
+	CreatedAt   time.Time     `db:"created_at"`
+	UpdatedAt   time.Time     `db:"updated_at"`
+	Amount      *float64      `db:"amount"`
+}
+
+const receiptColumns = "id, purchase_id, status, receipt_uuid, attempts, last_error, created_at, updated_at, amount"
+
+type ReceiptRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewReceiptRepository(pool *pgxpool.Pool) *ReceiptRepository {
+	return &ReceiptRepository{pool: pool}
+}
+
+func scanReceipt(row pgx.Row, r *Receipt) error {
+	return row.Scan(&r.ID, &r.PurchaseID, &r.Status, &r.ReceiptUUID, &r.Attempts, &r.LastError, &r.CreatedAt, &r.UpdatedAt, &r.Amount)
+}
+
+func buildInsertReceiptQuery(purchaseID int64) (string, []interface{}, error) {
+	return sq.Insert("receipt").
+		Columns("purchase_id").
+		Values(purchaseID).
+		Suffix("ON CONFLICT (purchase_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+}
+
+// CreateTx records a pending receipt in the transaction that marks its purchase paid.
+func (r *ReceiptRepository) CreateTx(ctx context.Context, tx pgx.Tx, purchaseID int64) error {
+	sql, args, err := buildInsertReceiptQuery(purchaseID)
+	if err != nil {
+		return fmt.Errorf("build insert receipt query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert receipt: %w", err)
+	}
+	return nil
+}
+
+// FindOrCreate returns the purchase's receipt, recording a pending one when the
+// purchase was paid before receipts were recorded.
+func (r *ReceiptRepository) FindOrCreate(ctx context.Context, purchaseID int64) (*Receipt, error) {
+	sql, args, err := buildInsertReceiptQuery(purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("build insert receipt query: %w", err)
+	}
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return nil, fmt.Errorf("insert receipt: %w", err)
+	}
+
+	receipt, err := r.FindByPurchaseID(ctx, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, fmt.Errorf("receipt of purchase %d not found", purchaseID)
+	}
+	return receipt, nil
+}
+
+func (r *ReceiptRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*Receipt, error) {
+	sql, args, err := sq.Select(receiptColumns).
+		From("receipt").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select receipt query: %w", err)
+	}
+
+	receipt := &Receipt{}
+	if err := scanReceipt(r.pool.QueryRow(ctx, sql, args...), receipt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query receipt: %w", err)
+	}
+	return receipt, nil
+}
+
+// FindByPurchaseIDs returns the receipts of the purchases keyed by purchase id.
+func (r *ReceiptRepository) FindByPurchaseIDs(ctx context.Context, purchaseIDs []int64) (map[int64]Receipt, error) {
+	receipts := make(map[int64]Receipt, len(purchaseIDs))
+	if len(purchaseIDs) == 0 {
+		return receipts, nil
+	}
+	err := r.collect(ctx, sq.Select(receiptColumns).
+		From("receipt").
+		Where(sq.Eq{"purchase_id": purchaseIDs}), func(receipt Receipt) {
+		receipts[receipt.PurchaseID] = receipt
+	})
+	return receipts, err
+}
+
+// FindByReceiptUUIDs returns the receipts registered under the Moynalog receipt
+// uuids keyed by uuid.
+func (r *ReceiptRepository) FindByReceiptUUIDs(ctx context.Context, receiptUUIDs []string) (map[string]Receipt, error) {
+	receipts := make(map[string]Receipt, len(receiptUUIDs))
+	if len(receiptUUIDs) == 0 {
+		return receipts, nil
+	}
+	err := r.collect(ctx, sq.Select(receiptColumns).
+		From("receipt").
+		Where(sq.Eq{"receipt_uuid": receiptUUIDs}), func(receipt Receipt) {
+		receipts[*receipt.ReceiptUUID] = receipt
+	})
+	return receipts, err
+}
+
+func (r *ReceiptRepository) collect(ctx context.Context, query sq.SelectBuilder, add func(receipt Receipt)) error {
+	sql, args, err := query.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("build select receipts query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("query receipts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var receipt Receipt
+		if err := scanReceipt(rows, &receipt); err != nil {
+			return fmt.Errorf("scan receipt: %w", err)
+		}
+		add(receipt)
+	}
+	return rows.Err()
+}
+
+func (r *ReceiptRepository) FindByStatus(ctx context.Context, status ReceiptStatus, limit uint64) ([]Receipt, error) {
+	var receipts []Receipt
+	err := r.collect(ctx, sq.Select(receiptColumns).
+		From("receipt").
+		Where(sq.Eq{"status": status}).
+		OrderBy("updated_at DESC").
+		Limit(limit), func(receipt Receipt) {
+		receipts = append(receipts, receipt)
+	})
+	return receipts, err
+}
+
+// MarkIssued records the receipt registered in Moynalog for amount rubles.
+func (r *ReceiptRepository) MarkIssued(ctx context.Context, id int64, receiptUUID string, amount float64) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":       ReceiptStatusIssued,
+		"receipt_uuid": receiptUUID,
+		"amount":       amount,
+		"attempts":     sq.Expr("attempts + 1"),
+		"last_error":   nil,
+	})
+}
+
+// MarkFailed records a failed attempt to register the receipt.
+func (r *ReceiptRepository) MarkFailed(ctx context.Context, id int64, receiptErr string) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":     ReceiptStatusFailed,
+		"attempts":   sq.Expr("attempts + 1"),
+		"last_error": receiptErr,
+	})
+}
+
+// MarkCanceled records that the receipt was annulled, or that it is no longer
+// needed because its purchase was refunded before it was issued.
+func (r *ReceiptRepository) MarkCanceled(ctx context.Context, id int64) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status": ReceiptStatusCanceled,
+	})
+}
+
+// ResendWith moves a failed receipt back to pending and runs enqueue in the same
+// transaction. It reports false when the purchase has no failed receipt.
+func (r *ReceiptRepository) ResendWith(ctx context.Context, purchaseID int64, enqueue func(tx pgx.Tx) error) (bool, error) {
+	sql, args, err := sq.Update("receipt").
+		Set("status", ReceiptStatusPending).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"purchase_id": purchaseID, "status": ReceiptStatusFailed}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build resend receipt query: %w", err)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("resend receipt: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+	if err := enqueue(tx); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+func (r *ReceiptRepository) update(ctx context.Context, id int64, updates map[string]interface{}) error {
+	sql, args, err := sq.Update("receipt").
+		SetMap(updates).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build update receipt query: %w", err)
+	}
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update receipt %d: %w", id, err)
+	}
+	return nil
+}
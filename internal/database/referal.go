@@ -16,6 +16,17 @@ type Referral struct {
 	RefereeID    int64     `db:"referee_id"`
 	UsedAt       time.Time `db:"used_at"`
 	BonusGranted bool      `db:"bonus_granted"`
+	// BonusPurchaseID and BonusExpireAt are stored before bonus days are sent to the
+	// referrer's panel user: the purchase whose job grants them, and the expiry it
+	// sets, so a retry sets the same expiry instead of adding the days twice.
+	BonusPurchaseID *int64     `db:"bonus_purchase_id"`
+	BonusExpireAt   *time.Time `db:"bonus_expire_at"`
+}
+
+const referralColumns = "id, referrer_id, referee_id, used_at, bonus_granted, bonus_purchase_id, bonus_expire_at"
+
+func scanReferral(row pgx.Row, ref *Referral) error {
+	return row.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted, &ref.BonusPurchaseID, &ref.BonusExpireAt)
 }
 
 type ReferralRepository struct {
@@ -30,7 +41,7 @@ func (r *ReferralRepository) Create(ctx context.Context, referrerID, refereeID i
 	query := sq.Insert("referral").
 		Columns("referrer_id", "referee_id", "used_at", "bonus_granted").
 		Values(referrerID, refereeID, sq.Expr("NOW()"), false).
-		Suffix("RETURNING id, referrer_id, referee_id, used_at, bonus_granted").
+		Suffix("RETURNING " + referralColumns).
 		PlaceholderFormat(sq.Dollar)
 
 	sql, args, err := query.ToSql()
@@ -40,14 +51,14 @@ func (r *ReferralRepository) Create(ctx context.Context, referrerID, refereeID i
 
 	row := r.pool.QueryRow(ctx, sql, args...)
 	var ref Referral
-	if err := row.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted); err != nil {
+	if err := scanReferral(row, &ref); err != nil {
 		return nil, fmt.Errorf("failed to scan inserted referral: %w", err)
 	}
 	return &ref, nil
 }
 
 func (r *ReferralRepository) FindByReferrer(ctx context.Context, referrerID int64) ([]Referral, error) {
-	query := sq.Select("id", "referrer_id", "referee_id", "used_at", "bonus_granted").
+	query := sq.Select(referralColumns).
 		From("referral").
 		Where(sq.Eq{"referrer_id": referrerID}).
 		OrderBy("used_at DESC").
@@ -67,7 +78,7 @@ func (r *ReferralRepository) FindByReferrer(ctx context.Context, referrerID int6
 	var list []Referral
 	for rows.Next() {
 		var ref Referral
-		if err := rows.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted); err != nil {
+		if err := scanReferral(rows, &ref); err != nil {
 			return nil, fmt.Errorf("failed to scan referral row: %w", err)
 		}
 		list = append(list, ref)
@@ -97,7 +108,7 @@ func (r *ReferralRepository) CountByReferrer(ctx context.Context, referrerID int
 }
 
 func (r *ReferralRepository) FindByReferee(ctx context.Context, refereeID int64) (*Referral, error) {
-	query := sq.Select("id", "referrer_id", "referee_id", "used_at", "bonus_granted").
+	query := sq.Select(referralColumns).
 		From("referral").
 		Where(sq.Eq{"referee_id": refereeID}).
 		Limit(1).
@@ -109,7 +120,7 @@ func (r *ReferralRepository) FindByReferee(ctx context.Context, refereeID int64)
 	}
 
 	var ref Referral
-	err = r.pool.QueryRow(ctx, sql, args...).Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted)
+	err = scanReferral(r.pool.QueryRow(ctx, sql, args...), &ref)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -139,3 +150,52 @@ func (r *ReferralRepository) MarkBonusGranted(ctx context.Context, referralID in
 	}
 	return nil
 }
+
+// SetBonusTarget stores the expiry the bonus sets on the referrer's panel user and
+// the purchase whose job grants it. A target that is already stored is kept, and
+// the stored referral is returned.
+func (r *ReferralRepository) SetBonusTarget(ctx context.Context, referralID, purchaseID int64, expireAt time.Time) (*Referral, error) {
+	sql, args, err := sq.Update("referral").
+		Set("bonus_purchase_id", sq.Expr("COALESCE(bonus_purchase_id, ?)", purchaseID)).
+		Set("bonus_expire_at", sq.Expr("COALESCE(bonus_expire_at, ?)", expireAt)).
+		Where(sq.Eq{"id": referralID}).
+		Suffix("RETURNING " + referralColumns).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build update referral bonus target query: %w", err)
+	}
+
+	var ref Referral
+	if err := scanReferral(r.pool.QueryRow(ctx, sql, args...), &ref); err != nil {
+		return nil, fmt.Errorf("update referral bonus target: %w", err)
+	}
+	return &ref, nil
+}
+
+// HasPendingBonus reports whether the referrer has a bonus whose target expiry is
+// stored but that is not granted yet. A grant or revoke applied before it would be
+// overwritten by the stored expiry, so they wait for it.
+func (r *ReferralRepository) HasPendingBonus(ctx context.Context, referrerID int64) (bool, error) {
+	sql, args, err := sq.Select("1").
+		From("referral").
+		Where(sq.And{
+			sq.Eq{"referrer_id": referrerID},
+			sq.Eq{"bonus_granted": false},
+			sq.NotEq{"bonus_expire_at": nil},
+			notDeadLettered("referral.bonus_purchase_id", referralBonusJobKind),
+		}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build select pending referral bonuses query: %w", err)
+	}
+
+	var pending bool
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&pending); err != nil {
+		return false, fmt.Errorf("query pending referral bonuses: %w", err)
+	}
+	return pending, nil
+}
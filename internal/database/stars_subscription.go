@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// StarsSubscription is a Telegram Stars subscription started by a purchase. Telegram
+// charges the customer every period until the subscription is canceled, each charge
+// renews the subscription it was started for.
+type StarsSubscription struct {
+	ID         int64      `db:"id"`
+	CustomerID int64      `db:"customer_id"`
+	PurchaseID int64      `db:"purchase_id"`
+	ChargeID   string     `db:"charge_id"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	CanceledAt *time.Time `db:"canceled_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+const starsSubscriptionColumns = "id, customer_id, purchase_id, charge_id, expires_at, canceled_at, created_at"
+
+type StarsSubscriptionRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewStarsSubscriptionRepository(pool *pgxpool.Pool) *StarsSubscriptionRepository {
+	return &StarsSubscriptionRepository{pool: pool}
+}
+
+func scanStarsSubscription(row pgx.Row, s *StarsSubscription) error {
+	return row.Scan(&s.ID, &s.CustomerID, &s.PurchaseID, &s.ChargeID, &s.ExpiresAt, &s.CanceledAt, &s.CreatedAt)
+}
+
+// Create stores the subscription started by its first payment. A subscription that
+// is already stored for the purchase is kept.
+func (r *StarsSubscriptionRepository) Create(ctx context.Context, sub *StarsSubscription) error {
+	sql, args, err := sq.Insert("stars_subscription").
+		Columns("customer_id", "purchase_id", "charge_id", "expires_at").
+		Values(sub.CustomerID, sub.PurchaseID, sub.ChargeID, sub.ExpiresAt).
+		Suffix("ON CONFLICT (purchase_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert stars subscription query: %w", err)
+	}
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert stars subscription: %w", err)
+	}
+	return nil
+}
+
+// FindByPurchaseID returns the subscription started by the purchase.
+func (r *StarsSubscriptionRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*StarsSubscription, error) {
+	return r.findOne(ctx, sq.Select(starsSubscriptionColumns).
+		From("stars_subscription").
+		Where(sq.Eq{"purchase_id": purchaseID}))
+}
+
+// FindActiveByCustomerID returns the customer's subscription that expires last,
+// nil when none runs past now.
+func (r *StarsSubscriptionRepository) FindActiveByCustomerID(ctx context.Context, customerID int64, now time.Time) (*StarsSubscription, error) {
+	return r.findOne(ctx, sq.Select(starsSubscriptionColumns).
+		From("stars_subscription").
+		Where(sq.And{
+			sq.Eq{"customer_id": customerID},
+			sq.Gt{"expires_at": now},
+		}).
+		OrderBy("expires_at DESC").
+		Limit(1))
+}
+
+func (r *StarsSubscriptionRepository) findOne(ctx context.Context, query sq.SelectBuilder) (*StarsSubscription, error) {
+	sql, args, err := query.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select stars subscription query: %w", err)
+	}
+
+	sub := &StarsSubscription{}
+	if err := scanStarsSubscription(r.pool.QueryRow(ctx, sql, args...), sub); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query stars subscription: %w", err)
+	}
+	return sub, nil
+}
+
+func (r *StarsSubscriptionRepository) UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	sql, args, err := sq.Update("stars_subscription").
+		SetMap(updates).
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build update stars subscription query: %w", err)
+	}
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update stars subscription: %w", err)
+	}
+	return nil
+}
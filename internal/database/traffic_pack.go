@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TrafficPack is extra traffic added to a customer's Remnawave traffic limit by a
+// traffic purchase. It is taken back from the limit once it expires or its
+// purchase is refunded.
+type TrafficPack struct {
+	ID         int64      `db:"id"`
+	PurchaseID int64      `db:"purchase_id"`
+	CustomerID int64      `db:"customer_id"`
+	Bytes      int64      `db:"bytes"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+const trafficPackColumns = "id, purchase_id, customer_id, bytes, expires_at, revoked_at, created_at"
+
+type TrafficPackRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTrafficPackRepository(pool *pgxpool.Pool) *TrafficPackRepository {
+	return &TrafficPackRepository{pool: pool}
+}
+
+func scanTrafficPack(row pgx.Row, p *TrafficPack) error {
+	return row.Scan(&p.ID, &p.PurchaseID, &p.CustomerID, &p.Bytes, &p.ExpiresAt, &p.RevokedAt, &p.CreatedAt)
+}
+
+// CreateTx stores the pack in the transaction that marks its purchase paid.
+func (r *TrafficPackRepository) CreateTx(ctx context.Context, tx pgx.Tx, pack *TrafficPack) error {
+	sql, args, err := sq.Insert("traffic_pack").
+		Columns("purchase_id", "customer_id", "bytes", "expires_at").
+		Values(pack.PurchaseID, pack.CustomerID, pack.Bytes, pack.ExpiresAt).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build insert traffic pack query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert traffic pack: %w", err)
+	}
+	return nil
+}
+
+func (r *TrafficPackRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*TrafficPack, error) {
+	sql, args, err := sq.Select(trafficPackColumns).
+		From("traffic_pack").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select traffic pack query: %w", err)
+	}
+
+	pack := &TrafficPack{}
+	if err := scanTrafficPack(r.pool.QueryRow(ctx, sql, args...), pack); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query traffic pack: %w", err)
+	}
+	return pack, nil
+}
+
+// FindExpired returns the packs that expired before now and are still part of a
+// traffic limit.
+func (r *TrafficPackRepository) FindExpired(ctx context.Context, now time.Time) ([]TrafficPack, error) {
+	sql, args, err := sq.Select(trafficPackColumns).
+		From("traffic_pack").
+		Where(sq.And{
+			sq.Eq{"revoked_at": nil},
+			sq.LtOrEq{"expires_at": now},
+		}).
+		OrderBy("expires_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select expired traffic packs query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query expired traffic packs: %w", err)
+	}
+	defer rows.Close()
+
+	var packs []TrafficPack
+	for rows.Next() {
+		var pack TrafficPack
+		if err := scanTrafficPack(rows, &pack); err != nil {
+			return nil, fmt.Errorf("scan traffic pack: %w", err)
+		}
+		packs = append(packs, pack)
+	}
+	return packs, rows.Err()
+}
+
+// ActiveBytes returns the traffic of the customer's packs that have not expired yet.
+func (r *TrafficPackRepository) ActiveBytes(ctx context.Context, customerID int64, now time.Time) (int64, error) {
+	sql, args, err := sq.Select("COALESCE(SUM(bytes), 0)").
+		From("traffic_pack").
+		Where(sq.And{
+			sq.Eq{"customer_id": customerID},
+			sq.Eq{"revoked_at": nil},
+			sq.Gt{"expires_at": now},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build sum traffic packs query: %w", err)
+	}
+
+	var bytes int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&bytes); err != nil {
+		return 0, fmt.Errorf("sum traffic packs: %w", err)
+	}
+	return bytes, nil
+}
+
+// RevokeWith locks the pack, runs apply and marks the pack revoked. Nothing is
+// recorded when apply fails, so the pack is revoked again later. It reports false
+// when the pack was already revoked.
+func (r *TrafficPackRepository) RevokeWith(ctx context.Context, id int64, apply func(pack *TrafficPack) error) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Select(trafficPackColumns).
+		From("traffic_pack").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build lock traffic pack query: %w", err)
+	}
+
+	pack := &TrafficPack{}
+	if err := scanTrafficPack(tx.QueryRow(ctx, sql, args...), pack); err != nil {
+		return false, fmt.Errorf("lock traffic pack: %w", err)
+	}
+	if pack.RevokedAt != nil {
+		return false, nil
+	}
+
+	if err := apply(pack); err != nil {
+		return false, err
+	}
+
+	sql, args, err = sq.Update("traffic_pack").
+		Set("revoked_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": pack.ID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build revoke traffic pack query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return false, fmt.Errorf("revoke traffic pack: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return true, nil
+}
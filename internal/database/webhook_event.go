@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type WebhookEventStatus string
+
+const (
+	WebhookEventStatusReceived  WebhookEventStatus = "received"
+	WebhookEventStatusProcessed WebhookEventStatus = "processed"
+	WebhookEventStatusFailed    WebhookEventStatus = "failed"
+)
+
+// WebhookEvent is a payment webhook request as it reached the bot, kept so failed
+// requests can be inspected and replayed through their handler.
+type WebhookEvent struct {
+	ID             int64               `db:"id"`
+	Provider       string              `db:"provider"`
+	Path           string              `db:"path"`
+	Headers        map[string][]string `db:"headers"`
+	Body           string              `db:"body"`
+	EventID        *string             `db:"event_id"`
+	SignatureValid *bool               `db:"signature_valid"`
+	Status         WebhookEventStatus  `db:"status"`
+	ResponseCode   *int                `db:"response_code"`
+	Error          *string             `db:"error"`
+	PurchaseID     *int64              `db:"purchase_id"`
+	Attempts       int                 `db:"attempts"`
+	CreatedAt      time.Time           `db:"created_at"`
+	UpdatedAt      time.Time           `db:"updated_at"`
+}
+
+const webhookEventColumns = "id, provider, path, headers, body, event_id, signature_valid, status, response_code, error, purchase_id, attempts, created_at, updated_at"
+
+type WebhookEventRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookEventRepository(pool *pgxpool.Pool) *WebhookEventRepository {
+	return &WebhookEventRepository{pool: pool}
+}
+
+func scanWebhookEvent(row pgx.Row, e *WebhookEvent) error {
+	var headers []byte
+	err := row.Scan(
+		&e.ID, &e.Provider, &e.Path, &headers, &e.Body, &e.EventID, &e.SignatureValid, &e.Status,
+		&e.ResponseCode, &e.Error, &e.PurchaseID, &e.Attempts, &e.CreatedAt, &e.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(headers, &e.Headers)
+}
+
+// Create stores a received webhook request and returns its id.
+func (r *WebhookEventRepository) Create(ctx context.Context, event *WebhookEvent) (int64, error) {
+	headers, err := json.Marshal(event.Headers)
+	if err != nil {
+		return 0, fmt.Errorf("marshal webhook headers: %w", err)
+	}
+
+	sql, args, err := sq.Insert("webhook_event").
+		Columns("provider", "path", "headers", "body").
+		Values(event.Provider, event.Path, headers, event.Body).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build insert webhook event query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("insert webhook event: %w", err)
+	}
+	return id, nil
+}
+
+// Claim stores a received webhook request that delivers an event, and reports
+// false when the provider's event was stored before and is handled or being
+// handled. An event that failed, or whose handling was left unfinished for
+// staleAfter, is taken over by the new request, which reuses its row.
+func (r *WebhookEventRepository) Claim(ctx context.Context, event *WebhookEvent, staleAfter time.Duration) (int64, bool, error) {
+	headers, err := json.Marshal(event.Headers)
+	if err != nil {
+		return 0, false, fmt.Errorf("marshal webhook headers: %w", err)
+	}
+
+	sql, args, err := sq.Insert("webhook_event").
+		Columns("provider", "path", "headers", "body", "event_id").
+		Values(event.Provider, event.Path, headers, event.Body, event.EventID).
+		Suffix(`ON CONFLICT (provider, event_id) WHERE event_id IS NOT NULL DO UPDATE
+SET status = ?, path = EXCLUDED.path, headers = EXCLUDED.headers, body = EXCLUDED.body, updated_at = NOW()
+WHERE webhook_event.status = ? OR (webhook_event.status = ? AND webhook_event.updated_at < NOW() - ? * INTERVAL '1 second')
+RETURNING id`, WebhookEventStatusReceived, WebhookEventStatusFailed, WebhookEventStatusReceived, staleAfter.Seconds()).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, false, fmt.Errorf("build claim webhook event query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("claim webhook event: %w", err)
+	}
+	return id, true, nil
+}
+
+func (r *WebhookEventRepository) FindByID(ctx context.Context, id int64) (*WebhookEvent, error) {
+	sql, args, err := sq.Select(webhookEventColumns).
+		From("webhook_event").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select webhook event query: %w", err)
+	}
+
+	event := &WebhookEvent{}
+	if err := scanWebhookEvent(r.pool.QueryRow(ctx, sql, args...), event); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query webhook event: %w", err)
+	}
+	return event, nil
+}
+
+func (r *WebhookEventRepository) FindByStatus(ctx context.Context, status WebhookEventStatus, limit uint64) ([]WebhookEvent, error) {
+	sql, args, err := sq.Select(webhookEventColumns).
+		From("webhook_event").
+		Where(sq.Eq{"status": status}).
+		OrderBy("created_at DESC").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build select webhook events query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []WebhookEvent
+	for rows.Next() {
+		var event WebhookEvent
+		if err := scanWebhookEvent(rows, &event); err != nil {
+			return nil, fmt.Errorf("scan webhook event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook events: %w", err)
+	}
+	return events, nil
+}
+
+// ClaimFailed moves a failed event back to received so it can be replayed, and
+// reports false when the event is not failed.
+func (r *WebhookEventRepository) ClaimFailed(ctx context.Context, id int64) (bool, error) {
+	sql, args, err := sq.Update("webhook_event").
+		Set("status", WebhookEventStatusReceived).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.And{
+			sq.Eq{"id": id},
+			sq.Eq{"status": WebhookEventStatusFailed},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build claim webhook event query: %w", err)
+	}
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("claim webhook event %d: %w", id, err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// Finish records the outcome of an attempt to handle the event.
+func (r *WebhookEventRepository) Finish(ctx context.Context, id int64, status WebhookEventStatus, responseCode int, signatureValid *bool, purchaseID *int64, eventErr *string) error {
+	sql, args, err := sq.Update("webhook_event").
+		Set("status", status).
+		Set("response_code", responseCode).
+		Set("signature_valid", signatureValid).
+		Set("purchase_id", sq.Expr("COALESCE(?, purchase_id)", purchaseID)).
+		Set("error", eventErr).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build update webhook event query: %w", err)
+	}
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update webhook event %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWebhookEventClaimFailedOnlyOnce(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewWebhookEventRepository(pool)
+
+	id, err := repo.Create(ctx, &WebhookEvent{Provider: "tribute", Path: "/tribute", Body: "{}"})
+	if err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+	if claimed, err := repo.ClaimFailed(ctx, id); err != nil || claimed {
+		t.Fatalf("expected an event that did not fail to stay unclaimed, got %v, %v", claimed, err)
+	}
+
+	if err := repo.Finish(ctx, id, WebhookEventStatusFailed, 500, nil, nil, nil); err != nil {
+		t.Fatalf("finish event: %v", err)
+	}
+	if claimed, err := repo.ClaimFailed(ctx, id); err != nil || !claimed {
+		t.Fatalf("expected the failed event to be claimed, got %v, %v", claimed, err)
+	}
+	if claimed, err := repo.ClaimFailed(ctx, id); err != nil || claimed {
+		t.Fatalf("expected a second claim to fail, got %v, %v", claimed, err)
+	}
+}
+
+func TestWebhookEventClaimDropsHandledDuplicates(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewWebhookEventRepository(pool)
+
+	eventID := fmt.Sprintf("event-%d", nextTestTelegramID())
+	event := &WebhookEvent{Provider: "tribute", Path: "/tribute", Body: "{}", EventID: &eventID}
+	id, claimed, err := repo.Claim(ctx, event, time.Hour)
+	if err != nil || !claimed {
+		t.Fatalf("expected the first delivery to be claimed, got %v, %v", claimed, err)
+	}
+	if _, claimed, err := repo.Claim(ctx, event, time.Hour); err != nil || claimed {
+		t.Fatalf("expected a delivery of an event being handled to be dropped, got %v, %v", claimed, err)
+	}
+
+	if err := repo.Finish(ctx, id, WebhookEventStatusFailed, 500, nil, nil, nil); err != nil {
+		t.Fatalf("finish event: %v", err)
+	}
+	retried, claimed, err := repo.Claim(ctx, event, time.Hour)
+	if err != nil || !claimed || retried != id {
+		t.Fatalf("expected a failed event to be taken over in its row, got %d, %v, %v", retried, claimed, err)
+	}
+
+	if err := repo.Finish(ctx, id, WebhookEventStatusProcessed, 200, nil, nil, nil); err != nil {
+		t.Fatalf("finish event: %v", err)
+	}
+	if _, claimed, err := repo.Claim(ctx, event, 0); err != nil || claimed {
+		t.Fatalf("expected a handled event to be dropped, got %v, %v", claimed, err)
+	}
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/utils"
+)
+
+// AutoRenewCallbackHandler turns renewal with the saved payment method on or off
+// and shows the start menu again.
+func (h Handler) AutoRenewCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil || customer.YookasaPaymentMethodID == nil {
+		return
+	}
+
+	err = h.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"auto_renew": !customer.AutoRenew,
+	})
+	if err != nil {
+		slog.Error("Error updating auto-renew", "error", err)
+		return
+	}
+	slog.Info("auto-renew toggled", "customer_id", utils.MaskHalfInt64(customer.ID), "auto_renew", !customer.AutoRenew)
+
+	h.StartCallbackHandler(ctx, b, update)
+}
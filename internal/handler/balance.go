@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+const balanceUsage = "Usage: /balance <telegram id> [<amount> [comment]]\n\nWithout an amount shows the customer's balance, with it credits a compensation."
+
+// balanceInfo is the balance line appended to the start and connect messages. It is
+// empty when the customer has never had any balance.
+func (h Handler) balanceInfo(ctx context.Context, customerID int64, langCode string) string {
+	balance, err := h.paymentService.Balance(ctx, customerID)
+	if err != nil {
+		slog.Error("Error getting balance", "error", err)
+		return ""
+	}
+	if balance == 0 {
+		return ""
+	}
+	return "\n\n" + fmt.Sprintf(h.translation.GetText(langCode, "balance_info"), payment.FormatAmount(balance))
+}
+
+// TopUpCallbackHandler shows the top-up amounts.
+func (h Handler) TopUpCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	var amountButtons []models.InlineKeyboardButton
+	for _, amount := range config.TopUpAmounts() {
+		amountButtons = append(amountButtons, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("%d ₽", amount),
+			CallbackData: fmt.Sprintf("%s?amount=%d", CallbackTopUpSell, amount),
+		})
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for len(amountButtons) > 0 {
+		n := min(2, len(amountButtons))
+		keyboard = append(keyboard, amountButtons[:n])
+		amountButtons = amountButtons[n:]
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart),
+	})
+
+	text := h.translation.GetText(langCode, "topup_info")
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+	} else if customer != nil {
+		text += h.balanceInfo(ctx, customer.ID, langCode)
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+		Text: text,
+	})
+	if err != nil {
+		slog.Error("Error sending top-up message", "error", err)
+	}
+}
+
+// TopUpSellCallbackHandler lists the providers a top-up can be paid with. Only ruble
+// providers that issue an invoice per purchase qualify.
+func (h Handler) TopUpSellCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, provider := range h.paymentService.Providers() {
+		if !canTopUpWith(provider) {
+			continue
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			h.translation.GetButton(langCode, provider.ButtonKey()).InlineCallback(fmt.Sprintf("%s?amount=%s&invoiceType=%s", CallbackTopUpPay, callbackQuery["amount"], provider.InvoiceType())),
+		})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackTopUp),
+	})
+
+	_, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending top-up sell message", "error", err)
+	}
+}
+
+func canTopUpWith(provider payment.Provider) bool {
+	if _, ok := provider.(payment.Settler); ok {
+		return false
+	}
+	if _, ok := provider.(payment.LinkProvider); ok {
+		return false
+	}
+	return provider.Currency() == "RUB"
+}
+
+// TopUpPaymentCallbackHandler creates the top-up purchase and shows its pay button.
+func (h Handler) TopUpPaymentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	amount, err := strconv.Atoi(callbackQuery["amount"])
+	if err != nil || !slices.Contains(config.TopUpAmounts(), amount) {
+		slog.Error("Invalid top-up amount", "amount", callbackQuery["amount"])
+		return
+	}
+	invoiceType := database.InvoiceType(callbackQuery["invoiceType"])
+	provider, ok := h.paymentService.Provider(invoiceType)
+	if !ok || !canTopUpWith(provider) {
+		slog.Error("Invalid top-up invoice type", "invoice_type", invoiceType)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", callback.Chat.ID, "error", err)
+		return
+	}
+
+	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, update.CallbackQuery.From.Username)
+	paymentURL, purchaseId, err := h.paymentService.CreatePurchase(ctxWithUsername, float64(amount), 0, customer, invoiceType, payment.AsTopUp())
+	if err != nil {
+		slog.Error("Error creating top-up payment", "error", err)
+		return
+	}
+
+	message, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{
+					h.translation.GetButton(langCode, "pay_button").InlineURL(paymentURL),
+					h.translation.GetButton(langCode, "back_button").InlineCallback(fmt.Sprintf("%s?amount=%d", CallbackTopUpSell, amount)),
+				},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error updating top-up message", "error", err)
+		return
+	}
+	h.cache.Set(purchaseId, message.ID)
+}
+
+// BalanceCommandHandler shows a customer's balance or credits a compensation to it.
+func (h Handler) BalanceCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := h.balanceCommand(ctx, update.Message.Text)
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending balance message", "error", err)
+	}
+}
+
+func (h Handler) balanceCommand(ctx context.Context, text string) string {
+	telegramID, amount, comment, ok := parseBalanceCommand(text)
+	if !ok {
+		return balanceUsage
+	}
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, telegramID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return fmt.Sprintf("Failed to find customer %d: %v", telegramID, err)
+	}
+	if customer == nil {
+		return fmt.Sprintf("Customer %d not found", telegramID)
+	}
+
+	if amount > 0 {
+		if err := h.paymentService.Compensate(ctx, customer.ID, amount, comment); err != nil {
+			slog.Error("Error crediting compensation", "error", err)
+			return fmt.Sprintf("Failed to credit customer %d: %v", telegramID, err)
+		}
+	}
+
+	balance, err := h.paymentService.Balance(ctx, customer.ID)
+	if err != nil {
+		slog.Error("Error getting balance", "error", err)
+		return fmt.Sprintf("Failed to get balance of customer %d: %v", telegramID, err)
+	}
+	if amount > 0 {
+		return fmt.Sprintf("Credited %s to customer %d, balance %s", payment.FormatAmount(amount), telegramID, payment.FormatAmount(balance))
+	}
+	return fmt.Sprintf("Customer %d balance: %s", telegramID, payment.FormatAmount(balance))
+}
+
+func parseBalanceCommand(text string) (telegramID int64, amount float64, comment string, ok bool) {
+	args := strings.Fields(text)
+	if len(args) < 2 {
+		return 0, 0, "", false
+	}
+	telegramID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || telegramID <= 0 {
+		return 0, 0, "", false
+	}
+	if len(args) == 2 {
+		return telegramID, 0, "", true
+	}
+	amount, err = strconv.ParseFloat(args[2], 64)
+	if err != nil || amount <= 0 {
+		return 0, 0, "", false
+	}
+	return telegramID, amount, strings.Join(args[3:], " "), true
+}
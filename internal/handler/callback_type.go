@@ -1,12 +1,25 @@
 package handler
 
 const (
-	CallbackBuy           = "buy"
-	CallbackSell          = "sell"
-	CallbackStart         = "start"
-	CallbackConnect       = "connect"
-	CallbackPayment       = "payment"
-	CallbackTrial         = "trial"
-	CallbackActivateTrial = "activate_trial"
-	CallbackReferral      = "referral"
+	CallbackBuy                     = "buy"
+	CallbackSell                    = "sell"
+	CallbackStart                   = "start"
+	CallbackConnect                 = "connect"
+	CallbackPayment                 = "payment"
+	CallbackTrial                   = "trial"
+	CallbackActivateTrial           = "activate_trial"
+	CallbackReferral                = "referral"
+	CallbackPromo                   = "promo"
+	CallbackGift                    = "gift"
+	CallbackTopUp                   = "topup"
+	CallbackTopUpSell               = "topup_sell"
+	CallbackTopUpPay                = "topup_pay"
+	CallbackTraffic                 = "traffic"
+	CallbackTrafficSell             = "traffic_sell"
+	CallbackTrafficPay              = "traffic_pay"
+	CallbackAutoRenew               = "auto_renew"
+	CallbackStarsSubscription       = "stars_sub"
+	CallbackStarsSubscriptionToggle = "stars_sub_toggle"
+	CallbackLinkReset               = "link_reset"
+	CallbackLinkResetConfirm        = "link_reset_confirm"
 )
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"remnawave-tg-shop-bot/internal/config"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"log/slog"
 
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/utils"
 )
@@ -38,12 +40,15 @@ func (h Handler) ConnectCommandHandler(ctx context.Context, b *bot.Bot, update *
 			markup = append(markup, []models.InlineKeyboardButton{bd.InlineWebApp(*customer.SubscriptionLink)})
 		}
 	}
+	if customer.ExpireAt != nil && customer.ExpireAt.After(time.Now()) {
+		markup = append(markup, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "link_reset_button").InlineCallback(CallbackLinkReset)})
+	}
 	markup = append(markup, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart)})
 
 	isDisabled := true
 	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    update.Message.Chat.ID,
-		Text:      buildConnectText(customer, langCode),
+		Text:      buildConnectText(customer, langCode) + h.trafficInfo(ctx, customer, langCode) + h.balanceInfo(ctx, customer.ID, langCode),
 		ParseMode: models.ParseModeHTML,
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
@@ -82,6 +87,9 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 			markup = append(markup, []models.InlineKeyboardButton{cbd.InlineWebApp(*customer.SubscriptionLink)})
 		}
 	}
+	if customer.ExpireAt != nil && customer.ExpireAt.After(time.Now()) {
+		markup = append(markup, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "link_reset_button").InlineCallback(CallbackLinkReset)})
+	}
 	markup = append(markup, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart)})
 
 	isDisabled := true
@@ -89,7 +97,7 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
 		ParseMode: models.ParseModeHTML,
-		Text:      buildConnectText(customer, langCode),
+		Text:      buildConnectText(customer, langCode) + h.trafficInfo(ctx, customer, langCode) + h.balanceInfo(ctx, customer.ID, langCode),
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
 		},
@@ -134,3 +142,53 @@ func buildConnectText(customer *database.Customer, langCode string) string {
 
 	return info.String()
 }
+
+// trafficUsageTimeout bounds the panel request of the connect screen, which is
+// shown without usage when the panel is slow.
+const trafficUsageTimeout = 3 * time.Second
+
+// progressBarWidth is the number of cells of the traffic usage bar.
+const progressBarWidth = 10
+
+// trafficInfo is the traffic usage appended to the connect message. It is empty
+// without an active subscription or when the usage cannot be fetched.
+func (h Handler) trafficInfo(ctx context.Context, customer *database.Customer, langCode string) string {
+	if customer.ExpireAt == nil || customer.ExpireAt.Before(time.Now()) {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, trafficUsageTimeout)
+	defer cancel()
+	usage, err := h.paymentService.TrafficUsage(ctx, customer)
+	if err != nil {
+		if !errors.Is(err, remnawave.ErrNotFound) {
+			slog.Error("Error getting traffic usage", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+		}
+		return ""
+	}
+
+	var info strings.Builder
+	if usage.LimitBytes > 0 {
+		percent := min(usage.UsedBytes*100/usage.LimitBytes, 100)
+		info.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "traffic_usage"),
+			utils.FormatBytes(usage.UsedBytes), utils.FormatBytes(usage.LimitBytes), progressBar(usage.UsedBytes, usage.LimitBytes), percent))
+		if reset, ok := usage.NextResetAt(time.Now()); ok && reset.Before(*customer.ExpireAt) {
+			info.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "traffic_reset"), reset.Format("02.01.2006")))
+		}
+	} else {
+		info.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "traffic_usage_unlimited"), utils.FormatBytes(usage.UsedBytes)))
+	}
+
+	if usage.Online {
+		info.WriteString(h.translation.GetText(langCode, "traffic_online"))
+	} else if usage.OnlineAt != nil {
+		info.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "traffic_last_online"), usage.OnlineAt.Format("02.01.2006 15:04")))
+	}
+	return info.String()
+}
+
+// progressBar draws used out of limit as a bar of filled and empty cells.
+func progressBar(used, limit int64) string {
+	filled := int(min(used*progressBarWidth/limit, progressBarWidth))
+	return strings.Repeat("▰", filled) + strings.Repeat("▱", progressBarWidth-filled)
+}
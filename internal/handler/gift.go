@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+func (h Handler) redeemGift(ctx context.Context, b *bot.Bot, customer *database.Customer, langCode, code string) {
+	gift, err := h.paymentService.RedeemGift(ctx, customer, code)
+
+	var text string
+	switch {
+	case errors.Is(err, database.ErrGiftNotFound):
+		text = h.translation.GetText(langCode, "promo_not_found")
+	case errors.Is(err, database.ErrGiftAlreadyRedeemed):
+		text = h.translation.GetText(langCode, "gift_already_redeemed")
+	case errors.Is(err, remnawave.ErrUnavailable):
+		text = h.translation.GetText(langCode, "panel_unavailable")
+	case err != nil:
+		slog.Error("Error redeeming gift", "error", err)
+		text = h.translation.GetText(langCode, "promo_error")
+	default:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "gift_redeemed"), gift.Days)
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart)},
+			},
+		},
+		Text: text,
+	})
+	if err != nil {
+		slog.Error("Error sending gift result message", "error", err)
+	}
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"time"
+
 	"remnawave-tg-shop-bot/internal/cache"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/remnawave"
 	"remnawave-tg-shop-bot/internal/sync"
 	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/internal/webhook"
 	"remnawave-tg-shop-bot/internal/yookasa"
 )
 
@@ -19,7 +23,12 @@ type Handler struct {
 	paymentService     *payment.PaymentService
 	syncService        *sync.SyncService
 	referralRepository *database.ReferralRepository
+	outboxRepository   *database.OutboxRepository
+	promoRepository    *database.PromoRepository
 	cache              *cache.Cache
+	promoInput         *cache.Cache
+	webhookRecorder    *webhook.Recorder
+	remnawaveClient    *remnawave.Client
 }
 
 func NewHandler(
@@ -29,7 +38,7 @@ func NewHandler(
 	customerRepository *database.CustomerRepository,
 	purchaseRepository *database.PurchaseRepository,
 	cryptoPayClient *cryptopay.Client,
-	yookasaClient *yookasa.Client, referralRepository *database.ReferralRepository, cache *cache.Cache) *Handler {
+	yookasaClient *yookasa.Client, referralRepository *database.ReferralRepository, outboxRepository *database.OutboxRepository, promoRepository *database.PromoRepository, cache *cache.Cache, webhookRecorder *webhook.Recorder, remnawaveClient *remnawave.Client) *Handler {
 	return &Handler{
 		syncService:        syncService,
 		paymentService:     paymentService,
@@ -39,6 +48,16 @@ func NewHandler(
 		yookasaClient:      yookasaClient,
 		translation:        translation,
 		referralRepository: referralRepository,
+		outboxRepository:   outboxRepository,
+		promoRepository:    promoRepository,
 		cache:              cache,
+		promoInput:         newPromoInputCache(),
+		webhookRecorder:    webhookRecorder,
+		remnawaveClient:    remnawaveClient,
 	}
 }
+
+// newPromoInputCache tracks users asked to type a promo code, keyed by Telegram ID.
+func newPromoInputCache() *cache.Cache {
+	return cache.NewCache(10 * time.Minute)
+}
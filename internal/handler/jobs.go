@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+const failedJobsLimit = 20
+
+func (h Handler) JobsCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	jobs, err := h.outboxRepository.FindByStatus(ctx, database.OutboxJobStatusDead, failedJobsLimit)
+	if err != nil {
+		slog.Error("Error finding failed jobs", "error", err)
+		return
+	}
+
+	text := "No failed jobs"
+	if len(jobs) > 0 {
+		var sb strings.Builder
+		sb.WriteString("Failed jobs:\n")
+		for _, job := range jobs {
+			lastError := ""
+			if job.LastError != nil {
+				lastError = *job.LastError
+			}
+			fmt.Fprintf(&sb, "\n#%d %s (%d attempts, %s)\n%s\n", job.ID, job.Kind, job.Attempts, job.UpdatedAt.Format("2006-01-02 15:04"), lastError)
+		}
+		sb.WriteString("\nRetry with /retry <id>")
+		text = sb.String()
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending jobs message", "error", err)
+	}
+}
+
+func (h Handler) RetryJobCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := "Usage: /retry <id>"
+	args := strings.Fields(update.Message.Text)
+	if len(args) == 2 {
+		if id, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+			retried, err := h.outboxRepository.Retry(ctx, id)
+			switch {
+			case err != nil:
+				slog.Error("Error retrying job", "error", err, "job_id", id)
+				text = "Failed to retry job, check logs"
+			case !retried:
+				text = fmt.Sprintf("Job #%d not found among failed jobs", id)
+			default:
+				text = fmt.Sprintf("Job #%d scheduled for retry", id)
+			}
+		}
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending retry message", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// LinkResetCallbackHandler asks the customer to confirm the subscription link
+// reset, or tells when it is possible again.
+func (h Handler) LinkResetCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(callback.Chat.ID), "error", err)
+		return
+	}
+
+	next, err := h.paymentService.NextLinkReset(ctx, customer)
+	if err != nil {
+		slog.Error("Error finding last link reset", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+		return
+	}
+	if !next.IsZero() {
+		h.showLinkResetResult(ctx, b, callback, langCode, fmt.Sprintf(h.translation.GetText(langCode, "link_reset_cooldown"), next.Format("02.01.2006 15:04")))
+		return
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "link_reset_confirm"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, "link_reset_confirm_button").InlineCallback(CallbackLinkResetConfirm)},
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackConnect)},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending link reset message", "error", err)
+	}
+}
+
+// LinkResetConfirmCallbackHandler revokes the subscription link and shows the new
+// one.
+func (h Handler) LinkResetConfirmCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(callback.Chat.ID), "error", err)
+		return
+	}
+
+	var text string
+	link, err := h.paymentService.ResetSubscriptionLink(ctx, customer)
+	switch {
+	case errors.Is(err, database.ErrLinkResetCooldown):
+		h.LinkResetCallbackHandler(ctx, b, update)
+		return
+	case errors.Is(err, database.ErrLinkResetNotSaved):
+		slog.Error("Error saving subscription link reset", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+		text = fmt.Sprintf(h.translation.GetText(langCode, "link_reset_not_saved"), link)
+	case errors.Is(err, remnawave.ErrUnavailable):
+		text = h.translation.GetText(langCode, "panel_unavailable")
+	case err != nil:
+		slog.Error("Error resetting subscription link", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+		text = h.translation.GetText(langCode, "link_reset_failed")
+	default:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "link_reset_done"), link)
+	}
+	h.showLinkResetResult(ctx, b, callback, langCode, text)
+}
+
+func (h Handler) showLinkResetResult(ctx context.Context, b *bot.Bot, callback *models.Message, langCode string, text string) {
+	isDisabled := true
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		LinkPreviewOptions: &models.LinkPreviewOptions{
+			IsDisabled: &isDisabled,
+		},
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackConnect)},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending link reset message", "error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// PanelCacheCommandHandler shows the hit and miss counters of the cached panel
+// squads and nodes. "/panel_cache reset" drops the cache.
+func (h Handler) PanelCacheCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	var sb strings.Builder
+	if strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/panel_cache")) == "reset" {
+		h.remnawaveClient.InvalidateCache()
+		slog.Info("panel cache invalidated by admin")
+		sb.WriteString("Panel cache reset\n\n")
+	}
+
+	stats := h.remnawaveClient.CacheStats()
+	fmt.Fprintf(&sb, "Panel cache (hits / misses):\nInternal squads: %d / %d\nExternal squads: %d / %d\nNodes: %d / %d\n\nReset with /panel_cache reset",
+		stats.InternalSquads.Hits, stats.InternalSquads.Misses,
+		stats.ExternalSquads.Hits, stats.ExternalSquads.Misses,
+		stats.Nodes.Hits, stats.Nodes.Misses)
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   sb.String(),
+	})
+	if err != nil {
+		slog.Error("Error sending panel cache message", "error", err)
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -13,6 +14,7 @@ import (
 
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/internal/remnawave"
 )
 
@@ -20,37 +22,24 @@ func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *mod
 	callback := update.CallbackQuery.Message.Message
 	langCode := update.CallbackQuery.From.LanguageCode
 
-	var priceButtons []models.InlineKeyboardButton
+	keyboard := h.planKeyboard(ctx, langCode, "")
 
-	if config.Price1() > 0 {
-		priceButtons = append(priceButtons, h.translation.GetButton(langCode, "month_1").InlineCallback(fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 1, config.Price1())))
-	}
-
-	if config.Price3() > 0 {
-		priceButtons = append(priceButtons, h.translation.GetButton(langCode, "month_3").InlineCallback(fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 3, config.Price3())))
-	}
-
-	if config.Price6() > 0 {
-		priceButtons = append(priceButtons, h.translation.GetButton(langCode, "month_6").InlineCallback(fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 6, config.Price6())))
-	}
-
-	if config.Price12() > 0 {
-		priceButtons = append(priceButtons, h.translation.GetButton(langCode, "month_12").InlineCallback(fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 12, config.Price12())))
-	}
-
-	keyboard := [][]models.InlineKeyboardButton{}
-
-	if len(priceButtons) == 4 {
-		keyboard = append(keyboard, priceButtons[:2])
-		keyboard = append(keyboard, priceButtons[2:])
-	} else if len(priceButtons) > 0 {
-		keyboard = append(keyboard, priceButtons)
-	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		h.translation.GetButton(langCode, "promo_button").InlineCallback(CallbackPromo),
+		h.translation.GetButton(langCode, "gift_button").InlineCallback(CallbackGift),
+	})
 
 	keyboard = append(keyboard, []models.InlineKeyboardButton{
 		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart),
 	})
 
+	h.promoInput.Delete(update.CallbackQuery.From.ID)
+
+	text := h.translation.GetText(langCode, "pricing_info")
+	if promo := h.activePromoCode(ctx, callback.Chat.ID); promo != nil {
+		text += "\n\n" + fmt.Sprintf(h.translation.GetText(langCode, "promo_active"), promo.Code, h.promoEffect(ctx, langCode, promo))
+	}
+
 	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
@@ -58,7 +47,7 @@ func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *mod
 		ReplyMarkup: models.InlineKeyboardMarkup{
 			InlineKeyboard: keyboard,
 		},
-		Text: h.translation.GetText(langCode, "pricing_info"),
+		Text: text,
 	})
 
 	if err != nil {
@@ -66,96 +55,126 @@ func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *mod
 	}
 }
 
-func (h Handler) SellCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+// GiftCallbackHandler shows the plans that can be bought as a gift for someone else.
+func (h Handler) GiftCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	callback := update.CallbackQuery.Message.Message
-	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
 	langCode := update.CallbackQuery.From.LanguageCode
-	month := callbackQuery["month"]
-	amount := callbackQuery["amount"]
 
-	var keyboard [][]models.InlineKeyboardButton
+	keyboard := h.planKeyboard(ctx, langCode, giftQuery)
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackBuy),
+	})
 
-	if config.IsCryptoPayEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "crypto_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypeCrypto, amount)),
-		})
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+		Text: h.translation.GetText(langCode, "gift_info"),
+	})
+	if err != nil {
+		slog.Error("Error sending gift message", "error", err)
 	}
+}
 
-	if config.IsYookasaEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "card_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypeYookasa, amount)),
-		})
+// planKeyboard lists the plans of the catalog two per row under their names, suffix
+// is appended to their callback data.
+func (h Handler) planKeyboard(ctx context.Context, langCode string, suffix string) [][]models.InlineKeyboardButton {
+	plans, err := h.paymentService.Plans(ctx)
+	if err != nil {
+		slog.Error("Error loading plans", "error", err)
+		return [][]models.InlineKeyboardButton{}
 	}
 
-	if config.IsPlategaSBPEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "platega_sbp_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypePlategaSBP, amount)),
-		})
+	keyboard := [][]models.InlineKeyboardButton{}
+	for i, plan := range plans {
+		label := h.translation.GetButton(langCode, "plan_button")
+		label.Text = fmt.Sprintf(label.Text, plan.Name)
+		button := label.InlineCallback(fmt.Sprintf("%s?plan=%d%s", CallbackSell, plan.ID, suffix))
+		if i%2 == 0 {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{button})
+		} else {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
 	}
+	return keyboard
+}
 
-	if config.IsPlategaCardsEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "platega_cards_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypePlategaCards, amount)),
-		})
+// callbackPlan returns the plan selected in the callback data.
+func (h Handler) callbackPlan(ctx context.Context, callbackQuery map[string]string) (*database.Plan, error) {
+	planID, err := strconv.ParseInt(callbackQuery["plan"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse plan id: %w", err)
 	}
+	return h.paymentService.Plan(ctx, planID)
+}
 
-	if config.IsPlategaAcquiringEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "platega_acquiring_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypePlategaAcquiring, amount)),
-		})
+func (h Handler) activePromoCode(ctx context.Context, telegramId int64) *database.PromoCode {
+	customer, err := h.customerRepository.FindByTelegramId(ctx, telegramId)
+	if err != nil || customer == nil {
+		return nil
 	}
-
-	if config.IsPlategaWorldwideEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "platega_worldwide_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypePlategaWorldwide, amount)),
-		})
+	promo, err := h.paymentService.ActivePromoCode(ctx, customer.ID)
+	if err != nil {
+		slog.Error("Error finding active promo code", "error", err)
+		return nil
 	}
+	return promo
+}
 
-	if config.IsPlategaCryptoEnabled() {
-		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "platega_crypto_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypePlategaCrypto, amount)),
-		})
+func (h Handler) SellCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+	langCode := update.CallbackQuery.From.LanguageCode
+	gift := isGiftCallback(callbackQuery)
+
+	plan, err := h.callbackPlan(ctx, callbackQuery)
+	if err != nil {
+		slog.Error("Error getting plan from query", "error", err)
+		return
 	}
 
-	if config.IsTelegramStarsEnabled() {
-		shouldShowStarsButton := true
+	var keyboard [][]models.InlineKeyboardButton
 
-		if config.RequirePaidPurchaseForStars() {
-			customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
-			if err != nil {
-				slog.Error("Error finding customer for stars check", "error", err)
-				shouldShowStarsButton = false
-			} else if customer != nil {
-				paidPurchase, err := h.purchaseRepository.FindSuccessfulPaidPurchaseByCustomer(ctx, customer.ID)
-				if err != nil {
-					slog.Error("Error checking paid purchase", "error", err)
-					shouldShowStarsButton = false
-				} else if paidPurchase == nil {
-					shouldShowStarsButton = false
-				}
-			} else {
-				shouldShowStarsButton = false
+	for _, provider := range h.paymentService.Providers() {
+		button := h.translation.GetButton(langCode, provider.ButtonKey())
+
+		if provider.InvoiceType() == database.InvoiceTypeBalance && !h.hasBalance(ctx, callback.Chat.ID) {
+			continue
+		}
+
+		if linkProvider, ok := provider.(payment.LinkProvider); ok {
+			// Link providers sell a recurring subscription to the payer and cannot be gifted.
+			if !gift {
+				keyboard = append(keyboard, []models.InlineKeyboardButton{button.InlineURL(linkProvider.CheckoutURL())})
 			}
+			continue
 		}
 
-		if shouldShowStarsButton {
-			keyboard = append(keyboard, []models.InlineKeyboardButton{
-				h.translation.GetButton(langCode, "stars_button").InlineCallback(fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypeTelegram, amount)),
-			})
+		if _, ok := plan.Price(provider.InvoiceType(), provider.Currency()); !ok {
+			continue
+		}
+
+		if provider.InvoiceType() == database.InvoiceTypeTelegram && !h.canPayWithStars(ctx, callback.Chat.ID) {
+			continue
 		}
-	}
 
-	if config.GetTributeWebHookUrl() != "" {
 		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			h.translation.GetButton(langCode, "tribute_button").InlineURL(config.GetTributePaymentUrl()),
+			button.InlineCallback(fmt.Sprintf("%s?plan=%d&invoiceType=%s%s", CallbackPayment, plan.ID, provider.InvoiceType(), giftSuffix(gift))),
 		})
 	}
 
+	back := CallbackBuy
+	if gift {
+		back = CallbackGift
+	}
 	keyboard = append(keyboard, []models.InlineKeyboardButton{
-		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackBuy),
+		h.translation.GetButton(langCode, "back_button").InlineCallback(back),
 	})
 
-	_, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+	_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
 		ReplyMarkup: models.InlineKeyboardMarkup{
@@ -168,23 +187,45 @@ func (h Handler) SellCallbackHandler(ctx context.Context, b *bot.Bot, update *mo
 	}
 }
 
-func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	callback := update.CallbackQuery.Message.Message
-	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
-	month, err := strconv.Atoi(callbackQuery["month"])
+func (h Handler) hasBalance(ctx context.Context, telegramId int64) bool {
+	customer, err := h.customerRepository.FindByTelegramId(ctx, telegramId)
+	if err != nil || customer == nil {
+		return false
+	}
+	balance, err := h.paymentService.Balance(ctx, customer.ID)
 	if err != nil {
-		slog.Error("Error getting month from query", "error", err)
-		return
+		slog.Error("Error getting balance", "error", err)
+		return false
+	}
+	return balance > 0
+}
+
+func (h Handler) canPayWithStars(ctx context.Context, telegramId int64) bool {
+	if !config.RequirePaidPurchaseForStars() {
+		return true
 	}
 
-	invoiceType := database.InvoiceType(callbackQuery["invoiceType"])
+	customer, err := h.customerRepository.FindByTelegramId(ctx, telegramId)
+	if err != nil {
+		slog.Error("Error finding customer for stars check", "error", err)
+		return false
+	}
+	if customer == nil {
+		return false
+	}
 
-	var price int
-	if invoiceType == database.InvoiceTypeTelegram {
-		price = config.StarsPrice(month)
-	} else {
-		price = config.Price(month)
+	paidPurchase, err := h.purchaseRepository.FindSuccessfulPaidPurchaseByCustomer(ctx, customer.ID)
+	if err != nil {
+		slog.Error("Error checking paid purchase", "error", err)
+		return false
 	}
+	return paidPurchase != nil
+}
+
+func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+	invoiceType := database.InvoiceType(callbackQuery["invoiceType"])
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
@@ -198,14 +239,50 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 		return
 	}
 
+	plan, err := h.callbackPlan(ctx, callbackQuery)
+	if err != nil {
+		slog.Error("Error getting plan from query", "error", err)
+		return
+	}
+
+	gift := isGiftCallback(callbackQuery)
+	sellCallback := fmt.Sprintf("%s?plan=%d%s", CallbackSell, plan.ID, giftSuffix(gift))
+
+	var opts []payment.PurchaseOption
+	if gift {
+		opts = append(opts, payment.AsGift())
+	}
+	promo, err := h.paymentService.ActivePromoCode(ctx, customer.ID)
+	if err != nil {
+		slog.Error("Error finding active promo code", "error", err)
+	} else if promo != nil {
+		opts = append(opts, payment.WithPromoCode(promo))
+	}
+
+	langCode := update.CallbackQuery.From.LanguageCode
+
 	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, update.CallbackQuery.From.Username)
-	paymentURL, purchaseId, err := h.paymentService.CreatePurchase(ctxWithUsername, float64(price), month, customer, invoiceType)
+	paymentURL, purchaseId, err := h.paymentService.CreatePlanPurchase(ctxWithUsername, plan, customer, invoiceType, opts...)
+	if errors.Is(err, database.ErrInsufficientBalance) {
+		h.sendInsufficientBalance(ctx, b, callback, langCode, sellCallback)
+		return
+	}
 	if err != nil {
 		slog.Error("Error creating payment", "error", err)
 		return
 	}
 
-	langCode := update.CallbackQuery.From.LanguageCode
+	if invoiceType == database.InvoiceTypeBalance {
+		// Paid already, the activation message replaces the sell message.
+		_, err = b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+			ChatID:    callback.Chat.ID,
+			MessageID: callback.ID,
+		})
+		if err != nil {
+			slog.Error("Error deleting sell message", "error", err)
+		}
+		return
+	}
 
 	message, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
 		ChatID:    callback.Chat.ID,
@@ -214,7 +291,7 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 			InlineKeyboard: [][]models.InlineKeyboardButton{
 				{
 					h.translation.GetButton(langCode, "pay_button").InlineURL(paymentURL),
-					h.translation.GetButton(langCode, "back_button").InlineCallback(fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, month, price)),
+					h.translation.GetButton(langCode, "back_button").InlineCallback(sellCallback),
 				},
 			},
 		},
@@ -226,30 +303,132 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 	h.cache.Set(purchaseId, message.ID)
 }
 
+func (h Handler) sendInsufficientBalance(ctx context.Context, b *bot.Bot, callback *models.Message, langCode string, back string) {
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "balance_insufficient"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, "topup_button").InlineCallback(CallbackTopUp)},
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(back)},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending insufficient balance message", "error", err)
+	}
+}
+
 func (h Handler) PreCheckoutCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	_, err := b.AnswerPreCheckoutQuery(ctx, &bot.AnswerPreCheckoutQueryParams{
+	params := &bot.AnswerPreCheckoutQueryParams{
 		PreCheckoutQueryID: update.PreCheckoutQuery.ID,
 		OK:                 true,
-	})
+	}
+
+	// Stars invoice links cannot be revoked, so refuse to charge for a purchase
+	// that has expired or was already paid.
+	purchaseId, err := strconv.ParseInt(strings.Split(update.PreCheckoutQuery.InvoicePayload, "&")[0], 10, 64)
+	if err == nil {
+		purchase, findErr := h.purchaseRepository.FindById(ctx, purchaseId)
+		if findErr != nil {
+			slog.Error("Error finding purchase for pre checkout", "error", findErr)
+		} else if purchase == nil || purchase.Status != database.PurchaseStatusPending && !h.starsSubscriptionRenewable(ctx, purchase) {
+			params.OK = false
+			params.ErrorMessage = h.translation.GetText(update.PreCheckoutQuery.From.LanguageCode, "invoice_expired")
+		}
+	}
+
+	_, err = b.AnswerPreCheckoutQuery(ctx, params)
 	if err != nil {
 		slog.Error("Error sending answer pre checkout query", "error", err)
 	}
 }
 
+// SuccessPaymentHandler processes Stars payments. Renewals of a Stars subscription
+// carry the payload of the purchase that started it and are recorded as new
+// purchases.
 func (h Handler) SuccessPaymentHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	payload := strings.Split(update.Message.SuccessfulPayment.InvoicePayload, "&")
+	successfulPayment := update.Message.SuccessfulPayment
+	payload := strings.Split(successfulPayment.InvoicePayload, "&")
 	purchaseId, err := strconv.Atoi(payload[0])
 	username := payload[1]
 	if err != nil {
 		slog.Error("Error parsing purchase id", "error", err)
 		return
 	}
-
 	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, username)
-	err = h.paymentService.ProcessPurchaseById(ctxWithUsername, int64(purchaseId))
+	expiresAt := time.Unix(int64(successfulPayment.SubscriptionExpirationDate), 0)
+
+	if successfulPayment.IsRecurring && !successfulPayment.IsFirstRecurring {
+		err = h.paymentService.RenewStarsSubscription(ctxWithUsername, int64(purchaseId), successfulPayment.TelegramPaymentChargeID, float64(successfulPayment.TotalAmount), successfulPayment.Currency, expiresAt)
+		if err != nil {
+			slog.Error("Error renewing stars subscription", "error", err)
+		}
+		return
+	}
+
+	// The charged amount is saved with the charge id, so the reconciliation checks
+	// a retried payment against what Telegram charged.
+	err = h.purchaseRepository.UpdateFields(ctx, int64(purchaseId), map[string]interface{}{
+		"telegram_charge_id":     successfulPayment.TelegramPaymentChargeID,
+		"telegram_paid_amount":   float64(successfulPayment.TotalAmount),
+		"telegram_paid_currency": successfulPayment.Currency,
+	})
+	if err != nil {
+		slog.Error("Error saving telegram charge", "error", err)
+	}
+
+	// The subscription is recorded before the payment is processed, so it renews
+	// even when processing fails now and is retried by the reconciliation.
+	if successfulPayment.IsFirstRecurring {
+		err = h.paymentService.StartStarsSubscription(ctx, int64(purchaseId), successfulPayment.TelegramPaymentChargeID, expiresAt)
+		if err != nil {
+			slog.Error("Error starting stars subscription", "error", err)
+		}
+	}
+
+	err = h.paymentService.ProcessPaidPurchase(ctxWithUsername, int64(purchaseId), float64(successfulPayment.TotalAmount), successfulPayment.Currency)
 	if err != nil {
 		slog.Error("Error processing purchase", "error", err)
+		if !errors.Is(err, payment.ErrPaymentMismatch) {
+			_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   fmt.Sprintf(h.translation.GetText(update.Message.From.LanguageCode, "payment_processing_delayed"), purchaseId),
+			})
+			if err != nil {
+				slog.Error("Error sending payment delayed message", "error", err)
+			}
+		}
+		return
+	}
+
+	if successfulPayment.IsFirstRecurring {
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    update.Message.Chat.ID,
+			ParseMode: models.ParseModeHTML,
+			Text:      fmt.Sprintf(h.translation.GetText(update.Message.From.LanguageCode, "stars_subscription_started"), expiresAt.Format("02.01.2006")),
+		})
+		if err != nil {
+			slog.Error("Error sending stars subscription message", "error", err)
+		}
+	}
+}
+
+// giftQuery marks sell and payment callbacks of the gift flow. Callback data is
+// limited to 64 bytes, so it is kept short.
+const giftQuery = "&gift=1"
+
+func isGiftCallback(callbackQuery map[string]string) bool {
+	return callbackQuery["gift"] == "1"
+}
+
+func giftSuffix(gift bool) string {
+	if gift {
+		return giftQuery
 	}
+	return ""
 }
 
 func parseCallbackData(data string) map[string]string {
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+const (
+	promoDeepLinkPrefix = "promo_"
+	promoListLimit      = 20
+	promoUsage          = "Usage:\n/promo - list recent codes\n/promo add <code> <percent|fixed|bonus_days|free_period> <value> [max=N] [per_user=N] [plan=ID] [from=YYYY-MM-DD] [until=YYYY-MM-DD]"
+)
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// AwaitingPromoCode reports whether the user pressed the promo button and the next
+// text message should be treated as a promo code.
+func (h Handler) AwaitingPromoCode(telegramID int64) bool {
+	_, ok := h.promoInput.Get(telegramID)
+	return ok
+}
+
+func (h Handler) PromoCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	h.promoInput.Set(update.CallbackQuery.From.ID, callback.ID)
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackBuy)},
+			},
+		},
+		Text: h.translation.GetText(langCode, "promo_enter"),
+	})
+	if err != nil {
+		slog.Error("Error sending promo message", "error", err)
+	}
+}
+
+func (h Handler) PromoCodeMessageHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.promoInput.Delete(update.Message.From.ID)
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, update.Message.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", update.Message.Chat.ID)
+		return
+	}
+
+	h.applyPromoCode(ctx, b, customer, update.Message.From.LanguageCode, update.Message.Text)
+}
+
+func (h Handler) applyPromoCode(ctx context.Context, b *bot.Bot, customer *database.Customer, langCode, code string) {
+	promo, err := h.paymentService.ApplyPromoCode(ctx, customer, code)
+
+	var text string
+	keyboard := [][]models.InlineKeyboardButton{
+		{h.translation.GetButton(langCode, "buy_button").InlineCallback(CallbackBuy)},
+	}
+	switch {
+	case errors.Is(err, database.ErrPromoNotFound):
+		// The promo code field also accepts gift codes.
+		h.redeemGift(ctx, b, customer, langCode, code)
+		return
+	case errors.Is(err, database.ErrPromoNotActive):
+		text = h.translation.GetText(langCode, "promo_not_active")
+	case errors.Is(err, database.ErrPromoExhausted):
+		text = h.translation.GetText(langCode, "promo_exhausted")
+	case errors.Is(err, database.ErrPromoAlreadyUsed):
+		text = h.translation.GetText(langCode, "promo_already_used")
+	case errors.Is(err, remnawave.ErrUnavailable):
+		text = h.translation.GetText(langCode, "panel_unavailable")
+	case err != nil:
+		slog.Error("Error applying promo code", "error", err)
+		text = h.translation.GetText(langCode, "promo_error")
+	case promo.Type == database.PromoTypeFreePeriod:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "promo_free_period_activated"), promo.Value)
+		keyboard = [][]models.InlineKeyboardButton{
+			{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart)},
+		}
+	default:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "promo_applied"), promo.Code, h.promoEffect(ctx, langCode, promo))
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+		Text: text,
+	})
+	if err != nil {
+		slog.Error("Error sending promo result message", "error", err)
+	}
+}
+
+func (h Handler) promoEffect(ctx context.Context, langCode string, promo *database.PromoCode) string {
+	effect := fmt.Sprintf(h.translation.GetText(langCode, "promo_effect_"+string(promo.Type)), promo.Value)
+	if promo.PlanID != nil {
+		plan, err := h.paymentService.Plan(ctx, *promo.PlanID)
+		if err != nil {
+			if !errors.Is(err, payment.ErrPlanNotFound) {
+				slog.Error("Error finding promo code plan", "error", err, "promo_id", promo.ID)
+			}
+			return effect
+		}
+		effect += fmt.Sprintf(h.translation.GetText(langCode, "promo_effect_plan"), plan.Name)
+	}
+	return effect
+}
+
+func (h Handler) PromoCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	args := strings.Fields(update.Message.Text)
+
+	var text string
+	switch {
+	case len(args) == 1:
+		text = h.listPromoCodes(ctx)
+	case args[1] == "add":
+		promo, err := parsePromoCommand(args[2:])
+		if err != nil {
+			text = fmt.Sprintf("%v\n\n%s", err, promoUsage)
+			break
+		}
+		if promo.PlanID != nil {
+			if _, err := h.paymentService.Plan(ctx, *promo.PlanID); err != nil {
+				text = fmt.Sprintf("Plan #%d: %v", *promo.PlanID, err)
+				break
+			}
+		}
+		id, err := h.promoRepository.Create(ctx, promo)
+		if err != nil {
+			slog.Error("Error creating promo code", "error", err)
+			text = fmt.Sprintf("Failed to create promo code: %v", err)
+			break
+		}
+		text = fmt.Sprintf("Promo code #%d %s created\nDeep link: %s?start=%s%s", id, promo.Code, config.BotURL(), promoDeepLinkPrefix, promo.Code)
+	default:
+		text = promoUsage
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending promo command message", "error", err)
+	}
+}
+
+func (h Handler) listPromoCodes(ctx context.Context) string {
+	promos, err := h.promoRepository.FindRecent(ctx, promoListLimit)
+	if err != nil {
+		slog.Error("Error finding promo codes", "error", err)
+		return "Failed to load promo codes, check logs"
+	}
+	if len(promos) == 0 {
+		return "No promo codes\n\n" + promoUsage
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Promo codes:\n")
+	for _, promo := range promos {
+		maxUses := "∞"
+		if promo.MaxUses != nil {
+			maxUses = strconv.Itoa(*promo.MaxUses)
+		}
+		fmt.Fprintf(&sb, "\n#%d %s %s %d, used %d/%s", promo.ID, promo.Code, promo.Type, promo.Value, promo.UsedCount, maxUses)
+		if promo.PlanID != nil {
+			fmt.Fprintf(&sb, ", plan #%d only", *promo.PlanID)
+		}
+		if promo.ValidUntil != nil {
+			fmt.Fprintf(&sb, ", until %s", promo.ValidUntil.Format("2006-01-02"))
+		}
+	}
+	return sb.String()
+}
+
+// parsePromoCommand builds a promo code from "<code> <type> <value> [key=value...]".
+func parsePromoCommand(args []string) (*database.PromoCode, error) {
+	if len(args) < 3 {
+		return nil, errors.New("not enough arguments")
+	}
+
+	promo := &database.PromoCode{
+		Code:         database.NormalizePromoCode(args[0]),
+		Type:         database.PromoType(args[1]),
+		PerUserLimit: 1,
+	}
+	if !promoCodePattern.MatchString(promo.Code) {
+		return nil, errors.New("code must be 3-32 latin letters, digits, _ or -")
+	}
+
+	value, err := strconv.Atoi(args[2])
+	if err != nil || value <= 0 {
+		return nil, errors.New("value must be a positive number")
+	}
+	promo.Value = value
+
+	switch promo.Type {
+	case database.PromoTypePercent:
+		if value >= 100 {
+			return nil, errors.New("percent must be below 100, use free_period for free access")
+		}
+	case database.PromoTypeFixed, database.PromoTypeBonusDays, database.PromoTypeFreePeriod:
+	default:
+		return nil, fmt.Errorf("unknown type %q", args[1])
+	}
+
+	for _, arg := range args[3:] {
+		key, val, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid option %q", arg)
+		}
+		switch key {
+		case "plan":
+			id, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, errors.New("plan must be a plan id")
+			}
+			promo.PlanID = &id
+		case "max", "per_user":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("%s must be a positive number", key)
+			}
+			switch key {
+			case "max":
+				promo.MaxUses = &n
+			case "per_user":
+				promo.PerUserLimit = n
+			}
+		case "from", "until":
+			t, err := time.ParseInLocation("2006-01-02", val, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a date like 2025-12-31", key)
+			}
+			if key == "from" {
+				promo.ValidFrom = &t
+			} else {
+				until := t.Add(24*time.Hour - time.Second)
+				promo.ValidUntil = &until
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+
+	if promo.PlanID != nil && promo.Type == database.PromoTypeFreePeriod {
+		return nil, errors.New("plan restriction does not apply to free_period codes")
+	}
+	return promo, nil
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	failedReceiptsLimit = 20
+	resendReceiptUsage  = "Usage: /resend_receipt <purchase id|all>"
+)
+
+func (h Handler) ReceiptsCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	receipts, err := h.paymentService.FailedReceipts(ctx, failedReceiptsLimit)
+	if err != nil {
+		slog.Error("Error finding failed receipts", "error", err)
+		return
+	}
+
+	text := "No failed receipts"
+	if len(receipts) > 0 {
+		var sb strings.Builder
+		sb.WriteString("Failed Moynalog receipts:\n")
+		for _, receipt := range receipts {
+			lastError := ""
+			if receipt.LastError != nil {
+				lastError = *receipt.LastError
+			}
+			fmt.Fprintf(&sb, "\nPurchase #%d (%d attempts, %s)\n%s\n", receipt.PurchaseID, receipt.Attempts, receipt.UpdatedAt.Format("2006-01-02 15:04"), lastError)
+		}
+		sb.WriteString("\nResend with /resend_receipt <purchase id|all>")
+		text = sb.String()
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending receipts message", "error", err)
+	}
+}
+
+func (h Handler) ResendReceiptCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := resendReceiptUsage
+	args := strings.Fields(update.Message.Text)
+	if len(args) == 2 {
+		if args[1] == "all" {
+			text = h.resendFailedReceipts(ctx)
+		} else if purchaseID, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+			text = h.resendReceipt(ctx, purchaseID)
+		}
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending resend receipt message", "error", err)
+	}
+}
+
+func (h Handler) resendReceipt(ctx context.Context, purchaseID int64) string {
+	resent, err := h.paymentService.ResendReceipt(ctx, purchaseID)
+	switch {
+	case err != nil:
+		slog.Error("Error resending receipt", "error", err, "purchase_id", purchaseID)
+		return "Failed to resend receipt, check logs"
+	case !resent:
+		return fmt.Sprintf("Purchase #%d has no failed receipt", purchaseID)
+	default:
+		return fmt.Sprintf("Receipt of purchase #%d scheduled for resending", purchaseID)
+	}
+}
+
+func (h Handler) resendFailedReceipts(ctx context.Context) string {
+	receipts, err := h.paymentService.FailedReceipts(ctx, failedReceiptsLimit)
+	if err != nil {
+		slog.Error("Error finding failed receipts", "error", err)
+		return "Failed to resend receipts, check logs"
+	}
+
+	resent := 0
+	for _, receipt := range receipts {
+		ok, err := h.paymentService.ResendReceipt(ctx, receipt.PurchaseID)
+		if err != nil {
+			slog.Error("Error resending receipt", "error", err, "purchase_id", receipt.PurchaseID)
+			continue
+		}
+		if ok {
+			resent++
+		}
+	}
+	return fmt.Sprintf("%d of %d failed receipts scheduled for resending", resent, len(receipts))
+}
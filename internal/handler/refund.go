@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/payment"
+)
+
+const refundUsage = "Usage: /refund <purchase id> [manual|balance]\n\nUse manual when the money was already returned in the provider's dashboard, balance to credit it to the customer's balance. Purchases paid from the balance are always refunded to it."
+
+func (h Handler) RefundCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	purchaseID, mode, ok := parseRefundCommand(update.Message.Text)
+	text := refundUsage
+	if ok {
+		text = h.refund(ctx, purchaseID, mode)
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending refund message", "error", err)
+	}
+}
+
+func (h Handler) refund(ctx context.Context, purchaseID int64, mode payment.RefundMode) string {
+	refunded, err := h.paymentService.RefundPurchase(ctx, purchaseID, mode)
+	switch {
+	case errors.Is(err, payment.ErrPurchaseNotFound):
+		return fmt.Sprintf("Purchase #%d not found", purchaseID)
+	case errors.Is(err, payment.ErrPurchaseNotPaid):
+		return fmt.Sprintf("Purchase #%d cannot be refunded: %v", purchaseID, err)
+	case errors.Is(err, payment.ErrRefundNotSupported):
+		return fmt.Sprintf("Purchase #%d: %v. Refund it in the provider's dashboard and run /refund %d manual", purchaseID, err, purchaseID)
+	case errors.Is(err, payment.ErrRefundRequested):
+		return fmt.Sprintf("Purchase #%d: %v. Check the refund in the provider's dashboard and run /refund %d manual to finish it", purchaseID, err, purchaseID)
+	case errors.Is(err, payment.ErrTopUpFromBalance):
+		return fmt.Sprintf("Purchase #%d is a balance top-up and cannot be refunded to the balance", purchaseID)
+	case err != nil:
+		slog.Error("Error refunding purchase", "error", err, "purchase_id", purchaseID)
+		return fmt.Sprintf("Failed to refund purchase #%d: %v", purchaseID, err)
+	case !refunded:
+		return fmt.Sprintf("Purchase #%d is already refunded", purchaseID)
+	default:
+		return fmt.Sprintf("Purchase #%d refunded. Subscription days and the Moynalog receipt are being reverted, see /jobs for failures", purchaseID)
+	}
+}
+
+func parseRefundCommand(text string) (purchaseID int64, mode payment.RefundMode, ok bool) {
+	args := strings.Fields(text)
+	if len(args) < 2 || len(args) > 3 {
+		return 0, "", false
+	}
+	mode = payment.RefundModeProvider
+	if len(args) == 3 {
+		mode = payment.RefundMode(args[2])
+		if mode != payment.RefundModeManual && mode != payment.RefundModeBalance {
+			return 0, "", false
+		}
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", false
+	}
+	return id, mode, true
+}
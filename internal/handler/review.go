@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/payment"
+)
+
+// ApproveCommandHandler processes a payment held for review as paid.
+func (h Handler) ApproveCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := "Usage: /approve <purchase id>"
+	if purchaseID, ok := parseReviewCommand(update.Message.Text); ok {
+		text = reviewResult(purchaseID, "approved and processed", h.paymentService.ApproveReviewedPurchase(ctx, purchaseID))
+	}
+	h.sendReviewMessage(ctx, b, update, text)
+}
+
+// RejectCommandHandler cancels a payment held for review.
+func (h Handler) RejectCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := "Usage: /reject <purchase id>"
+	if purchaseID, ok := parseReviewCommand(update.Message.Text); ok {
+		text = reviewResult(purchaseID, "cancelled. Return the money in the provider's dashboard", h.paymentService.RejectReviewedPurchase(ctx, purchaseID))
+	}
+	h.sendReviewMessage(ctx, b, update, text)
+}
+
+func (h Handler) sendReviewMessage(ctx context.Context, b *bot.Bot, update *models.Update, text string) {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending review message", "error", err)
+	}
+}
+
+func reviewResult(purchaseID int64, done string, err error) string {
+	switch {
+	case errors.Is(err, payment.ErrPurchaseNotFound):
+		return fmt.Sprintf("Purchase #%d not found", purchaseID)
+	case errors.Is(err, payment.ErrPurchaseNotInReview):
+		return fmt.Sprintf("Purchase #%d is not held for review", purchaseID)
+	case err != nil:
+		slog.Error("Error reviewing purchase", "error", err, "purchase_id", purchaseID)
+		return fmt.Sprintf("Failed to review purchase #%d: %v", purchaseID, err)
+	default:
+		return fmt.Sprintf("Purchase #%d %s", purchaseID, done)
+	}
+}
+
+func parseReviewCommand(text string) (int64, bool) {
+	args := strings.Fields(text)
+	if len(args) != 2 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// StarsSubscriptionCallbackHandler shows when the customer's Stars subscription
+// renews or ends and lets them cancel or resume it.
+func (h Handler) StarsSubscriptionCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", callback.Chat.ID, "error", err)
+		return
+	}
+
+	sub, err := h.paymentService.ActiveStarsSubscription(ctx, customer.ID)
+	if err != nil {
+		slog.Error("Error finding stars subscription", "error", err)
+		return
+	}
+	if sub == nil {
+		h.StartCallbackHandler(ctx, b, update)
+		return
+	}
+	h.showStarsSubscription(ctx, b, callback, langCode, sub)
+}
+
+// StarsSubscriptionToggleCallbackHandler cancels a renewing Stars subscription or
+// resumes a canceled one.
+func (h Handler) StarsSubscriptionToggleCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", callback.Chat.ID, "error", err)
+		return
+	}
+
+	sub, err := h.paymentService.ActiveStarsSubscription(ctx, customer.ID)
+	if err != nil {
+		slog.Error("Error finding stars subscription", "error", err)
+		return
+	}
+	if sub == nil {
+		h.StartCallbackHandler(ctx, b, update)
+		return
+	}
+
+	sub, err = h.paymentService.SetStarsSubscriptionCanceled(ctx, customer, sub.CanceledAt == nil)
+	if err != nil {
+		slog.Error("Error updating stars subscription", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+		return
+	}
+	h.showStarsSubscription(ctx, b, callback, langCode, sub)
+}
+
+func (h Handler) showStarsSubscription(ctx context.Context, b *bot.Bot, callback *models.Message, langCode string, sub *database.StarsSubscription) {
+	text := fmt.Sprintf(h.translation.GetText(langCode, "stars_subscription_info"), sub.ExpiresAt.Format("02.01.2006"))
+	toggleButton := "stars_subscription_cancel_button"
+	if sub.CanceledAt != nil {
+		text = fmt.Sprintf(h.translation.GetText(langCode, "stars_subscription_canceled"), sub.ExpiresAt.Format("02.01.2006"))
+		toggleButton = "stars_subscription_resume_button"
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, toggleButton).InlineCallback(CallbackStarsSubscriptionToggle)},
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart)},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending stars subscription message", "error", err)
+	}
+}
+
+// starsSubscriptionRenewable tells whether Telegram may charge the paid purchase
+// again because it started a Stars subscription.
+func (h Handler) starsSubscriptionRenewable(ctx context.Context, purchase *database.Purchase) bool {
+	if purchase.InvoiceType != database.InvoiceTypeTelegram || purchase.Status != database.PurchaseStatusPaid {
+		return false
+	}
+	renewable, err := h.paymentService.StarsSubscriptionRenewable(ctx, purchase.ID)
+	if err != nil {
+		slog.Error("Error finding stars subscription", "error", err)
+		return false
+	}
+	return renewable
+}
+
+// hasStarsSubscription tells whether the start menu links to the customer's Stars
+// subscription.
+func (h Handler) hasStarsSubscription(ctx context.Context, customerID int64) bool {
+	sub, err := h.paymentService.ActiveStarsSubscription(ctx, customerID)
+	if err != nil {
+		slog.Error("Error finding stars subscription", "error", err)
+		return false
+	}
+	return sub != nil
+}
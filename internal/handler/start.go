@@ -12,6 +12,7 @@ import (
 
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/utils"
 )
 
@@ -67,7 +68,7 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 		}
 	}
 
-	inlineKeyboard := h.buildStartKeyboard(existingCustomer, langCode)
+	inlineKeyboard := h.buildStartKeyboard(ctx, existingCustomer, langCode)
 
 	m, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
@@ -98,11 +99,28 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 		ReplyMarkup: models.InlineKeyboardMarkup{
 			InlineKeyboard: inlineKeyboard,
 		},
-		Text: h.translation.GetText(langCode, "greeting"),
+		Text: h.translation.GetText(langCode, "greeting") + h.balanceInfo(ctx, existingCustomer.ID, langCode),
 	})
 	if err != nil {
 		slog.Error("Error sending /start message", "error", err)
 	}
+
+	arg := startArg(update.Message.Text)
+	if code, ok := strings.CutPrefix(arg, promoDeepLinkPrefix); ok {
+		h.applyPromoCode(ctx, b, existingCustomer, langCode, code)
+	}
+	if code, ok := strings.CutPrefix(arg, payment.GiftDeepLinkPrefix); ok {
+		h.redeemGift(ctx, b, existingCustomer, langCode, code)
+	}
+}
+
+// startArg returns the deep link payload of a "/start <payload>" message.
+func startArg(text string) string {
+	args := strings.Fields(text)
+	if len(args) < 2 {
+		return ""
+	}
+	return args[1]
 }
 
 func (h Handler) StartCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
@@ -118,7 +136,7 @@ func (h Handler) StartCallbackHandler(ctx context.Context, b *bot.Bot, update *m
 		return
 	}
 
-	inlineKeyboard := h.buildStartKeyboard(existingCustomer, langCode)
+	inlineKeyboard := h.buildStartKeyboard(ctxWithTime, existingCustomer, langCode)
 
 	_, err = b.EditMessageText(ctxWithTime, &bot.EditMessageTextParams{
 		ChatID:    callback.Message.Message.Chat.ID,
@@ -127,7 +145,7 @@ func (h Handler) StartCallbackHandler(ctx context.Context, b *bot.Bot, update *m
 		ReplyMarkup: models.InlineKeyboardMarkup{
 			InlineKeyboard: inlineKeyboard,
 		},
-		Text: h.translation.GetText(langCode, "greeting"),
+		Text: h.translation.GetText(langCode, "greeting") + h.balanceInfo(ctxWithTime, existingCustomer.ID, langCode),
 	})
 	if err != nil {
 		slog.Error("Error sending /start message", "error", err)
@@ -143,7 +161,7 @@ func (h Handler) resolveConnectButton(lang string) []models.InlineKeyboardButton
 	return []models.InlineKeyboardButton{bd.InlineCallback(CallbackConnect)}
 }
 
-func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
+func (h Handler) buildStartKeyboard(ctx context.Context, existingCustomer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
 	var inlineKeyboard [][]models.InlineKeyboardButton
 
 	if existingCustomer.SubscriptionLink == nil && config.TrialDays() > 0 {
@@ -154,9 +172,26 @@ func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCod
 
 	if existingCustomer.SubscriptionLink != nil && existingCustomer.ExpireAt.After(time.Now()) {
 		inlineKeyboard = append(inlineKeyboard, h.resolveConnectButton(langCode))
+		if len(config.TrafficPacks()) > 0 {
+			inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "traffic_button").InlineCallback(CallbackTraffic)})
+		}
 	}
 
-	if config.GetReferralDays() > 0 {
+	if config.IsTelegramStarsEnabled() && h.hasStarsSubscription(ctx, existingCustomer.ID) {
+		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "stars_subscription_button").InlineCallback(CallbackStarsSubscription)})
+	}
+
+	if config.IsAutoPaymentEnabled() && existingCustomer.YookasaPaymentMethodID != nil {
+		autoRenewButton := "auto_renew_off_button"
+		if existingCustomer.AutoRenew {
+			autoRenewButton = "auto_renew_on_button"
+		}
+		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{h.translation.GetButton(langCode, autoRenewButton).InlineCallback(CallbackAutoRenew)})
+	}
+
+	inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "topup_button").InlineCallback(CallbackTopUp)})
+
+	if config.GetReferralDays() > 0 || config.ReferralBonusAmount() > 0 {
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{h.translation.GetButton(langCode, "referral_button").InlineCallback(CallbackReferral)})
 	}
 
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+// TrafficCallbackHandler shows the extra traffic packs to customers whose
+// subscription has a traffic limit.
+func (h Handler) TrafficCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", callback.Chat.ID, "error", err)
+		return
+	}
+
+	err = h.paymentService.CheckTrafficPackAvailable(ctx, customer)
+	if errors.Is(err, payment.ErrTrafficPackUnavailable) {
+		h.sendTrafficUnavailable(ctx, b, callback, langCode)
+		return
+	}
+	if err != nil {
+		slog.Error("Error checking traffic packs", "error", err)
+		return
+	}
+
+	var packButtons []models.InlineKeyboardButton
+	for _, pack := range config.TrafficPacks() {
+		packButtons = append(packButtons, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("+%d GB", pack.GB),
+			CallbackData: fmt.Sprintf("%s?gb=%d", CallbackTrafficSell, pack.GB),
+		})
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for len(packButtons) > 0 {
+		n := min(2, len(packButtons))
+		keyboard = append(keyboard, packButtons[:n])
+		packButtons = packButtons[n:]
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart),
+	})
+
+	text := h.translation.GetText(langCode, "traffic_info_subscription")
+	if config.TrafficPacksUntilReset() {
+		text = h.translation.GetText(langCode, "traffic_info_reset")
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+		Text: text,
+	})
+	if err != nil {
+		slog.Error("Error sending traffic message", "error", err)
+	}
+}
+
+// TrafficSellCallbackHandler lists the providers the pack can be paid with.
+func (h Handler) TrafficSellCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	pack, ok := callbackTrafficPack(callbackQuery)
+	if !ok {
+		slog.Error("Invalid traffic pack", "gb", callbackQuery["gb"])
+		return
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	for _, provider := range h.paymentService.Providers() {
+		if _, ok := provider.(payment.LinkProvider); ok {
+			continue
+		}
+		if _, ok := payment.TrafficPackPrice(pack, provider.Currency()); !ok {
+			continue
+		}
+		if provider.InvoiceType() == database.InvoiceTypeBalance && !h.hasBalance(ctx, callback.Chat.ID) {
+			continue
+		}
+		if provider.InvoiceType() == database.InvoiceTypeTelegram && !h.canPayWithStars(ctx, callback.Chat.ID) {
+			continue
+		}
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			h.translation.GetButton(langCode, provider.ButtonKey()).InlineCallback(fmt.Sprintf("%s?gb=%d&invoiceType=%s", CallbackTrafficPay, pack.GB, provider.InvoiceType())),
+		})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackTraffic),
+	})
+
+	_, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending traffic sell message", "error", err)
+	}
+}
+
+// TrafficPaymentCallbackHandler creates the traffic purchase and shows its pay button.
+func (h Handler) TrafficPaymentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+	langCode := update.CallbackQuery.From.LanguageCode
+	invoiceType := database.InvoiceType(callbackQuery["invoiceType"])
+
+	pack, ok := callbackTrafficPack(callbackQuery)
+	if !ok {
+		slog.Error("Invalid traffic pack", "gb", callbackQuery["gb"])
+		return
+	}
+	sellCallback := fmt.Sprintf("%s?gb=%d", CallbackTrafficSell, pack.GB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", callback.Chat.ID, "error", err)
+		return
+	}
+
+	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, update.CallbackQuery.From.Username)
+	paymentURL, purchaseId, err := h.paymentService.CreateTrafficPackPurchase(ctxWithUsername, pack.GB, customer, invoiceType)
+	if errors.Is(err, database.ErrInsufficientBalance) {
+		h.sendInsufficientBalance(ctx, b, callback, langCode, sellCallback)
+		return
+	}
+	if errors.Is(err, payment.ErrTrafficPackUnavailable) {
+		h.sendTrafficUnavailable(ctx, b, callback, langCode)
+		return
+	}
+	if err != nil {
+		slog.Error("Error creating traffic payment", "error", err)
+		return
+	}
+
+	if invoiceType == database.InvoiceTypeBalance {
+		// Paid already, the confirmation message replaces the sell message.
+		_, err = b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+			ChatID:    callback.Chat.ID,
+			MessageID: callback.ID,
+		})
+		if err != nil {
+			slog.Error("Error deleting traffic sell message", "error", err)
+		}
+		return
+	}
+
+	message, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{
+					h.translation.GetButton(langCode, "pay_button").InlineURL(paymentURL),
+					h.translation.GetButton(langCode, "back_button").InlineCallback(sellCallback),
+				},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error updating traffic message", "error", err)
+		return
+	}
+	h.cache.Set(purchaseId, message.ID)
+}
+
+func (h Handler) sendTrafficUnavailable(ctx context.Context, b *bot.Bot, callback *models.Message, langCode string) {
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "traffic_unavailable"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{h.translation.GetButton(langCode, "back_button").InlineCallback(CallbackStart)},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending traffic unavailable message", "error", err)
+	}
+}
+
+// callbackTrafficPack returns the offered pack selected in the callback data.
+func callbackTrafficPack(callbackQuery map[string]string) (config.TrafficPack, bool) {
+	gb, err := strconv.Atoi(callbackQuery["gb"])
+	if err != nil {
+		return config.TrafficPack{}, false
+	}
+	return config.FindTrafficPack(gb)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/webhook"
+)
+
+const failedWebhooksLimit = 20
+
+func (h Handler) WebhooksCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	events, err := h.webhookRecorder.Failed(ctx, failedWebhooksLimit)
+	if err != nil {
+		slog.Error("Error finding failed webhook events", "error", err)
+		return
+	}
+
+	text := "No failed webhooks"
+	if len(events) > 0 {
+		var sb strings.Builder
+		sb.WriteString("Failed webhooks:\n")
+		for _, event := range events {
+			code := 0
+			if event.ResponseCode != nil {
+				code = *event.ResponseCode
+			}
+			purchase := "-"
+			if event.PurchaseID != nil {
+				purchase = fmt.Sprintf("#%d", *event.PurchaseID)
+			}
+			eventErr := ""
+			if event.Error != nil {
+				eventErr = *event.Error
+			}
+			fmt.Fprintf(&sb, "\n#%d %s: %d, purchase %s (%d attempts, %s)\n%s\n",
+				event.ID, event.Provider, code, purchase, event.Attempts, event.CreatedAt.Format("2006-01-02 15:04"), eventErr)
+		}
+		sb.WriteString("\nReplay with /replay_webhook <id>")
+		text = sb.String()
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending webhooks message", "error", err)
+	}
+}
+
+func (h Handler) ReplayWebhookCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := "Usage: /replay_webhook <id>"
+	args := strings.Fields(update.Message.Text)
+	if len(args) == 2 {
+		if id, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+			event, err := h.webhookRecorder.Replay(ctx, id)
+			switch {
+			case errors.Is(err, webhook.ErrEventNotFound):
+				text = fmt.Sprintf("Webhook #%d not found", id)
+			case errors.Is(err, webhook.ErrSignatureRejected):
+				text = fmt.Sprintf("Webhook #%d failed the signature check and cannot be replayed", id)
+			case errors.Is(err, webhook.ErrEventNotFailed):
+				text = fmt.Sprintf("Webhook #%d did not fail, only failed webhooks can be replayed", id)
+			case err != nil:
+				slog.Error("Error replaying webhook event", "error", err, "event_id", id)
+				text = "Failed to replay webhook, check logs"
+			default:
+				code := 0
+				if event.ResponseCode != nil {
+					code = *event.ResponseCode
+				}
+				text = fmt.Sprintf("Webhook #%d replayed: %s (%d)", id, event.Status, code)
+			}
+		}
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		slog.Error("Error sending replay message", "error", err)
+	}
+}
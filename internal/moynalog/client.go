@@ -10,6 +10,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -137,6 +138,60 @@ func (c *Client) authenticateOnce() error {
 }
 
 func (c *Client) CreateIncome(ctx context.Context, amount float64, comment string) (*CreateIncomeResponse, error) {
+	var resp *CreateIncomeResponse
+	err := c.withRetry(ctx, func() error {
+		var err error
+		resp, err = c.createIncomeOnce(ctx, amount, comment)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create income failed: %w", err)
+	}
+	return resp, nil
+}
+
+// CancelIncome annuls a previously registered receipt, e.g. after a refund.
+func (c *Client) CancelIncome(ctx context.Context, receiptUUID string, comment string) error {
+	err := c.withRetry(ctx, func() error {
+		return c.cancelIncomeOnce(ctx, receiptUUID, comment)
+	})
+	if err != nil {
+		return fmt.Errorf("cancel income failed: %w", err)
+	}
+	return nil
+}
+
+// ListIncomes возвращает доходы, зарегистрированные в период [from, to).
+func (c *Client) ListIncomes(ctx context.Context, from, to time.Time) ([]Income, error) {
+	const limit = 50
+
+	var incomes []Income
+	for offset := 0; ; offset += limit {
+		var page *IncomesResponse
+		err := c.withRetry(ctx, func() error {
+			var err error
+			page, err = c.listIncomesOnce(ctx, from, to, offset, limit)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list incomes failed: %w", err)
+		}
+		incomes = append(incomes, page.Content...)
+		if !page.HasMore || len(page.Content) == 0 {
+			return incomes, nil
+		}
+	}
+}
+
+// ReceiptURL возвращает ссылку на печатную форму чека для покупателя.
+// Логин в Мой налог совпадает с ИНН, который входит в ссылку.
+func (c *Client) ReceiptURL(receiptUUID string) string {
+	return fmt.Sprintf("%s/receipt/%s/%s/print", c.baseURL, c.username, url.PathEscape(receiptUUID))
+}
+
+// withRetry runs call, re-authenticating on ErrAuth and retrying ErrRetryable
+// errors with exponential backoff.
+func (c *Client) withRetry(ctx context.Context, call func() error) error {
 	const (
 		maxRetries     = 3
 		baseDelay      = 500 * time.Millisecond
@@ -151,24 +206,24 @@ func (c *Client) CreateIncome(ctx context.Context, amount float64, comment strin
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		default:
 		}
 
-		resp, err := c.createIncomeOnce(ctx, amount, comment)
+		err := call()
 		if err == nil {
-			return resp, nil
+			return nil
 		}
 
 		if errors.Is(err, ErrAuth) {
 			if authRetries >= maxAuthRetries {
-				return nil, err
+				return err
 			}
 
 			c.token.Store("")
 
 			if err := c.authenticate(); err != nil {
-				return nil, fmt.Errorf("reauth failed: %w", err)
+				return fmt.Errorf("reauth failed: %w", err)
 			}
 
 			authRetries++
@@ -177,19 +232,19 @@ func (c *Client) CreateIncome(ctx context.Context, amount float64, comment strin
 		}
 
 		if !errors.Is(err, ErrRetryable) {
-			return nil, err
+			return err
 		}
 
 		lastErr = err
 
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		case <-time.After(baseDelay * time.Duration(1<<(attempt-1))):
 		}
 	}
 
-	return nil, fmt.Errorf("create income failed after retries: %w", lastErr)
+	return fmt.Errorf("failed after retries: %w", lastErr)
 }
 
 func (c *Client) createIncomeOnce(ctx context.Context, amount float64, comment string) (*CreateIncomeResponse, error) {
@@ -222,6 +277,84 @@ func (c *Client) createIncomeOnce(ctx context.Context, amount float64, comment s
 		return nil, err
 	}
 
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var incomeResp CreateIncomeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&incomeResp); err != nil {
+		return nil, err
+	}
+
+	return &incomeResp, nil
+}
+
+func (c *Client) cancelIncomeOnce(ctx context.Context, receiptUUID string, comment string) error {
+	cancelURL := fmt.Sprintf("%s/cancel", c.baseURL)
+	now := time.Now()
+
+	reqBody, err := json.Marshal(CancelIncomeRequest{
+		OperationTime: now,
+		RequestTime:   now,
+		Comment:       comment,
+		ReceiptUUID:   receiptUUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cancelURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+func (c *Client) listIncomesOnce(ctx context.Context, from, to time.Time, offset, limit int) (*IncomesResponse, error) {
+	query := url.Values{}
+	query.Set("from", from.Format(time.RFC3339))
+	query.Set("to", to.Format(time.RFC3339))
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("sortBy", "operation_time:asc")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/incomes?%s", c.baseURL, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var incomesResp IncomesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&incomesResp); err != nil {
+		return nil, err
+	}
+
+	return &incomesResp, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
 	token := c.token.Load().(string)
 
 	req.Header.Set("Content-Type", "application/json")
@@ -236,25 +369,21 @@ func (c *Client) createIncomeOnce(ctx context.Context, amount float64, comment s
 		}
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
+func checkResponse(resp *http.Response) error {
 	switch {
 	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
-		return nil, fmt.Errorf("%w: status %d", ErrAuth, resp.StatusCode)
+		return fmt.Errorf("%w: status %d", ErrAuth, resp.StatusCode)
 
 	case resp.StatusCode >= 500:
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: status %d: %s", ErrRetryable, resp.StatusCode, b)
+		return fmt.Errorf("%w: status %d: %s", ErrRetryable, resp.StatusCode, b)
 
 	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated:
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: status %d: %s", ErrClient, resp.StatusCode, b)
-	}
-
-	var incomeResp CreateIncomeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&incomeResp); err != nil {
-		return nil, err
+		return fmt.Errorf("%w: status %d: %s", ErrClient, resp.StatusCode, b)
 	}
-
-	return &incomeResp, nil
+	return nil
 }
@@ -1,6 +1,7 @@
 package moynalog
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -57,12 +58,61 @@ type IncomeClient struct {
 
 // CreateIncomeResponse - ответ на запрос создания дохода
 type CreateIncomeResponse struct {
-	ID            string       `json:"id"`
-	OperationTime time.Time    `json:"operationTime"`
-	RequestTime   time.Time    `json:"requestTime"`
-	Services      []Service    `json:"services"`
-	TotalAmount   string       `json:"totalAmount"`
-	Client        IncomeClient `json:"client"`
-	PaymentType   string       `json:"paymentType"`
-	Status        string       `json:"status"`
+	ID                  string       `json:"id"`
+	ApprovedReceiptUUID string       `json:"approvedReceiptUuid"`
+	OperationTime       time.Time    `json:"operationTime"`
+	RequestTime         time.Time    `json:"requestTime"`
+	Services            []Service    `json:"services"`
+	TotalAmount         string       `json:"totalAmount"`
+	Client              IncomeClient `json:"client"`
+	PaymentType         string       `json:"paymentType"`
+	Status              string       `json:"status"`
+}
+
+// ReceiptUUID возвращает идентификатор чека, нужный для его аннулирования
+func (r *CreateIncomeResponse) ReceiptUUID() string {
+	if r.ApprovedReceiptUUID != "" {
+		return r.ApprovedReceiptUUID
+	}
+	return r.ID
+}
+
+// CancelIncomeRequest - структура для запроса аннулирования чека
+type CancelIncomeRequest struct {
+	OperationTime time.Time `json:"operationTime"`
+	RequestTime   time.Time `json:"requestTime"`
+	Comment       string    `json:"comment"`
+	ReceiptUUID   string    `json:"receiptUuid"`
+	PartnerCode   *string   `json:"partnerCode"`
+}
+
+// IncomesResponse - страница списка зарегистрированных доходов
+type IncomesResponse struct {
+	Content []Income `json:"content"`
+	HasMore bool     `json:"hasMore"`
+}
+
+// Income - зарегистрированный доход (чек)
+type Income struct {
+	ApprovedReceiptUUID string              `json:"approvedReceiptUuid"`
+	Name                string              `json:"name"`
+	OperationTime       time.Time           `json:"operationTime"`
+	TotalAmount         json.Number         `json:"totalAmount"`
+	CancellationInfo    *IncomeCancellation `json:"cancellationInfo"`
+}
+
+// IncomeCancellation - сведения об аннулировании чека
+type IncomeCancellation struct {
+	OperationTime time.Time `json:"operationTime"`
+	Comment       string    `json:"comment"`
+}
+
+// Amount возвращает сумму чека в рублях
+func (i Income) Amount() (float64, error) {
+	return i.TotalAmount.Float64()
+}
+
+// Canceled сообщает, что чек аннулирован
+func (i Income) Canceled() bool {
+	return i.CancellationInfo != nil
 }
@@ -0,0 +1,197 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+)
+
+type panelCustomerRepository interface {
+	FindByRemnawaveUUID(ctx context.Context, userUUID uuid.UUID) (*database.Customer, error)
+	FindByTelegramId(ctx context.Context, telegramId int64) (*database.Customer, error)
+	UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error
+}
+
+type panelNodeLister interface {
+	GetNodes(ctx context.Context) ([]remnawave.Node, error)
+}
+
+// panelEventTexts are the messages sent to the customer for a panel user event.
+// Events without a text only update the customer.
+var panelEventTexts = map[string]string{
+	remnawave.EventUserExpired:  "panel_user_expired",
+	remnawave.EventUserLimited:  "panel_user_limited",
+	remnawave.EventUserDisabled: "panel_user_disabled",
+	remnawave.EventUserEnabled:  "panel_user_enabled",
+}
+
+// PanelEventService applies Remnawave panel webhook events to customers and tells
+// them what happened to their subscription.
+type PanelEventService struct {
+	customerRepository panelCustomerRepository
+	nodes              panelNodeLister
+	telegramBot        *bot.Bot
+	tm                 *translation.Manager
+	notify             func(ctx context.Context, customer database.Customer, event string) error
+	notifyAdmin        func(ctx context.Context, text string) error
+}
+
+func NewPanelEventService(customerRepository panelCustomerRepository, nodes panelNodeLister, telegramBot *bot.Bot, tm *translation.Manager) *PanelEventService {
+	svc := &PanelEventService{customerRepository: customerRepository, nodes: nodes, telegramBot: telegramBot, tm: tm}
+	svc.notify = svc.sendUserEventNotification
+	svc.notifyAdmin = svc.sendAdminNotification
+	return svc
+}
+
+// HandleUserEvent stores the user's expiration and subscription link on its
+// customer and notifies the customer. Users without a customer are ignored.
+func (s *PanelEventService) HandleUserEvent(ctx context.Context, event string, user *remnawave.User) error {
+	customer, err := s.findCustomer(ctx, user)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		slog.Debug("panel event for unknown user", "event", event, "user_uuid", user.UUID)
+		return nil
+	}
+
+	updates := map[string]interface{}{
+		"expire_at":         user.ExpireAt,
+		"subscription_link": user.SubscriptionUrl,
+		"remnawave_uuid":    user.UUID,
+	}
+	if event == remnawave.EventUserDeleted {
+		updates = map[string]interface{}{"remnawave_uuid": nil}
+	}
+	if err := s.customerRepository.UpdateFields(ctx, customer.ID, updates); err != nil {
+		return fmt.Errorf("update customer: %w", err)
+	}
+	slog.Info("panel event applied", "event", event, "customer_id", utils.MaskHalfInt64(customer.ID))
+
+	if _, ok := panelEventTexts[event]; !ok {
+		return nil
+	}
+	if err := s.notify(ctx, *customer, event); err != nil {
+		slog.Error("Error sending panel event notification", "error", err, "event", event, "customer_id", utils.MaskHalfInt64(customer.ID))
+	}
+	return nil
+}
+
+// HandleNodeEvent tells the admin when a node goes offline or comes back, and how
+// many nodes are online now.
+func (s *PanelEventService) HandleNodeEvent(ctx context.Context, event string, node *remnawave.Node) error {
+	var text string
+	switch event {
+	case remnawave.EventNodeConnectionLost:
+		text = fmt.Sprintf("Node %s (%s) is offline", node.Name, node.Address)
+	case remnawave.EventNodeConnectionRestored:
+		text = fmt.Sprintf("Node %s (%s) is back online", node.Name, node.Address)
+	default:
+		return nil
+	}
+	slog.Warn("panel node event", "event", event, "node", node.Name)
+	text += s.nodesOnline(ctx)
+
+	if err := s.notifyAdmin(ctx, text); err != nil {
+		slog.Error("notify admin about node event", "error", err, "event", event, "node", node.Name)
+	}
+	return nil
+}
+
+// nodesOnline returns the count of connected nodes for the admin alert, empty when
+// the node list cannot be loaded.
+func (s *PanelEventService) nodesOnline(ctx context.Context) string {
+	nodes, err := s.nodes.GetNodes(ctx)
+	if err != nil {
+		slog.Error("load panel nodes", "error", err)
+		return ""
+	}
+	online, enabled := 0, 0
+	for _, node := range nodes {
+		if node.IsDisabled {
+			continue
+		}
+		enabled++
+		if node.IsConnected {
+			online++
+		}
+	}
+	return fmt.Sprintf("\n%d of %d nodes online", online, enabled)
+}
+
+// findCustomer returns the customer the user belongs to. A customer whose UUID is
+// not stored yet is matched by Telegram ID only when the bot created the user.
+func (s *PanelEventService) findCustomer(ctx context.Context, user *remnawave.User) (*database.Customer, error) {
+	customer, err := s.customerRepository.FindByRemnawaveUUID(ctx, user.UUID)
+	if err != nil || customer != nil {
+		return customer, err
+	}
+	if user.TelegramID == nil {
+		return nil, nil
+	}
+
+	customer, err = s.customerRepository.FindByTelegramId(ctx, *user.TelegramID)
+	if err != nil || customer == nil {
+		return nil, err
+	}
+	if customer.RemnawaveUUID != nil || !strings.HasSuffix(user.Username, fmt.Sprintf("_%d", customer.TelegramID)) {
+		return nil, nil
+	}
+	return customer, nil
+}
+
+func (s *PanelEventService) sendUserEventNotification(ctx context.Context, customer database.Customer, event string) error {
+	keyboard := [][]models.InlineKeyboardButton{
+		{s.tm.GetButton(customer.Language, "renew_subscription_button").InlineCallback(handler.CallbackBuy)},
+	}
+	switch event {
+	case remnawave.EventUserLimited:
+		if len(config.TrafficPacks()) > 0 {
+			keyboard = [][]models.InlineKeyboardButton{
+				{s.tm.GetButton(customer.Language, "traffic_button").InlineCallback(handler.CallbackTraffic)},
+			}
+		}
+	case remnawave.EventUserDisabled:
+		keyboard = nil
+		if config.SupportURL() != "" {
+			keyboard = [][]models.InlineKeyboardButton{
+				{s.tm.GetButton(customer.Language, "support_button").InlineURL(config.SupportURL())},
+			}
+		}
+	case remnawave.EventUserEnabled:
+		keyboard = [][]models.InlineKeyboardButton{
+			{s.tm.GetButton(customer.Language, "connect_button").InlineCallback(handler.CallbackConnect)},
+		}
+	}
+
+	params := &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		Text:      s.tm.GetText(customer.Language, panelEventTexts[event]),
+		ParseMode: models.ParseModeHTML,
+	}
+	if len(keyboard) > 0 {
+		params.ReplyMarkup = models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	}
+	_, err := s.telegramBot.SendMessage(ctx, params)
+	return err
+}
+
+func (s *PanelEventService) sendAdminNotification(ctx context.Context, text string) error {
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: config.GetAdminTelegramId(),
+		Text:   text,
+	})
+	return err
+}
@@ -0,0 +1,159 @@
+package notification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+type panelCustomerRepoMock struct {
+	byUUID     *database.Customer
+	byTelegram *database.Customer
+	updates    map[string]interface{}
+	updatedID  int64
+}
+
+func (m *panelCustomerRepoMock) FindByRemnawaveUUID(ctx context.Context, userUUID uuid.UUID) (*database.Customer, error) {
+	return m.byUUID, nil
+}
+
+func (m *panelCustomerRepoMock) FindByTelegramId(ctx context.Context, telegramId int64) (*database.Customer, error) {
+	return m.byTelegram, nil
+}
+
+func (m *panelCustomerRepoMock) UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error {
+	m.updatedID = id
+	m.updates = updates
+	return nil
+}
+
+type panelNodesMock struct {
+	nodes []remnawave.Node
+	err   error
+}
+
+func (m *panelNodesMock) GetNodes(ctx context.Context) ([]remnawave.Node, error) {
+	return m.nodes, m.err
+}
+
+func newPanelEventServiceForTest(repo *panelCustomerRepoMock) (*PanelEventService, *[]string) {
+	svc := NewPanelEventService(repo, &panelNodesMock{err: remnawave.ErrUnavailable}, nil, nil)
+	var sent []string
+	svc.notify = func(ctx context.Context, customer database.Customer, event string) error {
+		sent = append(sent, event)
+		return nil
+	}
+	return svc, &sent
+}
+
+func TestPanelEventService_HandleUserEvent_LimitedUpdatesAndNotifies(t *testing.T) {
+	userUUID := uuid.New()
+	repo := &panelCustomerRepoMock{byUUID: &database.Customer{ID: 7, TelegramID: 42, RemnawaveUUID: &userUUID}}
+	svc, sent := newPanelEventServiceForTest(repo)
+
+	expireAt := time.Now().Add(24 * time.Hour)
+	user := &remnawave.User{UUID: userUUID, ExpireAt: expireAt, SubscriptionUrl: "https://sub/new"}
+	if err := svc.HandleUserEvent(context.Background(), remnawave.EventUserLimited, user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if repo.updatedID != 7 || repo.updates["expire_at"] != expireAt || repo.updates["subscription_link"] != "https://sub/new" {
+		t.Fatalf("expected the customer to be updated from the event, got %d %v", repo.updatedID, repo.updates)
+	}
+	if len(*sent) != 1 || (*sent)[0] != remnawave.EventUserLimited {
+		t.Fatalf("expected one traffic notification, got %v", *sent)
+	}
+}
+
+func TestPanelEventService_HandleUserEvent_ModifiedUpdatesSilently(t *testing.T) {
+	userUUID := uuid.New()
+	repo := &panelCustomerRepoMock{byUUID: &database.Customer{ID: 7, TelegramID: 42, RemnawaveUUID: &userUUID}}
+	svc, sent := newPanelEventServiceForTest(repo)
+
+	if err := svc.HandleUserEvent(context.Background(), remnawave.EventUserModified, &remnawave.User{UUID: userUUID}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.updatedID != 7 {
+		t.Fatalf("expected the customer to be updated")
+	}
+	if len(*sent) != 0 {
+		t.Fatalf("expected no notification, got %v", *sent)
+	}
+}
+
+func TestPanelEventService_HandleUserEvent_IgnoresOtherUserOfTelegramID(t *testing.T) {
+	storedUUID := uuid.New()
+	telegramID := int64(42)
+	repo := &panelCustomerRepoMock{byTelegram: &database.Customer{ID: 7, TelegramID: telegramID, RemnawaveUUID: &storedUUID}}
+	svc, sent := newPanelEventServiceForTest(repo)
+
+	user := &remnawave.User{UUID: uuid.New(), Username: "7_42", TelegramID: &telegramID}
+	if err := svc.HandleUserEvent(context.Background(), remnawave.EventUserExpired, user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.updates != nil || len(*sent) != 0 {
+		t.Fatalf("expected the event to be ignored, got %v %v", repo.updates, *sent)
+	}
+}
+
+func TestPanelEventService_HandleUserEvent_MatchesLegacyCustomerByUsername(t *testing.T) {
+	telegramID := int64(42)
+	repo := &panelCustomerRepoMock{byTelegram: &database.Customer{ID: 7, TelegramID: telegramID}}
+	svc, sent := newPanelEventServiceForTest(repo)
+
+	user := &remnawave.User{UUID: uuid.New(), Username: "7_42", TelegramID: &telegramID}
+	if err := svc.HandleUserEvent(context.Background(), remnawave.EventUserExpired, user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.updates["remnawave_uuid"] != user.UUID {
+		t.Fatalf("expected the user UUID to be stored, got %v", repo.updates)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("expected an expiration notification, got %v", *sent)
+	}
+}
+
+func TestPanelEventService_HandleNodeEvent_NotifiesAdmin(t *testing.T) {
+	svc, _ := newPanelEventServiceForTest(&panelCustomerRepoMock{})
+	var texts []string
+	svc.notifyAdmin = func(ctx context.Context, text string) error {
+		texts = append(texts, text)
+		return nil
+	}
+
+	node := &remnawave.Node{Name: "de-1", Address: "10.0.0.1"}
+	if err := svc.HandleNodeEvent(context.Background(), remnawave.EventNodeConnectionLost, node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(texts) != 1 || texts[0] != "Node de-1 (10.0.0.1) is offline" {
+		t.Fatalf("expected an offline alert, got %v", texts)
+	}
+}
+
+func TestPanelEventService_HandleNodeEvent_CountsOnlineNodes(t *testing.T) {
+	svc, _ := newPanelEventServiceForTest(&panelCustomerRepoMock{})
+	svc.nodes = &panelNodesMock{nodes: []remnawave.Node{
+		{Name: "de-1", IsConnected: false},
+		{Name: "nl-1", IsConnected: true},
+		{Name: "fi-1", IsConnected: true},
+		{Name: "old", IsDisabled: true},
+	}}
+	var texts []string
+	svc.notifyAdmin = func(ctx context.Context, text string) error {
+		texts = append(texts, text)
+		return nil
+	}
+
+	node := &remnawave.Node{Name: "de-1", Address: "10.0.0.1"}
+	if err := svc.HandleNodeEvent(context.Background(), remnawave.EventNodeConnectionLost, node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(texts) != 1 || texts[0] != "Node de-1 (10.0.0.1) is offline\n2 of 3 nodes online" {
+		t.Fatalf("expected the alert to count online nodes, got %q", texts)
+	}
+}
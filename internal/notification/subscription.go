@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/internal/translation"
 	"time"
 )
@@ -21,8 +22,11 @@ type tributeRepository interface {
 }
 
 type paymentProcessor interface {
-	CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (string, int64, error)
+	CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType, opts ...payment.PurchaseOption) (string, int64, error)
 	ProcessPurchaseById(ctx context.Context, purchaseId int64) error
+	AutoRenewEnabled(customer *database.Customer) bool
+	RenewWithSavedPaymentMethod(ctx context.Context, customer *database.Customer) error
+	StarsSubscriptionRenews(ctx context.Context, customerID int64) (bool, error)
 }
 
 type SubscriptionService struct {
@@ -32,6 +36,7 @@ type SubscriptionService struct {
 	telegramBot        *bot.Bot
 	tm                 *translation.Manager
 	notify             func(context.Context, database.Customer) error
+	notifyRenewFailed  func(context.Context, database.Customer) error
 }
 
 func NewSubscriptionService(customerRepository customerRepository,
@@ -41,6 +46,7 @@ func NewSubscriptionService(customerRepository customerRepository,
 	tm *translation.Manager) *SubscriptionService {
 	svc := &SubscriptionService{customerRepository: customerRepository, purchaseRepository: purchaseRepository, paymentService: paymentService, telegramBot: telegramBot, tm: tm}
 	svc.notify = svc.sendNotification
+	svc.notifyRenewFailed = svc.sendRenewFailedNotification
 	return svc
 }
 func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
@@ -75,6 +81,8 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 	}
 
 	tributesProcessed := make(map[int64]bool, len(*latestActiveTributes))
+	autoRenewed := 0
+	starsRenewing := 0
 
 	for _, customer := range *customers {
 		daysUntilExpiration := s.getDaysUntilExpiration(now, *customer.ExpireAt)
@@ -83,7 +91,7 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 			if daysUntilExpiration != 1 {
 				continue
 			}
-			_, purchaseId, err := s.paymentService.CreatePurchase(ctx, p.Amount, p.Month, &customer, database.InvoiceTypeTribute)
+			_, purchaseId, err := s.paymentService.CreatePurchase(ctx, p.Amount, p.Month, &customer, database.InvoiceTypeTribute, payment.PaidInCurrency(p.Currency))
 			if err != nil {
 				slog.Error("Failed to create tribute purchase", "error", err)
 				continue
@@ -101,12 +109,35 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 			continue
 		}
 
+		// Telegram renews Stars subscriptions itself, there is nothing to remind about.
+		renews, err := s.paymentService.StarsSubscriptionRenews(ctx, customer.ID)
+		if err != nil {
+			slog.Error("Failed to check stars subscription", "customer_id", customer.ID, "error", err)
+		} else if renews {
+			starsRenewing++
+			continue
+		}
+
 		send := s.notify
-		if send == nil {
-			send = s.sendNotification
+
+		if s.paymentService.AutoRenewEnabled(&customer) {
+			if daysUntilExpiration != 1 {
+				continue
+			}
+			err := s.paymentService.RenewWithSavedPaymentMethod(ctx, &customer)
+			if err == nil {
+				// A payment still pending at YooKassa warns the customer itself
+				// when it is declined later.
+				slog.Info("Auto-payment processed successfully", "customer_id", customer.ID)
+				autoRenewed++
+				continue
+			}
+			slog.Error("Failed to renew subscription with saved payment method", "customer_id", customer.ID, "error", err)
+			// The failure message doubles as the expiration reminder.
+			send = s.notifyRenewFailed
 		}
 
-		err := send(ctx, customer)
+		err = send(ctx, customer)
 		if err != nil {
 			slog.Error("Failed to send notification",
 				"customer_id", customer.ID,
@@ -121,7 +152,9 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 	}
 
 	slog.Info(fmt.Sprintf("Processed tributes customers %d with expiring subscriptions", len(tributesProcessed)))
-	slog.Info(fmt.Sprintf("Sent notifications to %d customers with expiring subscriptions", len(*customers)-len(tributesProcessed)))
+	slog.Info(fmt.Sprintf("Renewed %d subscriptions with saved payment methods", autoRenewed))
+	slog.Info(fmt.Sprintf("Skipped %d customers renewing with Stars subscriptions", starsRenewing))
+	slog.Info(fmt.Sprintf("Sent notifications to %d customers with expiring subscriptions", len(*customers)-len(tributesProcessed)-autoRenewed-starsRenewing))
 	return nil
 }
 
@@ -145,6 +178,26 @@ func (s *SubscriptionService) getDaysUntilExpiration(now time.Time, expireAt tim
 	return int(duration.Hours() / 24)
 }
 
+func (s *SubscriptionService) sendRenewFailedNotification(ctx context.Context, customer database.Customer) error {
+	messageText := fmt.Sprintf(
+		s.tm.GetText(customer.Language, "auto_renew_failed"),
+		customer.ExpireAt.Format("02.01.2006"),
+	)
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		Text:      messageText,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{s.tm.GetButton(customer.Language, "renew_subscription_button").InlineCallback(handler.CallbackBuy)},
+			},
+		},
+	})
+
+	return err
+}
+
 func (s *SubscriptionService) sendNotification(ctx context.Context, customer database.Customer) error {
 	expireDate := customer.ExpireAt.Format("02.01.2006")
 
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 )
 
 type customerRepoMock struct {
@@ -38,9 +39,13 @@ type paymentServiceMock struct {
 	createErr          error
 	processErr         error
 	purchaseIDToReturn int64
+	autoRenew          bool
+	renewCalls         int
+	renewErr           error
+	starsRenews        bool
 }
 
-func (m *paymentServiceMock) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (string, int64, error) {
+func (m *paymentServiceMock) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType, opts ...payment.PurchaseOption) (string, int64, error) {
 	m.createCalls++
 	m.amounts = append(m.amounts, amount)
 	m.months = append(m.months, months)
@@ -59,6 +64,19 @@ func (m *paymentServiceMock) ProcessPurchaseById(ctx context.Context, purchaseId
 	return m.processErr
 }
 
+func (m *paymentServiceMock) AutoRenewEnabled(customer *database.Customer) bool {
+	return m.autoRenew
+}
+
+func (m *paymentServiceMock) RenewWithSavedPaymentMethod(ctx context.Context, customer *database.Customer) error {
+	m.renewCalls++
+	return m.renewErr
+}
+
+func (m *paymentServiceMock) StarsSubscriptionRenews(ctx context.Context, customerID int64) (bool, error) {
+	return m.starsRenews, nil
+}
+
 func TestSubscriptionService_ProcessSubscriptionExpiration_ProcessesTribute(t *testing.T) {
 	expireAt := time.Now().Add(24 * time.Hour)
 	customers := []database.Customer{{ID: 1, ExpireAt: &expireAt}}
@@ -161,3 +179,90 @@ func TestSubscriptionService_ProcessSubscriptionExpiration_SkipsAutoRenewWhenLas
 		t.Fatalf("expected purchase repository to query by customer id %d, got %#v", customers[0].ID, pRepo.receivedIDs)
 	}
 }
+
+func TestSubscriptionService_ProcessSubscriptionExpiration_RenewsWithSavedPaymentMethod(t *testing.T) {
+	expireAt := time.Now().Add(24 * time.Hour)
+	customers := []database.Customer{{ID: 3, ExpireAt: &expireAt}}
+	tributes := []database.Purchase{}
+
+	payMock := &paymentServiceMock{autoRenew: true}
+	svc := NewSubscriptionService(&customerRepoMock{customers: &customers}, &purchaseRepoMock{tributes: &tributes}, payMock, nil, nil)
+	svc.notify = func(ctx context.Context, customer database.Customer) error {
+		t.Fatalf("sendNotification should not be called after a successful auto-payment")
+		return nil
+	}
+	svc.notifyRenewFailed = func(ctx context.Context, customer database.Customer) error {
+		t.Fatalf("sendRenewFailedNotification should not be called after a successful auto-payment")
+		return nil
+	}
+
+	if err := svc.ProcessSubscriptionExpiration(); err != nil {
+		t.Fatalf("ProcessSubscriptionExpiration returned error: %v", err)
+	}
+	if payMock.renewCalls != 1 {
+		t.Fatalf("expected auto-payment to be charged once, got %d", payMock.renewCalls)
+	}
+}
+
+func TestSubscriptionService_ProcessSubscriptionExpiration_NotifiesFailedAutoPayment(t *testing.T) {
+	expireAt := time.Now().Add(24 * time.Hour)
+	customers := []database.Customer{{ID: 4, ExpireAt: &expireAt}}
+	tributes := []database.Purchase{}
+
+	payMock := &paymentServiceMock{autoRenew: true, renewErr: payment.ErrAutoPaymentFailed}
+	failedCalls := 0
+
+	svc := NewSubscriptionService(&customerRepoMock{customers: &customers}, &purchaseRepoMock{tributes: &tributes}, payMock, nil, nil)
+	svc.notify = func(ctx context.Context, customer database.Customer) error {
+		t.Fatalf("sendNotification should not be called when the failure notification is sent")
+		return nil
+	}
+	svc.notifyRenewFailed = func(ctx context.Context, customer database.Customer) error {
+		failedCalls++
+		return nil
+	}
+
+	if err := svc.ProcessSubscriptionExpiration(); err != nil {
+		t.Fatalf("ProcessSubscriptionExpiration returned error: %v", err)
+	}
+	if failedCalls != 1 {
+		t.Fatalf("expected failure notification to be sent once, got %d", failedCalls)
+	}
+}
+
+func TestSubscriptionService_ProcessSubscriptionExpiration_SkipsAutoPaymentWhenNotOneDay(t *testing.T) {
+	expireAt := time.Now().Add(48 * time.Hour)
+	customers := []database.Customer{{ID: 6, ExpireAt: &expireAt}}
+	tributes := []database.Purchase{}
+
+	payMock := &paymentServiceMock{autoRenew: true}
+	svc := NewSubscriptionService(&customerRepoMock{customers: &customers}, &purchaseRepoMock{tributes: &tributes}, payMock, nil, nil)
+	svc.notify = func(ctx context.Context, customer database.Customer) error {
+		t.Fatalf("sendNotification should not be called for customers with auto-renewal")
+		return nil
+	}
+
+	if err := svc.ProcessSubscriptionExpiration(); err != nil {
+		t.Fatalf("ProcessSubscriptionExpiration returned error: %v", err)
+	}
+	if payMock.renewCalls != 0 {
+		t.Fatalf("expected auto-payment not to be charged, got %d", payMock.renewCalls)
+	}
+}
+
+func TestSubscriptionService_ProcessSubscriptionExpiration_SkipsStarsSubscription(t *testing.T) {
+	expireAt := time.Now().Add(24 * time.Hour)
+	customers := []database.Customer{{ID: 7, ExpireAt: &expireAt}}
+	tributes := []database.Purchase{}
+
+	payMock := &paymentServiceMock{starsRenews: true}
+	svc := NewSubscriptionService(&customerRepoMock{customers: &customers}, &purchaseRepoMock{tributes: &tributes}, payMock, nil, nil)
+	svc.notify = func(ctx context.Context, customer database.Customer) error {
+		t.Fatalf("sendNotification should not be called for customers with a Stars subscription")
+		return nil
+	}
+
+	if err := svc.ProcessSubscriptionExpiration(); err != nil {
+		t.Fatalf("ProcessSubscriptionExpiration returned error: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+const (
+	batchSize  = 20
+	jobTimeout = time.Minute
+	baseDelay  = 30 * time.Second
+	maxDelay   = time.Hour
+)
+
+// Handler runs a single job. Returning an error schedules a retry.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type jobStore interface {
+	Claim(ctx context.Context, limit int, lockFor time.Duration) ([]database.OutboxJob, error)
+	Complete(ctx context.Context, id int64) error
+	Fail(ctx context.Context, id int64, jobErr string, retryAt *time.Time) error
+}
+
+// Worker executes outbox jobs with exponential backoff. Jobs that exhaust their
+// attempts are moved to the dead status and reported through onDead.
+type Worker struct {
+	store    jobStore
+	handlers map[string]Handler
+	onDead   func(ctx context.Context, job database.OutboxJob)
+	now      func() time.Time
+}
+
+func NewWorker(store jobStore, handlers map[string]Handler, onDead func(ctx context.Context, job database.OutboxJob)) *Worker {
+	return &Worker{store: store, handlers: handlers, onDead: onDead, now: time.Now}
+}
+
+// Run claims a batch of due jobs and executes them one by one.
+func (w *Worker) Run(ctx context.Context) {
+	jobs, err := w.store.Claim(ctx, batchSize, 2*jobTimeout)
+	if err != nil {
+		slog.Error("outbox: claim jobs", "error", err)
+		return
+	}
+
+	for _, job := range jobs {
+		w.execute(ctx, job)
+	}
+}
+
+func (w *Worker) execute(ctx context.Context, job database.OutboxJob) {
+	jobErr := w.handle(ctx, job)
+	if jobErr == nil {
+		if err := w.store.Complete(ctx, job.ID); err != nil {
+			slog.Error("outbox: complete job", "job_id", job.ID, "kind", job.Kind, "error", err)
+		}
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		slog.Error("outbox: job is dead", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", jobErr)
+		if err := w.store.Fail(ctx, job.ID, jobErr.Error(), nil); err != nil {
+			slog.Error("outbox: mark job dead", "job_id", job.ID, "kind", job.Kind, "error", err)
+			return
+		}
+		if w.onDead != nil {
+			job.Status = database.OutboxJobStatusDead
+			w.onDead(ctx, job)
+		}
+		return
+	}
+
+	retryAt := w.now().Add(Backoff(job.Attempts))
+	slog.Warn("outbox: job failed, retrying", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "retry_at", retryAt, "error", jobErr)
+	if err := w.store.Fail(ctx, job.ID, jobErr.Error(), &retryAt); err != nil {
+		slog.Error("outbox: reschedule job", "job_id", job.ID, "kind", job.Kind, "error", err)
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, job database.OutboxJob) (err error) {
+	handler, ok := w.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	return handler(jobCtx, job.Payload)
+}
+
+// Backoff returns the delay before the next attempt after the given number of
+// attempts: 30s, 1m, 2m, ... capped at one hour.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := baseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+type storeMock struct {
+	jobs      []database.OutboxJob
+	completed []int64
+	failed    map[int64]*time.Time
+}
+
+func (m *storeMock) Claim(ctx context.Context, limit int, lockFor time.Duration) ([]database.OutboxJob, error) {
+	return m.jobs, nil
+}
+
+func (m *storeMock) Complete(ctx context.Context, id int64) error {
+	m.completed = append(m.completed, id)
+	return nil
+}
+
+func (m *storeMock) Fail(ctx context.Context, id int64, jobErr string, retryAt *time.Time) error {
+	if m.failed == nil {
+		m.failed = map[int64]*time.Time{}
+	}
+	m.failed[id] = retryAt
+	return nil
+}
+
+func TestWorkerRun(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &storeMock{jobs: []database.OutboxJob{
+		{ID: 1, Kind: "ok", Attempts: 1, MaxAttempts: 3},
+		{ID: 2, Kind: "fail", Attempts: 2, MaxAttempts: 3},
+		{ID: 3, Kind: "fail", Attempts: 3, MaxAttempts: 3},
+		{ID: 4, Kind: "unknown", Attempts: 1, MaxAttempts: 3},
+		{ID: 5, Kind: "panic", Attempts: 1, MaxAttempts: 3},
+	}}
+
+	var dead []int64
+	w := NewWorker(store, map[string]Handler{
+		"ok":    func(context.Context, json.RawMessage) error { return nil },
+		"fail":  func(context.Context, json.RawMessage) error { return errors.New("boom") },
+		"panic": func(context.Context, json.RawMessage) error { panic("boom") },
+	}, func(ctx context.Context, job database.OutboxJob) {
+		dead = append(dead, job.ID)
+	})
+	w.now = func() time.Time { return now }
+
+	w.Run(context.Background())
+
+	if len(store.completed) != 1 || store.completed[0] != 1 {
+		t.Fatalf("expected job 1 to complete, got %v", store.completed)
+	}
+	if retryAt := store.failed[2]; retryAt == nil || !retryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected job 2 to retry after 1m, got %v", retryAt)
+	}
+	if retryAt, ok := store.failed[3]; !ok || retryAt != nil {
+		t.Fatalf("expected job 3 to be dead, got %v", retryAt)
+	}
+	if store.failed[4] == nil || store.failed[5] == nil {
+		t.Fatalf("expected jobs 4 and 5 to be rescheduled, got %v", store.failed)
+	}
+	if len(dead) != 1 || dead[0] != 3 {
+		t.Fatalf("expected onDead for job 3, got %v", dead)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  30 * time.Second,
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		8:  time.Hour,
+		50: time.Hour,
+	}
+	for attempts, want := range cases {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d): want %v, got %v", attempts, want, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ErrAutoPaymentFailed is returned when the saved payment method could not be charged.
+var ErrAutoPaymentFailed = errors.New("auto-payment failed")
+
+func chargeSavedPaymentMethod() PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.chargeSaved = true
+	}
+}
+
+// AutoRenewEnabled tells whether the customer's subscription is renewed by charging
+// their saved YooKassa payment method.
+func (s PaymentService) AutoRenewEnabled(customer *database.Customer) bool {
+	if !config.IsAutoPaymentEnabled() || !customer.AutoRenew || customer.YookasaPaymentMethodID == nil {
+		return false
+	}
+	_, ok := s.Provider(database.InvoiceTypeYookasa)
+	return ok
+}
+
+// RenewWithSavedPaymentMethod charges the customer's saved YooKassa payment method
+// for the plan of their last subscription paid by card. A payment still pending
+// at YooKassa is finished by the webhook.
+func (s PaymentService) RenewWithSavedPaymentMethod(ctx context.Context, customer *database.Customer) error {
+	provider, ok := s.Provider(database.InvoiceTypeYookasa)
+	if !ok {
+		return fmt.Errorf("%w: yookassa is disabled", ErrAutoPaymentFailed)
+	}
+	last, err := s.purchaseRepository.FindLastPaidSubscription(ctx, customer.ID, database.InvoiceTypeYookasa)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		return fmt.Errorf("%w: no subscription paid by card", ErrAutoPaymentFailed)
+	}
+
+	var plan *database.Plan
+	if last.PlanID != nil {
+		if plan, err = s.planRepository.FindByID(ctx, *last.PlanID); err != nil {
+			return err
+		}
+	}
+
+	var purchaseID int64
+	if plan != nil {
+		_, purchaseID, err = s.CreatePlanPurchase(ctx, plan, customer, database.InvoiceTypeYookasa, chargeSavedPaymentMethod())
+	} else {
+		// The plan was deleted, renew at the price paid before any promo discount.
+		_, purchaseID, err = s.CreatePurchase(ctx, last.Amount+last.DiscountAmount, last.Month, customer, database.InvoiceTypeYookasa, chargeSavedPaymentMethod(), forDays(last.DurationDays))
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAutoPaymentFailed, err)
+	}
+
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return fmt.Errorf("purchase %s not found", utils.MaskHalfInt64(purchaseID))
+	}
+	tx, err := provider.FetchStatus(ctx, purchase)
+	if err != nil {
+		return err
+	}
+
+	switch tx.Status {
+	case database.PurchaseStatusPaid:
+		return s.ProcessPaidPurchase(ctx, purchaseID, tx.Amount, tx.Currency)
+	case database.PurchaseStatusCancel:
+		if _, err := s.purchaseRepository.Transition(ctx, purchaseID, database.PurchaseStatusCancel, nil); err != nil {
+			slog.Error("Error cancelling declined auto-payment", "error", err, "purchase_id", utils.MaskHalfInt64(purchaseID))
+		}
+		return fmt.Errorf("%w: payment declined", ErrAutoPaymentFailed)
+	}
+	slog.Info("auto-payment pending", "purchase_id", utils.MaskHalfInt64(purchaseID), "customer_id", utils.MaskHalfInt64(customer.ID))
+	return nil
+}
+
+// isAutoPayment reports whether the purchase charged the customer's saved payment
+// method. Those payments need no confirmation, so they have no payment URL.
+func isAutoPayment(purchase *database.Purchase) bool {
+	return purchase.InvoiceType == database.InvoiceTypeYookasa && purchase.YookasaID != nil && purchase.YookasaURL == nil
+}
+
+// warnAutoPaymentDeclined tells the customer that the cancelled purchase was an
+// auto-payment that did not go through. The expiration reminder is skipped while
+// an auto-payment is pending, so this is the customer's only warning.
+func (s PaymentService) warnAutoPaymentDeclined(ctx context.Context, purchase *database.Purchase) {
+	if !isAutoPayment(purchase) {
+		return
+	}
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil || customer == nil || customer.ExpireAt == nil {
+		slog.Error("Error finding customer of declined auto-payment", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		return
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "auto_renew_failed"), customer.ExpireAt.Format("02.01.2006")),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{s.translation.GetButton(customer.Language, "renew_subscription_button").InlineCallback("buy")},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending auto-payment declined message", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+	}
+}
+
+// SavePaymentMethod stores the payment method saved by a paid subscription purchase
+// on its customer and turns auto-renewal on.
+func (s PaymentService) SavePaymentMethod(ctx context.Context, purchaseID int64, methodID uuid.UUID) error {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return ErrPurchaseNotFound
+	}
+	if purchase.Kind != database.PurchaseKindSubscription {
+		return nil
+	}
+
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	}
+	if customer.YookasaPaymentMethodID != nil && *customer.YookasaPaymentMethodID == methodID {
+		return nil
+	}
+
+	if err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"yookasa_payment_method_id": methodID,
+		"auto_renew":                true,
+	}); err != nil {
+		return err
+	}
+	slog.Info("payment method saved", "customer_id", utils.MaskHalfInt64(customer.ID))
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      s.translation.GetText(customer.Language, "auto_renew_enabled"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{s.translation.GetButton(customer.Language, "back_button").InlineCallback("start")},
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending auto-renew message", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+	}
+	return nil
+}
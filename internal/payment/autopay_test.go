@@ -0,0 +1,30 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+func TestIsAutoPayment(t *testing.T) {
+	id := uuid.New()
+	url := "https://yoomoney.ru/checkout/payments/v2/contract?orderId=1"
+
+	tests := []struct {
+		name     string
+		purchase database.Purchase
+		want     bool
+	}{
+		{"saved card charge", database.Purchase{InvoiceType: database.InvoiceTypeYookasa, YookasaID: &id}, true},
+		{"invoice paid by the customer", database.Purchase{InvoiceType: database.InvoiceTypeYookasa, YookasaID: &id, YookasaURL: &url}, false},
+		{"payment not created", database.Purchase{InvoiceType: database.InvoiceTypeYookasa}, false},
+		{"other provider", database.Purchase{InvoiceType: database.InvoiceTypeCrypto}, false},
+	}
+	for _, tt := range tests {
+		if got := isAutoPayment(&tt.purchase); got != tt.want {
+			t.Errorf("%s: isAutoPayment() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
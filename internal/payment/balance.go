@@ -0,0 +1,113 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// ErrTopUpFromBalance is returned when a balance top-up is paid from the balance itself.
+var ErrTopUpFromBalance = errors.New("balance cannot be topped up from balance")
+
+// BalanceProvider pays for purchases from the customer's balance. The purchase is
+// paid as soon as it is created, the debit is recorded in the same transaction.
+type BalanceProvider struct {
+	balanceRepository *database.BalanceRepository
+}
+
+func NewBalanceProvider(balanceRepository *database.BalanceRepository) *BalanceProvider {
+	return &BalanceProvider{balanceRepository: balanceRepository}
+}
+
+func (p *BalanceProvider) InvoiceType() database.InvoiceType {
+	return database.InvoiceTypeBalance
+}
+
+func (p *BalanceProvider) ButtonKey() string {
+	return "balance_button"
+}
+
+func (p *BalanceProvider) IsEnabled() bool {
+	return true
+}
+
+func (p *BalanceProvider) Currency() string {
+	return "RUB"
+}
+
+func (p *BalanceProvider) InvoiceTTL() time.Duration {
+	return 0
+}
+
+func (p *BalanceProvider) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*Invoice, error) {
+	return &Invoice{}, nil
+}
+
+func (p *BalanceProvider) FetchStatus(ctx context.Context, purchase *database.Purchase) (*Transaction, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *BalanceProvider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	return nil
+}
+
+// Refund is not supported, balance purchases are refunded to the balance by RefundPurchase.
+func (p *BalanceProvider) Refund(ctx context.Context, purchase *database.Purchase) error {
+	return ErrNotSupported
+}
+
+func (p *BalanceProvider) SettleTx(ctx context.Context, tx pgx.Tx, purchase *database.Purchase) error {
+	return p.balanceRepository.DebitTx(ctx, tx, &database.BalanceTransaction{
+		CustomerID: purchase.CustomerID,
+		Amount:     purchase.Amount,
+		Reason:     database.BalanceReasonPurchase,
+		PurchaseID: &purchase.ID,
+	})
+}
+
+// AsTopUp makes the purchase a balance top-up: once paid its amount is credited to
+// the customer's balance.
+func AsTopUp() PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.kind = database.PurchaseKindTopUp
+	}
+}
+
+// Balance returns the customer's current balance.
+func (s PaymentService) Balance(ctx context.Context, customerID int64) (float64, error) {
+	return s.balanceRepository.Balance(ctx, customerID)
+}
+
+// Compensate credits amount to the customer's balance on behalf of an admin.
+func (s PaymentService) Compensate(ctx context.Context, customerID int64, amount float64, comment string) error {
+	entry := &database.BalanceTransaction{
+		CustomerID: customerID,
+		Amount:     amount,
+		Reason:     database.BalanceReasonCompensation,
+	}
+	if comment != "" {
+		entry.Comment = &comment
+	}
+	_, err := s.balanceRepository.Credit(ctx, entry)
+	return err
+}
+
+func (s PaymentService) creditTopUpTx(ctx context.Context, tx pgx.Tx, purchase *database.Purchase) error {
+	_, err := s.balanceRepository.CreditTx(ctx, tx, &database.BalanceTransaction{
+		CustomerID: purchase.CustomerID,
+		Amount:     purchase.Amount,
+		Reason:     database.BalanceReasonTopUp,
+		PurchaseID: &purchase.ID,
+	})
+	return err
+}
+
+// FormatAmount formats a balance amount without trailing zeros, e.g. 150 or 99.5.
+func FormatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
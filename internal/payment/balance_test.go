@@ -0,0 +1,34 @@
+package payment
+
+import (
+	"testing"
+)
+
+func TestBalanceProvider_IsSettlerOnly(t *testing.T) {
+	var provider Provider = NewBalanceProvider(nil)
+	if _, ok := provider.(Settler); !ok {
+		t.Error("balance provider must settle purchases itself")
+	}
+	if _, ok := provider.(Poller); ok {
+		t.Error("balance provider must not be polled")
+	}
+
+	r := NewRegistry(provider)
+	if len(r.Reconcilable()) != 0 {
+		t.Error("balance provider must not be reconciled")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := map[float64]string{
+		150:   "150",
+		99.5:  "99.5",
+		0:     "0",
+		-12.3: "-12.3",
+	}
+	for amount, want := range tests {
+		if got := FormatAmount(amount); got != want {
+			t.Errorf("FormatAmount(%v) = %q, want %q", amount, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ExpireStalePurchases cancels purchases whose invoice outlived the provider's
+// TTL. Each pending purchase is checked with the provider first so a late payment
+// is processed instead of lost. A pending purchase is only expired once the
+// provider reports the invoice cancelled or confirms cancelling it; otherwise it
+// is checked again on the next run. The "Pay" message of an expired purchase is
+// removed from the chat.
+func (s PaymentService) ExpireStalePurchases(ctx context.Context) {
+	now := time.Now()
+	for _, provider := range s.providers.Enabled() {
+		ttl := provider.InvoiceTTL()
+		if ttl <= 0 {
+			continue
+		}
+
+		for _, status := range []database.PurchaseStatus{database.PurchaseStatusNew, database.PurchaseStatusPending} {
+			purchases, err := s.purchaseRepository.FindByInvoiceTypeAndStatusCreatedBetween(ctx, provider.InvoiceType(), status, time.Time{}, now.Add(-ttl))
+			if err != nil {
+				slog.Error("expire: find stale purchases", "invoice_type", provider.InvoiceType(), "status", status, "error", err)
+				continue
+			}
+
+			for i := range purchases {
+				if err := s.expirePurchase(ctx, provider, &purchases[i]); err != nil {
+					slog.Error("expire: purchase", "purchase_id", utils.MaskHalfInt64(purchases[i].ID), "invoice_type", provider.InvoiceType(), "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (s PaymentService) expirePurchase(ctx context.Context, provider Provider, purchase *database.Purchase) error {
+	if purchase.TelegramChargeID != nil {
+		// Stars charged the customer already, the payment is still being processed.
+		return nil
+	}
+
+	if purchase.Status == database.PurchaseStatusPending {
+		tx, err := provider.FetchStatus(ctx, purchase)
+		cancelled := false
+		switch {
+		case errors.Is(err, ErrNotSupported):
+		case err != nil:
+			return err
+		case tx.Status == database.PurchaseStatusPaid:
+			ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, tx.Username)
+			return s.ProcessPaidPurchase(ctxWithUsername, purchase.ID, tx.Amount, tx.Currency)
+		case tx.Status == database.PurchaseStatusCancel:
+			cancelled = true
+		}
+
+		if !cancelled {
+			err := provider.Cancel(ctx, purchase)
+			if errors.Is(err, ErrStillPayable) || errors.Is(err, ErrNotSupported) {
+				slog.Debug("expire: invoice still payable", "purchase_id", utils.MaskHalfInt64(purchase.ID), "invoice_type", purchase.InvoiceType)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	applied, err := s.purchaseRepository.Transition(ctx, purchase.ID, database.PurchaseStatusCancel, nil)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return nil
+	}
+	slog.Info("expire: purchase expired", "purchase_id", utils.MaskHalfInt64(purchase.ID), "invoice_type", purchase.InvoiceType)
+	s.warnAutoPaymentDeclined(ctx, purchase)
+
+	s.deletePayMessage(ctx, purchase)
+	return nil
+}
+
+func (s PaymentService) deletePayMessage(ctx context.Context, purchase *database.Purchase) {
+	messageID, ok := s.cache.Get(purchase.ID)
+	if !ok {
+		return
+	}
+	s.cache.Delete(purchase.ID)
+
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil || customer == nil {
+		slog.Error("expire: find customer for pay message", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+		return
+	}
+
+	_, err = s.telegramBot.DeleteMessage(ctx, &bot.DeleteMessageParams{
+		ChatID:    customer.TelegramID,
+		MessageID: messageID,
+	})
+	if err != nil {
+		slog.Error("expire: delete pay message", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+type openInvoiceProvider struct {
+	providerMock
+	cancelErr error
+	cancelled int
+}
+
+func (p *openInvoiceProvider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	p.cancelled++
+	return p.cancelErr
+}
+
+// The service has no repositories, so reaching the cancel transition would panic.
+func TestExpirePurchaseKeepsPayableInvoices(t *testing.T) {
+	for _, cancelErr := range []error{ErrStillPayable, ErrNotSupported} {
+		provider := &openInvoiceProvider{cancelErr: cancelErr}
+		purchase := &database.Purchase{ID: 1, Status: database.PurchaseStatusPending}
+
+		if err := (PaymentService{}).expirePurchase(context.Background(), provider, purchase); err != nil {
+			t.Fatalf("%v: unexpected error: %v", cancelErr, err)
+		}
+		if provider.cancelled != 1 {
+			t.Fatalf("%v: expected one cancel attempt, got %d", cancelErr, provider.cancelled)
+		}
+	}
+}
+
+func TestExpirePurchaseSkipsChargedPurchases(t *testing.T) {
+	provider := &openInvoiceProvider{}
+	chargeID := "charge"
+	purchase := &database.Purchase{ID: 1, Status: database.PurchaseStatusPending, TelegramChargeID: &chargeID}
+
+	if err := (PaymentService{}).expirePurchase(context.Background(), provider, purchase); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.cancelled != 0 {
+		t.Fatalf("expected a charged purchase to be left alone, got %d cancel attempts", provider.cancelled)
+	}
+}
@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// GiftDeepLinkPrefix starts the /start payload of gift links.
+const GiftDeepLinkPrefix = "gift_"
+
+// AsGift makes the purchase a gift: once paid it produces a gift code instead of
+// extending the payer's subscription.
+func AsGift() PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.kind = database.PurchaseKindGift
+	}
+}
+
+// GiftLink returns the bot deep link that redeems the gift.
+func GiftLink(gift *database.Gift) string {
+	return fmt.Sprintf("%s?start=%s%s", config.BotURL(), GiftDeepLinkPrefix, gift.Code)
+}
+
+func newGiftCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate gift code: %w", err)
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+func (s PaymentService) createGiftTx(ctx context.Context, tx pgx.Tx, purchase *database.Purchase) error {
+	code, err := newGiftCode()
+	if err != nil {
+		return err
+	}
+	return s.giftRepository.CreateTx(ctx, tx, &database.Gift{
+		Code:       code,
+		PurchaseID: purchase.ID,
+		CustomerID: purchase.CustomerID,
+		Days:       purchase.Days(config.DaysInMonth()),
+	})
+}
+
+func (s PaymentService) notifyGiftPaid(ctx context.Context, customer *database.Customer, purchase *database.Purchase) error {
+	gift, err := s.giftRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if gift == nil {
+		return fmt.Errorf("gift for purchase %s not found", utils.MaskHalfInt64(purchase.ID))
+	}
+
+	link := GiftLink(gift)
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "gift_paid"), gift.Days, link, gift.Code),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{s.translation.GetButton(customer.Language, "share_gift_button").InlineURL("https://telegram.me/share/url?url=" + url.QueryEscape(link))},
+				{s.translation.GetButton(customer.Language, "back_button").InlineCallback("start")},
+			},
+		},
+	})
+	return err
+}
+
+// RedeemGift extends the customer's subscription by the gifted days and lets the
+// payer know the gift was used.
+func (s PaymentService) RedeemGift(ctx context.Context, customer *database.Customer, code string) (*database.Gift, error) {
+	gift, err := s.giftRepository.RedeemWith(ctx, code, customer.ID, func(gift *database.Gift) error {
+		user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, remnawaveUser(customer), nil, gift.Days, false)
+		if err != nil {
+			return err
+		}
+		return s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+			"subscription_link": user.SubscriptionUrl,
+			"expire_at":         user.ExpireAt,
+			"remnawave_uuid":    user.UUID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("gift redeemed", "gift_id", gift.ID, "customer_id", utils.MaskHalfInt64(customer.ID))
+
+	if gift.CustomerID != customer.ID {
+		payer, err := s.customerRepository.FindById(ctx, gift.CustomerID)
+		if err != nil {
+			slog.Error("Error finding gift payer", "error", err, "gift_id", gift.ID)
+		} else if payer != nil {
+			_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: payer.TelegramID,
+				Text:   s.translation.GetText(payer.Language, "gift_redeemed_notify"),
+			})
+			if err != nil {
+				slog.Error("Error sending gift redeemed message", "error", err, "gift_id", gift.ID)
+			}
+		}
+	}
+	return gift, nil
+}
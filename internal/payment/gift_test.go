@@ -0,0 +1,24 @@
+package payment
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewGiftCode(t *testing.T) {
+	pattern := regexp.MustCompile(`^[A-Z2-7]{16}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := newGiftCode()
+		if err != nil {
+			t.Fatalf("newGiftCode() returned error: %v", err)
+		}
+		if !pattern.MatchString(code) {
+			t.Fatalf("unexpected gift code format: %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate gift code: %q", code)
+		}
+		seen[code] = true
+	}
+}
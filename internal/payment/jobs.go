@@ -0,0 +1,251 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/outbox"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// Outbox job kinds enqueued when a purchase is paid.
+const (
+	JobPanelGrant      = "panel_grant"
+	JobPurchaseNotify  = "purchase_notify"
+	JobMoynalogReceipt = "moynalog_receipt"
+	JobReferralBonus   = "referral_bonus"
+)
+
+type purchaseJob struct {
+	PurchaseID int64 `json:"purchase_id"`
+}
+
+// JobHandlers returns the outbox handlers for the side effects of paid and
+// refunded purchases.
+func (s PaymentService) JobHandlers() map[string]outbox.Handler {
+	return map[string]outbox.Handler{
+		JobPanelGrant:      s.purchaseJobHandler(s.applyPanelGrant),
+		JobPanelRevoke:     s.purchaseJobHandler(s.applyPanelRevoke),
+		JobPurchaseNotify:  s.purchaseJobHandler(s.notifyPurchasePaid),
+		JobMoynalogReceipt: s.purchaseJobHandler(s.sendReceiptToMoynalog),
+		JobReferralBonus:   s.purchaseJobHandler(s.grantReferralBonus),
+
+		JobRefundSubscription: s.purchaseJobHandler(s.revokeRefundedTraffic),
+		JobRefundNotify:       s.purchaseJobHandler(s.notifyPurchaseRefunded),
+		JobMoynalogCancel:     s.purchaseJobHandler(s.cancelMoynalogReceipt),
+	}
+}
+
+func (s PaymentService) enqueuePurchaseJobs(ctx context.Context, tx pgx.Tx, purchase *database.Purchase) error {
+	var kinds []string
+	if grantsPanel(purchase) {
+		kinds = append(kinds, JobPanelGrant)
+	}
+	kinds = append(kinds, JobPurchaseNotify)
+	if purchase.Kind != database.PurchaseKindTopUp && purchase.Kind != database.PurchaseKindTraffic {
+		kinds = append(kinds, JobReferralBonus)
+	}
+	if s.receiptRequired(purchase) {
+		if err := s.receiptRepository.CreateTx(ctx, tx, purchase.ID); err != nil {
+			return err
+		}
+		kinds = append(kinds, JobMoynalogReceipt)
+	}
+
+	for _, kind := range kinds {
+		if err := s.outboxRepository.EnqueueTx(ctx, tx, kind, purchaseJob{PurchaseID: purchase.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s PaymentService) purchaseJobHandler(run func(ctx context.Context, purchase *database.Purchase) error) outbox.Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var job purchaseJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return fmt.Errorf("decode purchase job: %w", err)
+		}
+
+		purchase, err := s.purchaseRepository.FindById(ctx, job.PurchaseID)
+		if err != nil {
+			return err
+		}
+		if purchase == nil {
+			return fmt.Errorf("purchase %s not found", utils.MaskHalfInt64(job.PurchaseID))
+		}
+		return run(ctx, purchase)
+	}
+}
+
+func (s PaymentService) notifyPurchasePaid(ctx context.Context, purchase *database.Purchase) error {
+	if err := s.awaitPanelGrant(ctx, purchase); err != nil {
+		return err
+	}
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	}
+
+	switch purchase.Kind {
+	case database.PurchaseKindGift:
+		return s.notifyGiftPaid(ctx, customer, purchase)
+	case database.PurchaseKindTopUp:
+		return s.notifyBalanceToppedUp(ctx, customer, purchase)
+	case database.PurchaseKindTraffic:
+		return s.notifyTrafficPackAdded(ctx, customer, purchase)
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: customer.TelegramID,
+		Text:   s.translation.GetText(customer.Language, "subscription_activated"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: s.createConnectKeyboard(customer),
+		},
+	})
+	return err
+}
+
+func (s PaymentService) grantReferralBonus(ctx context.Context, purchase *database.Purchase) error {
+	if err := s.awaitPanelGrant(ctx, purchase); err != nil {
+		return err
+	}
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	}
+
+	referee, err := s.referralRepository.FindByReferee(ctx, customer.TelegramID)
+	if err != nil {
+		return err
+	}
+	if referee == nil || referee.BonusGranted {
+		return nil
+	}
+
+	refereeCustomer, err := s.customerRepository.FindByTelegramId(ctx, referee.ReferrerID)
+	if err != nil {
+		return err
+	}
+	if refereeCustomer == nil {
+		return fmt.Errorf("referrer %s not found", utils.MaskHalfInt64(referee.ReferrerID))
+	}
+
+	text := s.translation.GetText(refereeCustomer.Language, "referral_bonus_granted")
+	if amount := config.ReferralBonusAmount(); amount > 0 {
+		// The entry is tied to the referee's purchase, so a retried job credits it once.
+		_, err = s.balanceRepository.Credit(ctx, &database.BalanceTransaction{
+			CustomerID: refereeCustomer.ID,
+			Amount:     float64(amount),
+			Reason:     database.BalanceReasonReferral,
+			PurchaseID: &purchase.ID,
+		})
+		if err != nil {
+			return err
+		}
+		text = fmt.Sprintf(s.translation.GetText(refereeCustomer.Language, "referral_bonus_balance"), amount)
+	} else {
+		if referee.BonusExpireAt == nil {
+			if referee, err = s.setReferralBonusTarget(ctx, refereeCustomer, referee, purchase); err != nil {
+				return err
+			}
+		}
+		refereeUser, err := s.remnawaveClient.SetSubscription(ctx, remnawaveUser(refereeCustomer), nil, *referee.BonusExpireAt)
+		if err != nil {
+			return err
+		}
+		err = s.customerRepository.UpdateFields(ctx, refereeCustomer.ID, map[string]interface{}{
+			"subscription_link": refereeUser.SubscriptionUrl,
+			"expire_at":         refereeUser.ExpireAt,
+			"remnawave_uuid":    refereeUser.UUID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.referralRepository.MarkBonusGranted(ctx, referee.ID); err != nil {
+		return err
+	}
+	slog.Info("Granted referral bonus", "customer_id", utils.MaskHalfInt64(refereeCustomer.ID))
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    refereeCustomer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: s.createConnectKeyboard(refereeCustomer),
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending referral bonus message", "error", err, "customer_id", utils.MaskHalfInt64(refereeCustomer.ID))
+	}
+	return nil
+}
+
+func (s PaymentService) notifyBalanceToppedUp(ctx context.Context, customer *database.Customer, purchase *database.Purchase) error {
+	balance, err := s.balanceRepository.Balance(ctx, customer.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "balance_topped_up"), FormatAmount(purchase.Amount), FormatAmount(balance)),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{s.translation.GetButton(customer.Language, "buy_button").InlineCallback("buy")},
+				{s.translation.GetButton(customer.Language, "back_button").InlineCallback("start")},
+			},
+		},
+	})
+	return err
+}
+
+// setReferralBonusTarget computes the expiry the referral bonus days set on the
+// referrer's panel user and stores it before the panel call, like a panel grant. It
+// waits for the referrer's grants and revokes recorded before it, whose expiry it
+// would otherwise overwrite; later ones wait for the bonus.
+func (s PaymentService) setReferralBonusTarget(ctx context.Context, referrer *database.Customer, referral *database.Referral, purchase *database.Purchase) (*database.Referral, error) {
+	now := time.Now()
+	pending, err := s.panelGrantRepository.HasPendingCreatedBefore(ctx, referrer.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !pending {
+		pending, err = s.panelRevokeRepository.HasPendingBefore(ctx, referrer.ID, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pending {
+		return nil, fmt.Errorf("referrer %s: %w", utils.MaskHalfInt64(referrer.ID), errPanelGrantPending)
+	}
+
+	var current time.Time
+	user, err := s.remnawaveClient.GetUser(ctx, remnawaveUser(referrer))
+	switch {
+	case err == nil:
+		current = user.ExpireAt
+	case !errors.Is(err, remnawave.ErrNotFound):
+		return nil, err
+	}
+	return s.referralRepository.SetBonusTarget(ctx, referral.ID, purchase.ID, remnawave.ExtendExpire(config.GetReferralDays(), current))
+}
@@ -0,0 +1,92 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ErrNoActiveSubscription is returned when the customer has no active subscription
+// whose link could be reset.
+var ErrNoActiveSubscription = errors.New("customer has no active subscription")
+
+const linkResetSaveAttempts = 3
+
+// NextLinkReset returns when the customer may reset the subscription link again,
+// the zero time when it may reset it now.
+func (s PaymentService) NextLinkReset(ctx context.Context, customer *database.Customer) (time.Time, error) {
+	last, err := s.linkResetRepository.LastResetAt(ctx, customer.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if last == nil {
+		return time.Time{}, nil
+	}
+	next := last.Add(config.LinkResetCooldown())
+	if next.Before(time.Now()) {
+		return time.Time{}, nil
+	}
+	return next, nil
+}
+
+// ResetSubscriptionLink revokes the customer's subscription link in Remnawave and
+// stores the new one. It returns database.ErrLinkResetCooldown when the link was
+// reset within the cooldown, and the new link with database.ErrLinkResetNotSaved
+// when the panel revoked the old link but the new one could not be stored.
+func (s PaymentService) ResetSubscriptionLink(ctx context.Context, customer *database.Customer) (string, error) {
+	if customer.ExpireAt == nil || customer.ExpireAt.Before(time.Now()) {
+		return "", ErrNoActiveSubscription
+	}
+
+	var userUUID uuid.UUID
+	linkReset, err := s.linkResetRepository.ResetWith(ctx, customer.ID, config.LinkResetCooldown(), func() (string, error) {
+		user, err := s.remnawaveClient.RevokeSubscription(ctx, remnawaveUser(customer))
+		if err != nil {
+			return "", err
+		}
+		userUUID = user.UUID
+		return user.SubscriptionUrl, nil
+	})
+	if errors.Is(err, database.ErrLinkResetNotSaved) {
+		err = s.saveLinkReset(ctx, linkReset, err)
+	}
+	if linkReset == nil {
+		return "", err
+	}
+	s.rememberRemnawaveUser(ctx, customer, userUUID)
+	if err != nil {
+		return linkReset.NewLink, err
+	}
+
+	slog.Info("subscription link reset", "customer_id", utils.MaskHalfInt64(customer.ID), "link_reset_id", linkReset.ID)
+	return linkReset.NewLink, nil
+}
+
+// saveLinkReset retries storing a reset the panel already made. The old link no
+// longer works, so the new one must not be lost to a single failed write. When
+// every attempt fails the customer's link is refreshed by the next panel sync.
+func (s PaymentService) saveLinkReset(ctx context.Context, linkReset *database.LinkReset, err error) error {
+	delay := time.Second
+	for attempt := 0; attempt < linkResetSaveAttempts; attempt++ {
+		slog.Warn("retrying to save subscription link reset", "error", err, "customer_id", utils.MaskHalfInt64(linkReset.CustomerID), "attempt", attempt+1)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", database.ErrLinkResetNotSaved, ctx.Err())
+		case <-time.After(delay):
+		}
+		if err = s.linkResetRepository.Save(ctx, linkReset); err == nil {
+			return nil
+		}
+		delay *= 2
+	}
+	slog.Error("subscription link reset is not saved", "error", err, "customer_id", utils.MaskHalfInt64(linkReset.CustomerID))
+	return fmt.Errorf("%w: %w", database.ErrLinkResetNotSaved, err)
+}
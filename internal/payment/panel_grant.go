@@ -0,0 +1,182 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// errPanelGrantPending makes a job wait until the purchase's days or traffic are on
+// the panel.
+var errPanelGrantPending = errors.New("panel grant is not applied yet")
+
+// grantsPanel reports whether paying the purchase changes the customer's panel user.
+func grantsPanel(purchase *database.Purchase) bool {
+	return purchase.Kind != database.PurchaseKindGift && purchase.Kind != database.PurchaseKindTopUp
+}
+
+// applyPanelGrant adds the purchase's days or traffic to the customer's panel user.
+// The target expiry or limit is computed once from the panel and stored before it
+// is sent, so a retry after a failed call or commit sets the same value again.
+func (s PaymentService) applyPanelGrant(ctx context.Context, purchase *database.Purchase) error {
+	grant, err := s.panelGrantRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if grant == nil || grant.AppliedAt != nil {
+		return nil
+	}
+
+	pending, err := s.panelGrantRepository.HasPendingBefore(ctx, grant.CustomerID, grant.PurchaseID)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("customer %s: an earlier %w", utils.MaskHalfInt64(grant.CustomerID), errPanelGrantPending)
+	}
+	pending, err = s.panelRevokeRepository.HasPendingBefore(ctx, grant.CustomerID, grant.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("customer %s: an earlier panel revoke is not applied yet: %w", utils.MaskHalfInt64(grant.CustomerID), errPanelGrantPending)
+	}
+
+	customer, err := s.customerRepository.FindById(ctx, grant.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(grant.CustomerID))
+	}
+	if err := s.awaitReferralBonus(ctx, customer); err != nil {
+		return err
+	}
+
+	if purchase.Kind == database.PurchaseKindTraffic {
+		return s.applyTrafficGrant(ctx, customer, purchase, grant)
+	}
+	return s.applySubscriptionGrant(ctx, customer, purchase, grant)
+}
+
+func (s PaymentService) applySubscriptionGrant(ctx context.Context, customer *database.Customer, purchase *database.Purchase, grant *database.PanelGrant) error {
+	access, err := s.purchaseAccess(ctx, purchase)
+	if err != nil {
+		return err
+	}
+	if err := s.addTrafficPacks(ctx, customer.ID, access); err != nil {
+		return err
+	}
+
+	if grant.ExpireAt == nil {
+		var current time.Time
+		user, err := s.remnawaveClient.GetUser(ctx, remnawaveUser(customer))
+		switch {
+		case err == nil:
+			current = user.ExpireAt
+		case !errors.Is(err, remnawave.ErrNotFound):
+			return err
+		}
+		expireAt := remnawave.ExtendExpire(purchase.Days(config.DaysInMonth()), current)
+		if grant, err = s.panelGrantRepository.SetTarget(ctx, purchase.ID, &expireAt, nil); err != nil {
+			return err
+		}
+	}
+
+	user, err := s.remnawaveClient.SetSubscription(ctx, remnawaveUser(customer), access, *grant.ExpireAt)
+	if err != nil {
+		return err
+	}
+
+	err = s.panelGrantRepository.ApplyWith(ctx, purchase.ID, func(tx pgx.Tx) error {
+		return s.customerRepository.UpdateFieldsTx(ctx, tx, customer.ID, map[string]interface{}{
+			"subscription_link": user.SubscriptionUrl,
+			"expire_at":         user.ExpireAt,
+			"remnawave_uuid":    user.UUID,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("panel grant applied", "purchase_id", utils.MaskHalfInt64(purchase.ID), "customer_id", utils.MaskHalfInt64(customer.ID), "expire_at", user.ExpireAt)
+	return nil
+}
+
+func (s PaymentService) applyTrafficGrant(ctx context.Context, customer *database.Customer, purchase *database.Purchase, grant *database.PanelGrant) error {
+	if grant.TrafficLimit == nil {
+		user, err := s.remnawaveClient.GetUser(ctx, remnawaveUser(customer))
+		if err != nil {
+			return err
+		}
+		if user.TrafficLimitBytes == 0 {
+			return remnawave.ErrUnlimitedTraffic
+		}
+		limit := int64(user.TrafficLimitBytes) + purchase.TrafficBytes()
+		if grant, err = s.panelGrantRepository.SetTarget(ctx, purchase.ID, nil, &limit); err != nil {
+			return err
+		}
+	}
+
+	user, err := s.remnawaveClient.SetTrafficLimit(ctx, remnawaveUser(customer), int(*grant.TrafficLimit))
+	if err != nil {
+		return err
+	}
+
+	err = s.panelGrantRepository.ApplyWith(ctx, purchase.ID, func(tx pgx.Tx) error {
+		if err := s.customerRepository.UpdateFieldsTx(ctx, tx, customer.ID, map[string]interface{}{
+			"remnawave_uuid": user.UUID,
+		}); err != nil {
+			return err
+		}
+		return s.trafficPackRepository.CreateTx(ctx, tx, &database.TrafficPack{
+			PurchaseID: purchase.ID,
+			CustomerID: customer.ID,
+			Bytes:      purchase.TrafficBytes(),
+			ExpiresAt:  trafficPackExpiry(user, config.TrafficPacksUntilReset(), time.Now()),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("panel grant applied", "purchase_id", utils.MaskHalfInt64(purchase.ID), "customer_id", utils.MaskHalfInt64(customer.ID), "traffic_limit", *grant.TrafficLimit)
+	return nil
+}
+
+// awaitReferralBonus returns errPanelGrantPending while a referral bonus of the
+// customer has its target expiry stored but is not granted yet, since that expiry
+// would overwrite what a grant or revoke applied before it sets.
+func (s PaymentService) awaitReferralBonus(ctx context.Context, customer *database.Customer) error {
+	pending, err := s.referralRepository.HasPendingBonus(ctx, customer.TelegramID)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("customer %s: a referral bonus is not granted yet: %w", utils.MaskHalfInt64(customer.ID), errPanelGrantPending)
+	}
+	return nil
+}
+
+// awaitPanelGrant returns errPanelGrantPending while the purchase's grant has not
+// been applied, so jobs that tell the customer about it or build on it run after.
+func (s PaymentService) awaitPanelGrant(ctx context.Context, purchase *database.Purchase) error {
+	if !grantsPanel(purchase) {
+		return nil
+	}
+	grant, err := s.panelGrantRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if grant != nil && grant.AppliedAt == nil {
+		return fmt.Errorf("purchase %s: %w", utils.MaskHalfInt64(purchase.ID), errPanelGrantPending)
+	}
+	return nil
+}
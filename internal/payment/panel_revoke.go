@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// JobPanelRevoke takes the days of a cancelled or refunded purchase back from the
+// panel.
+const JobPanelRevoke = "panel_revoke"
+
+// applyPanelRevoke takes the purchase's days back from the customer's panel user.
+// It waits for the grants recorded before it, and stores the target expiry before
+// the panel call, so a retry sets the same expiry instead of taking the days twice.
+func (s PaymentService) applyPanelRevoke(ctx context.Context, purchase *database.Purchase) error {
+	revoke, err := s.panelRevokeRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if revoke == nil || revoke.AppliedAt != nil {
+		return nil
+	}
+
+	pending, err := s.panelGrantRepository.HasPendingCreatedBefore(ctx, revoke.CustomerID, revoke.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("customer %s: an earlier %w", utils.MaskHalfInt64(revoke.CustomerID), errPanelGrantPending)
+	}
+
+	customer, err := s.customerRepository.FindById(ctx, revoke.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(revoke.CustomerID))
+	}
+	if err := s.awaitReferralBonus(ctx, customer); err != nil {
+		return err
+	}
+
+	if revoke.ExpireAt == nil {
+		user, err := s.remnawaveClient.GetUser(ctx, remnawaveUser(customer))
+		if errors.Is(err, remnawave.ErrNotFound) {
+			slog.Warn("panel user to revoke days from not found", "purchase_id", utils.MaskHalfInt64(purchase.ID), "customer_id", utils.MaskHalfInt64(customer.ID))
+			return s.panelRevokeRepository.ApplyWith(ctx, purchase.ID, func(pgx.Tx) error { return nil })
+		}
+		if err != nil {
+			return err
+		}
+		if revoke, err = s.panelRevokeRepository.SetTarget(ctx, purchase.ID, remnawave.ExtendExpire(-revoke.Days, user.ExpireAt)); err != nil {
+			return err
+		}
+	}
+
+	user, err := s.remnawaveClient.SetExpire(ctx, remnawaveUser(customer), *revoke.ExpireAt)
+	if err != nil {
+		return err
+	}
+
+	err = s.panelRevokeRepository.ApplyWith(ctx, purchase.ID, func(tx pgx.Tx) error {
+		return s.customerRepository.UpdateFieldsTx(ctx, tx, customer.ID, map[string]interface{}{
+			"expire_at":      user.ExpireAt,
+			"remnawave_uuid": user.UUID,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("panel revoke applied", "purchase_id", utils.MaskHalfInt64(purchase.ID), "customer_id", utils.MaskHalfInt64(customer.ID), "expire_at", user.ExpireAt)
+	return nil
+}
+
+// revokePanelDaysTx records taking days back from the customer's panel user and
+// enqueues the job that does it, in the transaction that cancels or refunds the
+// purchase.
+func (s PaymentService) revokePanelDaysTx(ctx context.Context, tx pgx.Tx, purchaseID, customerID int64, days int) error {
+	if err := s.panelRevokeRepository.CreateTx(ctx, tx, purchaseID, customerID, days); err != nil {
+		return err
+	}
+	return s.outboxRepository.EnqueueTx(ctx, tx, JobPanelRevoke, purchaseJob{PurchaseID: purchaseID})
+}
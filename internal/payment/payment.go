@@ -7,32 +7,41 @@ import (
 	"log/slog"
 	"remnawave-tg-shop-bot/internal/cache"
 	"remnawave-tg-shop-bot/internal/config"
-	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/moynalog"
-	"remnawave-tg-shop-bot/internal/platega"
 	"remnawave-tg-shop-bot/internal/remnawave"
 	"remnawave-tg-shop-bot/internal/translation"
-	"remnawave-tg-shop-bot/internal/yookasa"
 	"remnawave-tg-shop-bot/utils"
+	"strings"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 )
 
 type PaymentService struct {
-	purchaseRepository *database.PurchaseRepository
-	remnawaveClient    *remnawave.Client
-	customerRepository *database.CustomerRepository
-	telegramBot        *bot.Bot
-	translation        *translation.Manager
-	cryptoPayClient    *cryptopay.Client
-	yookasaClient      *yookasa.Client
-	plategaClient      *platega.Client
-	referralRepository *database.ReferralRepository
-	cache              *cache.Cache
-	moynalogClient     *moynalog.Client
+	purchaseRepository          *database.PurchaseRepository
+	remnawaveClient             *remnawave.Client
+	customerRepository          *database.CustomerRepository
+	telegramBot                 *bot.Bot
+	translation                 *translation.Manager
+	providers                   *Registry
+	referralRepository          *database.ReferralRepository
+	outboxRepository            *database.OutboxRepository
+	promoRepository             *database.PromoRepository
+	giftRepository              *database.GiftRepository
+	balanceRepository           *database.BalanceRepository
+	planRepository              *database.PlanRepository
+	trafficPackRepository       *database.TrafficPackRepository
+	starsSubscriptionRepository *database.StarsSubscriptionRepository
+	receiptRepository           *database.ReceiptRepository
+	linkResetRepository         *database.LinkResetRepository
+	panelGrantRepository        *database.PanelGrantRepository
+	panelRevokeRepository       *database.PanelRevokeRepository
+	cache                       *cache.Cache
+	moynalogClient              *moynalog.Client
 }
 
 func NewPaymentService(
@@ -41,25 +50,43 @@ func NewPaymentService(
 	remnawaveClient *remnawave.Client,
 	customerRepository *database.CustomerRepository,
 	telegramBot *bot.Bot,
-	cryptoPayClient *cryptopay.Client,
-	yookasaClient *yookasa.Client,
-	plategaClient *platega.Client,
+	providers *Registry,
 	referralRepository *database.ReferralRepository,
+	outboxRepository *database.OutboxRepository,
+	promoRepository *database.PromoRepository,
+	giftRepository *database.GiftRepository,
+	balanceRepository *database.BalanceRepository,
+	planRepository *database.PlanRepository,
+	trafficPackRepository *database.TrafficPackRepository,
+	starsSubscriptionRepository *database.StarsSubscriptionRepository,
+	receiptRepository *database.ReceiptRepository,
+	linkResetRepository *database.LinkResetRepository,
+	panelGrantRepository *database.PanelGrantRepository,
+	panelRevokeRepository *database.PanelRevokeRepository,
 	cache *cache.Cache,
 	moynalogClient *moynalog.Client,
 ) *PaymentService {
 	return &PaymentService{
-		purchaseRepository: purchaseRepository,
-		remnawaveClient:    remnawaveClient,
-		customerRepository: customerRepository,
-		telegramBot:        telegramBot,
-		translation:        translation,
-		cryptoPayClient:    cryptoPayClient,
-		yookasaClient:      yookasaClient,
-		plategaClient:      plategaClient,
-		referralRepository: referralRepository,
-		cache:              cache,
-		moynalogClient:     moynalogClient,
+		purchaseRepository:          purchaseRepository,
+		remnawaveClient:             remnawaveClient,
+		customerRepository:          customerRepository,
+		telegramBot:                 telegramBot,
+		translation:                 translation,
+		providers:                   providers,
+		referralRepository:          referralRepository,
+		outboxRepository:            outboxRepository,
+		promoRepository:             promoRepository,
+		giftRepository:              giftRepository,
+		balanceRepository:           balanceRepository,
+		planRepository:              planRepository,
+		trafficPackRepository:       trafficPackRepository,
+		starsSubscriptionRepository: starsSubscriptionRepository,
+		receiptRepository:           receiptRepository,
+		linkResetRepository:         linkResetRepository,
+		panelGrantRepository:        panelGrantRepository,
+		panelRevokeRepository:       panelRevokeRepository,
+		cache:                       cache,
+		moynalogClient:              moynalogClient,
 	}
 }
 
@@ -80,106 +107,64 @@ func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int6
 		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
 	}
 
-	if messageId, b := s.cache.Get(purchase.ID); b {
-		_, err = s.telegramBot.DeleteMessage(ctx, &bot.DeleteMessageParams{
-			ChatID:    customer.TelegramID,
-			MessageID: messageId,
-		})
-		if err != nil {
-			slog.Error("Error deleting message", "error", err)
-		}
-	}
-
-	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, config.TrafficLimit(), purchase.Month*config.DaysInMonth(), false)
-	if err != nil {
-		return err
-	}
-
-	err = s.purchaseRepository.MarkAsPaid(ctx, purchase.ID)
-	if err != nil {
-		return err
-	}
-
-	customerFilesToUpdate := map[string]interface{}{
-		"subscription_link": user.SubscriptionUrl,
-		"expire_at":         user.ExpireAt,
-	}
-
-	err = s.customerRepository.UpdateFields(ctx, customer.ID, customerFilesToUpdate)
-	if err != nil {
-		return err
-	}
+	provider, _ := s.providers.Get(purchase.InvoiceType)
+	settler, settles := provider.(Settler)
 
-	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: customer.TelegramID,
-		Text:   s.translation.GetText(customer.Language, "subscription_activated"),
-		ReplyMarkup: models.InlineKeyboardMarkup{
-			InlineKeyboard: s.createConnectKeyboard(customer),
-		},
+	var promoOverused bool
+	applied, err := s.purchaseRepository.TransitionWith(ctx, purchase.ID, database.PurchaseStatusPaid, map[string]interface{}{
+		"paid_at": time.Now(),
+	}, func(tx pgx.Tx, locked *database.Purchase) error {
+		if settles {
+			if err := settler.SettleTx(ctx, tx, locked); err != nil {
+				return err
+			}
+		}
+		switch locked.Kind {
+		case database.PurchaseKindGift:
+			if err := s.createGiftTx(ctx, tx, locked); err != nil {
+				return err
+			}
+		case database.PurchaseKindTopUp:
+			if err := s.creditTopUpTx(ctx, tx, locked); err != nil {
+				return err
+			}
+		default:
+			// The panel is changed by the panel grant job after this commits, so a
+			// failure here cannot leave days on the panel without a paid purchase.
+			if err := s.panelGrantRepository.CreateTx(ctx, tx, locked.ID, customer.ID); err != nil {
+				return err
+			}
+		}
+		if locked.PromoCodeID != nil {
+			withinLimits, err := s.promoRepository.RedeemTx(ctx, tx, *locked.PromoCodeID, customer.ID, &locked.ID)
+			if err != nil {
+				return err
+			}
+			promoOverused = !withinLimits
+		}
+		return s.enqueuePurchaseJobs(ctx, tx, locked)
 	})
 	if err != nil {
 		return err
 	}
-
-	if purchase.InvoiceType == database.InvoiceTypeYookasa && s.moynalogClient != nil {
-		go func() {
-			moynalogCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-			defer cancel()
-			if err := s.sendReceiptToMoynalog(moynalogCtx, purchase); err != nil {
-				slog.Error("send receipt to Moynalog", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
-				_, sendErr := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: config.GetAdminTelegramId(),
-					Text:   "Ошибка при отправке чека в Мой налог. Проверьте логи.",
-				})
-				if sendErr != nil {
-					slog.Error("notify admin about Moynalog failure", "error", sendErr, "purchase_id", utils.MaskHalfInt64(purchase.ID))
-				}
-				return
-			}
-			slog.Info("Moynalog receipt sent", "purchase_id", utils.MaskHalfInt64(purchase.ID))
-		}()
-	}
-
-	ctxReferee := context.Background()
-	referee, err := s.referralRepository.FindByReferee(ctxReferee, customer.TelegramID)
-	if referee == nil {
-		return nil
-	}
-	if referee.BonusGranted {
+	if !applied {
+		slog.Info("purchase already paid, skipping", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType)
 		return nil
 	}
-	if err != nil {
-		return err
-	}
-	refereeCustomer, err := s.customerRepository.FindByTelegramId(ctxReferee, referee.ReferrerID)
-	if err != nil {
-		return err
-	}
-	refereeUser, err := s.remnawaveClient.CreateOrUpdateUser(ctxReferee, refereeCustomer.ID, refereeCustomer.TelegramID, config.TrafficLimit(), config.GetReferralDays(), false)
-	if err != nil {
-		return err
-	}
-	refereeUserFilesToUpdate := map[string]interface{}{
-		"subscription_link": refereeUser.SubscriptionUrl,
-		"expire_at":         refereeUser.ExpireAt,
-	}
-	err = s.customerRepository.UpdateFields(ctxReferee, refereeCustomer.ID, refereeUserFilesToUpdate)
-	if err != nil {
-		return err
+
+	if promoOverused {
+		s.reportOverusedPromo(ctx, purchase)
 	}
-	err = s.referralRepository.MarkBonusGranted(ctxReferee, referee.ID)
-	if err != nil {
-		return err
+
+	if messageId, b := s.cache.Get(purchase.ID); b {
+		_, err = s.telegramBot.DeleteMessage(ctx, &bot.DeleteMessageParams{
+			ChatID:    customer.TelegramID,
+			MessageID: messageId,
+		})
+		if err != nil {
+			slog.Error("Error deleting message", "error", err)
+		}
 	}
-	slog.Info("Granted referral bonus", "customer_id", utils.MaskHalfInt64(refereeCustomer.ID))
-	_, err = s.telegramBot.SendMessage(ctxReferee, &bot.SendMessageParams{
-		ChatID:    refereeCustomer.TelegramID,
-		ParseMode: models.ParseModeHTML,
-		Text:      s.translation.GetText(refereeCustomer.Language, "referral_bonus_granted"),
-		ReplyMarkup: models.InlineKeyboardMarkup{
-			InlineKeyboard: s.createConnectKeyboard(refereeCustomer),
-		},
-	})
 
 	slog.Info("purchase processed", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType, "customer_id", utils.MaskHalfInt64(customer.ID))
 
@@ -202,76 +187,192 @@ func (s PaymentService) createConnectKeyboard(customer *database.Customer) [][]m
 	return inlineCustomerKeyboard
 }
 
-func (s PaymentService) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (url string, purchaseId int64, err error) {
-	switch invoiceType {
-	case database.InvoiceTypeCrypto:
-		return s.createCryptoInvoice(ctx, amount, months, customer)
-	case database.InvoiceTypeYookasa:
-		return s.createYookasaInvoice(ctx, amount, months, customer)
-	case database.InvoiceTypeTelegram:
-		return s.createTelegramInvoice(ctx, amount, months, customer)
-	case database.InvoiceTypeTribute:
-		return s.createTributeInvoice(ctx, amount, months, customer)
-	case database.InvoiceTypePlategaSBP,
-		database.InvoiceTypePlategaCards,
-		database.InvoiceTypePlategaAcquiring,
-		database.InvoiceTypePlategaWorldwide,
-		database.InvoiceTypePlategaCrypto:
-		return s.createPlategaInvoice(ctx, amount, months, customer, invoiceType)
-	default:
-		return "", 0, fmt.Errorf("unknown invoice type: %s", invoiceType)
+type purchaseOptions struct {
+	promo     *database.PromoCode
+	kind      database.PurchaseKind
+	plan      *database.Plan
+	trafficGB int
+	currency  string
+	// durationDays is the length of a purchase made without a plan in days,
+	// instead of months.
+	durationDays int
+	// tributeEventID is the Tribute webhook event the purchase is created for.
+	tributeEventID string
+	// chargeSaved pays the purchase with the customer's saved payment method
+	// instead of issuing an invoice.
+	chargeSaved bool
+}
+
+// PurchaseOption customizes a purchase created by CreatePurchase.
+type PurchaseOption func(*purchaseOptions)
+
+// PaidInCurrency records the currency the provider was actually paid in, for
+// providers that accept more than their default currency.
+func PaidInCurrency(currency string) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.currency = strings.ToUpper(currency)
 	}
 }
 
-func (s PaymentService) createPlategaInvoice(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (url string, purchaseId int64, err error) {
-	if s.plategaClient == nil {
-		return "", 0, fmt.Errorf("platega client not configured")
+// ForTributeEvent ties the purchase to the Tribute webhook event that created it,
+// so the event cannot create a second purchase.
+func ForTributeEvent(eventID string) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.tributeEventID = eventID
 	}
+}
 
-	provider, err := platega.ProviderFor(s.plategaClient, invoiceType)
-	if err != nil {
-		return "", 0, err
+// forDays makes the purchase last the given days instead of its months.
+func forDays(days int) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.durationDays = days
+	}
+}
+
+func (s PaymentService) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType, opts ...PurchaseOption) (url string, purchaseId int64, err error) {
+	provider, ok := s.providers.Get(invoiceType)
+	if !ok || !provider.IsEnabled() {
+		return "", 0, fmt.Errorf("unknown invoice type: %s", invoiceType)
 	}
 
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
+	options := purchaseOptions{kind: database.PurchaseKindSubscription}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	_, settles := provider.(Settler)
+	if settles && options.kind == database.PurchaseKindTopUp {
+		return "", 0, ErrTopUpFromBalance
+	}
+	recurring, isRecurring := provider.(Recurring)
+	if options.chargeSaved && !isRecurring {
+		return "", 0, fmt.Errorf("%s cannot charge a saved payment method", invoiceType)
+	}
+
+	purchase := &database.Purchase{
 		InvoiceType: invoiceType,
 		Status:      database.PurchaseStatusNew,
 		Amount:      amount,
-		Currency:    "RUB",
+		Currency:    provider.Currency(),
 		CustomerID:  customer.ID,
 		Month:       months,
-	})
+		Kind:        options.kind,
+		TrafficGB:   options.trafficGB,
+	}
+	if options.currency != "" {
+		purchase.Currency = options.currency
+	}
+	if options.tributeEventID != "" {
+		purchase.TributeEventID = &options.tributeEventID
+	}
+	if options.durationDays > 0 {
+		purchase.DurationDays = options.durationDays
+	}
+	if options.plan != nil {
+		purchase.PlanID = &options.plan.ID
+		purchase.DurationDays = options.plan.Days
+	}
+	if options.promo != nil {
+		applyPromoCode(purchase, options.promo)
+	}
+	purchaseId, err = s.purchaseRepository.Create(ctx, purchase)
 	if err != nil {
 		slog.Error("Error creating purchase", "error", err)
 		return "", 0, err
 	}
+	purchase.ID = purchaseId
 
-	redirectURL, transactionID, err := provider.CreateInvoice(
-		ctx, purchaseId, amount, "RUB",
-		utils.FormatSubscriptionDescription(months),
-		config.BotURL(),
-	)
+	var invoice *Invoice
+	if options.chargeSaved {
+		invoice, err = recurring.ChargeSaved(ctx, purchase, customer)
+	} else {
+		invoice, err = provider.CreateInvoice(ctx, purchase, customer)
+	}
 	if err != nil {
-		slog.Error("Error creating platega invoice", "error", err, "invoice_type", invoiceType)
+		slog.Error("Error creating invoice", "error", err, "invoice_type", invoiceType)
 		return "", 0, err
 	}
 
 	updates := map[string]interface{}{
-		"platega_id":  transactionID,
-		"platega_url": redirectURL,
-		"status":      database.PurchaseStatusPending,
+		"status": database.PurchaseStatusPending,
+	}
+	for field, value := range invoice.Fields {
+		updates[field] = value
 	}
 	if err := s.purchaseRepository.UpdateFields(ctx, purchaseId, updates); err != nil {
 		slog.Error("Error updating purchase", "error", err)
 		return "", 0, err
 	}
 
-	return redirectURL, purchaseId, nil
+	if settles {
+		if err := s.ProcessPurchaseById(ctx, purchaseId); err != nil {
+			if _, cancelErr := s.purchaseRepository.Transition(ctx, purchaseId, database.PurchaseStatusCancel, nil); cancelErr != nil {
+				slog.Error("Error cancelling unsettled purchase", "error", cancelErr, "purchase_id", utils.MaskHalfInt64(purchaseId))
+			}
+			return "", 0, err
+		}
+	}
+
+	return invoice.URL, purchaseId, nil
+}
+
+// Providers returns the enabled payment providers in sell keyboard order.
+func (s PaymentService) Providers() []Provider {
+	return s.providers.Enabled()
+}
+
+// Provider returns the enabled provider of the given invoice type.
+func (s PaymentService) Provider(invoiceType database.InvoiceType) (Provider, bool) {
+	provider, ok := s.providers.Get(invoiceType)
+	if !ok || !provider.IsEnabled() {
+		return nil, false
+	}
+	return provider, true
+}
+
+// PollPendingInvoices asks every enabled Poller about its pending purchases and
+// processes the ones reported as paid.
+func (s PaymentService) PollPendingInvoices(ctx context.Context) {
+	for _, poller := range s.providers.Pollers() {
+		pendingPurchases, err := s.purchaseRepository.FindByInvoiceTypeAndStatus(ctx, poller.InvoiceType(), database.PurchaseStatusPending)
+		if err != nil {
+			slog.Error("Error finding pending purchases", "invoice_type", poller.InvoiceType(), "error", err)
+			continue
+		}
+		if len(*pendingPurchases) == 0 {
+			continue
+		}
+
+		transactions, err := poller.FetchStatuses(ctx, *pendingPurchases)
+		if err != nil {
+			slog.Error("Error fetching invoice statuses", "invoice_type", poller.InvoiceType(), "error", err)
+			continue
+		}
+
+		for purchaseID, tx := range transactions {
+			if tx.Status != database.PurchaseStatusPaid {
+				continue
+			}
+			ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, tx.Username)
+			if err := s.ProcessPaidPurchase(ctxWithUsername, purchaseID, tx.Amount, tx.Currency); err != nil {
+				slog.Error("Error processing invoice", "purchase_id", utils.MaskHalfInt64(purchaseID), "invoice_type", poller.InvoiceType(), "error", err)
+			} else {
+				slog.Info("Invoice processed", "purchase_id", utils.MaskHalfInt64(purchaseID), "invoice_type", poller.InvoiceType())
+			}
+		}
+	}
 }
 
 var ErrCustomerNotFound = errors.New("customer not found")
 
-func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId int64) error {
+// FindTributePurchase returns the purchase created for the Tribute webhook event.
+func (s PaymentService) FindTributePurchase(ctx context.Context, eventID string) (*database.Purchase, error) {
+	return s.purchaseRepository.FindByTributeEventID(ctx, eventID)
+}
+
+// CancelTributePurchase cancels the customer's latest Tribute purchase. A
+// cancellation sent before that purchase was created is about an earlier
+// subscription, and is ignored.
+func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId int64, cancelledAt time.Time) error {
 	slog.Info("Canceling tribute purchase", "telegram_id", utils.MaskHalfInt64(telegramId))
 	customer, err := s.customerRepository.FindByTelegramId(ctx, telegramId)
 	if err != nil {
@@ -287,22 +388,26 @@ func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId in
 	if tributePurchase == nil {
 		return errors.New("tribute purchase not found")
 	}
-	expireAt, err := s.remnawaveClient.DecreaseSubscription(ctx, telegramId, config.TrafficLimit(), -tributePurchase.Month*config.DaysInMonth())
+	if !cancelledAt.IsZero() && tributePurchase.CreatedAt.After(cancelledAt) {
+		slog.Info("tribute cancellation predates the latest purchase, skipping", "purchase_id", utils.MaskHalfInt64(tributePurchase.ID))
+		return nil
+	}
+	// The days are taken back by an outbox job after the commit, so the panel call
+	// is not made while the purchase is locked and a retry cannot take them twice.
+	applied, err := s.purchaseRepository.TransitionWith(ctx, tributePurchase.ID, database.PurchaseStatusCancel, nil, func(tx pgx.Tx, locked *database.Purchase) error {
+		if locked.Status != database.PurchaseStatusPaid {
+			return nil
+		}
+		return s.revokePanelDaysTx(ctx, tx, locked.ID, locked.CustomerID, locked.Days(config.DaysInMonth()))
+	})
 	if err != nil {
 		return err
 	}
-
-	if err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
-		"expire_at": expireAt,
-	}); err != nil {
-		return err
+	if !applied {
+		slog.Info("tribute purchase already cancelled, skipping", "purchase_id", utils.MaskHalfInt64(tributePurchase.ID))
+		return nil
 	}
 
-	if err := s.purchaseRepository.UpdateFields(ctx, tributePurchase.ID, map[string]interface{}{
-		"status": database.PurchaseStatusCancel,
-	}); err != nil {
-		return err
-	}
 	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    telegramId,
 		ParseMode: models.ParseModeHTML,
@@ -315,123 +420,27 @@ func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId in
 	return nil
 }
 
-func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
-		InvoiceType: database.InvoiceTypeCrypto,
-		Status:      database.PurchaseStatusNew,
-		Amount:      amount,
-		Currency:    "RUB",
-		CustomerID:  customer.ID,
-		Month:       months,
-	})
-	if err != nil {
-		slog.Error("Error creating purchase", "error", err)
-		return "", 0, err
-	}
-
-	invoice, err := s.cryptoPayClient.CreateInvoice(&cryptopay.InvoiceRequest{
-		CurrencyType:   "fiat",
-		Fiat:           "RUB",
-		Amount:         fmt.Sprintf("%d", int(amount)),
-		AcceptedAssets: "USDT",
-		Payload:        fmt.Sprintf("purchaseId=%d&username=%s", purchaseId, remnawave.UsernameFromCtx(ctx)),
-		Description:    fmt.Sprintf("Subscription on %d month", months),
-		PaidBtnName:    "callback",
-		PaidBtnUrl:     config.BotURL(),
-	})
-	if err != nil {
-		slog.Error("Error creating invoice", "error", err)
-		return "", 0, err
-	}
-
-	updates := map[string]interface{}{
-		"crypto_invoice_url": invoice.BotInvoiceUrl,
-		"crypto_invoice_id":  invoice.InvoiceID,
-		"status":             database.PurchaseStatusPending,
-	}
-
-	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, updates)
-	if err != nil {
-		slog.Error("Error updating purchase", "error", err)
-		return "", 0, err
+// remnawaveUser addresses the customer's panel user by its stored UUID, or by
+// Telegram ID for customers created before the UUID was stored.
+func remnawaveUser(customer *database.Customer) remnawave.UserRef {
+	ref := remnawave.UserRef{CustomerID: customer.ID, TelegramID: customer.TelegramID}
+	if customer.RemnawaveUUID != nil {
+		ref.UUID = *customer.RemnawaveUUID
 	}
-
-	return invoice.BotInvoiceUrl, purchaseId, nil
+	return ref
 }
 
-func (s PaymentService) createYookasaInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
-		InvoiceType: database.InvoiceTypeYookasa,
-		Status:      database.PurchaseStatusNew,
-		Amount:      amount,
-		Currency:    "RUB",
-		CustomerID:  customer.ID,
-		Month:       months,
-	})
-	if err != nil {
-		slog.Error("Error creating purchase", "error", err)
-		return "", 0, err
+// rememberRemnawaveUser stores the UUID of a panel user found by Telegram ID.
+func (s PaymentService) rememberRemnawaveUser(ctx context.Context, customer *database.Customer, userUUID uuid.UUID) {
+	if customer.RemnawaveUUID != nil && *customer.RemnawaveUUID == userUUID {
+		return
 	}
-
-	invoice, err := s.yookasaClient.CreateInvoice(ctx, int(amount), months, customer.ID, purchaseId)
-	if err != nil {
-		slog.Error("Error creating invoice", "error", err)
-		return "", 0, err
-	}
-
-	updates := map[string]interface{}{
-		"yookasa_url": invoice.Confirmation.ConfirmationURL,
-		"yookasa_id":  invoice.ID,
-		"status":      database.PurchaseStatusPending,
-	}
-
-	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, updates)
-	if err != nil {
-		slog.Error("Error updating purchase", "error", err)
-		return "", 0, err
-	}
-
-	return invoice.Confirmation.ConfirmationURL, purchaseId, nil
-}
-
-func (s PaymentService) createTelegramInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
-		InvoiceType: database.InvoiceTypeTelegram,
-		Status:      database.PurchaseStatusNew,
-		Amount:      amount,
-		Currency:    "STARS",
-		CustomerID:  customer.ID,
-		Month:       months,
+	err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"remnawave_uuid": userUUID,
 	})
 	if err != nil {
-		slog.Error("Error creating purchase", "error", err)
-		return "", 0, nil
-	}
-
-	invoiceUrl, err := s.telegramBot.CreateInvoiceLink(ctx, &bot.CreateInvoiceLinkParams{
-		Title:    s.translation.GetText(customer.Language, "invoice_title"),
-		Currency: "XTR",
-		Prices: []models.LabeledPrice{
-			{
-				Label:  s.translation.GetText(customer.Language, "invoice_label"),
-				Amount: int(amount),
-			},
-		},
-		Description: s.translation.GetText(customer.Language, "invoice_description"),
-		Payload:     fmt.Sprintf("%d&%s", purchaseId, remnawave.UsernameFromCtx(ctx)),
-	})
-
-	updates := map[string]interface{}{
-		"status": database.PurchaseStatusPending,
-	}
-
-	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, updates)
-	if err != nil {
-		slog.Error("Error updating purchase", "error", err)
-		return "", 0, err
+		slog.Error("store remnawave user uuid", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
 	}
-
-	return invoiceUrl, purchaseId, nil
 }
 
 func (s PaymentService) ActivateTrial(ctx context.Context, telegramId int64) (string, error) {
@@ -446,7 +455,7 @@ func (s PaymentService) ActivateTrial(ctx context.Context, telegramId int64) (st
 	if customer == nil {
 		return "", fmt.Errorf("customer %d not found", telegramId)
 	}
-	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, telegramId, config.TrialTrafficLimit(), config.TrialDays(), true)
+	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, remnawaveUser(customer), remnawave.TrialAccess(), config.TrialDays(), true)
 	if err != nil {
 		slog.Error("Error creating user", "error", err)
 		return "", err
@@ -455,6 +464,7 @@ func (s PaymentService) ActivateTrial(ctx context.Context, telegramId int64) (st
 	customerFilesToUpdate := map[string]interface{}{
 		"subscription_link": user.SubscriptionUrl,
 		"expire_at":         user.ExpireAt,
+		"remnawave_uuid":    user.UUID,
 	}
 
 	err = s.customerRepository.UpdateFields(ctx, customer.ID, customerFilesToUpdate)
@@ -477,57 +487,15 @@ func (s PaymentService) CancelYookassaPayment(purchaseId int64) error {
 		return fmt.Errorf("purchase with crypto invoice id %s not found", utils.MaskHalfInt64(purchaseId))
 	}
 
-	purchaseFieldsToUpdate := map[string]interface{}{
-		"status": database.PurchaseStatusCancel,
-	}
-
-	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, purchaseFieldsToUpdate)
+	applied, err := s.purchaseRepository.Transition(ctx, purchaseId, database.PurchaseStatusCancel, nil)
 	if err != nil {
 		return err
 	}
-
-	return nil
-}
-
-func (s PaymentService) createTributeInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
-		InvoiceType: database.InvoiceTypeTribute,
-		Status:      database.PurchaseStatusPending,
-		Amount:      amount,
-		Currency:    "RUB",
-		CustomerID:  customer.ID,
-		Month:       months,
-	})
-	if err != nil {
-		slog.Error("Error creating purchase", "error", err)
-		return "", 0, err
-	}
-
-	return "", purchaseId, nil
-}
-
-func (s PaymentService) sendReceiptToMoynalog(ctx context.Context, purchase *database.Purchase) error {
-	if s.moynalogClient == nil {
-		return fmt.Errorf("moynalog client not initialized")
-	}
-
-	var monthString string
-	switch purchase.Month {
-	case 1:
-		monthString = "месяц"
-	case 3, 4:
-		monthString = "месяца"
-	default:
-		monthString = "месяцев"
-	}
-	comment := fmt.Sprintf("Подписка на %d %s", purchase.Month, monthString)
-	amount := purchase.Amount
-
-	_, err := s.moynalogClient.CreateIncome(ctx, amount, comment)
-	if err != nil {
-		return fmt.Errorf("failed to create income in Moynalog: %w", err)
+	if !applied {
+		slog.Info("yookassa purchase not cancellable, skipping", "purchase_id", utils.MaskHalfInt64(purchaseId), "status", purchase.Status)
+		return nil
 	}
+	s.warnAutoPaymentDeclined(ctx, purchase)
 
-	slog.Info("Receipt sent to Moynalog", "purchase_id", utils.MaskHalfInt64(purchase.ID), "amount", amount, "comment", comment)
 	return nil
 }
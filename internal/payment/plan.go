@@ -0,0 +1,136 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ErrPlanNotFound is returned for plans that do not exist or are hidden.
+var ErrPlanNotFound = errors.New("plan not found")
+
+// legacyPlanMonths are the periods of the PRICE_* and STARS_PRICE_* settings.
+var legacyPlanMonths = []int{1, 3, 6, 12}
+
+// DefaultPlans builds the catalog from the legacy price settings. It seeds the plan
+// table on first start; access fields are left empty so the plans follow the
+// global traffic and squad configuration. name returns the name shown for a plan
+// of the given months.
+func DefaultPlans(name func(months int) string) []database.Plan {
+	var plans []database.Plan
+	for i, months := range legacyPlanMonths {
+		price := config.Price(months)
+		if price <= 0 {
+			continue
+		}
+		plan := database.Plan{
+			Name:      name(months),
+			Days:      months * config.DaysInMonth(),
+			PriceRUB:  &price,
+			Visible:   true,
+			SortOrder: i,
+		}
+		if starsPrice := config.StarsPrice(months); starsPrice > 0 {
+			plan.PriceStars = &starsPrice
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// Plans returns the plans offered to customers.
+func (s PaymentService) Plans(ctx context.Context) ([]database.Plan, error) {
+	return s.planRepository.FindVisible(ctx)
+}
+
+// Plan returns a plan offered to customers.
+func (s PaymentService) Plan(ctx context.Context, id int64) (*database.Plan, error) {
+	plan, err := s.planRepository.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil || !plan.Visible {
+		return nil, ErrPlanNotFound
+	}
+	return plan, nil
+}
+
+// CreatePlanPurchase creates a purchase of the plan priced in the provider's currency.
+func (s PaymentService) CreatePlanPurchase(ctx context.Context, plan *database.Plan, customer *database.Customer, invoiceType database.InvoiceType, opts ...PurchaseOption) (url string, purchaseId int64, err error) {
+	provider, ok := s.Provider(invoiceType)
+	if !ok {
+		return "", 0, fmt.Errorf("unknown invoice type: %s", invoiceType)
+	}
+	price, ok := plan.Price(invoiceType, provider.Currency())
+	if !ok {
+		return "", 0, fmt.Errorf("plan %d has no %s price", plan.ID, provider.Currency())
+	}
+	opts = append(opts, func(o *purchaseOptions) {
+		o.plan = plan
+	})
+	// The plan's days are recorded as its duration, months only describe purchases
+	// made without a plan.
+	return s.CreatePurchase(ctx, float64(price), 0, customer, invoiceType, opts...)
+}
+
+// PurchaseDescription describes the purchase on invoices and receipts.
+func PurchaseDescription(purchase *database.Purchase) string {
+	switch purchase.Kind {
+	case database.PurchaseKindTopUp:
+		return utils.BalanceTopUpDescription
+	case database.PurchaseKindTraffic:
+		return utils.FormatTrafficPackDescription(purchase.TrafficGB)
+	}
+	days := purchase.Days(config.DaysInMonth()) - purchase.BonusDays
+	if days%config.DaysInMonth() == 0 {
+		return utils.FormatSubscriptionDescription(days / config.DaysInMonth())
+	}
+	return utils.FormatSubscriptionDaysDescription(days)
+}
+
+// purchaseAccess returns the Remnawave access of the purchase's plan. Purchases
+// without a plan, or whose plan was deleted, grant the default access.
+func (s PaymentService) purchaseAccess(ctx context.Context, purchase *database.Purchase) (*remnawave.Access, error) {
+	if purchase.PlanID == nil {
+		return remnawave.DefaultAccess(), nil
+	}
+	plan, err := s.planRepository.FindByID(ctx, *purchase.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return remnawave.DefaultAccess(), nil
+	}
+	return planAccess(plan)
+}
+
+func planAccess(plan *database.Plan) (*remnawave.Access, error) {
+	access := remnawave.DefaultAccess()
+	if limit, ok := plan.TrafficLimitBytes(); ok {
+		access.TrafficLimit = limit
+	}
+	if plan.ResetStrategy != nil {
+		access.TrafficLimitStrategy = *plan.ResetStrategy
+	}
+	if len(plan.InternalSquads) > 0 {
+		access.InternalSquads = make(map[uuid.UUID]uuid.UUID, len(plan.InternalSquads))
+		for _, value := range plan.InternalSquads {
+			squad, err := uuid.Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("plan %d internal squad %q: %w", plan.ID, value, err)
+			}
+			access.InternalSquads[squad] = squad
+		}
+	}
+	if plan.ExternalSquad != nil {
+		access.ExternalSquad = *plan.ExternalSquad
+	}
+	return access, nil
+}
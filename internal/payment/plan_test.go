@@ -0,0 +1,44 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+func TestPlanAccess(t *testing.T) {
+	limit := 50
+	strategy := "WEEK"
+	squad := uuid.MustParse("773db654-a8b2-413a-a50b-75c3536238fd")
+	external := uuid.MustParse("bc979bdd-f1fa-4d94-8a51-38a0f518a2a2")
+
+	access, err := planAccess(&database.Plan{
+		TrafficLimitGB: &limit,
+		ResetStrategy:  &strategy,
+		InternalSquads: []string{squad.String()},
+		ExternalSquad:  &external,
+	})
+	if err != nil {
+		t.Fatalf("planAccess() error = %v", err)
+	}
+	if access.TrafficLimit != 50<<30 {
+		t.Errorf("TrafficLimit = %d, want %d", access.TrafficLimit, 50<<30)
+	}
+	if access.TrafficLimitStrategy != strategy {
+		t.Errorf("TrafficLimitStrategy = %q, want %q", access.TrafficLimitStrategy, strategy)
+	}
+	if _, ok := access.InternalSquads[squad]; !ok || len(access.InternalSquads) != 1 {
+		t.Errorf("InternalSquads = %v, want only %s", access.InternalSquads, squad)
+	}
+	if access.ExternalSquad != external {
+		t.Errorf("ExternalSquad = %s, want %s", access.ExternalSquad, external)
+	}
+}
+
+func TestPlanAccess_InvalidSquad(t *testing.T) {
+	if _, err := planAccess(&database.Plan{InternalSquads: []string{"not-a-uuid"}}); err == nil {
+		t.Error("planAccess() accepted an invalid squad UUID")
+	}
+}
@@ -0,0 +1,111 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// WithPromoCode applies the customer's promo code to the purchase when the code is
+// applicable to the chosen plan and provider.
+func WithPromoCode(promo *database.PromoCode) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.promo = promo
+	}
+}
+
+func applyPromoCode(purchase *database.Purchase, promo *database.PromoCode) {
+	amount, bonusDays, ok := promo.Apply(purchase.Amount, purchase.PlanID, purchase.Currency)
+	if !ok {
+		return
+	}
+	purchase.PromoCodeID = &promo.ID
+	purchase.DiscountAmount = purchase.Amount - amount
+	purchase.BonusDays = bonusDays
+	purchase.Amount = amount
+}
+
+// ApplyPromoCode validates the code for the customer. Discount and bonus codes are
+// remembered for the customer's next purchase, free period codes extend the
+// subscription right away.
+func (s PaymentService) ApplyPromoCode(ctx context.Context, customer *database.Customer, code string) (*database.PromoCode, error) {
+	promo, err := s.promoRepository.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if promo == nil {
+		return nil, database.ErrPromoNotFound
+	}
+
+	if promo.Type == database.PromoTypeFreePeriod {
+		err = s.promoRepository.RedeemWith(ctx, promo.ID, customer.ID, func(locked *database.PromoCode) error {
+			user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, remnawaveUser(customer), nil, locked.Value, false)
+			if err != nil {
+				return err
+			}
+			return s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+				"subscription_link": user.SubscriptionUrl,
+				"expire_at":         user.ExpireAt,
+				"remnawave_uuid":    user.UUID,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("free period promo code redeemed", "promo_code_id", promo.ID, "customer_id", utils.MaskHalfInt64(customer.ID), "days", promo.Value)
+		return promo, nil
+	}
+
+	redemptions, err := s.promoRepository.CountRedemptions(ctx, promo.ID, customer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := promo.Validate(time.Now(), redemptions); err != nil {
+		return nil, err
+	}
+	if err := s.promoRepository.Activate(ctx, promo.ID, customer.ID); err != nil {
+		return nil, err
+	}
+	slog.Info("promo code activated", "promo_code_id", promo.ID, "customer_id", utils.MaskHalfInt64(customer.ID))
+	return promo, nil
+}
+
+// ActivePromoCode returns the code the customer activated for the next purchase, or
+// nil when there is none or it is no longer valid.
+func (s PaymentService) ActivePromoCode(ctx context.Context, customerID int64) (*database.PromoCode, error) {
+	promo, err := s.promoRepository.FindActivated(ctx, customerID)
+	if err != nil || promo == nil {
+		return nil, err
+	}
+	redemptions, err := s.promoRepository.CountRedemptions(ctx, promo.ID, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if promo.Validate(time.Now(), redemptions) != nil {
+		return nil, nil
+	}
+	return promo, nil
+}
+
+// reportOverusedPromo tells the admin that a paid purchase redeemed its promo code
+// over the code's limits. The purchase keeps its discount: the customer paid the
+// price the invoice was issued with.
+func (s PaymentService) reportOverusedPromo(ctx context.Context, purchase *database.Purchase) {
+	slog.Warn("promo code redeemed over its limits", "purchase_id", utils.MaskHalfInt64(purchase.ID), "promo_code_id", *purchase.PromoCodeID)
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: config.GetAdminTelegramId(),
+		Text: fmt.Sprintf("Purchase #%d was paid with promo code #%d after the code reached its usage limits. The discount was kept because the customer already paid it.",
+			purchase.ID, *purchase.PromoCodeID),
+	})
+	if err != nil {
+		slog.Error("promo: notify admin", "error", err)
+	}
+}
@@ -0,0 +1,179 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// ErrNotSupported is returned by providers for operations their gateway has no API for.
+var ErrNotSupported = errors.New("operation not supported by payment provider")
+
+// ErrStillPayable is returned by Cancel when the provider keeps the invoice open
+// for now, so the purchase must not be expired yet.
+var ErrStillPayable = errors.New("invoice can still be paid")
+
+// Invoice is the result of issuing an invoice at a provider.
+type Invoice struct {
+	// URL is where the customer pays. Empty for providers that collect payment outside the bot.
+	URL string
+	// Fields are purchase columns to persist alongside the invoice, e.g. the provider transaction id.
+	Fields map[string]interface{}
+}
+
+// Transaction is the provider's view of a purchase.
+type Transaction struct {
+	Status   database.PurchaseStatus
+	Username string
+	// Amount and Currency are what the provider received, checked against the
+	// purchase before it is processed.
+	Amount   float64
+	Currency string
+	// PaymentMethodID is the payment method the provider saved for recurring
+	// payments, nil when none was saved.
+	PaymentMethodID *uuid.UUID
+}
+
+// Provider is a payment gateway the bot can sell subscriptions through.
+type Provider interface {
+	InvoiceType() database.InvoiceType
+	// ButtonKey is the translation key of the sell keyboard button.
+	ButtonKey() string
+	IsEnabled() bool
+	Currency() string
+	// InvoiceTTL is how long an unpaid invoice stays open before the purchase is
+	// expired. Zero disables expiry.
+	InvoiceTTL() time.Duration
+	CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*Invoice, error)
+	FetchStatus(ctx context.Context, purchase *database.Purchase) (*Transaction, error)
+	// Cancel closes the invoice so it can no longer be paid. It returns nil only
+	// once that is certain, ErrStillPayable while the invoice stays open and
+	// ErrNotSupported when the gateway cannot close invoices.
+	Cancel(ctx context.Context, purchase *database.Purchase) error
+	Refund(ctx context.Context, purchase *database.Purchase) error
+}
+
+// Poller is implemented by providers without reliable push notifications.
+// Their pending purchases are polled in batches by the invoice checker.
+type Poller interface {
+	Provider
+	FetchStatuses(ctx context.Context, purchases []database.Purchase) (map[int64]*Transaction, error)
+}
+
+// WebhookProvider is implemented by providers that notify the bot over HTTP.
+// Providers sharing a gateway may return the same path; it is mounted once.
+// WebhookName names the gateway in the webhook event log and WebhookEventID
+// identifies the event a request body delivers so its duplicates are dropped.
+type WebhookProvider interface {
+	Provider
+	WebhookName() string
+	WebhookPath() string
+	WebhookEventID(body []byte) string
+	WebhookHandler(service *PaymentService) http.Handler
+}
+
+// LinkProvider is implemented by providers whose checkout lives outside the bot.
+// The sell keyboard links to CheckoutURL instead of creating an invoice.
+type LinkProvider interface {
+	Provider
+	CheckoutURL() string
+}
+
+// Settler is implemented by providers that take the money inside the bot. The
+// purchase is paid right after it is created and SettleTx charges the customer in
+// the transaction that marks it paid.
+type Settler interface {
+	Provider
+	SettleTx(ctx context.Context, tx pgx.Tx, purchase *database.Purchase) error
+}
+
+// Recurring is implemented by providers that can charge a payment method saved by
+// an earlier payment. ChargeSaved pays the purchase without the customer, the
+// payment is confirmed through FetchStatus or the provider's webhook.
+type Recurring interface {
+	Provider
+	ChargeSaved(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*Invoice, error)
+}
+
+type Registry struct {
+	providers []Provider
+	byType    map[database.InvoiceType]Provider
+}
+
+// NewRegistry keeps providers in the given order, which is also the order of the sell keyboard.
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{byType: make(map[database.InvoiceType]Provider, len(providers))}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+func (r *Registry) Register(p Provider) {
+	if _, exists := r.byType[p.InvoiceType()]; exists {
+		panic("payment provider registered twice: " + string(p.InvoiceType()))
+	}
+	r.providers = append(r.providers, p)
+	r.byType[p.InvoiceType()] = p
+}
+
+func (r *Registry) Get(invoiceType database.InvoiceType) (Provider, bool) {
+	p, ok := r.byType[invoiceType]
+	return p, ok
+}
+
+func (r *Registry) Enabled() []Provider {
+	enabled := make([]Provider, 0, len(r.providers))
+	for _, p := range r.providers {
+		if p.IsEnabled() {
+			enabled = append(enabled, p)
+		}
+	}
+	return enabled
+}
+
+func (r *Registry) Pollers() []Poller {
+	var pollers []Poller
+	for _, p := range r.Enabled() {
+		if poller, ok := p.(Poller); ok {
+			pollers = append(pollers, poller)
+		}
+	}
+	return pollers
+}
+
+// Webhooks returns the enabled webhook providers keyed by their path.
+func (r *Registry) Webhooks() map[string]WebhookProvider {
+	webhooks := make(map[string]WebhookProvider)
+	for _, p := range r.Enabled() {
+		wp, ok := p.(WebhookProvider)
+		if !ok || wp.WebhookPath() == "" {
+			continue
+		}
+		if _, exists := webhooks[wp.WebhookPath()]; !exists {
+			webhooks[wp.WebhookPath()] = wp
+		}
+	}
+	return webhooks
+}
+
+// Reconcilable returns the enabled providers that confirm payments through
+// webhooks only, so their pending purchases need a periodic status check.
+func (r *Registry) Reconcilable() []WebhookProvider {
+	var providers []WebhookProvider
+	for _, p := range r.Enabled() {
+		if _, ok := p.(Poller); ok {
+			continue
+		}
+		if wp, ok := p.(WebhookProvider); ok {
+			providers = append(providers, wp)
+		}
+	}
+	return providers
+}
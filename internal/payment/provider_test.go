@@ -0,0 +1,98 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+type providerMock struct {
+	invoiceType database.InvoiceType
+	enabled     bool
+	path        string
+}
+
+func (m *providerMock) InvoiceType() database.InvoiceType { return m.invoiceType }
+func (m *providerMock) ButtonKey() string                 { return string(m.invoiceType) }
+func (m *providerMock) IsEnabled() bool                   { return m.enabled }
+func (m *providerMock) Currency() string                  { return "RUB" }
+func (m *providerMock) InvoiceTTL() time.Duration         { return time.Hour }
+func (m *providerMock) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*Invoice, error) {
+	return &Invoice{}, nil
+}
+func (m *providerMock) FetchStatus(ctx context.Context, purchase *database.Purchase) (*Transaction, error) {
+	return nil, ErrNotSupported
+}
+func (m *providerMock) Cancel(ctx context.Context, purchase *database.Purchase) error { return nil }
+func (m *providerMock) Refund(ctx context.Context, purchase *database.Purchase) error { return nil }
+func (m *providerMock) WebhookPath() string                                           { return m.path }
+func (m *providerMock) WebhookName() string                                           { return string(m.invoiceType) }
+func (m *providerMock) WebhookEventID(body []byte) string                             { return "" }
+func (m *providerMock) WebhookHandler(service *PaymentService) http.Handler           { return nil }
+
+func TestRegistry_EnabledKeepsRegistrationOrder(t *testing.T) {
+	r := NewRegistry(
+		&providerMock{invoiceType: "b", enabled: true},
+		&providerMock{invoiceType: "a", enabled: false},
+		&providerMock{invoiceType: "c", enabled: true},
+	)
+
+	enabled := r.Enabled()
+	if len(enabled) != 2 || enabled[0].InvoiceType() != "b" || enabled[1].InvoiceType() != "c" {
+		t.Fatalf("unexpected enabled providers: %#v", enabled)
+	}
+
+	if _, ok := r.Get("a"); !ok {
+		t.Fatalf("disabled provider should still be resolvable by invoice type")
+	}
+}
+
+func TestRegistry_WebhooksMountsSharedPathOnce(t *testing.T) {
+	r := NewRegistry(
+		&providerMock{invoiceType: "plt_sbp", enabled: true, path: "/webhook/platega"},
+		&providerMock{invoiceType: "plt_cards", enabled: true, path: "/webhook/platega"},
+		&providerMock{invoiceType: "yookasa", enabled: true, path: ""},
+		&providerMock{invoiceType: "tribute", enabled: false, path: "/webhook/tribute"},
+	)
+
+	webhooks := r.Webhooks()
+	if len(webhooks) != 1 {
+		t.Fatalf("expected one webhook, got %d", len(webhooks))
+	}
+	if p := webhooks["/webhook/platega"]; p == nil || p.InvoiceType() != "plt_sbp" {
+		t.Fatalf("expected first platega provider to own the path, got %#v", p)
+	}
+}
+
+func TestRegistry_RegisterTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic on duplicate invoice type")
+		}
+	}()
+	NewRegistry(&providerMock{invoiceType: "a"}, &providerMock{invoiceType: "a"})
+}
+
+type pollerMock struct {
+	providerMock
+}
+
+func (m *pollerMock) FetchStatuses(ctx context.Context, purchases []database.Purchase) (map[int64]*Transaction, error) {
+	return nil, nil
+}
+
+func TestRegistry_ReconcilableSkipsPollersAndDisabled(t *testing.T) {
+	r := NewRegistry(
+		&pollerMock{providerMock{invoiceType: "crypto", enabled: true}},
+		&providerMock{invoiceType: "yookasa", enabled: true},
+		&providerMock{invoiceType: "plt_sbp", enabled: false},
+	)
+
+	reconcilable := r.Reconcilable()
+	if len(reconcilable) != 1 || reconcilable[0].InvoiceType() != "yookasa" {
+		t.Fatalf("unexpected reconcilable providers: %#v", reconcilable)
+	}
+}
@@ -0,0 +1,144 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// receiptRequired tells whether the paid purchase is declared as Moynalog income.
+func (s PaymentService) receiptRequired(purchase *database.Purchase) bool {
+	return s.moynalogClient != nil && config.IsMoynalogInvoiceType(string(purchase.InvoiceType))
+}
+
+// receiptAmount returns the purchase amount in rubles, converted at the configured
+// exchange rate and rounded to kopecks.
+func receiptAmount(purchase *database.Purchase) (float64, error) {
+	rate, ok := config.MoynalogExchangeRate(purchase.Currency)
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for currency %s", purchase.Currency)
+	}
+	return roundKopecks(purchase.Amount * rate), nil
+}
+
+func roundKopecks(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// sendReceiptToMoynalog registers the purchase's income in Moynalog and sends the
+// receipt to the customer. A failed attempt is recorded on the receipt and retried
+// by the outbox worker.
+func (s PaymentService) sendReceiptToMoynalog(ctx context.Context, purchase *database.Purchase) error {
+	if s.moynalogClient == nil {
+		return fmt.Errorf("moynalog client not initialized")
+	}
+
+	receipt, err := s.receiptRepository.FindOrCreate(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if receipt.Status == database.ReceiptStatusIssued || receipt.Status == database.ReceiptStatusCanceled {
+		return nil
+	}
+
+	amount, err := receiptAmount(purchase)
+	if err != nil {
+		if markErr := s.receiptRepository.MarkFailed(ctx, receipt.ID, err.Error()); markErr != nil {
+			slog.Error("save failed Moynalog receipt", "error", markErr, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		}
+		return err
+	}
+
+	comment := PurchaseDescription(purchase)
+	income, err := s.moynalogClient.CreateIncome(ctx, amount, comment)
+	if err != nil {
+		if markErr := s.receiptRepository.MarkFailed(ctx, receipt.ID, err.Error()); markErr != nil {
+			slog.Error("save failed Moynalog receipt", "error", markErr, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		}
+		return fmt.Errorf("failed to create income in Moynalog: %w", err)
+	}
+
+	receiptUUID := income.ReceiptUUID()
+	if err := s.receiptRepository.MarkIssued(ctx, receipt.ID, receiptUUID, amount); err != nil {
+		// Failing the job would register the income a second time.
+		slog.Error("save Moynalog receipt uuid", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID), "receipt_uuid", receiptUUID)
+		return nil
+	}
+	slog.Info("Receipt sent to Moynalog", "purchase_id", utils.MaskHalfInt64(purchase.ID), "amount", amount, "currency", purchase.Currency, "comment", comment)
+
+	if err := s.sendReceiptLink(ctx, purchase, receiptUUID); err != nil {
+		slog.Error("Error sending receipt link", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+	return nil
+}
+
+func (s PaymentService) sendReceiptLink(ctx context.Context, purchase *database.Purchase, receiptUUID string) error {
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: customer.TelegramID,
+		Text:   s.translation.GetText(customer.Language, "receipt_issued"),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{s.translation.GetButton(customer.Language, "receipt_button").InlineURL(s.moynalogClient.ReceiptURL(receiptUUID))},
+			},
+		},
+	})
+	return err
+}
+
+// cancelMoynalogReceipt annuls the receipt of a refunded purchase. A receipt that
+// was not issued yet is canceled so it is never registered.
+func (s PaymentService) cancelMoynalogReceipt(ctx context.Context, purchase *database.Purchase) error {
+	if s.moynalogClient == nil {
+		return fmt.Errorf("moynalog client not initialized")
+	}
+
+	receipt, err := s.receiptRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if receipt == nil || receipt.Status == database.ReceiptStatusCanceled {
+		return nil
+	}
+
+	if receipt.Status == database.ReceiptStatusIssued && receipt.ReceiptUUID != nil {
+		if err := s.moynalogClient.CancelIncome(ctx, *receipt.ReceiptUUID, "Возврат средств"); err != nil {
+			return fmt.Errorf("failed to cancel income in Moynalog: %w", err)
+		}
+	}
+	if err := s.receiptRepository.MarkCanceled(ctx, receipt.ID); err != nil {
+		return err
+	}
+
+	slog.Info("Moynalog receipt cancelled", "purchase_id", utils.MaskHalfInt64(purchase.ID), "status", receipt.Status)
+	return nil
+}
+
+// FailedReceipts returns the receipts whose last attempt to register them failed.
+func (s PaymentService) FailedReceipts(ctx context.Context, limit uint64) ([]database.Receipt, error) {
+	return s.receiptRepository.FindByStatus(ctx, database.ReceiptStatusFailed, limit)
+}
+
+// ResendReceipt schedules the failed receipt of the purchase to be registered in
+// Moynalog again. It reports false when the purchase has no failed receipt.
+func (s PaymentService) ResendReceipt(ctx context.Context, purchaseID int64) (bool, error) {
+	return s.receiptRepository.ResendWith(ctx, purchaseID, func(tx pgx.Tx) error {
+		return s.outboxRepository.EnqueueTx(ctx, tx, JobMoynalogReceipt, purchaseJob{PurchaseID: purchaseID})
+	})
+}
@@ -0,0 +1,175 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/moynalog"
+)
+
+const (
+	// receiptReconcileDelay leaves receipts that are still being retried to the outbox worker.
+	receiptReconcileDelay = time.Hour
+	// receiptReconcileWindow overlaps consecutive daily runs so no payment is skipped.
+	receiptReconcileWindow = 24*time.Hour + receiptReconcileDelay
+	// receiptGapsReported keeps the admin report within a single Telegram message.
+	receiptGapsReported = 50
+)
+
+// receiptGap is a paid purchase or a Moynalog income that was not declared as expected.
+type receiptGap struct {
+	PurchaseID  int64
+	ReceiptUUID string
+	Reason      string
+}
+
+// ReconcileReceipts compares the purchases paid during the last day with the incomes
+// registered in Moynalog and reports every gap to the admin.
+func (s PaymentService) ReconcileReceipts(ctx context.Context) {
+	if s.moynalogClient == nil {
+		return
+	}
+
+	now := time.Now()
+	from := now.Add(-receiptReconcileWindow)
+	paid, err := s.purchaseRepository.FindPaidBetween(ctx, from, now.Add(-receiptReconcileDelay))
+	if err != nil {
+		slog.Error("reconcile receipts: find paid purchases", "error", err)
+		return
+	}
+
+	var purchases []database.Purchase
+	var purchaseIDs []int64
+	for _, p := range paid {
+		if s.receiptRequired(&p) {
+			purchases = append(purchases, p)
+			purchaseIDs = append(purchaseIDs, p.ID)
+		}
+	}
+	receipts, err := s.receiptRepository.FindByPurchaseIDs(ctx, purchaseIDs)
+	if err != nil {
+		slog.Error("reconcile receipts: find receipts", "error", err)
+		return
+	}
+
+	incomes, err := s.moynalogClient.ListIncomes(ctx, from, now)
+	if err != nil {
+		slog.Error("reconcile receipts: list Moynalog incomes", "error", err)
+		return
+	}
+	receiptUUIDs := make([]string, 0, len(incomes))
+	for _, income := range incomes {
+		receiptUUIDs = append(receiptUUIDs, income.ApprovedReceiptUUID)
+	}
+	known, err := s.receiptRepository.FindByReceiptUUIDs(ctx, receiptUUIDs)
+	if err != nil {
+		slog.Error("reconcile receipts: find receipts by uuid", "error", err)
+		return
+	}
+
+	gaps := findReceiptGaps(purchases, receipts, incomes, known)
+	slog.Info("receipts reconciled", "purchases", len(purchases), "incomes", len(incomes), "gaps", len(gaps))
+	if len(gaps) > 0 {
+		s.reportReceiptGaps(ctx, gaps)
+	}
+}
+
+// findReceiptGaps matches the paid purchases and their receipts against the incomes
+// registered in Moynalog. known holds the receipts of the listed incomes keyed by
+// receipt uuid, including receipts of purchases paid before the window.
+func findReceiptGaps(purchases []database.Purchase, receipts map[int64]database.Receipt, incomes []moynalog.Income, known map[string]database.Receipt) []receiptGap {
+	incomesByUUID := make(map[string]moynalog.Income, len(incomes))
+	for _, income := range incomes {
+		incomesByUUID[income.ApprovedReceiptUUID] = income
+	}
+
+	var gaps []receiptGap
+	for _, purchase := range purchases {
+		receipt, ok := receipts[purchase.ID]
+		if !ok {
+			gaps = append(gaps, receiptGap{PurchaseID: purchase.ID, Reason: "no receipt"})
+			continue
+		}
+		if receipt.Status != database.ReceiptStatusIssued || receipt.ReceiptUUID == nil {
+			gaps = append(gaps, receiptGap{PurchaseID: purchase.ID, Reason: fmt.Sprintf("receipt %s", receipt.Status)})
+			continue
+		}
+
+		receiptUUID := *receipt.ReceiptUUID
+		income, ok := incomesByUUID[receiptUUID]
+		switch {
+		case !ok:
+			gaps = append(gaps, receiptGap{PurchaseID: purchase.ID, ReceiptUUID: receiptUUID, Reason: "income not found in Moynalog"})
+		case income.Canceled():
+			gaps = append(gaps, receiptGap{PurchaseID: purchase.ID, ReceiptUUID: receiptUUID, Reason: "income canceled in Moynalog"})
+		default:
+			if reason := amountMismatch(income, receipt); reason != "" {
+				gaps = append(gaps, receiptGap{PurchaseID: purchase.ID, ReceiptUUID: receiptUUID, Reason: reason})
+			}
+		}
+	}
+
+	for _, income := range incomes {
+		if income.Canceled() {
+			continue
+		}
+		receipt, ok := known[income.ApprovedReceiptUUID]
+		switch {
+		case !ok:
+			gaps = append(gaps, receiptGap{ReceiptUUID: income.ApprovedReceiptUUID, Reason: "income without purchase"})
+		case receipt.Status == database.ReceiptStatusCanceled:
+			gaps = append(gaps, receiptGap{PurchaseID: receipt.PurchaseID, ReceiptUUID: income.ApprovedReceiptUUID, Reason: "refunded but income not canceled"})
+		}
+	}
+	return gaps
+}
+
+func amountMismatch(income moynalog.Income, receipt database.Receipt) string {
+	if receipt.Amount == nil {
+		return ""
+	}
+	amount, err := income.Amount()
+	if err != nil {
+		return fmt.Sprintf("invalid income amount %q", income.TotalAmount)
+	}
+	if math.Abs(amount-*receipt.Amount) >= 0.01 {
+		return fmt.Sprintf("declared %.2f RUB, expected %.2f RUB", amount, *receipt.Amount)
+	}
+	return ""
+}
+
+func (s PaymentService) reportReceiptGaps(ctx context.Context, gaps []receiptGap) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Moynalog reconciliation found %d gap(s):\n", len(gaps))
+	for i, gap := range gaps {
+		if i == receiptGapsReported {
+			fmt.Fprintf(&sb, "\n...and %d more", len(gaps)-i)
+			break
+		}
+		sb.WriteString("\n")
+		if gap.PurchaseID != 0 {
+			fmt.Fprintf(&sb, "#%d ", gap.PurchaseID)
+		}
+		if gap.ReceiptUUID != "" {
+			fmt.Fprintf(&sb, "%s ", gap.ReceiptUUID)
+		}
+		sb.WriteString(gap.Reason)
+	}
+	sb.WriteString("\n\nSee /receipts to resend failed receipts.")
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: config.GetAdminTelegramId(),
+		Text:   sb.String(),
+	})
+	if err != nil {
+		slog.Error("reconcile receipts: notify admin", "error", err)
+	}
+}
@@ -0,0 +1,72 @@
+package payment
+
+import (
+	"reflect"
+	"testing"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/moynalog"
+)
+
+func issuedReceipt(purchaseID int64, receiptUUID string, amount float64) database.Receipt {
+	return database.Receipt{
+		PurchaseID:  purchaseID,
+		Status:      database.ReceiptStatusIssued,
+		ReceiptUUID: &receiptUUID,
+		Amount:      &amount,
+	}
+}
+
+func TestFindReceiptGaps(t *testing.T) {
+	purchases := []database.Purchase{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}}
+	failed := database.Receipt{PurchaseID: 2, Status: database.ReceiptStatusFailed}
+	receipts := map[int64]database.Receipt{
+		1: issuedReceipt(1, "ok", 100),
+		2: failed,
+		3: issuedReceipt(3, "missing", 100),
+		4: issuedReceipt(4, "canceled", 100),
+		5: issuedReceipt(5, "mismatch", 100),
+	}
+	refunded := issuedReceipt(7, "refunded", 50)
+	refunded.Status = database.ReceiptStatusCanceled
+	incomes := []moynalog.Income{
+		{ApprovedReceiptUUID: "ok", TotalAmount: "100.00"},
+		{ApprovedReceiptUUID: "canceled", TotalAmount: "100", CancellationInfo: &moynalog.IncomeCancellation{}},
+		{ApprovedReceiptUUID: "mismatch", TotalAmount: "90.5"},
+		{ApprovedReceiptUUID: "older", TotalAmount: "10"},
+		{ApprovedReceiptUUID: "refunded", TotalAmount: "50"},
+		{ApprovedReceiptUUID: "manual", TotalAmount: "10"},
+	}
+	known := map[string]database.Receipt{
+		"ok":       receipts[1],
+		"canceled": receipts[4],
+		"mismatch": receipts[5],
+		"older":    issuedReceipt(8, "older", 10),
+		"refunded": refunded,
+	}
+
+	got := findReceiptGaps(purchases, receipts, incomes, known)
+	want := []receiptGap{
+		{PurchaseID: 2, Reason: "receipt failed"},
+		{PurchaseID: 3, ReceiptUUID: "missing", Reason: "income not found in Moynalog"},
+		{PurchaseID: 4, ReceiptUUID: "canceled", Reason: "income canceled in Moynalog"},
+		{PurchaseID: 5, ReceiptUUID: "mismatch", Reason: "declared 90.50 RUB, expected 100.00 RUB"},
+		{PurchaseID: 6, Reason: "no receipt"},
+		{PurchaseID: 7, ReceiptUUID: "refunded", Reason: "refunded but income not canceled"},
+		{ReceiptUUID: "manual", Reason: "income without purchase"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findReceiptGaps() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFindReceiptGapsNone(t *testing.T) {
+	purchases := []database.Purchase{{ID: 1}}
+	receipts := map[int64]database.Receipt{1: issuedReceipt(1, "ok", 99.99)}
+	incomes := []moynalog.Income{{ApprovedReceiptUUID: "ok", TotalAmount: "99.99"}}
+	known := map[string]database.Receipt{"ok": receipts[1]}
+
+	if got := findReceiptGaps(purchases, receipts, incomes, known); len(got) != 0 {
+		t.Errorf("findReceiptGaps() = %+v, want no gaps", got)
+	}
+}
@@ -0,0 +1,138 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+const (
+	// reconcileMinAge leaves fresh invoices to the webhook.
+	reconcileMinAge = 5 * time.Minute
+	// reconcileMaxAge bounds how far back pending purchases are checked.
+	reconcileMaxAge = 72 * time.Hour
+)
+
+// ReconcilePendingPurchases checks pending purchases of webhook-only providers
+// against the provider API. Purchases found paid are processed and reported to
+// the admin, purchases found cancelled are cancelled. It covers webhooks that were
+// lost or could not reach the bot, and Stars payments whose processing failed.
+func (s PaymentService) ReconcilePendingPurchases(ctx context.Context) {
+	now := time.Now()
+	s.retryStarsPayments(ctx, now)
+	var recovered []database.Purchase
+
+	for _, provider := range s.providers.Reconcilable() {
+		purchases, err := s.purchaseRepository.FindByInvoiceTypeAndStatusCreatedBetween(ctx, provider.InvoiceType(), database.PurchaseStatusPending, now.Add(-reconcileMaxAge), now.Add(-reconcileMinAge))
+		if err != nil {
+			slog.Error("reconcile: find pending purchases", "invoice_type", provider.InvoiceType(), "error", err)
+			continue
+		}
+
+		for i := range purchases {
+			purchase := &purchases[i]
+			paid, err := s.reconcilePurchase(ctx, provider, purchase)
+			if errors.Is(err, ErrNotSupported) {
+				break
+			}
+			if err != nil {
+				slog.Error("reconcile: check purchase", "purchase_id", utils.MaskHalfInt64(purchase.ID), "invoice_type", provider.InvoiceType(), "error", err)
+				continue
+			}
+			if paid {
+				recovered = append(recovered, *purchase)
+			}
+		}
+	}
+
+	if len(recovered) > 0 {
+		s.reportRecoveredPurchases(ctx, recovered)
+	}
+}
+
+func (s PaymentService) reconcilePurchase(ctx context.Context, provider Provider, purchase *database.Purchase) (bool, error) {
+	tx, err := provider.FetchStatus(ctx, purchase)
+	if err != nil {
+		return false, err
+	}
+
+	switch tx.Status {
+	case database.PurchaseStatusPaid:
+		ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, tx.Username)
+		if err := s.ProcessPaidPurchase(ctxWithUsername, purchase.ID, tx.Amount, tx.Currency); err != nil {
+			return false, err
+		}
+		slog.Warn("reconcile: recovered payment missed by webhook", "purchase_id", utils.MaskHalfInt64(purchase.ID), "invoice_type", purchase.InvoiceType)
+		if tx.PaymentMethodID != nil {
+			if err := s.SavePaymentMethod(ctx, purchase.ID, *tx.PaymentMethodID); err != nil {
+				slog.Error("reconcile: save payment method", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+			}
+		}
+		return true, nil
+	case database.PurchaseStatusCancel:
+		applied, err := s.purchaseRepository.Transition(ctx, purchase.ID, database.PurchaseStatusCancel, nil)
+		if err != nil {
+			return false, err
+		}
+		if applied {
+			slog.Info("reconcile: purchase cancelled", "purchase_id", utils.MaskHalfInt64(purchase.ID), "invoice_type", purchase.InvoiceType)
+			s.warnAutoPaymentDeclined(ctx, purchase)
+		}
+	}
+	return false, nil
+}
+
+// retryStarsPayments processes Stars purchases that Telegram charged but that are
+// still pending because processing the payment failed. Telegram does not deliver
+// the payment again, so the stored charge is the proof of payment, and its amount
+// is checked like the delivered one.
+func (s PaymentService) retryStarsPayments(ctx context.Context, now time.Time) {
+	purchases, err := s.purchaseRepository.FindByInvoiceTypeAndStatusCreatedBetween(ctx, database.InvoiceTypeTelegram, database.PurchaseStatusPending, now.Add(-reconcileMaxAge), now.Add(-reconcileMinAge))
+	if err != nil {
+		slog.Error("reconcile: find pending stars purchases", "error", err)
+		return
+	}
+
+	for i := range purchases {
+		purchase := &purchases[i]
+		if purchase.TelegramChargeID == nil {
+			continue
+		}
+		if purchase.TelegramPaidAmount == nil || purchase.TelegramPaidCurrency == nil {
+			s.holdForReview(ctx, purchase, fmt.Errorf("%w: charge %s has no recorded amount", ErrPaymentMismatch, *purchase.TelegramChargeID))
+			continue
+		}
+		if err := s.ProcessPaidPurchase(ctx, purchase.ID, *purchase.TelegramPaidAmount, *purchase.TelegramPaidCurrency); err != nil {
+			slog.Error("reconcile: process stars payment", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+			continue
+		}
+		slog.Warn("reconcile: processed stars payment after a failure", "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+}
+
+func (s PaymentService) reportRecoveredPurchases(ctx context.Context, purchases []database.Purchase) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Recovered %d payment(s) missed by webhooks:\n", len(purchases))
+	for _, p := range purchases {
+		fmt.Fprintf(&sb, "\n#%d %s %.2f %s", p.ID, p.InvoiceType, p.Amount, p.Currency)
+	}
+	sb.WriteString("\n\nCheck that the payment webhooks are reachable.")
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: config.GetAdminTelegramId(),
+		Text:   sb.String(),
+	})
+	if err != nil {
+		slog.Error("reconcile: notify admin", "error", err)
+	}
+}
@@ -0,0 +1,204 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/jackc/pgx/v4"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+var (
+	ErrPurchaseNotFound   = errors.New("purchase not found")
+	ErrRefundNotSupported = errors.New("provider does not support refunds")
+	ErrPurchaseNotPaid    = errors.New("purchase is not paid")
+	ErrRefundRequested    = errors.New("refund was already requested from the provider")
+)
+
+// Outbox job kinds enqueued when a purchase is refunded. Refunded subscription and
+// gift days are taken back by a JobPanelRevoke job; JobRefundSubscription keeps its
+// name for queued jobs and takes back refunded traffic.
+const (
+	JobRefundSubscription = "refund_subscription"
+	JobRefundNotify       = "refund_notify"
+	JobMoynalogCancel     = "moynalog_cancel"
+)
+
+// RefundMode tells RefundPurchase where the money goes.
+type RefundMode string
+
+const (
+	// RefundModeProvider returns the money through the purchase's provider.
+	RefundModeProvider RefundMode = "provider"
+	// RefundModeManual records a refund already made in the provider's dashboard.
+	RefundModeManual RefundMode = "manual"
+	// RefundModeBalance credits the amount to the customer's balance.
+	RefundModeBalance RefundMode = "balance"
+)
+
+// RefundPurchase returns the money for a paid purchase and marks it refunded.
+// Purchases paid from the balance are always refunded to the balance, and top-ups
+// take their amount back from it. Taking back the paid days, notifying the customer
+// and cancelling the Moynalog receipt run as outbox jobs. It reports false when the
+// purchase was already refunded.
+//
+// The provider is called outside the purchase lock, after the refund request is
+// stored. A refund whose recording failed returns ErrRefundRequested on the next
+// attempt instead of asking the provider again; it is finished in manual mode.
+func (s PaymentService) RefundPurchase(ctx context.Context, purchaseID int64, mode RefundMode) (bool, error) {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return false, err
+	}
+	if purchase == nil {
+		return false, ErrPurchaseNotFound
+	}
+
+	if purchase.InvoiceType == database.InvoiceTypeBalance {
+		mode = RefundModeBalance
+	}
+	if mode == RefundModeBalance && purchase.Kind == database.PurchaseKindTopUp {
+		return false, ErrTopUpFromBalance
+	}
+
+	if mode == RefundModeProvider {
+		if err := s.refundViaProvider(ctx, purchase); err != nil {
+			return false, err
+		}
+	}
+
+	applied, err := s.purchaseRepository.TransitionWith(ctx, purchase.ID, database.PurchaseStatusRefunded, nil, func(tx pgx.Tx, locked *database.Purchase) error {
+		if mode == RefundModeBalance {
+			if locked.RefundRequestedAt != nil {
+				return ErrRefundRequested
+			}
+			if _, err := s.balanceRepository.CreditTx(ctx, tx, &database.BalanceTransaction{
+				CustomerID: locked.CustomerID,
+				Amount:     locked.Amount,
+				Reason:     database.BalanceReasonRefund,
+				PurchaseID: &locked.ID,
+			}); err != nil {
+				return err
+			}
+		}
+		switch locked.Kind {
+		case database.PurchaseKindSubscription:
+			if err := s.revokePanelDaysTx(ctx, tx, locked.ID, locked.CustomerID, locked.Days(config.DaysInMonth())); err != nil {
+				return err
+			}
+		case database.PurchaseKindGift:
+			gift, err := s.giftRepository.RevokeTx(ctx, tx, locked.ID)
+			if err != nil {
+				return err
+			}
+			if gift != nil && gift.RedeemedBy != nil {
+				if err := s.revokePanelDaysTx(ctx, tx, locked.ID, *gift.RedeemedBy, gift.Days); err != nil {
+					return err
+				}
+			}
+		case database.PurchaseKindTopUp:
+			// The refunded money may already be spent, so the balance can go negative.
+			if _, err := s.balanceRepository.CreditTx(ctx, tx, &database.BalanceTransaction{
+				CustomerID: locked.CustomerID,
+				Amount:     -locked.Amount,
+				Reason:     database.BalanceReasonTopUpRefund,
+				PurchaseID: &locked.ID,
+			}); err != nil {
+				return err
+			}
+		}
+		return s.enqueueRefundJobs(ctx, tx, locked)
+	})
+	if errors.Is(err, database.ErrInvalidTransition) {
+		return false, fmt.Errorf("%w: status %s", ErrPurchaseNotPaid, purchase.Status)
+	}
+	if err != nil {
+		if mode == RefundModeProvider {
+			return false, fmt.Errorf("%w, but recording the refund failed: %v", ErrRefundRequested, err)
+		}
+		return false, err
+	}
+	if !applied {
+		slog.Info("purchase already refunded, skipping", "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		return false, nil
+	}
+
+	slog.Info("purchase refunded", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType, "mode", mode)
+	return true, nil
+}
+
+// refundViaProvider stores the refund request and asks the purchase's provider to
+// return the money. A request the provider declined is cleared, so it can be made
+// again. A purchase that is no longer paid is left to the transition, which reports
+// it.
+func (s PaymentService) refundViaProvider(ctx context.Context, purchase *database.Purchase) error {
+	provider, ok := s.providers.Get(purchase.InvoiceType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRefundNotSupported, purchase.InvoiceType)
+	}
+
+	requested, err := s.purchaseRepository.RequestRefund(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if !requested {
+		current, err := s.purchaseRepository.FindById(ctx, purchase.ID)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.Status == database.PurchaseStatusPaid {
+			return ErrRefundRequested
+		}
+		return nil
+	}
+
+	if err := provider.Refund(ctx, purchase); err != nil {
+		if cancelErr := s.purchaseRepository.CancelRefundRequest(ctx, purchase.ID); cancelErr != nil {
+			slog.Error("cancel refund request", "error", cancelErr, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		}
+		if errors.Is(err, ErrNotSupported) {
+			return fmt.Errorf("%w: %s", ErrRefundNotSupported, purchase.InvoiceType)
+		}
+		return fmt.Errorf("refund via %s: %w", purchase.InvoiceType, err)
+	}
+	return nil
+}
+
+func (s PaymentService) enqueueRefundJobs(ctx context.Context, tx pgx.Tx, purchase *database.Purchase) error {
+	kinds := []string{JobRefundNotify}
+	if purchase.Kind == database.PurchaseKindTraffic {
+		kinds = append(kinds, JobRefundSubscription)
+	}
+	if s.receiptRequired(purchase) {
+		kinds = append(kinds, JobMoynalogCancel)
+	}
+
+	for _, kind := range kinds {
+		if err := s.outboxRepository.EnqueueTx(ctx, tx, kind, purchaseJob{PurchaseID: purchase.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s PaymentService) notifyPurchaseRefunded(ctx context.Context, purchase *database.Purchase) error {
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: customer.TelegramID,
+		Text:   s.translation.GetText(customer.Language, "purchase_refunded"),
+	})
+	return err
+}
@@ -0,0 +1,132 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/go-telegram/bot"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+var (
+	// ErrPaymentMismatch is returned when a provider reports a payment whose amount
+	// or currency differs from the purchase. The purchase is held for review instead
+	// of being processed.
+	ErrPaymentMismatch     = errors.New("payment does not match purchase")
+	ErrPurchaseNotInReview = errors.New("purchase is not held for review")
+)
+
+// currencyAliases maps currency codes reported by providers to the codes purchases
+// are recorded in.
+var currencyAliases = map[string]string{
+	"XTR": "STARS",
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if alias, ok := currencyAliases[currency]; ok {
+		return alias
+	}
+	return currency
+}
+
+// checkPayment compares the amount and currency a provider received with the purchase.
+func checkPayment(purchase *database.Purchase, amount float64, currency string) error {
+	if normalizeCurrency(currency) != normalizeCurrency(purchase.Currency) {
+		return fmt.Errorf("%w: paid in %q, purchase is in %s", ErrPaymentMismatch, currency, purchase.Currency)
+	}
+	if math.Abs(amount-purchase.Amount) >= 0.01 {
+		return fmt.Errorf("%w: paid %.2f %s, purchase costs %.2f", ErrPaymentMismatch, amount, purchase.Currency, purchase.Amount)
+	}
+	return nil
+}
+
+// ProcessPaidPurchase processes a purchase the provider reports as paid once the
+// amount and currency it received match the purchase. A mismatched payment is held
+// for review, the admin is alerted and ErrPaymentMismatch is returned.
+func (s PaymentService) ProcessPaidPurchase(ctx context.Context, purchaseID int64, amount float64, currency string) error {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return ErrPurchaseNotFound
+	}
+	if purchase.Status == database.PurchaseStatusReview {
+		return fmt.Errorf("%w: purchase is held for review", ErrPaymentMismatch)
+	}
+
+	if err := checkPayment(purchase, amount, currency); err != nil {
+		s.holdForReview(ctx, purchase, err)
+		return err
+	}
+	return s.ProcessPurchaseById(ctx, purchaseID)
+}
+
+func (s PaymentService) holdForReview(ctx context.Context, purchase *database.Purchase, reason error) {
+	applied, err := s.purchaseRepository.Transition(ctx, purchase.ID, database.PurchaseStatusReview, nil)
+	if err != nil {
+		slog.Error("hold purchase for review", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		return
+	}
+	if !applied {
+		return
+	}
+	slog.Warn("payment held for review", "purchase_id", utils.MaskHalfInt64(purchase.ID), "invoice_type", purchase.InvoiceType, "reason", reason)
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: config.GetAdminTelegramId(),
+		Text: fmt.Sprintf("Purchase #%d (%s) is held for review: %v\n\nCheck the payment in the provider's dashboard, then run /approve %d to process it or /reject %d to cancel it.",
+			purchase.ID, purchase.InvoiceType, reason, purchase.ID, purchase.ID),
+	})
+	if err != nil {
+		slog.Error("notify admin about held payment", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+}
+
+// ApproveReviewedPurchase processes a purchase held for review as paid.
+func (s PaymentService) ApproveReviewedPurchase(ctx context.Context, purchaseID int64) error {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return ErrPurchaseNotFound
+	}
+	if purchase.Status != database.PurchaseStatusReview {
+		return ErrPurchaseNotInReview
+	}
+	return s.ProcessPurchaseById(ctx, purchaseID)
+}
+
+// RejectReviewedPurchase cancels a purchase held for review. The money received is
+// returned in the provider's dashboard.
+func (s PaymentService) RejectReviewedPurchase(ctx context.Context, purchaseID int64) error {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return ErrPurchaseNotFound
+	}
+	if purchase.Status != database.PurchaseStatusReview {
+		return ErrPurchaseNotInReview
+	}
+
+	applied, err := s.purchaseRepository.Transition(ctx, purchaseID, database.PurchaseStatusCancel, nil)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrPurchaseNotInReview
+	}
+	slog.Info("reviewed purchase rejected", "purchase_id", utils.MaskHalfInt64(purchaseID))
+	return nil
+}
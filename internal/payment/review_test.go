@@ -0,0 +1,37 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+func TestCheckPayment(t *testing.T) {
+	rub := &database.Purchase{Amount: 199, Currency: "RUB"}
+	stars := &database.Purchase{Amount: 150, Currency: "STARS"}
+	tests := []struct {
+		name     string
+		purchase *database.Purchase
+		amount   float64
+		currency string
+		mismatch bool
+	}{
+		{"exact", rub, 199, "RUB", false},
+		{"lower case currency", rub, 199.001, "rub", false},
+		{"underpaid", rub, 1, "RUB", true},
+		{"overpaid", rub, 299, "RUB", true},
+		{"other currency", rub, 199, "USD", true},
+		{"missing currency", rub, 199, "", true},
+		{"stars", stars, 150, "XTR", false},
+		{"stars underpaid", stars, 1, "XTR", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPayment(tt.purchase, tt.amount, tt.currency)
+			if got := errors.Is(err, ErrPaymentMismatch); got != tt.mismatch {
+				t.Errorf("checkPayment() = %v, want mismatch %v", err, tt.mismatch)
+			}
+		})
+	}
+}
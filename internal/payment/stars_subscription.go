@@ -0,0 +1,189 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// starsSubscriptionPeriod is the only subscription period Telegram accepts for Stars
+// invoices, 30 days in seconds.
+const starsSubscriptionPeriod = 30 * 24 * 60 * 60
+
+// ErrNoStarsSubscription is returned when the customer has no running Stars subscription.
+var ErrNoStarsSubscription = errors.New("no stars subscription")
+
+// starsSubscriptionEligible tells whether the purchase is sold as a Stars subscription.
+func starsSubscriptionEligible(purchase *database.Purchase) bool {
+	return config.IsStarsSubscriptionEnabled() && isStarsSubscriptionPurchase(purchase, config.DaysInMonth())
+}
+
+// isStarsSubscriptionPurchase tells whether the purchase is a one-month
+// subscription, which is sold with the Stars subscription period and grants
+// daysInMonth days on every payment. Plans of another length are paid once, and
+// so are purchases with a promo code because every renewal charges the price of
+// the first payment.
+func isStarsSubscriptionPurchase(purchase *database.Purchase, daysInMonth int) bool {
+	return purchase.Kind == database.PurchaseKindSubscription &&
+		purchase.PromoCodeID == nil &&
+		purchase.BonusDays == 0 &&
+		purchase.Days(daysInMonth) == daysInMonth
+}
+
+// starsRenewal returns the purchase recording a renewal charge of the subscription
+// started by first. It grants one month of config.DaysInMonth days. The charge id
+// keeps the expiry job away from it while it is pending, and the charged amount is
+// what the reconciliation checks when it retries the renewal.
+func starsRenewal(first *database.Purchase, chargeID string, amount float64, currency string) *database.Purchase {
+	return &database.Purchase{
+		Amount:               first.Amount,
+		CustomerID:           first.CustomerID,
+		Month:                1,
+		Currency:             first.Currency,
+		Status:               database.PurchaseStatusPending,
+		InvoiceType:          database.InvoiceTypeTelegram,
+		Kind:                 database.PurchaseKindSubscription,
+		PlanID:               first.PlanID,
+		TelegramChargeID:     &chargeID,
+		TelegramPaidAmount:   &amount,
+		TelegramPaidCurrency: &currency,
+	}
+}
+
+// StartStarsSubscription records the Stars subscription started by the first
+// payment of the purchase.
+func (s PaymentService) StartStarsSubscription(ctx context.Context, purchaseID int64, chargeID string, expiresAt time.Time) error {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return ErrPurchaseNotFound
+	}
+
+	err = s.starsSubscriptionRepository.Create(ctx, &database.StarsSubscription{
+		CustomerID: purchase.CustomerID,
+		PurchaseID: purchase.ID,
+		ChargeID:   chargeID,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("stars subscription started", "purchase_id", utils.MaskHalfInt64(purchase.ID), "customer_id", utils.MaskHalfInt64(purchase.CustomerID))
+	return nil
+}
+
+// RenewStarsSubscription records a renewal charge of the Stars subscription started
+// by the purchase as a new paid purchase, which extends the subscription. A charge
+// delivered twice is applied once, a charge that does not match the price of the
+// first payment is held for review.
+func (s PaymentService) RenewStarsSubscription(ctx context.Context, purchaseID int64, chargeID string, amount float64, currency string, expiresAt time.Time) error {
+	renewal, err := s.purchaseRepository.FindByTelegramChargeID(ctx, chargeID)
+	if err != nil {
+		return err
+	}
+	if renewal != nil {
+		return s.ProcessPaidPurchase(ctx, renewal.ID, amount, currency)
+	}
+
+	sub, err := s.starsSubscriptionRepository.FindByPurchaseID(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return fmt.Errorf("stars subscription of purchase %s not found", utils.MaskHalfInt64(purchaseID))
+	}
+	first, err := s.purchaseRepository.FindById(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if first == nil {
+		return ErrPurchaseNotFound
+	}
+
+	renewalID, err := s.purchaseRepository.Create(ctx, starsRenewal(first, chargeID, amount, currency))
+	if err != nil {
+		return err
+	}
+	// The renewal is recorded before it is processed: a renewal that fails to
+	// process keeps its charge id and is processed by the reconciliation.
+	if err := s.starsSubscriptionRepository.UpdateFields(ctx, sub.ID, map[string]interface{}{
+		"expires_at": expiresAt,
+	}); err != nil {
+		return err
+	}
+	if err := s.ProcessPaidPurchase(ctx, renewalID, amount, currency); err != nil {
+		return err
+	}
+	slog.Info("stars subscription renewed", "purchase_id", utils.MaskHalfInt64(renewalID), "customer_id", utils.MaskHalfInt64(sub.CustomerID))
+	return nil
+}
+
+// ActiveStarsSubscription returns the customer's running Stars subscription, nil
+// when there is none.
+func (s PaymentService) ActiveStarsSubscription(ctx context.Context, customerID int64) (*database.StarsSubscription, error) {
+	return s.starsSubscriptionRepository.FindActiveByCustomerID(ctx, customerID, time.Now())
+}
+
+// StarsSubscriptionRenews tells whether the customer's subscription is renewed by a
+// Stars subscription that was not canceled.
+func (s PaymentService) StarsSubscriptionRenews(ctx context.Context, customerID int64) (bool, error) {
+	sub, err := s.ActiveStarsSubscription(ctx, customerID)
+	if err != nil {
+		return false, err
+	}
+	return sub != nil && sub.CanceledAt == nil, nil
+}
+
+// StarsSubscriptionRenewable tells whether the purchase started a Stars subscription
+// that Telegram may still charge.
+func (s PaymentService) StarsSubscriptionRenewable(ctx context.Context, purchaseID int64) (bool, error) {
+	sub, err := s.starsSubscriptionRepository.FindByPurchaseID(ctx, purchaseID)
+	if err != nil {
+		return false, err
+	}
+	return sub != nil && sub.CanceledAt == nil, nil
+}
+
+// SetStarsSubscriptionCanceled cancels the customer's Stars subscription or resumes
+// it. A canceled subscription is not renewed but stays active until it expires.
+func (s PaymentService) SetStarsSubscriptionCanceled(ctx context.Context, customer *database.Customer, canceled bool) (*database.StarsSubscription, error) {
+	sub, err := s.ActiveStarsSubscription(ctx, customer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrNoStarsSubscription
+	}
+
+	_, err = s.telegramBot.EditUserStarSubscription(ctx, &bot.EditUserStarSubscriptionParams{
+		UserID:                  customer.TelegramID,
+		TelegramPaymentChargeID: sub.ChargeID,
+		IsCanceled:              canceled,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sub.CanceledAt = nil
+	if canceled {
+		now := time.Now()
+		sub.CanceledAt = &now
+	}
+	if err := s.starsSubscriptionRepository.UpdateFields(ctx, sub.ID, map[string]interface{}{
+		"canceled_at": sub.CanceledAt,
+	}); err != nil {
+		return nil, err
+	}
+	slog.Info("stars subscription updated", "customer_id", utils.MaskHalfInt64(customer.ID), "canceled", canceled)
+	return sub, nil
+}
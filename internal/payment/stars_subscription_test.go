@@ -0,0 +1,72 @@
+package payment
+
+import (
+	"testing"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+func TestIsStarsSubscriptionPurchase(t *testing.T) {
+	promoID := int64(3)
+	tests := []struct {
+		name     string
+		purchase database.Purchase
+		want     bool
+	}{
+		{"one-month plan", database.Purchase{Kind: database.PurchaseKindSubscription, DurationDays: 31}, true},
+		{"one month", database.Purchase{Kind: database.PurchaseKindSubscription, Month: 1}, true},
+		{"45-day plan", database.Purchase{Kind: database.PurchaseKindSubscription, DurationDays: 45}, false},
+		{"10-day plan", database.Purchase{Kind: database.PurchaseKindSubscription, DurationDays: 10}, false},
+		{"three months", database.Purchase{Kind: database.PurchaseKindSubscription, Month: 3}, false},
+		{"promo bonus days", database.Purchase{Kind: database.PurchaseKindSubscription, Month: 1, BonusDays: 5}, false},
+		{"promo discount", database.Purchase{Kind: database.PurchaseKindSubscription, Month: 1, PromoCodeID: &promoID}, false},
+		{"gift", database.Purchase{Kind: database.PurchaseKindGift, Month: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 31 days in a month: the check must not depend on the Stars period being 30 days.
+			if got := isStarsSubscriptionPurchase(&tt.purchase, 31); got != tt.want {
+				t.Errorf("isStarsSubscriptionPurchase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStarsRenewal(t *testing.T) {
+	planID := int64(2)
+	firstCharge := "first"
+	first := &database.Purchase{
+		ID:               10,
+		Amount:           150,
+		CustomerID:       4,
+		Month:            1,
+		Currency:         "STARS",
+		Status:           database.PurchaseStatusPaid,
+		InvoiceType:      database.InvoiceTypeTelegram,
+		Kind:             database.PurchaseKindSubscription,
+		PlanID:           &planID,
+		DurationDays:     30,
+		TelegramChargeID: &firstCharge,
+	}
+
+	renewal := starsRenewal(first, "second", 120, "XTR")
+	if renewal.Status != database.PurchaseStatusPending {
+		t.Errorf("status = %s, want pending", renewal.Status)
+	}
+	if renewal.Amount != first.Amount || renewal.CustomerID != first.CustomerID {
+		t.Errorf("renewal = %+v does not repeat the first purchase", renewal)
+	}
+	if got := renewal.Days(31); got != 31 {
+		t.Errorf("renewal grants %d days, want one month of 31", got)
+	}
+	if renewal.PlanID == nil || *renewal.PlanID != planID {
+		t.Errorf("plan = %v, want %d", renewal.PlanID, planID)
+	}
+	if renewal.TelegramChargeID == nil || *renewal.TelegramChargeID != "second" {
+		t.Errorf("charge id = %v, want second", renewal.TelegramChargeID)
+	}
+	if renewal.TelegramPaidAmount == nil || *renewal.TelegramPaidAmount != 120 ||
+		renewal.TelegramPaidCurrency == nil || *renewal.TelegramPaidCurrency != "XTR" {
+		t.Errorf("charged = %v %v, want 120 XTR", renewal.TelegramPaidAmount, renewal.TelegramPaidCurrency)
+	}
+}
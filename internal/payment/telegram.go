@@ -0,0 +1,110 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+)
+
+// TelegramProvider sells subscriptions for Telegram Stars. Payments are confirmed
+// by SuccessfulPayment updates delivered to the bot itself.
+type TelegramProvider struct {
+	telegramBot                 *bot.Bot
+	translation                 *translation.Manager
+	customerRepository          *database.CustomerRepository
+	starsSubscriptionRepository *database.StarsSubscriptionRepository
+}
+
+func NewTelegramProvider(telegramBot *bot.Bot, translation *translation.Manager, customerRepository *database.CustomerRepository, starsSubscriptionRepository *database.StarsSubscriptionRepository) *TelegramProvider {
+	return &TelegramProvider{telegramBot: telegramBot, translation: translation, customerRepository: customerRepository, starsSubscriptionRepository: starsSubscriptionRepository}
+}
+
+func (p *TelegramProvider) InvoiceType() database.InvoiceType {
+	return database.InvoiceTypeTelegram
+}
+
+func (p *TelegramProvider) ButtonKey() string {
+	return "stars_button"
+}
+
+func (p *TelegramProvider) IsEnabled() bool {
+	return config.IsTelegramStarsEnabled()
+}
+
+func (p *TelegramProvider) Currency() string {
+	return "STARS"
+}
+
+func (p *TelegramProvider) InvoiceTTL() time.Duration {
+	return config.StarsInvoiceTTL()
+}
+
+func (p *TelegramProvider) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*Invoice, error) {
+	var subscriptionPeriod int
+	if starsSubscriptionEligible(purchase) {
+		// A customer who is already subscribed pays once, so they are not charged
+		// by two subscriptions every month.
+		active, err := p.starsSubscriptionRepository.FindActiveByCustomerID(ctx, customer.ID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if active == nil || active.CanceledAt != nil {
+			subscriptionPeriod = starsSubscriptionPeriod
+		}
+	}
+
+	invoiceUrl, err := p.telegramBot.CreateInvoiceLink(ctx, &bot.CreateInvoiceLinkParams{
+		Title:    p.translation.GetText(customer.Language, "invoice_title"),
+		Currency: "XTR",
+		Prices: []models.LabeledPrice{
+			{
+				Label:  p.translation.GetText(customer.Language, "invoice_label"),
+				Amount: int(purchase.Amount),
+			},
+		},
+		Description:        p.translation.GetText(customer.Language, "invoice_description"),
+		Payload:            fmt.Sprintf("%d&%s", purchase.ID, remnawave.UsernameFromCtx(ctx)),
+		SubscriptionPeriod: subscriptionPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Invoice{URL: invoiceUrl}, nil
+}
+
+func (p *TelegramProvider) FetchStatus(ctx context.Context, purchase *database.Purchase) (*Transaction, error) {
+	return nil, ErrNotSupported
+}
+
+// Cancel has nothing to close: Stars invoice links cannot be revoked, but the
+// pre-checkout query refuses purchases that are no longer pending.
+func (p *TelegramProvider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	return nil
+}
+
+func (p *TelegramProvider) Refund(ctx context.Context, purchase *database.Purchase) error {
+	if purchase.TelegramChargeID == nil {
+		return fmt.Errorf("purchase %d has no telegram charge id", purchase.ID)
+	}
+	customer, err := p.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %d not found", purchase.CustomerID)
+	}
+
+	_, err = p.telegramBot.RefundStarPayment(ctx, &bot.RefundStarPaymentParams{
+		UserID:                  customer.TelegramID,
+		TelegramPaymentChargeID: *purchase.TelegramChargeID,
+	})
+	return err
+}
@@ -0,0 +1,195 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ErrTrafficPackUnavailable is returned when the customer has no active
+// subscription with a traffic limit to add a pack to.
+var ErrTrafficPackUnavailable = errors.New("traffic pack unavailable")
+
+// AsTrafficPack makes the purchase an extra traffic pack of gb gigabytes.
+func AsTrafficPack(gb int) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.kind = database.PurchaseKindTraffic
+		o.trafficGB = gb
+	}
+}
+
+// TrafficPackPrice returns the price of the pack in the provider's currency.
+func TrafficPackPrice(pack config.TrafficPack, currency string) (int, bool) {
+	price := pack.Price
+	if currency == "STARS" {
+		price = pack.StarsPrice
+	}
+	return price, price > 0
+}
+
+// CheckTrafficPackAvailable reports ErrTrafficPackUnavailable unless the customer
+// has an active subscription with a traffic limit.
+func (s PaymentService) CheckTrafficPackAvailable(ctx context.Context, customer *database.Customer) error {
+	if customer.ExpireAt == nil || customer.ExpireAt.Before(time.Now()) {
+		return ErrTrafficPackUnavailable
+	}
+	user, err := s.remnawaveClient.GetUser(ctx, remnawaveUser(customer))
+	if errors.Is(err, remnawave.ErrNotFound) {
+		return ErrTrafficPackUnavailable
+	}
+	if err != nil {
+		return err
+	}
+	s.rememberRemnawaveUser(ctx, customer, user.UUID)
+	if user.TrafficLimitBytes == 0 || user.ExpireAt.Before(time.Now()) {
+		return ErrTrafficPackUnavailable
+	}
+	return nil
+}
+
+// TrafficUsage returns the traffic the customer used since the last reset,
+// remnawave.ErrNotFound when the customer has no panel user.
+func (s PaymentService) TrafficUsage(ctx context.Context, customer *database.Customer) (*remnawave.Usage, error) {
+	usage, err := s.remnawaveClient.GetUsage(ctx, remnawaveUser(customer))
+	if err != nil {
+		return nil, err
+	}
+	s.rememberRemnawaveUser(ctx, customer, usage.UserUUID)
+	return usage, nil
+}
+
+// CreateTrafficPackPurchase creates a purchase of the configured pack of gb
+// gigabytes priced in the provider's currency.
+func (s PaymentService) CreateTrafficPackPurchase(ctx context.Context, gb int, customer *database.Customer, invoiceType database.InvoiceType) (url string, purchaseId int64, err error) {
+	pack, ok := config.FindTrafficPack(gb)
+	if !ok {
+		return "", 0, fmt.Errorf("traffic pack of %d GB is not offered", gb)
+	}
+	provider, ok := s.Provider(invoiceType)
+	if !ok {
+		return "", 0, fmt.Errorf("unknown invoice type: %s", invoiceType)
+	}
+	price, ok := TrafficPackPrice(pack, provider.Currency())
+	if !ok {
+		return "", 0, fmt.Errorf("traffic pack of %d GB has no %s price", gb, provider.Currency())
+	}
+	if err := s.CheckTrafficPackAvailable(ctx, customer); err != nil {
+		return "", 0, err
+	}
+	return s.CreatePurchase(ctx, float64(price), 0, customer, invoiceType, AsTrafficPack(gb))
+}
+
+// trafficPackExpiry returns when a pack added now expires: at the end of the
+// subscription, or at the next traffic reset when that comes first and untilReset
+// is set.
+func trafficPackExpiry(user *remnawave.User, untilReset bool, now time.Time) time.Time {
+	if untilReset {
+		if reset, ok := remnawave.NextTrafficReset(user.TrafficLimitStrategy, now); ok && reset.Before(user.ExpireAt) {
+			return reset
+		}
+	}
+	return user.ExpireAt
+}
+
+// addTrafficPacks adds the customer's active packs to the traffic limit of access,
+// so applying a plan again does not take away traffic that was paid for.
+func (s PaymentService) addTrafficPacks(ctx context.Context, customerID int64, access *remnawave.Access) error {
+	if access.TrafficLimit == 0 {
+		return nil
+	}
+	bytes, err := s.trafficPackRepository.ActiveBytes(ctx, customerID, time.Now())
+	if err != nil {
+		return err
+	}
+	access.TrafficLimit += int(bytes)
+	return nil
+}
+
+// ExpireTrafficPacks takes expired packs back from the traffic limits they raised.
+func (s PaymentService) ExpireTrafficPacks(ctx context.Context) {
+	packs, err := s.trafficPackRepository.FindExpired(ctx, time.Now())
+	if err != nil {
+		slog.Error("expire: find expired traffic packs", "error", err)
+		return
+	}
+	for i := range packs {
+		if err := s.revokeTrafficPack(ctx, &packs[i]); err != nil {
+			slog.Error("expire: traffic pack", "purchase_id", utils.MaskHalfInt64(packs[i].PurchaseID), "error", err)
+		}
+	}
+}
+
+func (s PaymentService) revokeTrafficPack(ctx context.Context, pack *database.TrafficPack) error {
+	customer, err := s.customerRepository.FindById(ctx, pack.CustomerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(pack.CustomerID))
+	}
+
+	revoked, err := s.trafficPackRepository.RevokeWith(ctx, pack.ID, func(locked *database.TrafficPack) error {
+		_, err := s.remnawaveClient.AddTrafficLimit(ctx, remnawaveUser(customer), -int(locked.Bytes))
+		if errors.Is(err, remnawave.ErrNotFound) || errors.Is(err, remnawave.ErrUnlimitedTraffic) {
+			// There is no limit left to take the pack back from.
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if revoked {
+		slog.Info("traffic pack revoked", "purchase_id", utils.MaskHalfInt64(pack.PurchaseID), "customer_id", utils.MaskHalfInt64(customer.ID))
+	}
+	return nil
+}
+
+// revokeRefundedTraffic takes back the traffic pack of a refunded purchase once it
+// was granted.
+func (s PaymentService) revokeRefundedTraffic(ctx context.Context, purchase *database.Purchase) error {
+	if purchase.Kind != database.PurchaseKindTraffic {
+		return nil
+	}
+	if err := s.awaitPanelGrant(ctx, purchase); err != nil {
+		return err
+	}
+	pack, err := s.trafficPackRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if pack == nil {
+		return nil
+	}
+	return s.revokeTrafficPack(ctx, pack)
+}
+
+func (s PaymentService) notifyTrafficPackAdded(ctx context.Context, customer *database.Customer, purchase *database.Purchase) error {
+	pack, err := s.trafficPackRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return err
+	}
+	if pack == nil {
+		return fmt.Errorf("traffic pack of purchase %s not found", utils.MaskHalfInt64(purchase.ID))
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "traffic_pack_added"), purchase.TrafficGB, pack.ExpiresAt.Format("02.01.2006 15:04")),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: s.createConnectKeyboard(customer),
+		},
+	})
+	return err
+}
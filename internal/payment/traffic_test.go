@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"testing"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/remnawave"
+)
+
+func TestTrafficPackExpiry(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2026, time.March, 18, 15, 30, 0, 0, time.UTC)
+	subscriptionEnd := time.Date(2026, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		strategy   string
+		expireAt   time.Time
+		untilReset bool
+		want       time.Time
+	}{
+		{"day reset", "DAY", subscriptionEnd, true, time.Date(2026, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"week reset", "WEEK", subscriptionEnd, true, time.Date(2026, time.March, 23, 0, 0, 0, 0, time.UTC)},
+		{"month reset", "MONTH", subscriptionEnd, true, time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"no reset", "NO_RESET", subscriptionEnd, true, subscriptionEnd},
+		{"subscription ends before reset", "MONTH", time.Date(2026, time.March, 25, 0, 0, 0, 0, time.UTC), true, time.Date(2026, time.March, 25, 0, 0, 0, 0, time.UTC)},
+		{"until subscription end", "DAY", subscriptionEnd, false, subscriptionEnd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &remnawave.User{TrafficLimitStrategy: tt.strategy, ExpireAt: tt.expireAt}
+			if got := trafficPackExpiry(user, tt.untilReset, now); !got.Equal(tt.want) {
+				t.Errorf("trafficPackExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextTrafficResetWeekOnMonday(t *testing.T) {
+	monday := time.Date(2026, time.March, 23, 10, 0, 0, 0, time.UTC)
+	got, ok := remnawave.NextTrafficReset("WEEK", monday)
+	want := time.Date(2026, time.March, 30, 0, 0, 0, 0, time.UTC)
+	if !ok || !got.Equal(want) {
+		t.Errorf("NextTrafficReset() = %v, %v, want %v, true", got, ok, want)
+	}
+}
+
+func TestTrafficPackPrice(t *testing.T) {
+	pack := config.TrafficPack{GB: 50, Price: 150}
+
+	if price, ok := TrafficPackPrice(pack, "RUB"); !ok || price != 150 {
+		t.Errorf("TrafficPackPrice(RUB) = %d, %v, want 150, true", price, ok)
+	}
+	if _, ok := TrafficPackPrice(pack, "STARS"); ok {
+		t.Error("TrafficPackPrice(STARS) is offered without a Stars price")
+	}
+
+	pack.StarsPrice = 100
+	if price, ok := TrafficPackPrice(pack, "STARS"); !ok || price != 100 {
+		t.Errorf("TrafficPackPrice(STARS) = %d, %v, want 100, true", price, ok)
+	}
+}
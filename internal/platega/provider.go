@@ -2,71 +2,163 @@ package platega
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"time"
 
+	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 )
 
 type Provider struct {
 	client        *Client
+	purchaseRepo  *database.PurchaseRepository
 	invoiceType   database.InvoiceType
 	paymentMethod PaymentMethod
+	buttonKey     string
+	enabled       func() bool
 }
 
+var _ payment.WebhookProvider = (*Provider)(nil)
+
 func (p *Provider) InvoiceType() database.InvoiceType {
 	return p.invoiceType
 }
 
+func (p *Provider) ButtonKey() string {
+	return p.buttonKey
+}
+
+func (p *Provider) IsEnabled() bool {
+	return p.enabled() && p.IsConfigured()
+}
+
 func (p *Provider) IsConfigured() bool {
 	return p.client != nil && p.client.IsConfigured()
 }
 
-func (p *Provider) CreateInvoice(
-	ctx context.Context,
-	purchaseID int64,
-	amount float64,
-	currency string,
-	description string,
-	returnURL string,
-) (redirectURL string, transactionID string, err error) {
+func (p *Provider) Currency() string {
+	return "RUB"
+}
+
+func (p *Provider) InvoiceTTL() time.Duration {
+	return config.PlategaInvoiceTTL()
+}
+
+func (p *Provider) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*payment.Invoice, error) {
 	if p.client == nil {
-		return "", "", fmt.Errorf("platega client not configured")
+		return nil, fmt.Errorf("platega client not configured")
 	}
 
 	resp, err := p.client.CreateTransaction(ctx, &CreateTransactionRequest{
 		PaymentMethod: p.paymentMethod,
 		PaymentDetails: PaymentDetails{
-			Amount:   amount,
-			Currency: currency,
+			Amount:   purchase.Amount,
+			Currency: purchase.Currency,
 		},
-		Description: description,
-		Return:      returnURL,
-		FailedUrl:   returnURL,
-		Payload:     fmt.Sprintf("purchaseId=%d", purchaseID),
+		Description: payment.PurchaseDescription(purchase),
+		Return:      config.BotURL(),
+		FailedUrl:   config.BotURL(),
+		Payload:     fmt.Sprintf("purchaseId=%d", purchase.ID),
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("create platega transaction: %w", err)
+		return nil, fmt.Errorf("create platega transaction: %w", err)
+	}
+
+	return &payment.Invoice{
+		URL: resp.Redirect,
+		Fields: map[string]interface{}{
+			"platega_id":  resp.TransactionId,
+			"platega_url": resp.Redirect,
+		},
+	}, nil
+}
+
+func (p *Provider) FetchStatus(ctx context.Context, purchase *database.Purchase) (*payment.Transaction, error) {
+	if purchase.PlategaID == nil {
+		return nil, fmt.Errorf("purchase %d has no platega transaction id", purchase.ID)
+	}
+	tx, err := p.client.GetTransaction(ctx, *purchase.PlategaID)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.Transaction{
+		Status:   purchaseStatus(tx.Status),
+		Amount:   tx.PaymentDetails.Amount,
+		Currency: tx.PaymentDetails.Currency,
+	}, nil
+}
+
+func (p *Provider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	return payment.ErrNotSupported
+}
+
+func (p *Provider) Refund(ctx context.Context, purchase *database.Purchase) error {
+	return payment.ErrNotSupported
+}
+
+func (p *Provider) WebhookName() string {
+	return "platega"
+}
+
+func (p *Provider) WebhookPath() string {
+	return config.GetPlategaWebHookUrl()
+}
+
+// WebhookEventID is the transaction and the status it reached, a transaction is
+// reported once per status.
+func (p *Provider) WebhookEventID(body []byte) string {
+	var payload CallbackPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Id == "" {
+		return ""
 	}
+	return fmt.Sprintf("%s:%s", payload.Id, payload.Status)
+}
 
-	return resp.Redirect, resp.TransactionId, nil
+func (p *Provider) WebhookHandler(service *payment.PaymentService) http.Handler {
+	return NewWebhookHandler(p.purchaseRepo, service, config.PlategaMerchantId(), config.PlategaSecret())
 }
 
-var invoiceTypeToMethod = map[database.InvoiceType]PaymentMethod{
-	database.InvoiceTypePlategaSBP:       PaymentMethodSBPQR,
-	database.InvoiceTypePlategaCards:     PaymentMethodCardsRUB,
-	database.InvoiceTypePlategaAcquiring: PaymentMethodCardAcquiring,
-	database.InvoiceTypePlategaWorldwide: PaymentMethodInternationalAcquiring,
-	database.InvoiceTypePlategaCrypto:    PaymentMethodCrypto,
+func purchaseStatus(status PaymentStatus) database.PurchaseStatus {
+	switch status {
+	case StatusConfirmed:
+		return database.PurchaseStatusPaid
+	case StatusCanceled, StatusChargebacked:
+		return database.PurchaseStatusCancel
+	default:
+		return database.PurchaseStatusPending
+	}
 }
 
-func ProviderFor(client *Client, invoiceType database.InvoiceType) (*Provider, error) {
-	method, ok := invoiceTypeToMethod[invoiceType]
-	if !ok {
-		return nil, fmt.Errorf("unsupported platega invoice type: %s", invoiceType)
+type methodSpec struct {
+	invoiceType database.InvoiceType
+	method      PaymentMethod
+	buttonKey   string
+	enabled     func() bool
+}
+
+var methods = []methodSpec{
+	{database.InvoiceTypePlategaSBP, PaymentMethodSBPQR, "platega_sbp_button", config.IsPlategaSBPEnabled},
+	{database.InvoiceTypePlategaCards, PaymentMethodCardsRUB, "platega_cards_button", config.IsPlategaCardsEnabled},
+	{database.InvoiceTypePlategaAcquiring, PaymentMethodCardAcquiring, "platega_acquiring_button", config.IsPlategaAcquiringEnabled},
+	{database.InvoiceTypePlategaWorldwide, PaymentMethodInternationalAcquiring, "platega_worldwide_button", config.IsPlategaWorldwideEnabled},
+	{database.InvoiceTypePlategaCrypto, PaymentMethodCrypto, "platega_crypto_button", config.IsPlategaCryptoEnabled},
+}
+
+// NewProviders returns one provider per Platega payment method, in sell keyboard order.
+func NewProviders(client *Client, purchaseRepo *database.PurchaseRepository) []*Provider {
+	providers := make([]*Provider, 0, len(methods))
+	for _, m := range methods {
+		providers = append(providers, &Provider{
+			client:        client,
+			purchaseRepo:  purchaseRepo,
+			invoiceType:   m.invoiceType,
+			paymentMethod: m.method,
+			buttonKey:     m.buttonKey,
+			enabled:       m.enabled,
+		})
 	}
-	return &Provider{
-		client:        client,
-		invoiceType:   invoiceType,
-		paymentMethod: method,
-	}, nil
+	return providers
 }
@@ -3,6 +3,7 @@ package platega
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -11,10 +12,12 @@ import (
 	"time"
 
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/webhook"
 )
 
 type PurchaseProcessor interface {
-	ProcessPurchaseById(ctx context.Context, purchaseId int64) error
+	ProcessPaidPurchase(ctx context.Context, purchaseID int64, amount float64, currency string) error
 }
 
 type WebhookHandler struct {
@@ -45,12 +48,18 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	merchantID := r.Header.Get("X-MerchantId")
-	secretHeader := r.Header.Get("X-Secret")
-	if merchantID != h.expectedMerchantID || secretHeader != h.expectedSecret {
-		slog.Warn("platega webhook: invalid credentials", "received_merchant_id", merchantID)
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+	// The secret header of a replayed event was not stored, its credentials were
+	// checked when it was received.
+	if !webhook.Replayed(r.Context()) {
+		merchantID := r.Header.Get("X-MerchantId")
+		secretHeader := r.Header.Get("X-Secret")
+		valid := webhook.EqualSecret(merchantID, h.expectedMerchantID) && webhook.EqualSecret(secretHeader, h.expectedSecret)
+		webhook.MarkSignature(r.Context(), valid)
+		if !valid {
+			slog.Warn("platega webhook: invalid credentials", "received_merchant_id", merchantID)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
@@ -87,6 +96,7 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	purchase, err := h.purchaseRepo.FindById(ctx, purchaseID)
 	if err != nil {
 		slog.Error("platega webhook: find purchase failed", "purchase_id", purchaseID, "error", err)
+		webhook.RecordError(ctx, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -95,8 +105,9 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	webhook.LinkPurchase(ctx, purchaseID)
 
-	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusCancel {
+	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusCancel || purchase.Status == database.PurchaseStatusRefunded || purchase.Status == database.PurchaseStatusReview {
 		slog.Info("platega webhook: purchase already finalized", "purchase_id", purchaseID, "status", purchase.Status)
 		w.WriteHeader(http.StatusOK)
 		return
@@ -104,17 +115,21 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	switch payload.Status {
 	case StatusConfirmed:
-		if err := h.processor.ProcessPurchaseById(ctx, purchaseID); err != nil {
+		if err := h.processor.ProcessPaidPurchase(ctx, purchaseID, payload.Amount, payload.Currency); err != nil {
+			if errors.Is(err, payment.ErrPaymentMismatch) {
+				slog.Warn("platega webhook: payment held for review", "purchase_id", purchaseID, "error", err)
+				break
+			}
 			slog.Error("platega webhook: process purchase failed", "purchase_id", purchaseID, "error", err)
+			webhook.RecordError(ctx, err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 	case StatusCanceled, StatusChargebacked:
-		err := h.purchaseRepo.UpdateFields(ctx, purchaseID, map[string]interface{}{
-			"status": database.PurchaseStatusCancel,
-		})
+		_, err := h.purchaseRepo.Transition(ctx, purchaseID, database.PurchaseStatusCancel, nil)
 		if err != nil {
 			slog.Error("platega webhook: cancel purchase failed", "purchase_id", purchaseID, "error", err)
+			webhook.RecordError(ctx, err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
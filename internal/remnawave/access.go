@@ -0,0 +1,37 @@
+package remnawave
+
+import (
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/internal/config"
+)
+
+// Access is what a subscription grants in Remnawave besides its duration.
+type Access struct {
+	// TrafficLimit is in bytes, zero means unlimited.
+	TrafficLimit         int
+	TrafficLimitStrategy string
+	// InternalSquads selects squads by UUID, empty selects all of them.
+	InternalSquads map[uuid.UUID]uuid.UUID
+	ExternalSquad  uuid.UUID
+}
+
+// DefaultAccess is the access configured for paid subscriptions.
+func DefaultAccess() *Access {
+	return &Access{
+		TrafficLimit:         config.TrafficLimit(),
+		TrafficLimitStrategy: config.TrafficLimitResetStrategy(),
+		InternalSquads:       config.SquadUUIDs(),
+		ExternalSquad:        config.ExternalSquadUUID(),
+	}
+}
+
+// TrialAccess is the access configured for trial subscriptions.
+func TrialAccess() *Access {
+	return &Access{
+		TrafficLimit:         config.TrialTrafficLimit(),
+		TrafficLimitStrategy: config.TrialTrafficLimitResetStrategy(),
+		InternalSquads:       config.TrialInternalSquads(),
+		ExternalSquad:        config.TrialExternalSquadUUID(),
+	}
+}
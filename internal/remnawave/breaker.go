@@ -0,0 +1,213 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned without calling the panel while the circuit breaker
+// is open.
+var ErrUnavailable = errors.New("remnawave panel is temporarily unavailable")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerStatus describes the circuit breaker for health checks. DownSince is set
+// while requests to the panel fail.
+type BreakerStatus struct {
+	State     BreakerState
+	Failures  int
+	DownSince *time.Time
+}
+
+// OutageFunc is called once the panel has been unreachable for the alert delay,
+// and again with recovered set when it answers after that.
+type OutageFunc func(since time.Time, recovered bool)
+
+// breaker stops calls to the panel after threshold consecutive failures. Once
+// openFor has passed a single probe is let through, which closes the breaker when
+// it succeeds and opens it again when it fails.
+type breaker struct {
+	mu         sync.Mutex
+	threshold  int
+	openFor    time.Duration
+	alertAfter time.Duration
+	onOutage   OutageFunc
+	now        func() time.Time
+
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	downSince time.Time
+	probing   bool
+	alerted   bool
+}
+
+func newBreaker(threshold int, openFor, alertAfter time.Duration) *breaker {
+	return &breaker{
+		threshold:  threshold,
+		openFor:    openFor,
+		alertAfter: alertAfter,
+		now:        time.Now,
+		state:      BreakerClosed,
+	}
+}
+
+// allow reports whether a request may be sent, ErrUnavailable when it may not.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		b.checkOutage()
+		if b.now().Sub(b.openedAt) < b.openFor {
+			return ErrUnavailable
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrUnavailable
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record counts the outcome of a request allow let through. Requests cancelled by
+// the caller say nothing about the panel and are not counted.
+func (b *breaker) record(ctx context.Context, status int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case ctx.Err() != nil:
+		b.probing = false
+	case isPanelFailure(status, err):
+		b.failures++
+		b.probing = false
+		if b.downSince.IsZero() {
+			b.downSince = b.now()
+		}
+		if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+			if b.state == BreakerClosed {
+				slog.Warn("remnawave circuit breaker opened", "failures", b.failures, "error", err)
+			}
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+		}
+		b.checkOutage()
+	default:
+		if b.state != BreakerClosed {
+			slog.Info("remnawave circuit breaker closed")
+		}
+		if b.alerted && b.onOutage != nil {
+			go b.onOutage(b.downSince, true)
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		b.downSince = time.Time{}
+		b.alerted = false
+	}
+}
+
+// checkOutage raises the outage alert once the panel has been down long enough.
+// The caller holds the lock.
+func (b *breaker) checkOutage() {
+	if b.alerted || b.downSince.IsZero() || b.now().Sub(b.downSince) < b.alertAfter {
+		return
+	}
+	b.alerted = true
+	slog.Error("remnawave panel unreachable", "since", b.downSince)
+	if b.onOutage != nil {
+		go b.onOutage(b.downSince, false)
+	}
+}
+
+// down raises the outage alert when it is due and reports whether the panel is
+// failing. It lets the alert fire while nothing else calls the panel.
+func (b *breaker) down() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkOutage()
+	return !b.downSince.IsZero()
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if !b.downSince.IsZero() {
+		since := b.downSince
+		status.DownSince = &since
+	}
+	return status
+}
+
+// isPanelFailure reports whether a response means the panel is down: no response
+// at all or a server error. Client errors come from a working panel.
+func isPanelFailure(status int, err error) bool {
+	if errors.Is(err, ErrUnavailable) {
+		return false
+	}
+	return (err != nil && status == 0) || status >= http.StatusInternalServerError
+}
+
+// retryPolicy retries failed idempotent requests with jittered exponential backoff.
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// idempotentMethods may be sent again after a failure. The bot's PATCH requests
+// set absolute values, so repeating one has the same effect.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+func (p retryPolicy) attemptsFor(method string) int {
+	if !idempotentMethods[method] || p.attempts < 1 {
+		return 1
+	}
+	return p.attempts
+}
+
+// backoff returns a random delay of up to baseDelay doubled for each failed
+// attempt, capped at maxDelay.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.baseDelay << attempt
+	if delay <= 0 || delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return rand.N(delay) + 1
+}
+
+// retryable reports whether a failed request may succeed when sent again.
+func retryable(ctx context.Context, status int, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrUnavailable) {
+		return false
+	}
+	return isPanelFailure(status, err) || status == http.StatusTooManyRequests
+}
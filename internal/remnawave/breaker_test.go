@@ -0,0 +1,129 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThresholdAndProbes(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(2, 30*time.Second, time.Hour)
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+	down := errors.New("connection refused")
+
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("expected request %d to be allowed, got %v", i, err)
+		}
+		b.record(ctx, 0, down)
+	}
+	if err := b.allow(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected the open breaker to fail fast, got %v", err)
+	}
+
+	now = now.Add(31 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected a probe after the open period, got %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected a single probe at a time, got %v", err)
+	}
+	b.record(ctx, http.StatusOK, nil)
+
+	if status := b.status(); status.State != BreakerClosed || status.DownSince != nil {
+		t.Fatalf("expected the breaker to close after a successful probe, got %+v", status)
+	}
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	b := newBreaker(1, time.Minute, time.Hour)
+	ctx := context.Background()
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b.record(ctx, http.StatusBadRequest, errors.New("API error 400"))
+
+	if status := b.status(); status.State != BreakerClosed {
+		t.Fatalf("expected client errors to keep the breaker closed, got %+v", status)
+	}
+}
+
+func TestBreakerAlertsOnceAfterOutageAndOnRecovery(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(1, time.Second, 5*time.Minute)
+	b.now = func() time.Time { return now }
+	alerts := make(chan bool, 4)
+	b.onOutage = func(since time.Time, recovered bool) { alerts <- recovered }
+	ctx := context.Background()
+
+	b.allow()
+	b.record(ctx, http.StatusBadGateway, errors.New("API error 502"))
+	for i := 0; i < 3; i++ {
+		now = now.Add(3 * time.Minute)
+		b.allow()
+		b.record(ctx, http.StatusBadGateway, errors.New("API error 502"))
+	}
+	if recovered := <-alerts; recovered {
+		t.Fatalf("expected an outage alert first")
+	}
+
+	now = now.Add(time.Minute)
+	b.allow()
+	b.record(ctx, http.StatusOK, nil)
+	if recovered := <-alerts; !recovered {
+		t.Fatalf("expected a recovery alert")
+	}
+	select {
+	case recovered := <-alerts:
+		t.Fatalf("expected exactly two alerts, got another with recovered=%v", recovered)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBreakerAlertsWithoutTraffic(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newBreaker(1, time.Second, 5*time.Minute)
+	b.now = func() time.Time { return now }
+	alerts := make(chan bool, 1)
+	b.onOutage = func(since time.Time, recovered bool) { alerts <- recovered }
+
+	if b.down() {
+		t.Fatalf("expected a fresh breaker not to be down")
+	}
+	b.allow()
+	b.record(context.Background(), 0, errors.New("connection refused"))
+
+	now = now.Add(6 * time.Minute)
+	if !b.down() {
+		t.Fatalf("expected the breaker to be down")
+	}
+	select {
+	case recovered := <-alerts:
+		if recovered {
+			t.Fatalf("expected an outage alert, got a recovery")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected an outage alert without requests")
+	}
+}
+
+func TestRetryPolicyRetriesOnlyIdempotentRequests(t *testing.T) {
+	p := retryPolicy{attempts: 3, baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	if got := p.attemptsFor(http.MethodPost); got != 1 {
+		t.Fatalf("expected POST to be sent once, got %d attempts", got)
+	}
+	if got := p.attemptsFor(http.MethodGet); got != 3 {
+		t.Fatalf("expected GET to be retried, got %d attempts", got)
+	}
+	for attempt := 0; attempt < 10; attempt++ {
+		if delay := p.backoff(attempt); delay <= 0 || delay > time.Second {
+			t.Fatalf("backoff %d out of range: %v", attempt, delay)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package remnawave
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats counts the lookups of a cached panel list.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// ttlCache keeps a value loaded from the panel for ttl. Concurrent misses wait
+// for a single load, and a failed load is not cached.
+type ttlCache[T any] struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	value    T
+	loadedAt time.Time
+	valid    bool
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+func (c *ttlCache[T]) get(ctx context.Context, load func(context.Context) (T, error)) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid && time.Since(c.loadedAt) < c.ttl {
+		c.hits.Add(1)
+		return c.value, nil
+	}
+	c.misses.Add(1)
+
+	value, err := load(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	c.value, c.loadedAt, c.valid = value, time.Now(), true
+	return value, nil
+}
+
+func (c *ttlCache[T]) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+}
+
+func (c *ttlCache[T]) stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// panelCache holds the panel data that rarely changes: squads and nodes.
+type panelCache struct {
+	internalSquads ttlCache[[]internalSquadItem]
+	externalSquads ttlCache[[]ExternalSquad]
+	nodes          ttlCache[[]Node]
+}
+
+func newPanelCache(ttl time.Duration) *panelCache {
+	c := &panelCache{}
+	c.internalSquads.ttl = ttl
+	c.externalSquads.ttl = ttl
+	c.nodes.ttl = ttl
+	return c
+}
+
+// PanelCacheStats are the lookup counters of each cached panel list.
+type PanelCacheStats struct {
+	InternalSquads CacheStats `json:"internalSquads"`
+	ExternalSquads CacheStats `json:"externalSquads"`
+	Nodes          CacheStats `json:"nodes"`
+}
+
+// CacheStats returns the hit and miss counters of the panel data cache.
+func (r *Client) CacheStats() PanelCacheStats {
+	return PanelCacheStats{
+		InternalSquads: r.cache.internalSquads.stats(),
+		ExternalSquads: r.cache.externalSquads.stats(),
+		Nodes:          r.cache.nodes.stats(),
+	}
+}
+
+// InvalidateCache drops the cached squads and nodes so they are loaded from the
+// panel again.
+func (r *Client) InvalidateCache() {
+	r.cache.internalSquads.invalidate()
+	r.cache.externalSquads.invalidate()
+	r.cache.nodes.invalidate()
+}
@@ -0,0 +1,60 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTTLCacheReusesValueUntilInvalidated(t *testing.T) {
+	c := &ttlCache[int]{ttl: time.Hour}
+	ctx := context.Background()
+	loads := 0
+	load := func(context.Context) (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if v, err := c.get(ctx, load); err != nil || v != 1 {
+			t.Fatalf("expected the first loaded value, got %d, %v", v, err)
+		}
+	}
+	c.invalidate()
+	if v, _ := c.get(ctx, load); v != 2 {
+		t.Fatalf("expected a reload after invalidation, got %d", v)
+	}
+
+	if stats := c.stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Fatalf("expected 2 hits and 2 misses, got %+v", stats)
+	}
+}
+
+func TestTTLCacheDoesNotKeepFailedLoad(t *testing.T) {
+	c := &ttlCache[int]{ttl: time.Hour}
+	ctx := context.Background()
+
+	if _, err := c.get(ctx, func(context.Context) (int, error) { return 0, ErrUnavailable }); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected the load error, got %v", err)
+	}
+	if v, err := c.get(ctx, func(context.Context) (int, error) { return 7, nil }); err != nil || v != 7 {
+		t.Fatalf("expected the value to be loaded again, got %d, %v", v, err)
+	}
+}
+
+func TestTTLCacheExpires(t *testing.T) {
+	c := &ttlCache[int]{ttl: time.Millisecond}
+	ctx := context.Background()
+	loads := 0
+	load := func(context.Context) (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	c.get(ctx, load)
+	time.Sleep(5 * time.Millisecond)
+	if v, _ := c.get(ctx, load); v != 2 {
+		t.Fatalf("expected an expired value to be reloaded, got %d", v)
+	}
+}
@@ -18,8 +18,13 @@ import (
 	"github.com/google/uuid"
 )
 
-// ErrNotFound is returned when the API responds with 404.
-var ErrNotFound = errors.New("not found")
+var (
+	// ErrNotFound is returned when the API responds with 404.
+	ErrNotFound = errors.New("not found")
+	// ErrAmbiguousUser is returned when a customer without a stored UUID has several
+	// panel users and none of them was created by the bot.
+	ErrAmbiguousUser = errors.New("several panel users share the telegram id")
+)
 
 // ctxKey is an unexported type for context keys in this package.
 type ctxKey string
@@ -30,6 +35,9 @@ const CtxKeyUsername ctxKey = "username"
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
+	retry      retryPolicy
+	breaker    *breaker
+	cache      *panelCache
 }
 
 type headerTransport struct {
@@ -75,20 +83,91 @@ func NewClient(baseURL, token, mode string) *Client {
 	return &Client{
 		httpClient: client,
 		baseURL:    baseURL,
+		retry: retryPolicy{
+			attempts:  config.RemnawaveRetryAttempts(),
+			baseDelay: config.RemnawaveRetryBaseDelay(),
+			maxDelay:  config.RemnawaveRetryMaxDelay(),
+		},
+		breaker: newBreaker(config.RemnawaveBreakerThreshold(), config.RemnawaveBreakerOpenDuration(), config.RemnawaveOutageAlertAfter()),
+		cache:   newPanelCache(config.RemnawaveCacheTTL()),
 	}
 }
 
+// OnOutage sets the function called when the panel has been unreachable for the
+// configured time and when it recovers afterwards.
+func (r *Client) OnOutage(fn OutageFunc) {
+	r.breaker.mu.Lock()
+	defer r.breaker.mu.Unlock()
+	r.breaker.onOutage = fn
+}
+
+// WatchOutage checks the breaker every interval until ctx is done, so the outage
+// alert is raised without traffic to the panel. While the panel is down it is
+// pinged, which lets the breaker probe it and notice the recovery.
+func (r *Client) WatchOutage(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.breaker.down() {
+				continue
+			}
+			if err := r.Ping(ctx); err != nil {
+				slog.Debug("remnawave outage check failed", "error", err)
+			}
+		}
+	}
+}
+
+// BreakerStatus returns the state of the circuit breaker in front of the panel.
+func (r *Client) BreakerStatus() BreakerStatus {
+	return r.breaker.status()
+}
+
 // ---------------------------------------------------------------------------
 // Generic HTTP helpers
 // ---------------------------------------------------------------------------
 
+// doRequest sends the request through the circuit breaker. Idempotent requests
+// that fail because the panel is down are sent again after a backoff.
 func (r *Client) doRequest(ctx context.Context, method, path string, body any) ([]byte, int, error) {
-	var bodyReader io.Reader
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
+		var err error
+		data, err = json.Marshal(body)
 		if err != nil {
 			return nil, 0, fmt.Errorf("marshal request body: %w", err)
 		}
+	}
+
+	attempts := r.retry.attemptsFor(method)
+	for attempt := 0; ; attempt++ {
+		if err := r.breaker.allow(); err != nil {
+			return nil, 0, err
+		}
+		respBody, status, err := r.send(ctx, method, path, data)
+		r.breaker.record(ctx, status, err)
+		if err == nil || attempt+1 >= attempts || !retryable(ctx, status, err) {
+			return respBody, status, err
+		}
+
+		delay := r.retry.backoff(attempt)
+		slog.Warn("remnawave request failed, retrying", "method", method, "status", status, "attempt", attempt+1, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return respBody, status, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (r *Client) send(ctx context.Context, method, path string, data []byte) ([]byte, int, error) {
+	var bodyReader io.Reader
+	if data != nil {
 		bodyReader = bytes.NewReader(data)
 	}
 
@@ -96,7 +175,7 @@ func (r *Client) doRequest(ctx context.Context, method, path string, body any) (
 	if err != nil {
 		return nil, 0, fmt.Errorf("create request: %w", err)
 	}
-	if body != nil {
+	if data != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
@@ -174,9 +253,34 @@ func (r *Client) GetUsers(ctx context.Context) ([]User, error) {
 }
 
 // ---------------------------------------------------------------------------
-// Users — get by Telegram ID
+// Users — get by UUID or Telegram ID
 // ---------------------------------------------------------------------------
 
+// UserRef addresses the panel user of a customer. UUID is uuid.Nil until the user is
+// created or found, it is then looked up by Telegram ID.
+type UserRef struct {
+	CustomerID int64
+	TelegramID int64
+	UUID       uuid.UUID
+}
+
+// GetUser returns the user the ref addresses, ErrNotFound when there is none.
+func (r *Client) GetUser(ctx context.Context, ref UserRef) (*User, error) {
+	if ref.UUID != uuid.Nil {
+		var resp apiResponse[User]
+		if err := r.doJSON(ctx, http.MethodGet, "/api/users/"+ref.UUID.String(), nil, &resp); err != nil {
+			return nil, err
+		}
+		return &resp.Response, nil
+	}
+
+	users, err := r.getUsersByTelegramID(ctx, ref.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	return PickUser(users, ref)
+}
+
 func (r *Client) getUsersByTelegramID(ctx context.Context, telegramID int64) ([]User, error) {
 	var resp apiResponse[[]User]
 	err := r.doJSON(ctx, http.MethodGet, "/api/users/by-telegram-id/"+strconv.FormatInt(telegramID, 10), nil, &resp)
@@ -187,15 +291,60 @@ func (r *Client) getUsersByTelegramID(ctx context.Context, telegramID int64) ([]
 }
 
 // ---------------------------------------------------------------------------
-// Internal squads
+// Squads and nodes — cached
 // ---------------------------------------------------------------------------
 
 func (r *Client) getInternalSquads(ctx context.Context) ([]internalSquadItem, error) {
-	var resp apiResponse[internalSquadsResponse]
-	if err := r.doJSON(ctx, http.MethodGet, "/api/internal-squads", nil, &resp); err != nil {
+	return r.cache.internalSquads.get(ctx, func(ctx context.Context) ([]internalSquadItem, error) {
+		var resp apiResponse[internalSquadsResponse]
+		if err := r.doJSON(ctx, http.MethodGet, "/api/internal-squads", nil, &resp); err != nil {
+			return nil, err
+		}
+		return resp.Response.InternalSquads, nil
+	})
+}
+
+func (r *Client) getExternalSquads(ctx context.Context) ([]ExternalSquad, error) {
+	return r.cache.externalSquads.get(ctx, func(ctx context.Context) ([]ExternalSquad, error) {
+		var resp apiResponse[externalSquadsResponse]
+		if err := r.doJSON(ctx, http.MethodGet, "/api/external-squads", nil, &resp); err != nil {
+			return nil, err
+		}
+		return resp.Response.ExternalSquads, nil
+	})
+}
+
+// GetNodes returns the panel's nodes. Node webhooks drop the cached list before
+// they are handled, so the connection state is current when the panel webhook is
+// set up.
+func (r *Client) GetNodes(ctx context.Context) ([]Node, error) {
+	return r.cache.nodes.get(ctx, func(ctx context.Context) ([]Node, error) {
+		var resp apiResponse[[]Node]
+		if err := r.doJSON(ctx, http.MethodGet, "/api/nodes", nil, &resp); err != nil {
+			return nil, err
+		}
+		return resp.Response, nil
+	})
+}
+
+// externalSquad returns the selected external squad when the panel has it. A
+// squad that was deleted in the panel is left out, like unknown internal squads,
+// instead of failing the request.
+func (r *Client) externalSquad(ctx context.Context, selected uuid.UUID) (*uuid.UUID, error) {
+	if selected == uuid.Nil {
+		return nil, nil
+	}
+	squads, err := r.getExternalSquads(ctx)
+	if err != nil {
 		return nil, err
 	}
-	return resp.Response.InternalSquads, nil
+	for _, s := range squads {
+		if s.UUID == selected {
+			return &selected, nil
+		}
+	}
+	slog.Warn("external squad not found in panel", "squad_uuid", selected)
+	return nil, nil
 }
 
 func filterSquadsBySelection(allSquads []internalSquadItem, selected map[uuid.UUID]uuid.UUID) []uuid.UUID {
@@ -219,54 +368,122 @@ func filterSquadsBySelection(allSquads []internalSquadItem, selected map[uuid.UU
 // DecreaseSubscription
 // ---------------------------------------------------------------------------
 
-func (r *Client) DecreaseSubscription(ctx context.Context, telegramId int64, trafficLimit int, days int) (*time.Time, error) {
-	users, err := r.getUsersByTelegramID(ctx, telegramId)
+// DecreaseSubscription shortens the user's subscription by days, which are negative.
+func (r *Client) DecreaseSubscription(ctx context.Context, ref UserRef, days int) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("find user with telegramId %d: %w", ref.TelegramID, err)
 	}
-	if len(users) == 0 {
-		return nil, fmt.Errorf("user with telegramId %d not found", telegramId)
+	return r.updateUser(ctx, existingUser, nil, ExtendExpire(days, existingUser.ExpireAt))
+}
+
+// SetExpire sets the user's expiry without changing its access. It returns
+// ErrNotFound when the user does not exist.
+func (r *Client) SetExpire(ctx context.Context, ref UserRef, expireAt time.Time) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
+	if err != nil {
+		return nil, err
 	}
+	return r.updateUser(ctx, existingUser, nil, expireAt)
+}
 
-	existingUser := findUserBySuffix(users, telegramId)
+// ---------------------------------------------------------------------------
+// RevokeSubscription
+// ---------------------------------------------------------------------------
 
-	updated, err := r.updateUser(ctx, existingUser, trafficLimit, days)
+// RevokeSubscription gives the user a new subscription link. The old link stops
+// working.
+func (r *Client) RevokeSubscription(ctx context.Context, ref UserRef) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
 	if err != nil {
 		return nil, err
 	}
 
-	return &updated.ExpireAt, nil
+	var resp apiResponse[User]
+	if err := r.doJSON(ctx, http.MethodPost, "/api/users/"+existingUser.UUID.String()+"/actions/revoke", struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	slog.Info("revoked user subscription", "telegramId", utils.MaskHalf(strconv.FormatInt(ref.TelegramID, 10)))
+	return &resp.Response, nil
 }
 
 // ---------------------------------------------------------------------------
 // CreateOrUpdateUser
 // ---------------------------------------------------------------------------
 
-func (r *Client) CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, days int, isTrialUser bool) (*User, error) {
-	users, err := r.getUsersByTelegramID(ctx, telegramId)
+// CreateOrUpdateUser extends the user's subscription by days and applies access.
+// With nil access new users get the default (or trial) access and existing users
+// keep theirs. A user deleted in the panel is created again.
+func (r *Client) CreateOrUpdateUser(ctx context.Context, ref UserRef, access *Access, days int, isTrialUser bool) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
+	if errors.Is(err, ErrNotFound) {
+		if access == nil {
+			access = DefaultAccess()
+			if isTrialUser {
+				access = TrialAccess()
+			}
+		}
+		return r.createUser(ctx, ref.CustomerID, ref.TelegramID, access, time.Now().UTC().AddDate(0, 0, days), isTrialUser)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if len(users) == 0 {
-		return r.createUser(ctx, customerId, telegramId, trafficLimit, days, isTrialUser)
-	}
+	return r.updateUser(ctx, existingUser, access, ExtendExpire(days, existingUser.ExpireAt))
+}
 
-	existingUser := findUserBySuffix(users, telegramId)
-	return r.updateUser(ctx, existingUser, trafficLimit, days)
+// SetSubscription creates or updates the user so that the subscription ends at
+// expireAt. Unlike CreateOrUpdateUser it sets an absolute expiry, so sending it
+// again after a failure does not extend the subscription twice.
+func (r *Client) SetSubscription(ctx context.Context, ref UserRef, access *Access, expireAt time.Time) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
+	if errors.Is(err, ErrNotFound) {
+		if access == nil {
+			access = DefaultAccess()
+		}
+		return r.createUser(ctx, ref.CustomerID, ref.TelegramID, access, expireAt, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.updateUser(ctx, existingUser, access, expireAt)
 }
 
 // ---------------------------------------------------------------------------
 // Internal helpers
 // ---------------------------------------------------------------------------
 
-func findUserBySuffix(users []User, telegramId int64) *User {
-	suffix := fmt.Sprintf("_%d", telegramId)
+// PickUser picks the customer's user among the panel users of its Telegram ID: the
+// one with the stored UUID, the one the bot created for the customer, one the bot
+// created for the Telegram ID, or the only one. It returns ErrNotFound when there
+// are no users and ErrAmbiguousUser when several users remain.
+func PickUser(users []User, ref UserRef) (*User, error) {
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+
+	for i := range users {
+		if ref.UUID != uuid.Nil && users[i].UUID == ref.UUID {
+			return &users[i], nil
+		}
+	}
+	if ref.CustomerID != 0 {
+		username := generateUsername(ref.CustomerID, ref.TelegramID)
+		for i := range users {
+			if users[i].Username == username {
+				return &users[i], nil
+			}
+		}
+	}
+	suffix := fmt.Sprintf("_%d", ref.TelegramID)
 	for i := range users {
-		if strings.Contains(users[i].Username, suffix) {
-			return &users[i]
+		if strings.HasSuffix(users[i].Username, suffix) {
+			return &users[i], nil
 		}
 	}
-	return &users[0]
+	if len(users) == 1 {
+		return &users[0], nil
+	}
+	return nil, fmt.Errorf("%w: %d users for telegramId %d", ErrAmbiguousUser, len(users), ref.TelegramID)
 }
 
 // UsernameFromCtx extracts the Telegram username stored under CtxKeyUsername.
@@ -278,29 +495,25 @@ func UsernameFromCtx(ctx context.Context) string {
 	return ""
 }
 
-func (r *Client) updateUser(ctx context.Context, existingUser *User, trafficLimit int, days int) (*User, error) {
-	newExpire := getNewExpire(days, existingUser.ExpireAt)
-
-	squads, err := r.getInternalSquads(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	selectedSquads := config.SquadUUIDs()
-	squadIds := filterSquadsBySelection(squads, selectedSquads)
-
+func (r *Client) updateUser(ctx context.Context, existingUser *User, access *Access, newExpire time.Time) (*User, error) {
 	userUpdate := &UpdateUserRequest{
-		UUID:                 &existingUser.UUID,
-		ExpireAt:             &newExpire,
-		Status:               "ACTIVE",
-		TrafficLimitBytes:    &trafficLimit,
-		ActiveInternalSquads: squadIds,
-		TrafficLimitStrategy: normalizeStrategy(config.TrafficLimitResetStrategy()),
+		UUID:     &existingUser.UUID,
+		ExpireAt: &newExpire,
+		Status:   "ACTIVE",
 	}
 
-	externalSquad := config.ExternalSquadUUID()
-	if externalSquad != uuid.Nil {
-		userUpdate.ExternalSquadUuid = &externalSquad
+	if access != nil {
+		squads, err := r.getInternalSquads(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		userUpdate.TrafficLimitBytes = &access.TrafficLimit
+		userUpdate.ActiveInternalSquads = filterSquadsBySelection(squads, access.InternalSquads)
+		userUpdate.TrafficLimitStrategy = normalizeStrategy(access.TrafficLimitStrategy)
+		if userUpdate.ExternalSquadUuid, err = r.externalSquad(ctx, access.ExternalSquad); err != nil {
+			return nil, err
+		}
 	}
 
 	tag := config.RemnawaveTag()
@@ -322,33 +535,21 @@ func (r *Client) updateUser(ctx context.Context, existingUser *User, trafficLimi
 	if existingUser.TelegramID != nil {
 		tgid = strconv.FormatInt(*existingUser.TelegramID, 10)
 	}
-	slog.Info("updated user", "telegramId", utils.MaskHalf(tgid), "username", utils.MaskHalf(username), "days", days)
+	slog.Info("updated user", "telegramId", utils.MaskHalf(tgid), "username", utils.MaskHalf(username), "expire_at", newExpire)
 	return &resp.Response, nil
 }
 
-func (r *Client) createUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, days int, isTrialUser bool) (*User, error) {
-	expireAt := time.Now().UTC().AddDate(0, 0, days)
+func (r *Client) createUser(ctx context.Context, customerId int64, telegramId int64, access *Access, expireAt time.Time, isTrialUser bool) (*User, error) {
 	username := generateUsername(customerId, telegramId)
 
 	squads, err := r.getInternalSquads(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	selectedSquads := config.SquadUUIDs()
-	if isTrialUser {
-		selectedSquads = config.TrialInternalSquads()
-	}
-	squadIds := filterSquadsBySelection(squads, selectedSquads)
-
-	externalSquad := config.ExternalSquadUUID()
-	if isTrialUser {
-		externalSquad = config.TrialExternalSquadUUID()
-	}
-
-	strategy := config.TrafficLimitResetStrategy()
-	if isTrialUser {
-		strategy = config.TrialTrafficLimitResetStrategy()
+	squadIds := filterSquadsBySelection(squads, access.InternalSquads)
+	externalSquad, err := r.externalSquad(ctx, access.ExternalSquad)
+	if err != nil {
+		return nil, err
 	}
 
 	tid := int(telegramId)
@@ -358,11 +559,9 @@ func (r *Client) createUser(ctx context.Context, customerId int64, telegramId in
 		Status:               "ACTIVE",
 		TelegramID:           &tid,
 		ExpireAt:             expireAt,
-		TrafficLimitStrategy: normalizeStrategy(strategy),
-		TrafficLimitBytes:    &trafficLimit,
-	}
-	if externalSquad != uuid.Nil {
-		createReq.ExternalSquadUuid = &externalSquad
+		TrafficLimitStrategy: normalizeStrategy(access.TrafficLimitStrategy),
+		TrafficLimitBytes:    &access.TrafficLimit,
+		ExternalSquadUuid:    externalSquad,
 	}
 	tag := config.RemnawaveTag()
 	if isTrialUser {
@@ -381,7 +580,7 @@ func (r *Client) createUser(ctx context.Context, customerId int64, telegramId in
 	if err := r.doJSON(ctx, http.MethodPost, "/api/users", createReq, &resp); err != nil {
 		return nil, err
 	}
-	slog.Info("created user", "telegramId", utils.MaskHalf(strconv.FormatInt(telegramId, 10)), "username", utils.MaskHalf(tgUsername), "days", days)
+	slog.Info("created user", "telegramId", utils.MaskHalf(strconv.FormatInt(telegramId, 10)), "username", utils.MaskHalf(tgUsername), "expire_at", expireAt)
 	return &resp.Response, nil
 }
 
@@ -393,7 +592,9 @@ func generateUsername(customerId int64, telegramId int64) string {
 	return fmt.Sprintf("%d_%d", customerId, telegramId)
 }
 
-func getNewExpire(daysToAdd int, currentExpire time.Time) time.Time {
+// ExtendExpire returns currentExpire moved by daysToAdd, counting from now when the
+// subscription has already ended.
+func ExtendExpire(daysToAdd int, currentExpire time.Time) time.Time {
 	if daysToAdd <= 0 {
 		if currentExpire.AddDate(0, 0, daysToAdd).Before(time.Now()) {
 			return time.Now().UTC().AddDate(0, 0, 1)
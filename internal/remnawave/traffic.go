@@ -0,0 +1,128 @@
+package remnawave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ErrUnlimitedTraffic is returned when the traffic limit of a user without one is
+// changed.
+var ErrUnlimitedTraffic = errors.New("user has unlimited traffic")
+
+// AddTrafficLimit changes the user's traffic limit by bytes, which may be negative.
+// The expiry, status and squads of the user are left as they are.
+func (r *Client) AddTrafficLimit(ctx context.Context, ref UserRef, bytes int) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser.TrafficLimitBytes == 0 {
+		return nil, ErrUnlimitedTraffic
+	}
+
+	limit := existingUser.TrafficLimitBytes + bytes
+	if limit <= 0 {
+		return nil, fmt.Errorf("traffic limit %d cannot be lowered by %d", existingUser.TrafficLimitBytes, -bytes)
+	}
+
+	var resp apiResponse[User]
+	if err := r.doJSON(ctx, http.MethodPatch, "/api/users", &UpdateUserRequest{
+		UUID:              &existingUser.UUID,
+		TrafficLimitBytes: &limit,
+	}, &resp); err != nil {
+		return nil, err
+	}
+
+	slog.Info("updated user traffic limit", "telegramId", utils.MaskHalf(strconv.FormatInt(ref.TelegramID, 10)), "bytes", bytes)
+	return &resp.Response, nil
+}
+
+// SetTrafficLimit sets the user's traffic limit to limit bytes. The limit is
+// absolute, so sending it again after a failure changes nothing.
+func (r *Client) SetTrafficLimit(ctx context.Context, ref UserRef, limit int) (*User, error) {
+	existingUser, err := r.GetUser(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp apiResponse[User]
+	if err := r.doJSON(ctx, http.MethodPatch, "/api/users", &UpdateUserRequest{
+		UUID:              &existingUser.UUID,
+		TrafficLimitBytes: &limit,
+	}, &resp); err != nil {
+		return nil, err
+	}
+
+	slog.Info("set user traffic limit", "telegramId", utils.MaskHalf(strconv.FormatInt(ref.TelegramID, 10)), "limit", limit)
+	return &resp.Response, nil
+}
+
+// onlineWindow is how recently a user must have been connected to count as online.
+const onlineWindow = 5 * time.Minute
+
+// Usage is the traffic a user consumed since the last reset.
+type Usage struct {
+	UserUUID  uuid.UUID
+	UsedBytes int64
+	// LimitBytes is zero for users with unlimited traffic.
+	LimitBytes  int64
+	Strategy    string
+	LastResetAt *time.Time
+	OnlineAt    *time.Time
+	Online      bool
+}
+
+// NextResetAt returns when the used traffic is reset next, false when it is never
+// reset.
+func (u *Usage) NextResetAt(now time.Time) (time.Time, bool) {
+	return NextTrafficReset(u.Strategy, now)
+}
+
+// GetUsage returns the user's traffic usage, ErrNotFound when there is no user.
+func (r *Client) GetUsage(ctx context.Context, ref UserRef) (*Usage, error) {
+	user, err := r.GetUser(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	onlineAt := user.UserTraffic.OnlineAt
+	return &Usage{
+		UserUUID:    user.UUID,
+		UsedBytes:   user.UserTraffic.UsedTrafficBytes,
+		LimitBytes:  int64(user.TrafficLimitBytes),
+		Strategy:    user.TrafficLimitStrategy,
+		LastResetAt: user.LastTrafficResetAt,
+		OnlineAt:    onlineAt,
+		Online:      onlineAt != nil && time.Since(*onlineAt) < onlineWindow,
+	}, nil
+}
+
+// NextTrafficReset returns when Remnawave next resets the used traffic of users
+// with the given strategy: daily, on Mondays or on the first day of the month, at
+// midnight UTC. It reports false for NO_RESET.
+func NextTrafficReset(strategy string, now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch normalizeStrategy(strategy) {
+	case "DAY":
+		return midnight.AddDate(0, 0, 1), true
+	case "WEEK":
+		daysToMonday := (8 - int(midnight.Weekday())) % 7
+		if daysToMonday == 0 {
+			daysToMonday = 7
+		}
+		return midnight.AddDate(0, 0, daysToMonday), true
+	case "MONTH":
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC), true
+	default:
+		return time.Time{}, false
+	}
+}
@@ -8,13 +8,23 @@ import (
 
 // User represents a Remnawave user.
 type User struct {
-	UUID              uuid.UUID `json:"uuid"`
-	Username          string    `json:"username"`
-	SubscriptionUrl   string    `json:"subscriptionUrl"`
-	ExpireAt          time.Time `json:"expireAt"`
-	TelegramID        *int64    `json:"telegramId"`
-	Status            string    `json:"status"`
-	TrafficLimitBytes int       `json:"trafficLimitBytes"`
+	UUID                 uuid.UUID   `json:"uuid"`
+	Username             string      `json:"username"`
+	SubscriptionUrl      string      `json:"subscriptionUrl"`
+	ExpireAt             time.Time   `json:"expireAt"`
+	TelegramID           *int64      `json:"telegramId"`
+	Status               string      `json:"status"`
+	TrafficLimitBytes    int         `json:"trafficLimitBytes"`
+	TrafficLimitStrategy string      `json:"trafficLimitStrategy"`
+	LastTrafficResetAt   *time.Time  `json:"lastTrafficResetAt"`
+	UserTraffic          UserTraffic `json:"userTraffic"`
+}
+
+// UserTraffic is the traffic a user consumed and when it was last connected.
+type UserTraffic struct {
+	UsedTrafficBytes         int64      `json:"usedTrafficBytes"`
+	LifetimeUsedTrafficBytes int64      `json:"lifetimeUsedTrafficBytes"`
+	OnlineAt                 *time.Time `json:"onlineAt"`
 }
 
 // getAllUsersResponse is the raw API response for GET /api/users.
@@ -36,6 +46,26 @@ type apiErrorResponse struct {
 	ErrorCode string `json:"errorCode"`
 }
 
+// ExternalSquad is a panel external squad.
+type ExternalSquad struct {
+	UUID uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+}
+
+// externalSquadsResponse is the response body for GET /api/external-squads.
+type externalSquadsResponse struct {
+	ExternalSquads []ExternalSquad `json:"externalSquads"`
+}
+
+// Node is a panel node.
+type Node struct {
+	UUID        uuid.UUID `json:"uuid"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	IsConnected bool      `json:"isConnected"`
+	IsDisabled  bool      `json:"isDisabled"`
+}
+
 // internalSquadItem is a single squad in the internal squads response.
 type internalSquadItem struct {
 	UUID uuid.UUID `json:"uuid"`
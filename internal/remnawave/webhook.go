@@ -0,0 +1,136 @@
+package remnawave
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/webhook"
+)
+
+// Events the panel sends to the webhook.
+const (
+	EventUserModified           = "user.modified"
+	EventUserDeleted            = "user.deleted"
+	EventUserRevoked            = "user.revoked"
+	EventUserDisabled           = "user.disabled"
+	EventUserEnabled            = "user.enabled"
+	EventUserLimited            = "user.limited"
+	EventUserExpired            = "user.expired"
+	EventNodeConnectionLost     = "node.connection_lost"
+	EventNodeConnectionRestored = "node.connection_restored"
+)
+
+const signatureHeader = "X-Remnawave-Signature"
+
+// WebhookEvent is a notification the panel sends about a user or a node.
+type WebhookEvent struct {
+	Event     string          `json:"event"`
+	Timestamp string          `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// EventHandler reacts to the panel's webhook events.
+type EventHandler interface {
+	HandleUserEvent(ctx context.Context, event string, user *User) error
+	HandleNodeEvent(ctx context.Context, event string, node *Node) error
+}
+
+// WebhookHandler returns the handler for panel webhooks. Requests must be signed
+// with an HMAC-SHA256 of the body keyed by secret. Node and squad events also drop
+// the cached node and squad lists.
+func (r *Client) WebhookHandler(secret string, events EventHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second*30)
+		defer cancel()
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			slog.Error("remnawave webhook: read body error", "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		defer req.Body.Close()
+
+		valid := VerifyWebhookSignature(body, req.Header.Get(signatureHeader), secret)
+		webhook.MarkSignature(ctx, valid)
+		if !valid {
+			slog.Warn("remnawave webhook: invalid signature", "remote_addr", req.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			slog.Error("remnawave webhook: unmarshal error", "error", err)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(event.Event, "user."):
+			var user User
+			if err := json.Unmarshal(event.Data, &user); err != nil {
+				slog.Error("remnawave webhook: unmarshal user error", "event", event.Event, "error", err)
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			err = events.HandleUserEvent(ctx, event.Event, &user)
+		case strings.HasPrefix(event.Event, "node."):
+			r.cache.nodes.invalidate()
+			var node Node
+			if err := json.Unmarshal(event.Data, &node); err != nil {
+				slog.Error("remnawave webhook: unmarshal node error", "event", event.Event, "error", err)
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			err = events.HandleNodeEvent(ctx, event.Event, &node)
+		case strings.HasPrefix(event.Event, "internal_squad."), strings.HasPrefix(event.Event, "external_squad."):
+			r.cache.internalSquads.invalidate()
+			r.cache.externalSquads.invalidate()
+			slog.Info("remnawave webhook: squads changed", "event", event.Event)
+		default:
+			slog.Debug("remnawave webhook: event ignored", "event", event.Event)
+		}
+		if err != nil {
+			slog.Error("remnawave webhook: handle event error", "event", event.Event, "error", err)
+			webhook.RecordError(ctx, err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// VerifyWebhookSignature reports whether signature is the hex HMAC-SHA256 of body
+// keyed by secret.
+func VerifyWebhookSignature(body []byte, signature, secret string) bool {
+	if signature == "" || secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// WebhookEventID identifies a panel event by its name, timestamp and subject.
+func WebhookEventID(body []byte) string {
+	var event struct {
+		Event     string `json:"event"`
+		Timestamp string `json:"timestamp"`
+		Data      struct {
+			UUID string `json:"uuid"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.Event == "" || event.Timestamp == "" {
+		return ""
+	}
+	return event.Event + ":" + event.Data.UUID + ":" + event.Timestamp
+}
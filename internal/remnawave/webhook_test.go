@@ -0,0 +1,54 @@
+package remnawave
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type eventHandlerMock struct{}
+
+func (eventHandlerMock) HandleUserEvent(ctx context.Context, event string, user *User) error {
+	return nil
+}
+
+func (eventHandlerMock) HandleNodeEvent(ctx context.Context, event string, node *Node) error {
+	return nil
+}
+
+func TestWebhookHandlerDropsCachedSquadsAndNodes(t *testing.T) {
+	ctx := context.Background()
+	for _, event := range []string{"internal_squad.updated", "external_squad.deleted", EventNodeConnectionLost} {
+		r := &Client{cache: newPanelCache(time.Hour)}
+		r.cache.internalSquads.get(ctx, func(context.Context) ([]internalSquadItem, error) { return nil, nil })
+		r.cache.externalSquads.get(ctx, func(context.Context) ([]ExternalSquad, error) { return nil, nil })
+		r.cache.nodes.get(ctx, func(context.Context) ([]Node, error) { return nil, nil })
+
+		body := `{"event":"` + event + `","timestamp":"2026-01-01T00:00:00Z","data":{}}`
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(signatureHeader, hex.EncodeToString(mac.Sum(nil)))
+		rec := httptest.NewRecorder()
+		r.WebhookHandler("secret", eventHandlerMock{}).ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", event, rec.Code)
+		}
+
+		squadsDropped := !r.cache.internalSquads.valid && !r.cache.externalSquads.valid
+		nodesDropped := !r.cache.nodes.valid
+		if strings.HasPrefix(event, "node.") {
+			if !nodesDropped || squadsDropped {
+				t.Fatalf("%s: expected only the nodes to be dropped", event)
+			}
+		} else if !squadsDropped || nodesDropped {
+			t.Fatalf("%s: expected only the squads to be dropped", event)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"log/slog"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+
+	"github.com/google/uuid"
 )
 
 type SyncService struct {
@@ -22,8 +25,7 @@ func (s SyncService) Sync() {
 	slog.Info("Starting sync")
 	ctx := context.Background()
 	var telegramIDs []int64
-	telegramIDsSet := make(map[int64]int64)
-	var mappedUsers []database.Customer
+	usersByTelegramID := make(map[int64][]remnawave.User)
 	users, err := s.client.GetUsers(ctx)
 	if err != nil {
 		slog.Error("Error while getting users from remnawave", "error", err)
@@ -39,19 +41,10 @@ func (s SyncService) Sync() {
 			continue
 		}
 		tid := *user.TelegramID
-		if _, exists := telegramIDsSet[tid]; exists {
-			continue
+		if _, exists := usersByTelegramID[tid]; !exists {
+			telegramIDs = append(telegramIDs, tid)
 		}
-
-		telegramIDsSet[tid] = tid
-
-		telegramIDs = append(telegramIDs, tid)
-
-		mappedUsers = append(mappedUsers, database.Customer{
-			TelegramID:       tid,
-			ExpireAt:         &user.ExpireAt,
-			SubscriptionLink: &user.SubscriptionUrl,
-		})
+		usersByTelegramID[tid] = append(usersByTelegramID[tid], user)
 	}
 
 	existingCustomers, err := s.customerRepository.FindByTelegramIds(ctx, telegramIDs)
@@ -67,8 +60,35 @@ func (s SyncService) Sync() {
 	var toCreate []database.Customer
 	var toUpdate []database.Customer
 
-	for _, cust := range mappedUsers {
-		if existing, found := existingMap[cust.TelegramID]; found {
+	for _, tid := range telegramIDs {
+		ref := remnawave.UserRef{TelegramID: tid}
+		existing, found := existingMap[tid]
+		if found {
+			ref.CustomerID = existing.ID
+			if existing.RemnawaveUUID != nil {
+				ref.UUID = *existing.RemnawaveUUID
+			}
+		}
+
+		candidates := usersByTelegramID[tid]
+		user, err := remnawave.PickUser(candidates, ref)
+		if err != nil {
+			// Keep the customer, but leave its UUID unset until an admin resolves the
+			// duplicate panel users.
+			slog.Warn("Several panel users for customer", "telegram_id", utils.MaskHalfInt64(tid), "count", len(candidates))
+			user = &remnawave.User{ExpireAt: candidates[0].ExpireAt, SubscriptionUrl: candidates[0].SubscriptionUrl}
+		}
+
+		cust := database.Customer{
+			TelegramID:       tid,
+			ExpireAt:         &user.ExpireAt,
+			SubscriptionLink: &user.SubscriptionUrl,
+		}
+		if user.UUID != uuid.Nil {
+			cust.RemnawaveUUID = &user.UUID
+		}
+
+		if found {
 			cust.ID = existing.ID
 			cust.CreatedAt = existing.CreatedAt
 			cust.Language = existing.Language
@@ -0,0 +1,94 @@
+package tribute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+)
+
+// Provider records Tribute subscriptions. Customers pay in the Tribute app and the
+// purchase is created from the webhook, so there is no invoice to issue.
+type Provider struct {
+	customerRepository *database.CustomerRepository
+}
+
+var (
+	_ payment.WebhookProvider = (*Provider)(nil)
+	_ payment.LinkProvider    = (*Provider)(nil)
+)
+
+func NewProvider(customerRepository *database.CustomerRepository) *Provider {
+	return &Provider{customerRepository: customerRepository}
+}
+
+func (p *Provider) InvoiceType() database.InvoiceType {
+	return database.InvoiceTypeTribute
+}
+
+func (p *Provider) ButtonKey() string {
+	return "tribute_button"
+}
+
+func (p *Provider) IsEnabled() bool {
+	return config.GetTributeWebHookUrl() != ""
+}
+
+func (p *Provider) Currency() string {
+	return "RUB"
+}
+
+func (p *Provider) InvoiceTTL() time.Duration {
+	return 0
+}
+
+func (p *Provider) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*payment.Invoice, error) {
+	return &payment.Invoice{}, nil
+}
+
+func (p *Provider) FetchStatus(ctx context.Context, purchase *database.Purchase) (*payment.Transaction, error) {
+	return nil, payment.ErrNotSupported
+}
+
+func (p *Provider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	return payment.ErrNotSupported
+}
+
+func (p *Provider) Refund(ctx context.Context, purchase *database.Purchase) error {
+	return payment.ErrNotSupported
+}
+
+func (p *Provider) CheckoutURL() string {
+	return config.GetTributePaymentUrl()
+}
+
+func (p *Provider) WebhookName() string {
+	return "tribute"
+}
+
+func (p *Provider) WebhookPath() string {
+	return config.GetTributeWebHookUrl()
+}
+
+// WebhookEventID identifies an event by its name, subscriber and creation time, the
+// webhook carries no event id.
+func (p *Provider) WebhookEventID(body []byte) string {
+	var wh SubscriptionWebhook
+	if err := json.Unmarshal(body, &wh); err != nil || wh.Name == TestHook {
+		return ""
+	}
+	return eventID(wh)
+}
+
+func eventID(wh SubscriptionWebhook) string {
+	return fmt.Sprintf("%s:%d:%d:%d", wh.Name, wh.Payload.SubscriptionID, wh.Payload.TelegramUserID, wh.CreatedAt.UnixNano())
+}
+
+func (p *Provider) WebhookHandler(service *payment.PaymentService) http.Handler {
+	return NewClient(service, p.customerRepository).WebHookHandler()
+}
@@ -9,12 +9,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"log/slog"
 	"net/http"
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/webhook"
 	"strings"
 	"time"
 )
@@ -60,8 +60,10 @@ func (c *Client) WebHookHandler() http.Handler {
 		mac.Write(body)
 		expected := hex.EncodeToString(mac.Sum(nil))
 
-		if !hmac.Equal([]byte(expected), []byte(signature)) {
-			log.Printf("webhook: bad signature (expected %s)", expected)
+		valid := hmac.Equal([]byte(expected), []byte(signature))
+		webhook.MarkSignature(ctx, valid)
+		if !valid {
+			slog.Warn("tribute webhook: invalid signature", "remote_addr", r.RemoteAddr)
 			http.Error(w, "invalid signature", http.StatusUnauthorized)
 			return
 		}
@@ -78,6 +80,7 @@ func (c *Client) WebHookHandler() http.Handler {
 			err := c.newSubscriptionHandler(ctx, wh)
 			if err != nil {
 				slog.Error("webhook: new subscription error", "error", err, "payload", string(body))
+				webhook.RecordError(ctx, err)
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 				return
 			}
@@ -90,6 +93,7 @@ func (c *Client) WebHookHandler() http.Handler {
 			}
 			if err != nil {
 				slog.Error("webhook: cancel subscription error", "error", err, "payload", string(body))
+				webhook.RecordError(ctx, err)
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 				return
 			}
@@ -101,10 +105,22 @@ func (c *Client) WebHookHandler() http.Handler {
 }
 
 func (c *Client) cancelSubscriptionHandler(ctx context.Context, wh SubscriptionWebhook) error {
-	return c.paymentService.CancelTributePurchase(ctx, wh.Payload.TelegramUserID)
+	return c.paymentService.CancelTributePurchase(ctx, wh.Payload.TelegramUserID, wh.CreatedAt)
 }
 
+// newSubscriptionHandler creates and pays the purchase for the event. A retried or
+// replayed event pays the purchase it created before instead of a new one.
 func (c *Client) newSubscriptionHandler(ctx context.Context, wh SubscriptionWebhook) error {
+	eventID := eventID(wh)
+	purchase, err := c.paymentService.FindTributePurchase(ctx, eventID)
+	if err != nil {
+		return err
+	}
+	if purchase != nil {
+		webhook.LinkPurchase(ctx, purchase.ID)
+		return c.paymentService.ProcessPurchaseById(ctx, purchase.ID)
+	}
+
 	months := convertPeriodToMonths(wh.Payload.Period)
 
 	customer, err := c.customerRepository.FindByTelegramId(ctx, wh.Payload.TelegramUserID)
@@ -115,10 +131,11 @@ func (c *Client) newSubscriptionHandler(ctx context.Context, wh SubscriptionWebh
 		return fmt.Errorf("customer not found for telegram_id: %d", wh.Payload.TelegramUserID)
 	}
 
-	_, purchaseId, err := c.paymentService.CreatePurchase(ctx, float64(wh.Payload.Amount), months, customer, database.InvoiceTypeTribute)
+	_, purchaseId, err := c.paymentService.CreatePurchase(ctx, float64(wh.Payload.Amount), months, customer, database.InvoiceTypeTribute, payment.PaidInCurrency(wh.Payload.Currency), payment.ForTributeEvent(eventID))
 	if err != nil {
 		return err
 	}
+	webhook.LinkPurchase(ctx, purchaseId)
 
 	err = c.paymentService.ProcessPurchaseById(ctx, purchaseId)
 	if err != nil {
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+const failedEventsLimit = 50
+
+type eventView struct {
+	ID             int64                       `json:"id"`
+	Provider       string                      `json:"provider"`
+	Status         database.WebhookEventStatus `json:"status"`
+	ResponseCode   *int                        `json:"response_code"`
+	SignatureValid *bool                       `json:"signature_valid"`
+	PurchaseID     *int64                      `json:"purchase_id"`
+	Error          *string                     `json:"error"`
+	Attempts       int                         `json:"attempts"`
+	Body           string                      `json:"body"`
+	CreatedAt      time.Time                   `json:"created_at"`
+	UpdatedAt      time.Time                   `json:"updated_at"`
+}
+
+func newEventView(e database.WebhookEvent) eventView {
+	return eventView{
+		ID:             e.ID,
+		Provider:       e.Provider,
+		Status:         e.Status,
+		ResponseCode:   e.ResponseCode,
+		SignatureValid: e.SignatureValid,
+		PurchaseID:     e.PurchaseID,
+		Error:          e.Error,
+		Attempts:       e.Attempts,
+		Body:           e.Body,
+		CreatedAt:      e.CreatedAt,
+		UpdatedAt:      e.UpdatedAt,
+	}
+}
+
+// RegisterAPI mounts the admin API for webhook events, authorized by a bearer token:
+//
+//	GET  /admin/webhooks              lists failed events
+//	POST /admin/webhooks/{id}/replay  replays an event
+func (rec *Recorder) RegisterAPI(mux *http.ServeMux, token string) {
+	mux.Handle("GET /admin/webhooks", authorized(token, http.HandlerFunc(rec.listFailed)))
+	mux.Handle("POST /admin/webhooks/{id}/replay", authorized(token, http.HandlerFunc(rec.replay)))
+}
+
+func authorized(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !EqualSecret(r.Header.Get("Authorization"), "Bearer "+token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rec *Recorder) listFailed(w http.ResponseWriter, r *http.Request) {
+	events, err := rec.Failed(r.Context(), failedEventsLimit)
+	if err != nil {
+		slog.Error("webhook api: find failed events", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]eventView, 0, len(events))
+	for _, e := range events {
+		views = append(views, newEventView(e))
+	}
+	writeJSON(w, views)
+}
+
+func (rec *Recorder) replay(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	e, err := rec.Replay(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrEventNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrSignatureRejected), errors.Is(err, ErrUnknownProvider), errors.Is(err, ErrEventNotFailed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		slog.Error("webhook api: replay event", "event_id", id, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	default:
+		writeJSON(w, newEventView(*e))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("webhook api: write response", "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import "context"
+
+type eventKey struct{}
+
+type eventIDKey struct{}
+
+// event collects what a handler learns about the request it serves.
+type event struct {
+	signatureValid *bool
+	purchaseID     *int64
+	err            error
+	replayed       bool
+}
+
+func withEvent(ctx context.Context, e *event) context.Context {
+	return context.WithValue(ctx, eventKey{}, e)
+}
+
+func eventFromContext(ctx context.Context) *event {
+	e, _ := ctx.Value(eventKey{}).(*event)
+	return e
+}
+
+// MarkSignature records whether the request passed the provider's signature or
+// credentials check.
+func MarkSignature(ctx context.Context, valid bool) {
+	if e := eventFromContext(ctx); e != nil {
+		e.signatureValid = &valid
+	}
+}
+
+// LinkPurchase records the purchase the request is about.
+func LinkPurchase(ctx context.Context, purchaseID int64) {
+	if e := eventFromContext(ctx); e != nil {
+		e.purchaseID = &purchaseID
+	}
+}
+
+// RecordError records why the request failed, the response only carries a
+// generic message.
+func RecordError(ctx context.Context, err error) {
+	if e := eventFromContext(ctx); e != nil {
+		e.err = err
+	}
+}
+
+// Replayed tells whether the request is a stored event replayed by the admin. Its
+// signature was checked when it was received, and headers carrying secrets were
+// not stored.
+func Replayed(ctx context.Context) bool {
+	e := eventFromContext(ctx)
+	return e != nil && e.replayed
+}
+
+// withEventID records the provider's id of the event the request delivers, so the
+// recorder can drop the event when it was handled before.
+func withEventID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, eventIDKey{}, id)
+}
+
+func eventIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(eventIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Policy is what the guard checks for a provider's webhook.
+type Policy struct {
+	// AllowedIPs are the networks the provider calls from. Empty allows any address.
+	AllowedIPs []netip.Prefix
+	// EventID identifies the event a request delivers, empty when it has none.
+	EventID func(body []byte) string
+}
+
+// Guard rejects webhook requests from unknown addresses or with oversized bodies and
+// identifies the event a request delivers, so the Recorder can drop events that
+// were already handled.
+type Guard struct {
+	trustedProxies []netip.Prefix
+	maxBodySize    int64
+}
+
+func NewGuard(trustedProxies []netip.Prefix, maxBodySize int64) *Guard {
+	return &Guard{
+		trustedProxies: trustedProxies,
+		maxBodySize:    maxBodySize,
+	}
+}
+
+// Handle wraps the provider's webhook handler with the checks of the policy. Events
+// replayed by the admin skip the checks.
+func (g *Guard) Handle(provider string, policy Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Replayed(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := g.clientIP(r)
+		if len(policy.AllowedIPs) > 0 && !contains(policy.AllowedIPs, ip) {
+			slog.Warn("webhook: address not allowed", "provider", provider, "ip", ip, "remote_addr", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, g.maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				slog.Warn("webhook: body too large", "provider", provider, "limit", g.maxBodySize)
+				http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			slog.Error("webhook: read body error", "provider", provider, "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if policy.EventID != nil {
+			if id := policy.EventID(body); id != "" {
+				r = r.WithContext(withEventID(r.Context(), id))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the caller's address. Behind a trusted proxy it is the last
+// X-Forwarded-For entry not added by a trusted proxy.
+func (g *Guard) clientIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip = ip.Unmap()
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && contains(g.trustedProxies, ip); i-- {
+		next, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		ip = next.Unmap()
+	}
+	return ip
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// EqualSecret compares a received secret with the expected one in constant time.
+func EqualSecret(received, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(received), []byte(expected)) == 1
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func prefixes(values ...string) []netip.Prefix {
+	var result []netip.Prefix
+	for _, v := range values {
+		result = append(result, netip.MustParsePrefix(v))
+	}
+	return result
+}
+
+func serve(h http.Handler, remoteAddr, forwardedFor, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestGuard_AllowList(t *testing.T) {
+	g := NewGuard(prefixes("10.0.0.0/8"), 1024)
+	h := g.Handle("yookassa", Policy{AllowedIPs: prefixes("185.71.76.0/27")}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         int
+	}{
+		{"allowed address", "185.71.76.5:443", "", http.StatusOK},
+		{"unknown address", "1.2.3.4:443", "", http.StatusForbidden},
+		{"forwarded header of untrusted caller", "1.2.3.4:443", "185.71.76.5", http.StatusForbidden},
+		{"trusted proxy", "10.0.0.2:443", "185.71.76.5", http.StatusOK},
+		{"spoofed entry before the proxy's", "10.0.0.2:443", "185.71.76.5, 1.2.3.4", http.StatusForbidden},
+		{"chained trusted proxies", "10.0.0.2:443", "185.71.76.5, 10.0.0.3", http.StatusOK},
+		{"trusted proxy without header", "10.0.0.2:443", "", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		if got := serve(h, c.remoteAddr, c.forwardedFor, "{}"); got != c.want {
+			t.Fatalf("%s: expected %d, got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestGuard_EmptyAllowListAllowsAny(t *testing.T) {
+	g := NewGuard(nil, 1024)
+	h := g.Handle("tribute", Policy{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if got := serve(h, "1.2.3.4:443", "", "{}"); got != http.StatusOK {
+		t.Fatalf("expected 200, got %d", got)
+	}
+}
+
+func TestGuard_BodyLimit(t *testing.T) {
+	g := NewGuard(nil, 8)
+	h := g.Handle("platega", Policy{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if got := serve(h, "1.2.3.4:443", "", strings.Repeat("x", 9)); got != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", got)
+	}
+	if got := serve(h, "1.2.3.4:443", "", strings.Repeat("x", 8)); got != http.StatusOK {
+		t.Fatalf("expected 200 for a body at the limit, got %d", got)
+	}
+}
+
+func TestGuard_IdentifiesEvent(t *testing.T) {
+	var got []string
+	g := NewGuard(nil, 1024)
+	h := g.Handle("cryptopay", Policy{EventID: func(body []byte) string {
+		if string(body) == "test" {
+			return ""
+		}
+		return "event-" + string(body)
+	}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, eventIDFromContext(r.Context()))
+	}))
+
+	serve(h, "1.2.3.4:443", "", "1")
+	serve(h, "1.2.3.4:443", "", "test")
+	if len(got) != 2 || got[0] != "event-1" || got[1] != "" {
+		t.Fatalf("expected the event id to reach the recorder, got %q", got)
+	}
+}
+
+func TestGuard_ReplayedEventSkipsChecks(t *testing.T) {
+	called := false
+	g := NewGuard(nil, 1024)
+	h := g.Handle("yookassa", Policy{AllowedIPs: prefixes("185.71.76.0/27")}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{}"))
+	req = req.WithContext(withEvent(context.Background(), &event{replayed: true}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !called {
+		t.Fatalf("expected replayed event to reach the handler")
+	}
+}
+
+func TestEqualSecret(t *testing.T) {
+	if !EqualSecret("secret", "secret") || EqualSecret("secret", "other") || EqualSecret("", "secret") {
+		t.Fatalf("unexpected comparison result")
+	}
+}
@@ -0,0 +1,229 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// maxErrorSize bounds the response body stored as the error of a failed event.
+const maxErrorSize = 1024
+
+// claimTimeout is how long an event being handled holds off its duplicates. After
+// that the handling is taken as lost, and a redelivery handles the event again.
+const claimTimeout = 5 * time.Minute
+
+var (
+	ErrEventNotFound     = errors.New("webhook event not found")
+	ErrUnknownProvider   = errors.New("no webhook handler for provider")
+	ErrSignatureRejected = errors.New("webhook event did not pass the signature check")
+	ErrEventNotFailed    = errors.New("only failed webhook events can be replayed")
+)
+
+// redactedHeaders carry credentials and are not stored.
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"X-Secret":      true,
+}
+
+// Recorder stores every webhook request with its outcome and replays stored
+// requests through the handler that received them. Bodies larger than maxBodySize
+// are neither read nor stored.
+type Recorder struct {
+	repository  *database.WebhookEventRepository
+	handlers    map[string]http.Handler
+	maxBodySize int64
+}
+
+func NewRecorder(repository *database.WebhookEventRepository, maxBodySize int64) *Recorder {
+	return &Recorder{
+		repository:  repository,
+		handlers:    make(map[string]http.Handler),
+		maxBodySize: maxBodySize,
+	}
+}
+
+// Handle wraps the provider's webhook handler so its requests are recorded. A
+// request whose event the Guard identified is stored once per provider and event,
+// and dropped while that event is handled or after it succeeded. A failed event is
+// handled again so the provider can retry it. A request is served even when it
+// cannot be stored. The recorder goes inside the Guard, so requests the guard
+// rejects are not stored.
+func (rec *Recorder) Handle(provider string, next http.Handler) http.Handler {
+	rec.handlers[provider] = next
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, rec.maxBodySize))
+		if err != nil {
+			slog.Error("webhook: read body error", "provider", provider, "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		r.Body.Close()
+
+		ctx := context.WithoutCancel(r.Context())
+		stored := &database.WebhookEvent{
+			Provider: provider,
+			Path:     r.URL.Path,
+			Headers:  storedHeaders(r.Header),
+			Body:     string(body),
+		}
+		var id int64
+		if eventID := eventIDFromContext(r.Context()); eventID != "" {
+			stored.EventID = &eventID
+			var claimed bool
+			id, claimed, err = rec.repository.Claim(ctx, stored, claimTimeout)
+			if err == nil && !claimed {
+				slog.Info("webhook: duplicate event dropped", "provider", provider, "event_id", eventID)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		} else {
+			id, err = rec.repository.Create(ctx, stored)
+		}
+		if err != nil {
+			slog.Error("webhook: store event", "provider", provider, "error", err)
+		}
+
+		e := &event{}
+		rw := &responseRecorder{w: w, header: w.Header()}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(rw, r.WithContext(withEvent(r.Context(), e)))
+
+		if id != 0 {
+			rec.finish(ctx, id, e, rw)
+		}
+	})
+}
+
+// Replay runs a stored failed event through its provider's handler again and
+// returns the event with the new outcome. Events that were handled are not
+// replayed, because their handlers would pay or cancel again. The event is claimed
+// before it runs, so concurrent replays run it once.
+func (rec *Recorder) Replay(ctx context.Context, id int64) (*database.WebhookEvent, error) {
+	stored, err := rec.repository.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrEventNotFound
+	}
+	if stored.SignatureValid != nil && !*stored.SignatureValid {
+		return nil, ErrSignatureRejected
+	}
+	handler, ok := rec.handlers[stored.Provider]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownProvider, stored.Provider)
+	}
+	claimed, err := rec.repository.ClaimFailed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, fmt.Errorf("%w: event %d is %s", ErrEventNotFailed, id, stored.Status)
+	}
+
+	e := &event{replayed: true}
+	req, err := http.NewRequestWithContext(withEvent(ctx, e), http.MethodPost, stored.Path, strings.NewReader(stored.Body))
+	if err != nil {
+		return nil, fmt.Errorf("build replay request: %w", err)
+	}
+	for name, values := range stored.Headers {
+		req.Header[name] = values
+	}
+
+	rw := &responseRecorder{header: make(http.Header)}
+	handler.ServeHTTP(rw, req)
+	slog.Info("webhook: event replayed", "event_id", id, "provider", stored.Provider, "code", rw.code())
+
+	if err := rec.finish(ctx, id, e, rw); err != nil {
+		return nil, err
+	}
+	return rec.repository.FindByID(ctx, id)
+}
+
+// Failed returns the latest events whose handler responded with an error.
+func (rec *Recorder) Failed(ctx context.Context, limit uint64) ([]database.WebhookEvent, error) {
+	return rec.repository.FindByStatus(ctx, database.WebhookEventStatusFailed, limit)
+}
+
+func (rec *Recorder) finish(ctx context.Context, id int64, e *event, rw *responseRecorder) error {
+	status := database.WebhookEventStatusProcessed
+	var eventErr *string
+	if rw.code() >= http.StatusBadRequest {
+		status = database.WebhookEventStatusFailed
+		msg := strings.TrimSpace(rw.body.String())
+		eventErr = &msg
+	}
+	if e.err != nil {
+		msg := e.err.Error()
+		eventErr = &msg
+	}
+
+	err := rec.repository.Finish(ctx, id, status, rw.code(), e.signatureValid, e.purchaseID, eventErr)
+	if err != nil {
+		slog.Error("webhook: store event outcome", "event_id", id, "error", err)
+	}
+	return err
+}
+
+func storedHeaders(header http.Header) map[string][]string {
+	stored := make(map[string][]string, len(header))
+	for name, values := range header {
+		if !redactedHeaders[http.CanonicalHeaderKey(name)] {
+			stored[name] = values
+		}
+	}
+	return stored
+}
+
+// responseRecorder passes the response through to w, if any, and keeps its status
+// code and the beginning of its body.
+type responseRecorder struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	if r.w != nil {
+		r.w.WriteHeader(status)
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if room := maxErrorSize - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(room, len(b))])
+	}
+	if r.w != nil {
+		return r.w.Write(b)
+	}
+	return len(b), nil
+}
+
+func (r *responseRecorder) code() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStoredHeaders_RedactsCredentials(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Basic secret")
+	header.Set("X-Secret", "secret")
+	header.Set("Cookie", "session=secret")
+	header.Set("Crypto-Pay-Api-Signature", "abc")
+	header.Set("Content-Type", "application/json")
+
+	stored := storedHeaders(header)
+	for _, name := range []string{"Authorization", "X-Secret", "Cookie"} {
+		if _, ok := stored[name]; ok {
+			t.Fatalf("header %s must not be stored", name)
+		}
+	}
+	if len(stored) != 2 || stored["Crypto-Pay-Api-Signature"][0] != "abc" {
+		t.Fatalf("unexpected stored headers: %v", stored)
+	}
+}
+
+func TestResponseRecorder_KeepsCodeAndBody(t *testing.T) {
+	w := httptest.NewRecorder()
+	rw := &responseRecorder{w: w, header: w.Header()}
+	http.Error(rw, "purchase not found", http.StatusNotFound)
+	rw.WriteHeader(http.StatusOK)
+
+	if rw.code() != http.StatusNotFound || w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d and %d", rw.code(), w.Code)
+	}
+	if strings.TrimSpace(rw.body.String()) != "purchase not found" || !strings.Contains(w.Body.String(), "purchase not found") {
+		t.Fatalf("unexpected body %q", rw.body.String())
+	}
+}
+
+func TestResponseRecorder_DefaultsToOK(t *testing.T) {
+	rw := &responseRecorder{header: make(http.Header)}
+	if rw.code() != http.StatusOK {
+		t.Fatalf("expected 200 without a write, got %d", rw.code())
+	}
+
+	rw.Write([]byte(strings.Repeat("x", 2*maxErrorSize)))
+	if rw.code() != http.StatusOK || rw.body.Len() != maxErrorSize {
+		t.Fatalf("expected 200 and a body of %d bytes, got %d and %d", maxErrorSize, rw.code(), rw.body.Len())
+	}
+}
+
+func TestEvent_Annotations(t *testing.T) {
+	MarkSignature(context.Background(), true)
+	if Replayed(context.Background()) {
+		t.Fatalf("request without an event must not be replayed")
+	}
+
+	e := &event{replayed: true}
+	ctx := withEvent(context.Background(), e)
+	MarkSignature(ctx, false)
+	LinkPurchase(ctx, 42)
+	RecordError(ctx, errors.New("boom"))
+
+	if e.signatureValid == nil || *e.signatureValid {
+		t.Fatalf("expected signature to be marked invalid")
+	}
+	if e.purchaseID == nil || *e.purchaseID != 42 {
+		t.Fatalf("expected purchase 42, got %v", e.purchaseID)
+	}
+	if e.err == nil || !Replayed(ctx) {
+		t.Fatalf("expected error and replayed flag to be recorded")
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	h := authorized("token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for header, want := range map[string]int{
+		"":             http.StatusUnauthorized,
+		"Bearer other": http.StatusUnauthorized,
+		"token":        http.StatusUnauthorized,
+		"Bearer token": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("authorization %q: expected %d, got %d", header, want, w.Code)
+		}
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"net/http"
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/remnawave"
-	"remnawave-tg-shop-bot/utils"
 	"strconv"
 	"time"
 
@@ -21,6 +20,8 @@ import (
 type YookasaAPI interface {
 	CreatePayment(ctx context.Context, request PaymentRequest, idempotencyKey string) (*Payment, error)
 	GetPayment(ctx context.Context, paymentID uuid.UUID) (*Payment, error)
+	CreateRefund(ctx context.Context, request RefundRequest, idempotencyKey string) (*Refund, error)
+	CancelPayment(ctx context.Context, paymentID uuid.UUID, idempotencyKey string) (*Payment, error)
 }
 
 type Client struct {
@@ -40,13 +41,44 @@ func NewClient(baseURL, shopID, secretKey string) *Client {
 	}
 }
 
-func (c *Client) CreateInvoice(ctx context.Context, amount int, month int, customerId int64, purchaseId int64) (*Payment, error) {
+// CreateInvoice creates a payment the customer confirms on the YooKassa page. With
+// savePaymentMethod the payment method is saved for recurring payments.
+func (c *Client) CreateInvoice(ctx context.Context, amount int, description string, customerId int64, purchaseId int64, savePaymentMethod bool) (*Payment, error) {
+	paymentRequest := c.newPaymentRequest(ctx, amount, description, customerId, purchaseId)
+	paymentRequest.SavePaymentMethod = savePaymentMethod
+
+	idempotencyKey := uuid.New().String()
+
+	payment, err := c.CreatePayment(ctx, paymentRequest, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// ChargeSavedPaymentMethod creates a recurring payment charged to a saved payment
+// method without confirmation by the customer. Retries for the same purchase do not
+// charge twice.
+func (c *Client) ChargeSavedPaymentMethod(ctx context.Context, amount int, description string, customerId int64, purchaseId int64, paymentMethodID uuid.UUID) (*Payment, error) {
+	paymentRequest := c.newPaymentRequest(ctx, amount, description, customerId, purchaseId)
+	paymentRequest.Confirmation = nil
+	paymentRequest.PaymentMethodID = &paymentMethodID
+
+	payment, err := c.CreatePayment(ctx, paymentRequest, fmt.Sprintf("autopay-%d", purchaseId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recurring payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+func (c *Client) newPaymentRequest(ctx context.Context, amount int, description string, customerId int64, purchaseId int64) PaymentRequest {
 	rub := Amount{
 		Value:    strconv.Itoa(amount),
 		Currency: "RUB",
 	}
 
-	description := utils.FormatSubscriptionDescription(month)
 	receipt := &Receipt{
 		Customer: &Customer{
 			Email: config.YookasaEmail(),
@@ -69,22 +101,13 @@ func (c *Client) CreateInvoice(ctx context.Context, amount int, month int, custo
 		"username":   remnawave.UsernameFromCtx(ctx),
 	}
 
-	paymentRequest := NewPaymentRequest(
+	return NewPaymentRequest(
 		rub,
 		config.BotURL(),
 		description,
 		receipt,
 		metaData,
 	)
-
-	idempotencyKey := uuid.New().String()
-
-	payment, err := c.CreatePayment(ctx, paymentRequest, idempotencyKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create payment: %w", err)
-	}
-
-	return payment, nil
 }
 
 func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idempotencyKey string) (*Payment, error) {
@@ -126,6 +149,79 @@ func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idem
 	return &payment, nil
 }
 
+func (c *Client) CreateRefund(ctx context.Context, request RefundRequest, idempotencyKey string) (*Refund, error) {
+	refundURL := fmt.Sprintf("%s/refunds", c.baseURL)
+
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refund request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", refundURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("Idempotence-Key", idempotencyKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading refund resp: %w", err)
+		}
+		return nil, fmt.Errorf("API return error. Status: %d, Body: %s", resp.StatusCode, string(body))
+	}
+
+	var refund Refund
+	if err := json.NewDecoder(resp.Body).Decode(&refund); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &refund, nil
+}
+
+func (c *Client) CancelPayment(ctx context.Context, paymentID uuid.UUID, idempotencyKey string) (*Payment, error) {
+	cancelURL := fmt.Sprintf("%s/payments/%s/cancel", c.baseURL, paymentID)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cancelURL, bytes.NewBufferString("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("Idempotence-Key", idempotencyKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading cancel resp: %w", err)
+		}
+		return nil, fmt.Errorf("API return error. Status: %d, Body: %s", resp.StatusCode, string(body))
+	}
+
+	var payment Payment
+	if err := json.NewDecoder(resp.Body).Decode(&payment); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &payment, nil
+}
+
 func (c *Client) GetPayment(ctx context.Context, paymentID uuid.UUID) (*Payment, error) {
 	paymentURL := fmt.Sprintf("%s/payments/%s", c.baseURL, paymentID)
 
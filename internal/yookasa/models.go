@@ -1,6 +1,7 @@
 package yookasa
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,14 +28,32 @@ func (p *Payment) IsCancelled() bool {
 	return p.Status == "canceled"
 }
 
+type RefundRequest struct {
+	PaymentID   uuid.UUID `json:"payment_id"`
+	Amount      Amount    `json:"amount"`
+	Description string    `json:"description,omitempty"`
+}
+
+type Refund struct {
+	ID        uuid.UUID `json:"id"`
+	PaymentID uuid.UUID `json:"payment_id"`
+	Status    string    `json:"status"`
+	Amount    Amount    `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *Refund) IsCancelled() bool {
+	return r.Status == "canceled"
+}
+
 type PaymentRequest struct {
 	Amount            Amount             `json:"amount"`
-	Confirmation      ConfirmationType   `json:"confirmation"`
+	Confirmation      *ConfirmationType  `json:"confirmation,omitempty"`
 	Capture           bool               `json:"capture"`
 	Description       string             `json:"description,omitempty"`
 	PaymentMethodData *PaymentMethodData `json:"payment_method_data,omitempty"`
 	SavePaymentMethod bool               `json:"save_payment_method"`
-	PaymentMethodID   *uuid.UUID         `json:"payment_method_id"`
+	PaymentMethodID   *uuid.UUID         `json:"payment_method_id,omitempty"`
 	Receipt           *Receipt           `json:"receipt,omitempty"`
 	Metadata          map[string]any     `json:"metadata,omitempty"`
 }
@@ -49,7 +68,7 @@ func NewPaymentRequest(
 		Amount:   amount,
 		Receipt:  receipt,
 		Metadata: metadata,
-		Confirmation: ConfirmationType{
+		Confirmation: &ConfirmationType{
 			Type:      "redirect",
 			ReturnURL: urlRedirect,
 		},
@@ -82,6 +101,11 @@ type Amount struct {
 	Currency string `json:"currency"`
 }
 
+// Float returns the amount value as a number.
+func (a Amount) Float() (float64, error) {
+	return strconv.ParseFloat(a.Value, 64)
+}
+
 type PaymentMethodData struct {
 	Type string `json:"type"`
 }
@@ -0,0 +1,179 @@
+package yookasa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+)
+
+type Provider struct {
+	client       *Client
+	purchaseRepo *database.PurchaseRepository
+}
+
+var (
+	_ payment.WebhookProvider = (*Provider)(nil)
+	_ payment.Recurring       = (*Provider)(nil)
+)
+
+func NewProvider(client *Client, purchaseRepo *database.PurchaseRepository) *Provider {
+	return &Provider{client: client, purchaseRepo: purchaseRepo}
+}
+
+func (p *Provider) InvoiceType() database.InvoiceType {
+	return database.InvoiceTypeYookasa
+}
+
+func (p *Provider) ButtonKey() string {
+	return "card_button"
+}
+
+func (p *Provider) IsEnabled() bool {
+	return config.IsYookasaEnabled()
+}
+
+func (p *Provider) Currency() string {
+	return "RUB"
+}
+
+func (p *Provider) InvoiceTTL() time.Duration {
+	return config.YookasaInvoiceTTL()
+}
+
+func (p *Provider) CreateInvoice(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*payment.Invoice, error) {
+	// Only subscriptions are renewed, so only their payments save the card.
+	savePaymentMethod := config.IsAutoPaymentEnabled() && purchase.Kind == database.PurchaseKindSubscription
+	invoice, err := p.client.CreateInvoice(ctx, int(purchase.Amount), payment.PurchaseDescription(purchase), customer.ID, purchase.ID, savePaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.Invoice{
+		URL: invoice.Confirmation.ConfirmationURL,
+		Fields: map[string]interface{}{
+			"yookasa_url": invoice.Confirmation.ConfirmationURL,
+			"yookasa_id":  invoice.ID,
+		},
+	}, nil
+}
+
+// ChargeSaved pays the purchase with the customer's saved payment method.
+func (p *Provider) ChargeSaved(ctx context.Context, purchase *database.Purchase, customer *database.Customer) (*payment.Invoice, error) {
+	if customer.YookasaPaymentMethodID == nil {
+		return nil, fmt.Errorf("customer %d has no saved payment method", customer.ID)
+	}
+	pmt, err := p.client.ChargeSavedPaymentMethod(ctx, int(purchase.Amount), payment.PurchaseDescription(purchase), customer.ID, purchase.ID, *customer.YookasaPaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.Invoice{
+		Fields: map[string]interface{}{
+			"yookasa_id": pmt.ID,
+		},
+	}, nil
+}
+
+func (p *Provider) FetchStatus(ctx context.Context, purchase *database.Purchase) (*payment.Transaction, error) {
+	if purchase.YookasaID == nil {
+		return nil, fmt.Errorf("purchase %d has no yookassa payment id", purchase.ID)
+	}
+	pmt, err := p.client.GetPayment(ctx, *purchase.YookasaID)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := pmt.Amount.Float()
+	if err != nil {
+		return nil, fmt.Errorf("invalid yookassa payment amount %q: %w", pmt.Amount.Value, err)
+	}
+
+	status := database.PurchaseStatusPending
+	switch {
+	case pmt.IsCancelled():
+		status = database.PurchaseStatusCancel
+	case pmt.Paid && pmt.Status == "succeeded":
+		status = database.PurchaseStatusPaid
+	}
+	tx := &payment.Transaction{
+		Status:   status,
+		Username: pmt.Metadata["username"],
+		Amount:   amount,
+		Currency: pmt.Amount.Currency,
+	}
+	if pmt.PaymentMethod.Saved {
+		tx.PaymentMethodID = &pmt.PaymentMethod.ID
+	}
+	return tx, nil
+}
+
+// Cancel voids a payment that is waiting for capture. Pending payments cannot be
+// cancelled through the API and expire on the YooKassa side on their own, so
+// they are reported as still payable until YooKassa cancels them.
+func (p *Provider) Cancel(ctx context.Context, purchase *database.Purchase) error {
+	if purchase.YookasaID == nil {
+		return nil
+	}
+	pmt, err := p.client.GetPayment(ctx, *purchase.YookasaID)
+	if err != nil {
+		return err
+	}
+
+	switch pmt.Status {
+	case "waiting_for_capture":
+		_, err := p.client.CancelPayment(ctx, pmt.ID, fmt.Sprintf("cancel-%d", purchase.ID))
+		return err
+	case "succeeded":
+		return fmt.Errorf("yookassa payment %s already succeeded", pmt.ID)
+	case "canceled":
+		return nil
+	default:
+		return payment.ErrStillPayable
+	}
+}
+
+func (p *Provider) Refund(ctx context.Context, purchase *database.Purchase) error {
+	if purchase.YookasaID == nil {
+		return fmt.Errorf("purchase %d has no yookassa payment id", purchase.ID)
+	}
+	refund, err := p.client.CreateRefund(ctx, RefundRequest{
+		PaymentID: *purchase.YookasaID,
+		Amount: Amount{
+			Value:    strconv.FormatFloat(purchase.Amount, 'f', 2, 64),
+			Currency: "RUB",
+		},
+	}, fmt.Sprintf("refund-%d", purchase.ID))
+	if err != nil {
+		return err
+	}
+	if refund.IsCancelled() {
+		return fmt.Errorf("yookassa refund %s was canceled", refund.ID)
+	}
+	return nil
+}
+
+func (p *Provider) WebhookName() string {
+	return "yookassa"
+}
+
+func (p *Provider) WebhookPath() string {
+	return config.GetYookasaWebHookUrl()
+}
+
+func (p *Provider) WebhookEventID(body []byte) string {
+	var env webhookEnvelope
+	if err := json.Unmarshal(body, &env); err != nil || env.Event == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", env.Event, env.Object.ID)
+}
+
+func (p *Provider) WebhookHandler(service *payment.PaymentService) http.Handler {
+	return NewWebhookHandler(p.client, service, p.purchaseRepo)
+}
@@ -3,6 +3,7 @@ package yookasa
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -10,14 +11,17 @@ import (
 	"time"
 
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/webhook"
 
 	"github.com/google/uuid"
 )
 
 type PurchaseProcessor interface {
-	ProcessPurchaseById(ctx context.Context, purchaseId int64) error
+	ProcessPaidPurchase(ctx context.Context, purchaseID int64, amount float64, currency string) error
 	CancelYookassaPayment(purchaseId int64) error
+	SavePaymentMethod(ctx context.Context, purchaseID int64, methodID uuid.UUID) error
 }
 
 type WebhookHandler struct {
@@ -72,14 +76,15 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payment, err := h.client.GetPayment(ctx, env.Object.ID)
+	pmt, err := h.client.GetPayment(ctx, env.Object.ID)
 	if err != nil {
 		slog.Error("yookassa webhook: get payment failed", "payment_id", env.Object.ID, "error", err)
+		webhook.RecordError(ctx, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	purchaseIDStr, ok := payment.Metadata["purchaseId"]
+	purchaseIDStr, ok := pmt.Metadata["purchaseId"]
 	if !ok {
 		slog.Warn("yookassa webhook: missing purchaseId in metadata", "payment_id", env.Object.ID)
 		w.WriteHeader(http.StatusOK)
@@ -95,6 +100,7 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	purchase, err := h.purchaseRepo.FindById(ctx, purchaseID)
 	if err != nil {
 		slog.Error("yookassa webhook: find purchase failed", "purchase_id", purchaseID, "error", err)
+		webhook.RecordError(ctx, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
@@ -103,15 +109,17 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusCancel {
+	webhook.LinkPurchase(ctx, purchaseID)
+	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusCancel || purchase.Status == database.PurchaseStatusRefunded || purchase.Status == database.PurchaseStatusReview {
 		slog.Info("yookassa webhook: purchase already finalized", "purchase_id", purchaseID, "status", purchase.Status)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	if payment.IsCancelled() {
+	if pmt.IsCancelled() {
 		if err := h.processor.CancelYookassaPayment(purchaseID); err != nil {
 			slog.Error("yookassa webhook: cancel failed", "purchase_id", purchaseID, "error", err)
+			webhook.RecordError(ctx, err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
@@ -119,18 +127,37 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !payment.Paid {
-		slog.Info("yookassa webhook: payment not paid yet", "purchase_id", purchaseID, "status", payment.Status)
+	if !pmt.Paid {
+		slog.Info("yookassa webhook: payment not paid yet", "purchase_id", purchaseID, "status", pmt.Status)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, payment.Metadata["username"])
-	if err := h.processor.ProcessPurchaseById(ctxWithUsername, purchaseID); err != nil {
+	amount, err := pmt.Amount.Float()
+	if err != nil {
+		slog.Error("yookassa webhook: invalid amount", "purchase_id", purchaseID, "amount", pmt.Amount.Value, "error", err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctxWithUsername := context.WithValue(ctx, remnawave.CtxKeyUsername, pmt.Metadata["username"])
+	if err := h.processor.ProcessPaidPurchase(ctxWithUsername, purchaseID, amount, pmt.Amount.Currency); err != nil {
+		if errors.Is(err, payment.ErrPaymentMismatch) {
+			slog.Warn("yookassa webhook: payment held for review", "purchase_id", purchaseID, "error", err)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 		slog.Error("yookassa webhook: process purchase failed", "purchase_id", purchaseID, "error", err)
+		webhook.RecordError(ctx, err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
+	if pmt.PaymentMethod.Saved {
+		if err := h.processor.SavePaymentMethod(ctx, purchaseID, pmt.PaymentMethod.ID); err != nil {
+			slog.Error("yookassa webhook: save payment method failed", "purchase_id", purchaseID, "error", err)
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
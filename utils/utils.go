@@ -6,6 +6,14 @@ import (
 	"strings"
 )
 
+// BalanceTopUpDescription describes balance top-up purchases.
+const BalanceTopUpDescription = "Пополнение баланса"
+
+// FormatTrafficPackDescription describes extra traffic purchases.
+func FormatTrafficPackDescription(gb int) string {
+	return fmt.Sprintf("Дополнительный трафик %d ГБ", gb)
+}
+
 func FormatSubscriptionDescription(months int) string {
 	var unit string
 	switch months {
@@ -19,6 +27,35 @@ func FormatSubscriptionDescription(months int) string {
 	return fmt.Sprintf("Подписка на %d %s", months, unit)
 }
 
+func FormatSubscriptionDaysDescription(days int) string {
+	var unit string
+	switch {
+	case days%10 == 1 && days%100 != 11:
+		unit = "день"
+	case days%10 >= 2 && days%10 <= 4 && (days%100 < 12 || days%100 > 14):
+		unit = "дня"
+	default:
+		unit = "дней"
+	}
+	return fmt.Sprintf("Подписка на %d %s", days, unit)
+}
+
+// FormatBytes formats a traffic amount in binary units, e.g. "1.5 GB".
+func FormatBytes(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", bytes, units[unit])
+	}
+	formatted := strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0")
+	return formatted + " " + units[unit]
+}
+
 func MaskHalfInt(input int) string {
 	return MaskHalf(strconv.Itoa(input))
 }
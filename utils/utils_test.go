@@ -0,0 +1,24 @@
+package utils
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{input: 0, expected: "0 B"},
+		{input: 1023, expected: "1023 B"},
+		{input: 1024, expected: "1 KB"},
+		{input: 1536 << 20, expected: "1.5 GB"},
+		{input: 100 << 30, expected: "100 GB"},
+		{input: 3 << 40, expected: "3 TB"},
+		{input: 2048 << 40, expected: "2048 TB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.input); got != tt.expected {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}